@@ -2,14 +2,15 @@ package scanbench
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"testing"
 
 	"github.com/valyala/fastjson"
 	"go.mongodb.org/mongo-driver/bson"
 
 	"flexbuffers"
-	"flexbuffers/convert"
 	"flexbuffers/pkg/fakedata"
+	"flexbuffers/process"
 )
 
 func scanJsons(b *testing.B) [][]byte {
@@ -90,3 +91,31 @@ func BenchmarkScanJson(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkExportArrow(b *testing.B) {
+	jsonDocs := scanJsons(b)
+	var docs []flexbuffers.Raw
+	for _, d := range jsonDocs {
+		fbDoc, err := process.FromJson(d)
+		if err != nil {
+			b.Fatal(err)
+		}
+		docs = append(docs, fbDoc)
+	}
+	columns, err := process.InferColumns(docs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := process.NewArrowStreamWriter(ioutil.Discard, columns)
+		for _, d := range docs {
+			if err := w.Write(d); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
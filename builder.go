@@ -18,6 +18,7 @@ var (
 	ErrInvalidData       = errors.New("invalid data")
 	ErrRecursiveData     = errors.New("invalid data: data has a cyclic offset")
 	ErrNoNullByte        = errors.New("no null terminator found")
+	ErrDuplicateKey      = errors.New("duplicate map key")
 )
 
 type BuilderFlag int
@@ -31,6 +32,21 @@ const (
 	BuilderFlagShareAll            BuilderFlag = 7
 )
 
+// DuplicateKeyPolicy decides what to do with maps having the same key more than once.
+// Map.Get finds an arbitrary one of duplicate keys.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeysAllow keeps every entry.
+	DuplicateKeysAllow DuplicateKeyPolicy = iota
+	// DuplicateKeysReject fails with ErrDuplicateKey.
+	DuplicateKeysReject
+	// DuplicateKeysFirst keeps the entry added first.
+	DuplicateKeysFirst
+	// DuplicateKeysLast keeps the entry added last.
+	DuplicateKeysLast
+)
+
 type offsetAndLen struct {
 	offset uint64
 	size   int
@@ -44,11 +60,28 @@ type Builder struct {
 	forceMinBitWidth BitWidth
 	err              error
 	ext              int64
-	extMap           map[int]int64
+	extStack         []extMark
 
 	keyOffsetMap        map[uint64]offsetAndLen
 	stringOffsetMap     map[uint64]offsetAndLen
 	keyVectorsOffsetMap map[uint64]value
+
+	// with a key dictionary, keys are kept in keys until the map ends instead of the buffer
+	keyDict *KeyDictionary
+	keys    []byte
+	keySet  []byte
+
+	duplicateKeys DuplicateKeyPolicy
+	orderedMaps   bool
+	// mapOrder is the index each entry was added at, while a map is sorted
+	mapOrder []int
+
+	// scalars are stored indirectly at indirectWidth if indirectScalars, see SetIndirectScalars
+	indirectScalars bool
+	indirectWidth   BitWidth
+	indirectPaths   [][]pathPattern
+	// containers are the vectors and maps being built, tracked for indirectPaths
+	containers []container
 }
 
 func NewBuilder() *Builder {
@@ -75,12 +108,18 @@ func (b *Builder) Size() int {
 	return len(b.buf)
 }
 
+// Clear discards the document and allocates new buffers, so Raw returned by Buffer stays valid.
+// Use Reset to reuse the buffers.
 func (b *Builder) Clear() {
 	b.buf = make([]byte, 0, 64)
 	b.stack = nil
 	b.finished = false
 	b.forceMinBitWidth = BitWidth8
-	b.extMap = make(map[int]int64)
+	b.err = nil
+	b.ext = 0
+	b.extStack = nil
+	b.containers = nil
+	b.keys = b.keys[:0]
 	if b.flags&BuilderFlagShareKeys == BuilderFlagShareKeys {
 		b.keyOffsetMap = make(map[uint64]offsetAndLen)
 	} else {
@@ -98,6 +137,46 @@ func (b *Builder) Clear() {
 	}
 }
 
+// Reset discards the document to build another one, keeping the capacity of the buffer, the stack and the maps.
+// Raw returned by Buffer is overwritten by the next document, copy it with AppendTo or use FinishTo before Reset.
+func (b *Builder) Reset() {
+	b.buf = b.buf[:0]
+	b.stack = b.stack[:0]
+	b.finished = false
+	b.forceMinBitWidth = BitWidth8
+	b.err = nil
+	b.ext = 0
+	b.extStack = b.extStack[:0]
+	b.containers = b.containers[:0]
+	b.keys = b.keys[:0]
+	for k := range b.keyOffsetMap {
+		delete(b.keyOffsetMap, k)
+	}
+	for k := range b.stringOffsetMap {
+		delete(b.stringOffsetMap, k)
+	}
+	for k := range b.keyVectorsOffsetMap {
+		delete(b.keyVectorsOffsetMap, k)
+	}
+}
+
+// FinishTo finishes the document, appends it to dst and resets the builder.
+// The returned Raw is owned by the caller, so the builder can be reused right away.
+// On errors, the builder is not reset.
+func (b *Builder) FinishTo(dst []byte) (Raw, error) {
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	dst = b.AppendTo(dst)
+	b.Reset()
+	return dst, nil
+}
+
+// AppendTo appends the finished document to dst.
+func (b *Builder) AppendTo(dst []byte) Raw {
+	return append(dst, b.Buffer()...)
+}
+
 func (b *Builder) Finish() error {
 	if b.err != nil {
 		return b.err
@@ -105,6 +184,8 @@ func (b *Builder) Finish() error {
 	if len(b.stack) == 0 {
 		return fmt.Errorf("empty document")
 	}
+	b.materializeKeys(0)
+	b.materializeScalars(0, 1)
 	byteWidth := b.align(b.stack[0].ElemWidth(len(b.buf), 0))
 	if err := b.WriteAny(&b.stack[0], byteWidth); err != nil {
 		return err
@@ -116,6 +197,9 @@ func (b *Builder) Finish() error {
 }
 
 func (b *Builder) Ext(i int64) {
+	if i == ExtOrderedMap && b.err == nil {
+		b.err = fmt.Errorf("ext %d is reserved for ordered maps", i)
+	}
 	b.ext = i
 }
 
@@ -123,7 +207,33 @@ func (b *Builder) WriteBytes(data []byte) {
 	b.buf = append(b.buf, data...)
 }
 
+// SetKeyDictionary makes the builder store map keys in the dictionary, instead of the buffer.
+// Key sets not in the dictionary are added to it. The built buffer must be read with the dictionary,
+// see Raw.RootWithKeyDictionary.
+func (b *Builder) SetKeyDictionary(d *KeyDictionary) {
+	b.keyDict = d
+}
+
+// SetDuplicateKeys sets the policy for duplicate keys of maps, which is applied by EndMap.
+// Values of dropped entries stay in the buffer without being referred.
+func (b *Builder) SetDuplicateKeys(p DuplicateKeyPolicy) {
+	b.duplicateKeys = p
+}
+
+// SetOrderedMaps makes maps keep the order their entries were added in, in addition to the order of keys which
+// Map.Get depends on. Map.AppendOrder and JSON output follow the order. The order is stored after the ext of the map,
+// see ExtOrderedMap, maps whose entries were added sorted are stored as usual.
+func (b *Builder) SetOrderedMaps(ordered bool) {
+	b.orderedMaps = ordered
+}
+
 func (b *Builder) Key(key []byte) uint64 {
+	if b.keyDict != nil {
+		sloc := uint64(len(b.keys))
+		b.keys = append(append(b.keys, key...), 0)
+		b.stack = append(b.stack, newValueUInt(sloc, FBTKey, BitWidth8, false))
+		return sloc
+	}
 	sloc := uint64(len(b.buf))
 	var conflict bool
 	var hash uint64
@@ -151,6 +261,30 @@ func (b *Builder) Key(key []byte) uint64 {
 	return sloc
 }
 
+// BuiltValue is a handle of a value which is already pushed to the Builder.
+type BuiltValue struct {
+	v value
+}
+
+// LastValue returns a handle of the value pushed last.
+// The handle can be passed to PushValue to refer the same data again without writing it twice.
+func (b *Builder) LastValue() (BuiltValue, error) {
+	if len(b.stack) == 0 {
+		return BuiltValue{}, fmt.Errorf("no value pushed")
+	}
+	v := b.stack[len(b.stack)-1]
+	if v.typ == FBTKey {
+		return BuiltValue{}, fmt.Errorf("last value is a key")
+	}
+	return BuiltValue{v: v}, nil
+}
+
+// PushValue pushes a value obtained by LastValue again. Values stored by offset (strings, vectors, maps ...)
+// are shared, so the data is written only once.
+func (b *Builder) PushValue(v BuiltValue) {
+	b.stack = append(b.stack, v.v)
+}
+
 func (b *Builder) AttachMetadata(tag int, body []byte) {
 
 }
@@ -165,7 +299,7 @@ func (b *Builder) NullField(key []byte) {
 }
 
 func (b *Builder) Int(i int64) {
-	b.stack = append(b.stack, newValueInt(i, FBTInt, WidthI(i)))
+	b.pushScalar(newValueInt(i, FBTInt, WidthI(i)))
 }
 
 func (b *Builder) IntField(key []byte, i int64) {
@@ -174,7 +308,7 @@ func (b *Builder) IntField(key []byte, i int64) {
 }
 
 func (b *Builder) UInt(i uint64) {
-	b.stack = append(b.stack, newValueUInt(i, FBTUint, WidthU(i), false))
+	b.pushScalar(newValueUInt(i, FBTUint, WidthU(i), false))
 }
 
 func (b *Builder) UIntField(key []byte, i uint64) {
@@ -183,7 +317,7 @@ func (b *Builder) UIntField(key []byte, i uint64) {
 }
 
 func (b *Builder) Float32(f float32) {
-	b.stack = append(b.stack, newValueFloat32(f))
+	b.pushScalar(newValueFloat32(f))
 }
 
 func (b *Builder) Float32Field(key []byte, f float32) {
@@ -192,7 +326,7 @@ func (b *Builder) Float32Field(key []byte, f float32) {
 }
 
 func (b *Builder) Float64(f float64) {
-	b.stack = append(b.stack, newValueFloat64(f))
+	b.pushScalar(newValueFloat64(f))
 }
 
 func (b *Builder) Float64Field(key []byte, f float64) {
@@ -279,24 +413,49 @@ func (b *Builder) BlobField(key, data []byte) int {
 	return len(b.stack)
 }
 
+// extMark is the ext of the vector or map started at start.
+type extMark struct {
+	start int
+	ext   int64
+}
+
+// pushExt records the pending ext for the vector or map starting at n. A vector and its first element vector start
+// at the same n, so a mark without ext is pushed too if the outer one has the ext.
+func (b *Builder) pushExt(n int) {
+	if b.ext != 0 || len(b.extStack) > 0 && b.extStack[len(b.extStack)-1].start == n {
+		b.extStack = append(b.extStack, extMark{start: n, ext: b.ext})
+		b.ext = 0
+	}
+}
+
+// popExt returns the ext of the vector or map started at start.
+func (b *Builder) popExt(start int) int64 {
+	if l := len(b.extStack); l > 0 && b.extStack[l-1].start == start {
+		ext := b.extStack[l-1].ext
+		b.extStack = b.extStack[:l-1]
+		return ext
+	}
+	return 0
+}
+
 func (b *Builder) StartVector() int {
 	n := len(b.stack)
-	if b.ext != 0 {
-		b.extMap[n] = b.ext
-	}
+	b.pushExt(n)
+	b.startContainer(n, false)
 	return n
 }
 
 func (b *Builder) StartVectorField(key []byte) int {
 	b.Key(key)
-	return len(b.stack)
+	n := len(b.stack)
+	b.startContainer(n, false)
+	return n
 }
 
 func (b *Builder) StartMap() int {
 	n := len(b.stack)
-	if b.ext != 0 {
-		b.extMap[n] = b.ext
-	}
+	b.pushExt(n)
+	b.startContainer(n, true)
 	return n
 }
 
@@ -328,12 +487,34 @@ func (b *Builder) Map(fn func(bld *Builder)) int {
 
 func (b *Builder) StartMapField(key []byte) int {
 	b.Key(key)
-	return len(b.stack)
+	n := len(b.stack)
+	b.startContainer(n, true)
+	return n
 }
 
 func (b *Builder) EndVector(start int, typed, fixed bool) (uint64, error) {
-	ext := b.extMap[start]
-	vec, err := b.createVector(start, len(b.stack)-start, 1, typed, fixed, nil, ext, ext != 0)
+	b.endContainer(start)
+	b.materializeKeys(start)
+	if !typed {
+		b.materializeScalars(start, 1)
+	}
+	ext := b.popExt(start)
+	vec, err := b.createVector(start, len(b.stack)-start, 1, typed, fixed, FBTNull, nil, ext, ext != 0)
+	if err != nil {
+		return 0, err
+	}
+	b.stack = b.stack[:start]
+	b.stack = append(b.stack, vec)
+	return vec.AsUInt(), nil
+}
+
+// EndTypedVector ends a typed vector of elemType, which is one of Int, UInt, Float, Key and String,
+// or one of Int, UInt and Float for fixed vectors. Unlike EndVector, empty vectors keep the type.
+func (b *Builder) EndTypedVector(start int, elemType Type, fixed bool) (uint64, error) {
+	b.endContainer(start)
+	b.materializeKeys(start)
+	ext := b.popExt(start)
+	vec, err := b.createVector(start, len(b.stack)-start, 1, true, fixed, elemType, nil, ext, ext != 0)
 	if err != nil {
 		return 0, err
 	}
@@ -365,6 +546,8 @@ func (b *Builder) VectorField(key []byte, typed, fixed bool, fn func(bld *Builde
 type keysValueSlice struct {
 	b      *Builder
 	values []value
+	// order is swapped with values if not nil
+	order []int
 }
 
 func (k *keysValueSlice) Len() int {
@@ -372,17 +555,21 @@ func (k *keysValueSlice) Len() int {
 }
 
 func (k *keysValueSlice) Less(i, j int) bool {
-	iKey := readCStringBytes(k.b.buf, int(k.values[2*i].d))
-	jKey := readCStringBytes(k.b.buf, int(k.values[2*j].d))
-	return bytes.Compare(iKey, jKey) <= 0
+	iKey := k.b.keyBytes(k.values[2*i])
+	jKey := k.b.keyBytes(k.values[2*j])
+	return bytes.Compare(iKey, jKey) < 0
 }
 
 func (k *keysValueSlice) Swap(i, j int) {
 	k.values[2*i], k.values[2*j] = k.values[2*j], k.values[2*i]
 	k.values[2*i+1], k.values[2*j+1] = k.values[2*j+1], k.values[2*i+1]
+	if k.order != nil {
+		k.order[i], k.order[j] = k.order[j], k.order[i]
+	}
 }
 
 func (b *Builder) EndMap(start int) (int, error) {
+	b.endContainer(start)
 	l := len(b.stack) - start
 	if l&1 > 0 {
 		return 0, ErrOddSizeMapContent
@@ -397,9 +584,43 @@ func (b *Builder) EndMap(start int) (int, error) {
 		b:      b,
 		values: b.stack[start:],
 	}
-	sort.Sort(&sortingSlice)
+	if b.orderedMaps {
+		b.mapOrder = b.mapOrder[:0]
+		for i := 0; i < l; i++ {
+			b.mapOrder = append(b.mapOrder, i)
+		}
+		sortingSlice.order = b.mapOrder
+	}
+	// keep the order of duplicated keys, so rebuilding a map gives the same map
+	sort.Stable(&sortingSlice)
+	if b.duplicateKeys != DuplicateKeysAllow {
+		var err error
+		if l, err = b.removeDuplicateKeys(start); err != nil {
+			return 0, err
+		}
+	}
+	b.materializeScalars(start+1, 2)
 
-	ext := b.extMap[start]
+	ext := b.popExt(start)
+	// the order follows the ext
+	var order []byte
+	if b.orderedMaps && !sort.IntsAreSorted(b.mapOrder[:l]) {
+		order = b.encodeMapOrder(ext, l)
+		ext = ExtOrderedMap
+	}
+	if b.keyDict != nil {
+		keys, err := b.keyDictionaryKeys(start)
+		if err != nil {
+			return 0, err
+		}
+		// no keys vector in the buffer, attach ext after values
+		idx, err := b.endMap(start, l, keys, ext)
+		if err != nil {
+			return 0, err
+		}
+		b.buf = append(b.buf, order...)
+		return idx, nil
+	}
 	share := b.flags&BuilderFlagShareKeyVectors == BuilderFlagShareKeyVectors
 	var keys value
 	var err error
@@ -416,15 +637,16 @@ func (b *Builder) EndMap(start int) (int, error) {
 		}
 	}
 	// attach ext only after keys vector
-	keys, err = b.createVector(start, l, 2, true, false, nil, ext, false)
+	keys, err = b.createVector(start, l, 2, true, false, FBTNull, nil, ext, false)
 	if err != nil {
 		return 0, err
 	}
+	b.buf = append(b.buf, order...)
 	if share {
 		b.keyVectorsOffsetMap[hash] = keys
 	}
 keyOk:
-	vec, err := b.createVector(start+1, l, 2, false, false, &keys, 0, ext != 0)
+	vec, err := b.createVector(start+1, l, 2, false, false, FBTNull, &keys, 0, ext != 0)
 	if err != nil {
 		return 0, err
 	}
@@ -433,6 +655,94 @@ keyOk:
 	return int(vec.AsUInt()), nil
 }
 
+// removeDuplicateKeys applies the policy to the sorted entries of the map started at start,
+// and returns the number of entries left.
+func (b *Builder) removeDuplicateKeys(start int) (int, error) {
+	n := start
+	for i := start; i < len(b.stack); i += 2 {
+		if n > start && bytes.Equal(b.keyBytes(b.stack[n-2]), b.keyBytes(b.stack[i])) {
+			switch b.duplicateKeys {
+			case DuplicateKeysReject:
+				return 0, fmt.Errorf("%w: %q", ErrDuplicateKey, b.keyBytes(b.stack[i]))
+			case DuplicateKeysLast:
+				// the entry keeps the position of the first one in the order
+				b.stack[n-1] = b.stack[i+1]
+			}
+			continue
+		}
+		b.stack[n], b.stack[n+1] = b.stack[i], b.stack[i+1]
+		if b.orderedMaps {
+			b.mapOrder[(n-start)/2] = b.mapOrder[(i-start)/2]
+		}
+		n += 2
+	}
+	b.stack = b.stack[:n]
+	return (n - start) / 2, nil
+}
+
+// encodeMapOrder returns the ext and the indexes of the l sorted entries in the order they were added, by mapOrder.
+func (b *Builder) encodeMapOrder(ext int64, l int) []byte {
+	indexes := make([]int, l)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return b.mapOrder[indexes[i]] < b.mapOrder[indexes[j]]
+	})
+	var buf [binary.MaxVarintLen64]byte
+	dst := append([]byte(nil), buf[:binary.PutVarint(buf[:], ext)]...)
+	for _, idx := range indexes {
+		dst = append(dst, buf[:binary.PutUvarint(buf[:], uint64(idx))]...)
+	}
+	return dst
+}
+
+func (b *Builder) endMap(start, l int, keys value, ext int64) (int, error) {
+	vec, err := b.createVector(start+1, l, 2, false, false, FBTNull, &keys, ext, ext != 0)
+	if err != nil {
+		return 0, err
+	}
+	b.stack = b.stack[:start]
+	b.stack = append(b.stack, vec)
+	return int(vec.AsUInt()), nil
+}
+
+// keyBytes returns the key pushed by Key.
+func (b *Builder) keyBytes(v value) []byte {
+	if b.keyDict != nil {
+		return readCStringBytes(b.keys, int(v.d))
+	}
+	return readCStringBytes(b.buf, int(v.d))
+}
+
+// keyDictionaryKeys returns the index of sorted map keys in the key dictionary, as an uint value.
+func (b *Builder) keyDictionaryKeys(start int) (value, error) {
+	b.keySet = b.keySet[:0]
+	for key := start; key < len(b.stack); key += 2 {
+		b.keySet = append(append(b.keySet, b.keyBytes(b.stack[key])...), 0)
+	}
+	idx, err := b.keyDict.add(b.keySet)
+	if err != nil {
+		return value{}, err
+	}
+	return newValueUInt(uint64(idx), FBTUint, WidthU(uint64(idx)), false), nil
+}
+
+// materializeKeys writes keys outside of maps to the buffer, they can't be stored in the key dictionary.
+func (b *Builder) materializeKeys(start int) {
+	if b.keyDict == nil {
+		return
+	}
+	for i := start; i < len(b.stack); i++ {
+		if b.stack[i].typ == FBTKey {
+			key := b.keyBytes(b.stack[i])
+			b.stack[i].d = int64(len(b.buf))
+			b.WriteBytes(key)
+			b.buf = append(b.buf, 0)
+		}
+	}
+}
+
 func (b *Builder) WriteOffset(o int, byteWidth int) error {
 	reloff := len(b.buf) - o
 	if byteWidth != 8 && reloff >= 1<<(byteWidth*8) {
@@ -453,7 +763,7 @@ func (b *Builder) createBlob(data []byte, trailing int, t Type) int {
 	}
 	hasExt := b.ext != 0
 	if hasExt {
-		var buf [8]byte
+		var buf [binary.MaxVarintLen64]byte
 		l := binary.PutVarint(buf[:], b.ext)
 		b.buf = append(b.buf, buf[:l]...)
 		b.ext = 0
@@ -476,7 +786,9 @@ func (b *Builder) WriteAny(v *value, byteWidth int) error {
 	return nil
 }
 
-func (b *Builder) createVector(start, vecLen, step int, typed, fixed bool, keys *value, ext int64, hasExtType bool) (value, error) {
+// createVector writes the vector of the values on the stack from start. Typed vectors have the type of the
+// first element, or elemType if it is not FBTNull.
+func (b *Builder) createVector(start, vecLen, step int, typed, fixed bool, elemType Type, keys *value, ext int64, hasExtType bool) (value, error) {
 	bitWidth := BitWidthMax(b.forceMinBitWidth, WidthU(uint64(vecLen)))
 	prefixElems := 1
 	if keys != nil {
@@ -484,26 +796,44 @@ func (b *Builder) createVector(start, vecLen, step int, typed, fixed bool, keys
 		prefixElems += 2
 	}
 	vectorType := FBTKey
+	if elemType != FBTNull {
+		vectorType = elemType
+	}
 	for i := start; i < len(b.stack); i += step {
 		elemWidth := b.stack[i].ElemWidth(len(b.buf), i+prefixElems)
 		bitWidth = BitWidthMax(bitWidth, elemWidth)
 		if typed {
-			if i == start {
+			if i == start && elemType == FBTNull {
 				vectorType = b.stack[i].typ
 			} else if b.stack[i].typ != vectorType {
 				return value{}, fmt.Errorf("inconsistent type")
 			}
 		}
 	}
-	if fixed && !IsTypedVectorElementType(vectorType) {
-		return value{}, fmt.Errorf("item type should be one of Int / UInt / Float / Key")
+	// vectors of bool are not typed, FBTVectorBool overlaps the meta bit of packed types
+	if typed && (vectorType < FBTInt || FBTString < vectorType) {
+		return value{}, fmt.Errorf("item type should be one of Int / UInt / Float / Key / String")
+	}
+	if fixed {
+		if vectorType < FBTInt || FBTFloat < vectorType {
+			return value{}, fmt.Errorf("item type should be one of Int / UInt / Float")
+		}
+		if vecLen < 2 || 4 < vecLen {
+			return value{}, fmt.Errorf("fixed vector should have 2 to 4 items")
+		}
 	}
 	byteWidth := b.align(bitWidth)
 	if keys != nil {
-		if err := b.WriteOffset(int(keys.d), byteWidth); err != nil {
-			return value{}, err
+		if keys.typ == FBTUint {
+			// index of the key dictionary, zero keys width marks it
+			b.WriteUInt(keys.AsUInt(), byteWidth)
+			b.WriteUInt(0, byteWidth)
+		} else {
+			if err := b.WriteOffset(int(keys.d), byteWidth); err != nil {
+				return value{}, err
+			}
+			b.WriteUInt(1<<keys.minBitWidth, byteWidth)
 		}
-		b.WriteUInt(1<<keys.minBitWidth, byteWidth)
 	}
 	if !fixed {
 		b.WriteUInt(uint64(vecLen), byteWidth)
@@ -522,19 +852,18 @@ func (b *Builder) createVector(start, vecLen, step int, typed, fixed bool, keys
 	}
 	hasExt := ext != 0
 	if hasExt {
-		var buf [8]byte
+		var buf [binary.MaxVarintLen64]byte
 		l := binary.PutVarint(buf[:], ext)
 		b.buf = append(b.buf, buf[:l]...)
 	}
 	t := FBTVector
 	if keys != nil {
 		t = FBTMap
-		if typed {
-			if fixed {
-				t = ToTypedVector(vectorType, vecLen)
-			} else {
-				t = ToTypedVector(vectorType, 0)
-			}
+	} else if typed {
+		if fixed {
+			t = ToTypedVector(vectorType, vecLen)
+		} else {
+			t = ToTypedVector(vectorType, 0)
 		}
 	}
 	return value{
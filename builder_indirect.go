@@ -0,0 +1,157 @@
+package flexbuffers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// container is a vector or map being built from the value at start of the stack.
+type container struct {
+	start int
+	isMap bool
+}
+
+// pathPattern is an element of a dotted path given to SetIndirectScalars.
+type pathPattern struct {
+	key string
+	// index is the vector index, or -1 if key is not a number
+	index int
+	any   bool
+}
+
+// SetIndirectScalars makes Int, UInt, Float32 and Float64 store the values indirectly at byteWidth bytes, so that
+// Reference.MutateInt and the other Mutate methods can update them in place with any value fitting in byteWidth,
+// whatever the width of the vector or map holding them. With byteWidth 8, updates never overflow.
+//
+// paths select the values to store indirectly, all values if none. A path is dotted like "stats.count", elements are
+// map keys or vector indexes, "*" matches any key or index and the empty path is the root.
+//
+// Values which need more than byteWidth bytes are stored at their width, floats at 4 bytes at least.
+// Elements of typed vectors are always inline, see EndTypedVector. byteWidth 0 stores values inline as usual.
+func (b *Builder) SetIndirectScalars(byteWidth int, paths ...string) error {
+	switch byteWidth {
+	case 0:
+		b.indirectScalars = false
+		b.indirectPaths = nil
+		return nil
+	case 1, 2, 4, 8:
+	default:
+		return fmt.Errorf("invalid byte width %d", byteWidth)
+	}
+	b.indirectScalars = true
+	b.indirectWidth = WidthB(byteWidth)
+	b.indirectPaths = nil
+	for _, path := range paths {
+		b.indirectPaths = append(b.indirectPaths, parsePathPattern(path))
+	}
+	return nil
+}
+
+func parsePathPattern(path string) []pathPattern {
+	if path == "" {
+		return []pathPattern{}
+	}
+	elems := strings.Split(path, ".")
+	patterns := make([]pathPattern, len(elems))
+	for i, e := range elems {
+		index, err := strconv.Atoi(e)
+		if err != nil || index < 0 {
+			index = -1
+		}
+		patterns[i] = pathPattern{key: e, index: index, any: e == "*"}
+	}
+	return patterns
+}
+
+func (b *Builder) startContainer(start int, isMap bool) {
+	if b.indirectPaths != nil {
+		b.containers = append(b.containers, container{start: start, isMap: isMap})
+	}
+}
+
+// endContainer forgets the container started at start, and ones inside it which were not ended.
+// A vector and its first element start at the same index, the inner one is ended first.
+func (b *Builder) endContainer(start int) {
+	l := len(b.containers)
+	for l > 0 && b.containers[l-1].start > start {
+		l--
+	}
+	if l > 0 && b.containers[l-1].start == start {
+		l--
+	}
+	b.containers = b.containers[:l]
+}
+
+// pushScalar pushes v, marking it to be stored indirectly if it is selected by SetIndirectScalars.
+func (b *Builder) pushScalar(v value) {
+	if b.indirectScalars {
+		v.indirect = b.indirectPaths == nil || b.atIndirectPath()
+	}
+	b.stack = append(b.stack, v)
+}
+
+// atIndirectPath returns true if the value pushed next is at one of indirectPaths.
+func (b *Builder) atIndirectPath() bool {
+	for _, path := range b.indirectPaths {
+		if len(path) == len(b.containers) && b.matchPath(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Builder) matchPath(path []pathPattern) bool {
+	for i, c := range b.containers {
+		// the element of c is the next container, or the value pushed next
+		next := len(b.stack)
+		if i+1 < len(b.containers) {
+			next = b.containers[i+1].start
+		}
+		p := path[i]
+		if p.any {
+			continue
+		}
+		if c.isMap {
+			if next == 0 || b.stack[next-1].typ != FBTKey || string(b.keyBytes(b.stack[next-1])) != p.key {
+				return false
+			}
+		} else if next-c.start != p.index {
+			return false
+		}
+	}
+	return true
+}
+
+// materializeScalars writes the scalars to be stored indirectly on the stack from start, every step values.
+// They are written before the vector or map referring them.
+func (b *Builder) materializeScalars(start, step int) {
+	if !b.indirectScalars {
+		return
+	}
+	for i := start; i < len(b.stack); i += step {
+		v := &b.stack[i]
+		if !v.indirect {
+			continue
+		}
+		bitWidth := BitWidthMax(b.indirectWidth, v.minBitWidth)
+		switch v.typ {
+		case FBTInt:
+			byteWidth := b.align(bitWidth)
+			loc := len(b.buf)
+			b.WriteInt(v.AsInt(), byteWidth)
+			*v = newValueUInt(uint64(loc), FBTIndirectInt, bitWidth, false)
+		case FBTUint:
+			byteWidth := b.align(bitWidth)
+			loc := len(b.buf)
+			b.WriteUInt(v.AsUInt(), byteWidth)
+			*v = newValueUInt(uint64(loc), FBTIndirectUInt, bitWidth, false)
+		case FBTFloat:
+			bitWidth = BitWidthMax(bitWidth, BitWidth32)
+			byteWidth := b.align(bitWidth)
+			loc := len(b.buf)
+			_ = b.WriteDouble(v.AsFloat(), byteWidth)
+			*v = newValueUInt(uint64(loc), FBTIndirectFloat, bitWidth, false)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package flexbuffers
+
+import "sync"
+
+// BuilderPool is a pool of builders with the same flags, safe for concurrent use.
+// Builders put back to the pool keep the capacity of their buffers, so building many documents doesn't
+// allocate for each of them.
+type BuilderPool struct {
+	flags BuilderFlag
+	pool  sync.Pool
+}
+
+func NewBuilderPool(flags BuilderFlag) *BuilderPool {
+	p := &BuilderPool{flags: flags}
+	p.pool.New = func() interface{} {
+		return NewBuilderWithFlags(flags)
+	}
+	return p
+}
+
+// Get returns an empty builder.
+func (p *BuilderPool) Get() *Builder {
+	return p.pool.Get().(*Builder)
+}
+
+// Put resets b and returns it to the pool. The buffer of b is reused, so Raw returned by b.Buffer
+// must be copied before Put, see Builder.FinishTo.
+func (p *BuilderPool) Put(b *Builder) {
+	if b.flags != p.flags || b.keyDict != nil {
+		// builders configured differently are not reused
+		return
+	}
+	b.Reset()
+	p.pool.Put(b)
+}
@@ -0,0 +1,52 @@
+package flexbuffers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilderPool(t *testing.T) {
+	a := assert.New(t)
+	build := func(b *Builder, i int) Raw {
+		b.Map(func(b *Builder) {
+			b.StringValueField([]byte("name"), fmt.Sprintf("doc%d", i))
+			b.IntField([]byte("id"), int64(i))
+			b.VectorField([]byte("tags"), false, false, func(b *Builder) {
+				b.StringValue("a")
+				b.StringValue("a")
+			})
+		})
+		if err := b.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		return append(Raw(nil), b.Buffer()...)
+	}
+
+	// a reset builder writes the same document as a new one, and keeps its buffer
+	b := NewBuilderWithFlags(BuilderFlagShareAll)
+	first := build(b, 0)
+	capacity := cap(b.buf)
+	b.Reset()
+	a.Equal(first, build(b, 0))
+	a.Equal(capacity, cap(b.buf))
+
+	pool := NewBuilderPool(BuilderFlagShareAll)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				b := pool.Get()
+				raw := build(b, w*100+i)
+				pool.Put(b)
+				a.Equal(int64(w*100+i), raw.LookupOrNull("id").AsInt64())
+				a.Equal(fmt.Sprintf("doc%d", w*100+i), raw.LookupOrNull("name").AsStringRef().StringValueOrEmpty())
+			}
+		}(w)
+	}
+	wg.Wait()
+}
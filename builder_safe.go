@@ -33,7 +33,7 @@ func (b *Builder) IndirectFloat32(f float32) {
 	bitWidth := BitWidth32
 	byteWidth := b.align(bitWidth)
 	iloc := uint64(len(b.buf))
-	binary.LittleEndian.PutUint64(tmp[:], uint64(math.Float32bits(f)))
+	binary.LittleEndian.PutUint32(tmp[:], math.Float32bits(f))
 	b.WriteBytes(tmp[:byteWidth])
 	b.stack = append(b.stack, newValueUInt(iloc, FBTIndirectFloat, bitWidth, false))
 }
@@ -43,7 +43,11 @@ func (b *Builder) IndirectFloat64(f float64) {
 	bitWidth := WidthF(f)
 	byteWidth := b.align(bitWidth)
 	iloc := uint64(len(b.buf))
-	binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(f))
+	if bitWidth == BitWidth32 {
+		binary.LittleEndian.PutUint32(tmp[:], math.Float32bits(float32(f)))
+	} else {
+		binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(f))
+	}
 	b.WriteBytes(tmp[:byteWidth])
 	b.stack = append(b.stack, newValueUInt(iloc, FBTIndirectFloat, bitWidth, false))
 }
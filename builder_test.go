@@ -1,6 +1,7 @@
 package flexbuffers
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -343,6 +344,391 @@ func TestBuildAndParse(t *testing.T) {
 	}
 }
 
+func TestBuilder_DuplicateKeysKeepOrder(t *testing.T) {
+	a := assert.New(t)
+	b := NewBuilder()
+	b.Map(func(b *Builder) {
+		for i := 0; i < 20; i++ {
+			b.IntField([]byte("b"), int64(i))
+			b.IntField([]byte("a"), int64(i))
+		}
+	})
+	a.NoError(b.Finish())
+	values := b.Buffer().RootOrNull().AsMap().Values()
+	for i := 0; i < 20; i++ {
+		a.Equal(int64(i), values.AtOrNull(i).AsInt64())
+		a.Equal(int64(i), values.AtOrNull(20+i).AsInt64())
+	}
+}
+
+func TestBuilder_Reset(t *testing.T) {
+	a := assert.New(t)
+	build := func(b *Builder) {
+		b.Map(func(b *Builder) {
+			b.Ext(3)
+			b.StringValueField([]byte("a"), "foo")
+			b.VectorField([]byte("b"), false, false, func(b *Builder) {
+				b.StringValue("foo")
+				b.Int(-1)
+			})
+		})
+	}
+	fresh := NewBuilderWithFlags(BuilderFlagShareAll)
+	build(fresh)
+	if err := fresh.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	expected := fresh.Buffer()
+
+	b := NewBuilderWithFlags(BuilderFlagShareAll)
+	// an error is discarded by Reset
+	b.Map(func(b *Builder) {
+		b.Int(1)
+	})
+	a.Error(b.Finish())
+	b.Reset()
+
+	build(b)
+	out, err := b.FinishTo([]byte("prefix"))
+	if a.NoError(err) {
+		a.Equal(append([]byte("prefix"), expected...), []byte(out))
+	}
+	capacity := cap(b.buf)
+	build(b)
+	out, err = b.FinishTo(nil)
+	if a.NoError(err) {
+		a.Equal(expected, out)
+	}
+	a.Equal(capacity, cap(b.buf))
+
+	build(b)
+	if a.NoError(b.Finish()) {
+		a.Equal([]byte(expected), []byte(b.AppendTo(nil)))
+	}
+}
+
+func TestBuilder_TypedVector(t *testing.T) {
+	a := assert.New(t)
+	b := NewBuilder()
+	b.Vector(false, false, func(b *Builder) {
+		b.Vector(true, true, func(b *Builder) {
+			b.UInt(1)
+			b.UInt(2)
+		})
+		b.Vector(true, true, func(b *Builder) {
+			b.Float64(0.5)
+			b.Float64(1)
+			b.Float64(1.5)
+			b.Float64(2)
+		})
+		start := b.StartVector()
+		_, err := b.EndTypedVector(start, FBTString, false)
+		a.NoError(err)
+		b.IndirectFloat64(1)
+		b.IndirectFloat32(2)
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	vec := b.Buffer().RootOrNull().AsVector()
+	a.Equal(FBTVectorUInt2, vec.AtOrNull(0).Type())
+	a.Equal(uint64(2), vec.AtOrNull(0).AsFixedTypedVector().AtOrNull(1).AsUInt64())
+	a.Equal(FBTVectorFloat4, vec.AtOrNull(1).Type())
+	a.Equal(FBTVectorString, vec.AtOrNull(2).Type())
+	a.Equal(1.0, vec.AtOrNull(3).AsFloat64())
+	a.Equal(2.0, vec.AtOrNull(4).AsFloat64())
+
+	for _, fn := range []func(b *Builder){
+		func(b *Builder) {
+			b.StringValue("a")
+			b.StringValue("b")
+		},
+		func(b *Builder) {
+			b.Int(1)
+		},
+		func(b *Builder) {
+			b.Int(1)
+			b.UInt(1)
+		},
+		func(b *Builder) {
+			b.Bool(true)
+			b.Bool(false)
+		},
+	} {
+		b := NewBuilder()
+		b.Vector(true, true, fn)
+		a.Error(b.Finish())
+	}
+	// FBTVectorBool cannot be stored
+	b = NewBuilder()
+	b.Vector(true, false, func(b *Builder) {
+		b.Bool(true)
+	})
+	a.Error(b.Finish())
+}
+
+func TestBuilder_DuplicateKeys(t *testing.T) {
+	build := func(policy DuplicateKeyPolicy, flags BuilderFlag) (Raw, error) {
+		b := NewBuilderWithFlags(flags)
+		b.SetDuplicateKeys(policy)
+		b.Map(func(b *Builder) {
+			b.IntField([]byte("b"), 1)
+			b.IntField([]byte("a"), 2)
+			b.IntField([]byte("b"), 3)
+			b.MapField([]byte("c"), func(b *Builder) {
+				b.IntField([]byte("x"), 4)
+			})
+			b.IntField([]byte("b"), 5)
+		})
+		if err := b.Finish(); err != nil {
+			return nil, err
+		}
+		return b.Buffer(), nil
+	}
+	cases := []struct {
+		policy DuplicateKeyPolicy
+		size   int
+		b      int64
+	}{
+		{policy: DuplicateKeysFirst, size: 3, b: 1},
+		{policy: DuplicateKeysLast, size: 3, b: 5},
+	}
+	for _, cas := range cases {
+		for _, flags := range []BuilderFlag{BuilderFlagNone, BuilderFlagShareAll} {
+			a := assert.New(t)
+			buf, err := build(cas.policy, flags)
+			if !a.NoError(err) {
+				continue
+			}
+			a.NoError(buf.ValidateWithOptions(ValidateOptions{RequireSortedKeys: true, RequireUniqueKeys: true}))
+			m := buf.RootOrNull().AsMap()
+			a.Equal(cas.size, m.SizeOrZero())
+			a.Equal(cas.b, m.GetOrNull("b").AsInt64())
+			a.Equal(int64(2), m.GetOrNull("a").AsInt64())
+			a.Equal(int64(4), m.GetOrNull("c").AsMap().GetOrNull("x").AsInt64())
+		}
+	}
+
+	_, err := build(DuplicateKeysReject, BuilderFlagNone)
+	assert.True(t, errors.Is(err, ErrDuplicateKey), "%v", err)
+
+	buf, err := build(DuplicateKeysAllow, BuilderFlagNone)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, buf.RootOrNull().AsMap().SizeOrZero())
+	}
+}
+
+func TestBuilder_OrderedMaps(t *testing.T) {
+	build := func(b *Builder) Raw {
+		b.SetOrderedMaps(true)
+		b.SetDuplicateKeys(DuplicateKeysLast)
+		b.Map(func(b *Builder) {
+			b.IntField([]byte("z"), 1)
+			b.Key([]byte("m"))
+			b.Ext(7)
+			b.Map(func(b *Builder) {
+				b.IntField([]byte("y"), 2)
+				b.IntField([]byte("b"), 3)
+				b.IntField([]byte("y"), 4)
+			})
+			b.MapField([]byte("sorted"), func(b *Builder) {
+				b.IntField([]byte("a"), 5)
+				b.IntField([]byte("b"), 6)
+			})
+			b.IntField([]byte("a"), 7)
+		})
+		if err := b.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		return append(Raw(nil), b.Buffer()...)
+	}
+	d := NewKeyDictionary()
+	bd := NewBuilder()
+	bd.SetKeyDictionary(d)
+	for _, buf := range []Raw{build(NewBuilder()), build(NewBuilderWithFlags(BuilderFlagShareAll)), build(bd)} {
+		a := assert.New(t)
+		root, err := buf.RootWithKeyDictionary(d)
+		if !a.NoError(err) {
+			continue
+		}
+		a.NoError(root.ValidateWithOptions(ValidateOptions{StrictAlignment: true, RequireSortedKeys: true, RequireUniqueKeys: true}))
+		m := root.AsMap()
+		a.True(m.Ordered())
+		order, err := m.AppendOrder(nil)
+		a.NoError(err)
+		// a, m, sorted, z
+		a.Equal([]int{3, 1, 2, 0}, order)
+		a.Equal(int64(7), m.GetOrNull("a").AsInt64())
+		a.Equal(int64(7), m.GetOrNull("m").Ext())
+		a.True(m.GetOrNull("m").AsMap().Ordered())
+		a.Equal(int64(4), m.GetOrNull("m").AsMap().GetOrNull("y").AsInt64())
+		a.False(m.GetOrNull("sorted").AsMap().Ordered())
+
+		out, err := root.AppendJson(nil, JsonOptions{Ext: true})
+		a.NoError(err)
+		a.Equal(`{"z":1,"m":{"$ext":7,"value":{"y":4,"b":3}},"sorted":{"a":5,"b":6},"a":7}`, string(out))
+		out, err = root.AppendJson(nil, JsonOptions{KeyOrder: KeyOrderSorted})
+		a.NoError(err)
+		a.Equal(`{"a":7,"m":{"b":3,"y":4},"sorted":{"a":5,"b":6},"z":1}`, string(out))
+	}
+
+	// the inspector annotates the order
+	spans := build(NewBuilder()).Inspect()
+	assert.Empty(t, InvalidSpans(spans))
+	orders := 0
+	for _, s := range spans {
+		if s.Kind == SpanMapOrder {
+			orders++
+		}
+	}
+	assert.Equal(t, 2, orders)
+
+	// maps added in the order of keys are stored as usual
+	sorted := func(ordered bool) Raw {
+		b := NewBuilder()
+		b.SetOrderedMaps(ordered)
+		b.Map(func(b *Builder) {
+			b.IntField([]byte("a"), 1)
+			b.IntField([]byte("b"), 2)
+		})
+		if err := b.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		return b.Buffer()
+	}
+	assert.Equal(t, sorted(false), sorted(true))
+
+	b := NewBuilder()
+	b.Ext(ExtOrderedMap)
+	b.StringValue("x")
+	assert.Error(t, b.Finish())
+}
+
+func TestBuilder_IndirectScalars(t *testing.T) {
+	build := func(paths ...string) Raw {
+		b := NewBuilder()
+		if err := b.SetIndirectScalars(8, paths...); err != nil {
+			t.Fatal(err)
+		}
+		b.Map(func(b *Builder) {
+			b.MapField([]byte("stats"), func(b *Builder) {
+				b.IntField([]byte("count"), 1)
+				b.UIntField([]byte("bytes"), 2)
+				b.Float32Field([]byte("ratio"), 0.5)
+			})
+			b.VectorField([]byte("items"), false, false, func(b *Builder) {
+				for i := 0; i < 2; i++ {
+					b.Map(func(b *Builder) {
+						b.IntField([]byte("n"), int64(i))
+					})
+				}
+			})
+			b.VectorField([]byte("typed"), true, false, func(b *Builder) {
+				b.Int(3)
+				b.Int(4)
+			})
+		})
+		if err := b.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		return b.Buffer()
+	}
+	types := func(buf Raw) map[string]Type {
+		root, err := buf.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := root.AsMap()
+		stats := m.GetOrNull("stats").AsMap()
+		items := m.GetOrNull("items").AsVector()
+		return map[string]Type{
+			"stats.count": stats.GetOrNull("count").Type(),
+			"stats.bytes": stats.GetOrNull("bytes").Type(),
+			"stats.ratio": stats.GetOrNull("ratio").Type(),
+			"items.0.n":   items.AtOrNull(0).AsMap().GetOrNull("n").Type(),
+			"items.1.n":   items.AtOrNull(1).AsMap().GetOrNull("n").Type(),
+			"typed":       m.GetOrNull("typed").Type(),
+		}
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		want  map[string]Type
+	}{
+		{
+			name: "all",
+			want: map[string]Type{
+				"stats.count": FBTIndirectInt,
+				"stats.bytes": FBTIndirectUInt,
+				"stats.ratio": FBTIndirectFloat,
+				"items.0.n":   FBTIndirectInt,
+				"items.1.n":   FBTIndirectInt,
+				"typed":       FBTVectorInt,
+			},
+		},
+		{
+			name:  "paths",
+			paths: []string{"stats.count", "items.*.n", "typed.0"},
+			want: map[string]Type{
+				"stats.count": FBTIndirectInt,
+				"stats.bytes": FBTUint,
+				"stats.ratio": FBTFloat,
+				"items.0.n":   FBTIndirectInt,
+				"items.1.n":   FBTIndirectInt,
+				"typed":       FBTVectorInt,
+			},
+		},
+		{
+			name:  "index",
+			paths: []string{"items.1.n"},
+			want: map[string]Type{
+				"stats.count": FBTInt,
+				"stats.bytes": FBTUint,
+				"stats.ratio": FBTFloat,
+				"items.0.n":   FBTInt,
+				"items.1.n":   FBTIndirectInt,
+				"typed":       FBTVectorInt,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			buf := build(tt.paths...)
+			a.NoError(buf.Validate())
+			a.Equal(tt.want, types(buf))
+		})
+	}
+
+	// values of 1 byte in maps of 1 byte width are updated with any value
+	buf := build()
+	root, _ := buf.Root()
+	stats := root.AsMap().GetOrNull("stats").AsMap()
+	a := assert.New(t)
+	a.NoError(stats.GetOrNull("count").MutateInt(math.MinInt64))
+	a.NoError(stats.GetOrNull("bytes").MutateUInt(math.MaxUint64))
+	a.NoError(stats.GetOrNull("ratio").MutateFloat64(math.MaxFloat64))
+	a.Equal(int64(math.MinInt64), stats.GetOrNull("count").AsInt64())
+	a.Equal(uint64(math.MaxUint64), stats.GetOrNull("bytes").AsUInt64())
+	a.Equal(math.MaxFloat64, stats.GetOrNull("ratio").AsFloat64())
+	inline := build("none")
+	root, _ = inline.Root()
+	a.Error(root.AsMap().GetOrNull("stats").AsMap().GetOrNull("count").MutateInt(math.MinInt64))
+
+	// the root
+	b := NewBuilder()
+	a.NoError(b.SetIndirectScalars(4, ""))
+	b.Int(1)
+	a.NoError(b.Finish())
+	root, _ = b.Buffer().Root()
+	a.Equal(FBTIndirectInt, root.Type())
+	a.NoError(root.MutateInt(math.MaxInt32))
+	a.Equal(int64(math.MaxInt32), root.AsInt64())
+	a.Error(root.MutateInt(math.MaxInt64))
+
+	a.Error(NewBuilder().SetIndirectScalars(3))
+}
+
 func TestBuilder_KeyShare(t *testing.T) {
 	a := assert.New(t)
 	b := NewBuilderWithFlags(BuilderFlagShareKeys)
@@ -42,7 +42,11 @@ func (b *Builder) IndirectFloat64(f float64) {
 	bitWidth := WidthF(f)
 	byteWidth := b.align(bitWidth)
 	iloc := uint64(len(b.buf))
-	*((*float64)(unsafe.Pointer(&tmp[0]))) = f
+	if bitWidth == BitWidth32 {
+		*((*float32)(unsafe.Pointer(&tmp[0]))) = float32(f)
+	} else {
+		*((*float64)(unsafe.Pointer(&tmp[0]))) = f
+	}
 	b.WriteBytes(tmp[:byteWidth])
 	b.stack = append(b.stack, newValueUInt(iloc, FBTIndirectFloat, bitWidth, false))
 }
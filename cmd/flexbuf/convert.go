@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"flexbuffers"
+	"flexbuffers/container"
+	"flexbuffers/pkg/lz4"
+	"flexbuffers/process"
+)
+
+const (
+	formatFlexbuf = "flexbuf"
+	formatArchive = "archive"
+	formatJSON    = "json"
+	formatBSON    = "bson"
+	formatMsgpack = "msgpack"
+	formatArrow   = "arrow"
+)
+
+// source reads documents of any format as flexbuffers.
+type source interface {
+	Next() (flexbuffers.Raw, error)
+	Close() error
+}
+
+// sink writes flexbuffers documents in any format.
+type sink interface {
+	Write(doc flexbuffers.Raw) error
+	Close() error
+}
+
+type convertOptions struct {
+	input  inputOptions
+	from   string
+	to     string
+	output string
+
+	// flexbuf output
+	single      bool
+	header      bool
+	varint      bool
+	checksum    bool
+	sync        bool
+	compress    bool
+	dictSamples int
+	dictSize    int
+	indexes     indexFlags
+
+	// archive input
+	records recordOptions
+
+	// arrow output
+	sample    int
+	columns   string
+	batchSize int
+
+	json jsonOutputOptions
+	// json input
+	typedVectors  bool
+	fixedVectors  bool
+	strict        bool
+	duplicateKeys string
+	orderedMaps   bool
+	indirect      int
+	indirectPaths string
+}
+
+func runConvert(c *command, args []string) error {
+	var opts convertOptions
+	fs := c.flagSet()
+	opts.input.register(fs)
+	opts.json.register(fs)
+	fs.StringVar(&opts.from, "from", formatFlexbuf, "input format: flexbuf (single document, stream or archive), json, bson or msgpack")
+	fs.StringVar(&opts.to, "to", formatJSON, "output format: flexbuf (stream), archive, json, bson, msgpack or arrow")
+	fs.BoolVar(&opts.typedVectors, "typed-vectors", false, "build JSON arrays of numbers or strings of the same type as typed vectors")
+	fs.BoolVar(&opts.fixedVectors, "fixed-vectors", false, "build JSON arrays of 2 to 4 numbers of the same type as fixed typed vectors")
+	fs.BoolVar(&opts.strict, "strict", false, "reject JSON input with invalid strings or numbers, too deep nesting or trailing content")
+	fs.StringVar(&opts.duplicateKeys, "duplicate-keys", "allow", "what to do with duplicate keys of JSON objects and BSON documents: allow, reject, first or last")
+	fs.BoolVar(&opts.orderedMaps, "ordered-maps", false, "keep the order of JSON object keys in maps, which is used by JSON output")
+	fs.IntVar(&opts.indirect, "indirect", 0, "store JSON numbers indirectly at 1, 2, 4 or 8 bytes, so they can be updated in place")
+	fs.StringVar(&opts.indirectPaths, "indirect-paths", "", "comma separated dotted paths of numbers to store indirectly, * matches any key or index, all numbers if empty")
+	fs.StringVar(&opts.output, "o", "", "output file, stdout if empty")
+	fs.BoolVar(&opts.single, "single", false, "write a single flexbuffers document instead of a stream, the input must have one document")
+	fs.BoolVar(&opts.header, "header", false, "write stream header, the output can't be read by old readers")
+	fs.BoolVar(&opts.varint, "varint", false, "write lengths as varint (implies -header)")
+	fs.BoolVar(&opts.checksum, "checksum", false, "write CRC32C checksum for each record (implies -header)")
+	fs.BoolVar(&opts.sync, "sync", false, "write sync markers to recover from corrupted records (implies -header)")
+	fs.BoolVar(&opts.compress, "compress", false, "compress each record by LZ4 (implies -header)")
+	fs.IntVar(&opts.dictSamples, "dict-samples", 0, "train a compression dictionary from the first N records (implies -compress)")
+	fs.IntVar(&opts.dictSize, "dict-size", 16<<10, "maximum size of the compression dictionary")
+	fs.Var(&opts.indexes, "index", "secondary index of the output archive as name=dotted.path, can be repeated")
+	opts.records.register(fs)
+	fs.IntVar(&opts.sample, "sample", 1000, "number of documents to infer Arrow schema")
+	fs.StringVar(&opts.columns, "columns", "", "comma separated dotted paths to export to Arrow, all columns if empty")
+	fs.IntVar(&opts.batchSize, "batch", 1024, "rows per Arrow record batch")
+	if err := c.parse(fs, args, 0, 1); err != nil {
+		return err
+	}
+
+	src, err := openSource(fs.Arg(0), &opts)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, closeOutput, err := createOutput(opts.output)
+	if err != nil {
+		return err
+	}
+	dst, err := newSink(out, &opts)
+	if err != nil {
+		closeOutput()
+		return err
+	}
+	for i := 0; ; i++ {
+		doc, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closeOutput()
+			return fmt.Errorf("record %d: %v", i, err)
+		}
+		if err := dst.Write(doc); err != nil {
+			closeOutput()
+			return fmt.Errorf("record %d: %v", i, err)
+		}
+	}
+	if err := dst.Close(); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
+
+// createOutput creates the file, or returns buffered stdout if the name is empty. close flushes the output.
+func createOutput(name string) (io.Writer, func() error, error) {
+	if name == "" {
+		w := bufio.NewWriter(os.Stdout)
+		return w, w.Flush, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+func openSource(name string, opts *convertOptions) (source, error) {
+	if opts.from == formatFlexbuf {
+		in, err := openInput(name, opts.input)
+		if err != nil {
+			return nil, err
+		}
+		if err := opts.records.apply(in); err != nil {
+			in.Close()
+			return nil, err
+		}
+		return in, nil
+	}
+
+	var r io.Reader = os.Stdin
+	var closer io.Closer = ioutil.NopCloser(nil)
+	if name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		r, closer = f, f
+	}
+	br := bufio.NewReader(r)
+	var duplicateKeys flexbuffers.DuplicateKeyPolicy
+	switch opts.duplicateKeys {
+	case "allow":
+		duplicateKeys = flexbuffers.DuplicateKeysAllow
+	case "reject":
+		duplicateKeys = flexbuffers.DuplicateKeysReject
+	case "first":
+		duplicateKeys = flexbuffers.DuplicateKeysFirst
+	case "last":
+		duplicateKeys = flexbuffers.DuplicateKeysLast
+	default:
+		closer.Close()
+		return nil, fmt.Errorf("unknown duplicate keys policy %q", opts.duplicateKeys)
+	}
+	switch opts.from {
+	case formatJSON:
+		jsonOpts := process.JsonInputOptions{
+			Extended:      opts.json.extended,
+			TypedVectors:  opts.typedVectors,
+			FixedVectors:  opts.fixedVectors,
+			NumberExt:     opts.json.numberExt,
+			Strict:        opts.strict,
+			DuplicateKeys: duplicateKeys,
+			OrderedMaps:   opts.orderedMaps,
+		}
+		if opts.indirect != 0 {
+			jsonOpts.IndirectScalars = opts.indirect
+			if opts.indirectPaths != "" {
+				jsonOpts.IndirectPaths = strings.Split(opts.indirectPaths, ",")
+			}
+		}
+		return &jsonSource{dec: json.NewDecoder(br), opts: jsonOpts, Closer: closer}, nil
+	case formatBSON:
+		return &bsonSource{r: br, duplicateKeys: duplicateKeys, Closer: closer}, nil
+	case formatMsgpack:
+		data, err := ioutil.ReadAll(br)
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
+		return &msgpackSource{data: data, b: flexbuffers.NewBuilder(), Closer: closer}, nil
+	default:
+		closer.Close()
+		return nil, fmt.Errorf("unknown input format %q", opts.from)
+	}
+}
+
+// jsonSource reads a sequence of JSON values, like newline delimited JSON.
+type jsonSource struct {
+	dec  *json.Decoder
+	opts process.JsonInputOptions
+	io.Closer
+}
+
+func (s *jsonSource) Next() (flexbuffers.Raw, error) {
+	var msg json.RawMessage
+	start := s.dec.InputOffset()
+	if err := s.dec.Decode(&msg); err != nil {
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			return nil, fmt.Errorf("offset %d: %v", syntaxErr.Offset, err)
+		}
+		return nil, err
+	}
+	raw, err := process.FromJsonWithOptions(msg, s.opts)
+	if err != nil {
+		// positions of JsonSyntaxError are in the document
+		return nil, fmt.Errorf("document at offset %d: %v", start, err)
+	}
+	return raw, nil
+}
+
+// maxBSONDocumentSize is the largest document bsonSource reads, the limit of MongoDB is 16 MiB.
+const maxBSONDocumentSize = 64 << 20
+
+// bsonSource reads concatenated BSON documents.
+type bsonSource struct {
+	r             *bufio.Reader
+	duplicateKeys flexbuffers.DuplicateKeyPolicy
+	io.Closer
+}
+
+func (s *bsonSource) Next() (flexbuffers.Raw, error) {
+	head, err := s.r.Peek(4)
+	if err == io.EOF && len(head) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n := binary.LittleEndian.Uint32(head)
+	if n < 5 || n > maxBSONDocumentSize {
+		return nil, fmt.Errorf("invalid BSON document length %d", n)
+	}
+	// the buffer grows with the data read, not the length which may be larger than the input
+	data, err := ioutil.ReadAll(io.LimitReader(s.r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < int(n) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := flexbuffers.NewBuilder()
+	r := process.BSONReader{Output: process.NewFlexbuffersWriter(b), DuplicateKeys: s.duplicateKeys}
+	if err := r.ReadBuffer(data); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
+
+// msgpackSource reads concatenated MessagePack values.
+type msgpackSource struct {
+	data []byte
+	// b is reused for every value
+	b *flexbuffers.Builder
+	io.Closer
+}
+
+func (s *msgpackSource) Next() (flexbuffers.Raw, error) {
+	if len(s.data) == 0 {
+		return nil, io.EOF
+	}
+	s.b.Reset()
+	r := process.MsgpackReader{Output: process.NewFlexbuffersWriter(s.b)}
+	n, err := r.ReadValue(s.data)
+	if err != nil {
+		return nil, err
+	}
+	s.data = s.data[n:]
+	return s.b.FinishTo(nil)
+}
+
+func newSink(out io.Writer, opts *convertOptions) (sink, error) {
+	w := bufio.NewWriter(out)
+	switch opts.to {
+	case formatFlexbuf:
+		if opts.single {
+			return &singleSink{w: w}, nil
+		}
+		var so container.StreamOptions
+		if opts.varint {
+			so.Flags |= container.FlagVarint
+		}
+		if opts.checksum {
+			so.Flags |= container.FlagChecksum
+		}
+		if opts.sync {
+			so.Flags |= container.FlagSync
+		}
+		if opts.compress || opts.dictSamples > 0 {
+			so.Flags |= container.FlagCompressed
+		}
+		so.Legacy = !opts.header && so.Flags == 0
+		return &streamSink{w: w, opts: so, dictSamples: opts.dictSamples, dictSize: opts.dictSize}, nil
+	case formatArchive:
+		aw, err := container.NewArchiveWriter(w, opts.indexes...)
+		if err != nil {
+			return nil, err
+		}
+		return &archiveSink{w: w, aw: aw}, nil
+	case formatJSON, formatBSON, formatMsgpack:
+		jsonOpts, err := opts.json.options()
+		if err != nil {
+			return nil, err
+		}
+		return &encodeSink{w: w, format: opts.to, json: flexbuffers.NewJsonEncoder(w, jsonOpts)}, nil
+	case formatArrow:
+		return &arrowSink{out: out, w: w, opts: opts}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", opts.to)
+	}
+}
+
+type singleSink struct {
+	w       *bufio.Writer
+	written bool
+}
+
+func (s *singleSink) Write(doc flexbuffers.Raw) error {
+	if s.written {
+		return fmt.Errorf("-single requires the input to have one document")
+	}
+	s.written = true
+	_, err := s.w.Write(doc)
+	return err
+}
+
+func (s *singleSink) Close() error {
+	return s.w.Flush()
+}
+
+// streamSink writes a stream, records are buffered until the compression dictionary is trained.
+type streamSink struct {
+	w           *bufio.Writer
+	opts        container.StreamOptions
+	dictSamples int
+	dictSize    int
+	samples     []flexbuffers.Raw
+	sw          *container.StreamWriter
+}
+
+func (s *streamSink) start() error {
+	if len(s.samples) > 0 {
+		buffers := make([][]byte, len(s.samples))
+		for i, d := range s.samples {
+			buffers[i] = d
+		}
+		s.opts.Dictionary = lz4.TrainDictionary(buffers, s.dictSize)
+	}
+	var err error
+	if s.sw, err = container.NewStreamWriter(s.w, s.opts); err != nil {
+		return err
+	}
+	for _, d := range s.samples {
+		if err := s.sw.Write(d); err != nil {
+			return err
+		}
+	}
+	s.samples = nil
+	return nil
+}
+
+func (s *streamSink) Write(doc flexbuffers.Raw) error {
+	if s.sw == nil {
+		if len(s.samples) < s.dictSamples {
+			s.samples = append(s.samples, append(flexbuffers.Raw(nil), doc...))
+			return nil
+		}
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	return s.sw.Write(doc)
+}
+
+func (s *streamSink) Close() error {
+	if s.sw == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+type archiveSink struct {
+	w  *bufio.Writer
+	aw *container.ArchiveWriter
+}
+
+func (s *archiveSink) Write(doc flexbuffers.Raw) error {
+	_, err := s.aw.Write(doc)
+	return err
+}
+
+func (s *archiveSink) Close() error {
+	if err := s.aw.Close(); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// encodeSink writes JSON lines, or concatenated BSON documents or MessagePack values.
+type encodeSink struct {
+	w      *bufio.Writer
+	format string
+	json   *flexbuffers.JsonEncoder
+}
+
+func (s *encodeSink) Write(doc flexbuffers.Raw) error {
+	var data []byte
+	var err error
+	switch s.format {
+	case formatJSON:
+		root, err := doc.Root()
+		if err != nil {
+			return err
+		}
+		if err := s.json.Encode(root); err != nil {
+			return err
+		}
+		return s.w.WriteByte('\n')
+	case formatBSON:
+		data, err = process.ToBSON(doc)
+	default:
+		data, err = process.ToMsgpack(doc)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(data)
+	return err
+}
+
+func (s *encodeSink) Close() error {
+	return s.w.Flush()
+}
+
+// arrowSink infers the schema from the first documents, and writes Arrow IPC file if the output is seekable,
+// or Arrow IPC stream.
+type arrowSink struct {
+	out     io.Writer
+	w       *bufio.Writer
+	opts    *convertOptions
+	samples []flexbuffers.Raw
+	aw      *process.ArrowWriter
+}
+
+func (s *arrowSink) start() error {
+	columns, err := process.InferColumns(s.samples)
+	if err != nil {
+		return err
+	}
+	if s.opts.columns != "" {
+		columns = selectColumns(columns, strings.Split(s.opts.columns, ","))
+	}
+	if f, ok := s.out.(*os.File); ok && f != os.Stdout {
+		if s.aw, err = process.NewArrowFileWriter(f, columns); err != nil {
+			return err
+		}
+	} else {
+		s.aw = process.NewArrowStreamWriter(s.w, columns)
+	}
+	s.aw.BatchSize = s.opts.batchSize
+	for _, d := range s.samples {
+		if err := s.aw.Write(d); err != nil {
+			return err
+		}
+	}
+	s.samples = nil
+	return nil
+}
+
+func (s *arrowSink) Write(doc flexbuffers.Raw) error {
+	if s.aw == nil {
+		if len(s.samples) < s.opts.sample {
+			s.samples = append(s.samples, append(flexbuffers.Raw(nil), doc...))
+			return nil
+		}
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	return s.aw.Write(doc)
+}
+
+func (s *arrowSink) Close() error {
+	if s.aw == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if err := s.aw.Close(); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// selectColumns picks columns by names, columns not found in samples are exported as string.
+func selectColumns(inferred []process.Column, names []string) []process.Column {
+	columns := make([]process.Column, 0, len(names))
+	for _, name := range names {
+		c := process.Column{Name: name, Path: strings.Split(name, "."), Type: process.ColumnNull}
+		for _, ic := range inferred {
+			if ic.Name == name {
+				c = ic
+				break
+			}
+		}
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+type indexFlags []container.IndexSpec
+
+func (f *indexFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *indexFlags) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return fmt.Errorf("index must be name=path, but got %s", s)
+	}
+	*f = append(*f, container.IndexSpec{Name: s[:i], Path: strings.Split(s[i+1:], ".")})
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBSONSource_Length(t *testing.T) {
+	a := assert.New(t)
+	next := func(data []byte) error {
+		s := &bsonSource{r: bufio.NewReader(bytes.NewReader(data)), Closer: ioutil.NopCloser(nil)}
+		_, err := s.Next()
+		return err
+	}
+	// an empty document
+	a.NoError(next([]byte{5, 0, 0, 0, 0}))
+	a.EqualError(next([]byte{0xff, 0xff, 0xff, 0xff, 0}), "invalid BSON document length 4294967295")
+	// the length is larger than the input
+	a.Equal(io.ErrUnexpectedEOF, next([]byte{0, 0, 0, 1, 0}))
+}
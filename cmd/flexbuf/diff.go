@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"flexbuffers"
+)
+
+// differ prints differences of two documents as "~ path: old -> new", "- path: old" and "+ path: new".
+type differ struct {
+	w      *bufio.Writer
+	prefix string
+	count  int
+}
+
+func runDiff(c *command, args []string) error {
+	var opts inputOptions
+	fs := c.flagSet()
+	opts.register(fs)
+	if err := c.parse(fs, args, 2, 2); err != nil {
+		return err
+	}
+	a, err := openInput(fs.Arg(0), opts)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := openInput(fs.Arg(1), opts)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	d := differ{w: bufio.NewWriter(os.Stdout)}
+	err = d.inputs(a, b)
+	if ferr := d.w.Flush(); err == nil {
+		err = ferr
+	}
+	if err == nil && d.count > 0 {
+		return errFailed
+	}
+	return err
+}
+
+func (d *differ) inputs(a, b *input) error {
+	for i := 0; ; i++ {
+		docA, errA := a.Next()
+		if errA != nil && errA != io.EOF {
+			return fmt.Errorf("%s: record %d: %v", a.name, i, errA)
+		}
+		docB, errB := b.Next()
+		if errB != nil && errB != io.EOF {
+			return fmt.Errorf("%s: record %d: %v", b.name, i, errB)
+		}
+		switch {
+		case errA == io.EOF && errB == io.EOF:
+			return nil
+		case errA == io.EOF:
+			d.count++
+			fmt.Fprintf(d.w, "+ record %d\n", i)
+			continue
+		case errB == io.EOF:
+			d.count++
+			fmt.Fprintf(d.w, "- record %d\n", i)
+			continue
+		}
+		rootA, err := docA.Root()
+		if err != nil {
+			return fmt.Errorf("%s: record %d: %v", a.name, i, err)
+		}
+		rootB, err := docB.Root()
+		if err != nil {
+			return fmt.Errorf("%s: record %d: %v", b.name, i, err)
+		}
+		d.prefix = "record " + strconv.Itoa(i) + ": "
+		if err := d.diff("", rootA, rootB); err != nil {
+			return fmt.Errorf("record %d: %v", i, err)
+		}
+	}
+}
+
+func joinPath(path, elem string) string {
+	if path == "" {
+		return elem
+	}
+	return path + "." + elem
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+func (d *differ) diff(path string, a, b flexbuffers.Reference) error {
+	switch {
+	case a.IsMap() && b.IsMap():
+		return d.diffMaps(path, a, b)
+	case a.IsAnyVector() && b.IsAnyVector():
+		return d.diffVectors(path, a, b)
+	}
+	sa, sb := a.String(), b.String()
+	if sa != sb {
+		d.count++
+		fmt.Fprintf(d.w, "%s~ %s: %s -> %s\n", d.prefix, displayPath(path), sa, sb)
+	}
+	return nil
+}
+
+type diffEntry struct {
+	values [2]flexbuffers.Reference
+	has    [2]bool
+}
+
+func (d *differ) diffMaps(path string, a, b flexbuffers.Reference) error {
+	entries := map[string]*diffEntry{}
+	var keys []string
+	collect := func(side int) func(key string, v flexbuffers.Reference) error {
+		return func(key string, v flexbuffers.Reference) error {
+			e, ok := entries[key]
+			if !ok {
+				e = &diffEntry{}
+				entries[key] = e
+				keys = append(keys, key)
+			}
+			e.values[side], e.has[side] = v, true
+			return nil
+		}
+	}
+	if err := forEachEntry(a, collect(0)); err != nil {
+		return err
+	}
+	if err := forEachEntry(b, collect(1)); err != nil {
+		return err
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e := entries[key]
+		p := joinPath(path, key)
+		switch {
+		case !e.has[1]:
+			d.count++
+			fmt.Fprintf(d.w, "%s- %s: %s\n", d.prefix, p, e.values[0].String())
+		case !e.has[0]:
+			d.count++
+			fmt.Fprintf(d.w, "%s+ %s: %s\n", d.prefix, p, e.values[1].String())
+		default:
+			if err := d.diff(p, e.values[0], e.values[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *differ) diffVectors(path string, a, b flexbuffers.Reference) error {
+	va, err := a.AnyVector()
+	if err != nil {
+		return err
+	}
+	vb, err := b.AnyVector()
+	if err != nil {
+		return err
+	}
+	la, err := va.Size()
+	if err != nil {
+		return err
+	}
+	lb, err := vb.Size()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < la || i < lb; i++ {
+		p := joinPath(path, strconv.Itoa(i))
+		switch {
+		case i >= lb:
+			ea, err := va.At(i)
+			if err != nil {
+				return err
+			}
+			d.count++
+			fmt.Fprintf(d.w, "%s- %s: %s\n", d.prefix, p, ea.String())
+		case i >= la:
+			eb, err := vb.At(i)
+			if err != nil {
+				return err
+			}
+			d.count++
+			fmt.Fprintf(d.w, "%s+ %s: %s\n", d.prefix, p, eb.String())
+		default:
+			ea, err := va.At(i)
+			if err != nil {
+				return err
+			}
+			eb, err := vb.At(i)
+			if err != nil {
+				return err
+			}
+			if err := d.diff(p, ea, eb); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
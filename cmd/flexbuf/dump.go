@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"flexbuffers"
+)
+
+func runDump(c *command, args []string) error {
+	var opts inputOptions
+	fs := c.flagSet()
+	opts.register(fs)
+	plain := fs.Bool("plain", false, "print plain hex dump without annotations")
+	if err := c.parse(fs, args, 0, 1); err != nil {
+		return err
+	}
+	in, err := openInput(fs.Arg(0), opts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	invalid := 0
+	err = in.forEach(func(i int, doc flexbuffers.Raw) error {
+		fmt.Fprintf(w, "record %d: %d bytes\n", i, len(doc))
+		if *plain {
+			_, err := fmt.Fprintln(w, hex.Dump(doc))
+			return err
+		}
+		if len(flexbuffers.InvalidSpans(doc.Inspect())) > 0 {
+			invalid++
+		}
+		if err := doc.Dump(w); err != nil {
+			return err
+		}
+		return w.WriteByte('\n')
+	})
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if err == nil && invalid > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %d records have invalid regions\n", in.name, invalid)
+		return errFailed
+	}
+	return err
+}
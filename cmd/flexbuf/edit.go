@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"flexbuffers"
+	"flexbuffers/container"
+	"flexbuffers/process"
+)
+
+// editNode is a tree of edits by path. A node either sets a value, deletes it, or edits its children.
+type editNode struct {
+	set      flexbuffers.Raw
+	del      bool
+	children map[string]*editNode
+}
+
+func (n *editNode) add(path []string, set flexbuffers.Raw, del bool) error {
+	for i, p := range path {
+		if n.set != nil || n.del {
+			return fmt.Errorf("conflicting edits of %s", strings.Join(path[:i], "."))
+		}
+		if n.children == nil {
+			n.children = map[string]*editNode{}
+		}
+		child, ok := n.children[p]
+		if !ok {
+			child = &editNode{}
+			n.children[p] = child
+		}
+		n = child
+	}
+	if n.set != nil || n.del || n.children != nil {
+		return fmt.Errorf("conflicting edits of %s", displayPath(strings.Join(path, ".")))
+	}
+	n.set, n.del = set, del
+	return nil
+}
+
+type setFlag struct{ root *editNode }
+
+func (f setFlag) String() string { return "" }
+
+func (f setFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return fmt.Errorf("must be path=json, but got %s", s)
+	}
+	v, err := process.FromJsonWithOptions([]byte(s[i+1:]), process.JsonInputOptions{Strict: true})
+	if err != nil {
+		return fmt.Errorf("%s: %v", s[:i], err)
+	}
+	return f.root.add(splitPath(s[:i]), v, false)
+}
+
+type deleteFlag struct{ root *editNode }
+
+func (f deleteFlag) String() string { return "" }
+
+func (f deleteFlag) Set(s string) error {
+	path := splitPath(s)
+	if len(path) == 0 {
+		return fmt.Errorf("can't delete the root")
+	}
+	return f.root.add(path, nil, true)
+}
+
+// editor rebuilds a document applying edits. Vectors are rebuilt as untyped vectors.
+type editor struct {
+	w      *process.FlexbuffersWriter
+	reader process.FlexbuffersReader
+}
+
+func runEdit(c *command, args []string) error {
+	var opts inputOptions
+	fs := c.flagSet()
+	opts.register(fs)
+	edits := &editNode{}
+	fs.Var(setFlag{edits}, "set", "set the value at the dotted path to JSON value as path=json, can be repeated")
+	fs.Var(deleteFlag{edits}, "delete", "delete the value at the dotted path, can be repeated")
+	output := fs.String("o", "", "output file, stdout if empty")
+	inPlace := fs.Bool("w", false, "write the result to the input file")
+	if err := c.parse(fs, args, 0, 1); err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+	if *inPlace && (name == "" || name == "-" || *output != "") {
+		fmt.Fprintf(os.Stderr, "flexbuf %s: -w requires an input file and no -o\n", c.name)
+		return errUsage
+	}
+	in, err := openInput(name, opts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if in.archive != nil {
+		return fmt.Errorf("%s: editing archives is not supported, convert it to a stream", in.name)
+	}
+
+	var out *os.File
+	switch {
+	case *inPlace:
+		out, err = ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".*")
+	case *output != "":
+		out, err = os.Create(*output)
+	default:
+		out = os.Stdout
+	}
+	if err != nil {
+		return err
+	}
+	err = edit(in, out, edits)
+	if out != os.Stdout {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if *inPlace {
+			if err == nil {
+				err = os.Rename(out.Name(), name)
+			} else {
+				os.Remove(out.Name())
+			}
+		}
+	}
+	return err
+}
+
+// edit writes edited documents in the framing of the input.
+func edit(in *input, out io.Writer, edits *editNode) error {
+	w := bufio.NewWriter(out)
+	var sw *container.StreamWriter
+	err := in.forEach(func(i int, doc flexbuffers.Raw) error {
+		edited, err := editDocument(doc, edits)
+		if err != nil {
+			return fmt.Errorf("%s: record %d: %v", in.name, i, err)
+		}
+		if in.stream == nil {
+			_, err = w.Write(edited)
+			return err
+		}
+		if sw == nil {
+			// the header of the input is read by the first Next
+			if sw, err = container.NewStreamWriter(w, in.StreamOptions()); err != nil {
+				return err
+			}
+		}
+		return sw.Write(edited)
+	})
+	if err != nil {
+		return err
+	}
+	if in.stream != nil && sw == nil {
+		// keep the header of an empty stream
+		if _, err := container.NewStreamWriter(w, in.StreamOptions()); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func editDocument(doc flexbuffers.Raw, edits *editNode) (flexbuffers.Raw, error) {
+	root, err := doc.Root()
+	if err != nil {
+		return nil, err
+	}
+	b := flexbuffers.NewBuilder()
+	// entries of ordered maps are read in their order, other maps are built sorted as before
+	b.SetOrderedMaps(true)
+	e := editor{w: process.NewFlexbuffersWriter(b)}
+	e.reader.Output = e.w
+	if err := e.write("", root, edits); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
+
+func (e *editor) write(path string, ref flexbuffers.Reference, n *editNode) error {
+	switch {
+	case n == nil:
+		return e.reader.ReadReference(ref)
+	case n.set != nil:
+		return e.reader.ReadBuffer(n.set)
+	case ref.IsMap():
+		return e.writeMap(path, ref, n)
+	case ref.IsAnyVector():
+		return e.writeVector(path, ref, n)
+	default:
+		return fmt.Errorf("%s is not a map or vector", displayPath(path))
+	}
+}
+
+func (e *editor) writeMap(path string, ref flexbuffers.Reference, n *editNode) error {
+	if ext := ref.Ext(); ext != 0 {
+		_ = e.w.PushExt(ext)
+	}
+	ptr, err := e.w.BeginObject()
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	err = forEachEntry(ref, func(key string, v flexbuffers.Reference) error {
+		child := n.children[key]
+		seen[key] = true
+		if child != nil && child.del {
+			return nil
+		}
+		if err := e.w.PushObjectKey(key); err != nil {
+			return err
+		}
+		return e.write(joinPath(path, key), v, child)
+	})
+	if err != nil {
+		return err
+	}
+	// keys to add
+	for _, key := range sortedKeys(n.children) {
+		if seen[key] || n.children[key].del {
+			continue
+		}
+		if err := e.w.PushObjectKey(key); err != nil {
+			return err
+		}
+		if err := e.writeNew(n.children[key]); err != nil {
+			return err
+		}
+	}
+	return e.w.EndObject(ptr)
+}
+
+func (e *editor) writeVector(path string, ref flexbuffers.Reference, n *editNode) error {
+	vec, err := ref.AnyVector()
+	if err != nil {
+		return err
+	}
+	sz, err := vec.Size()
+	if err != nil {
+		return err
+	}
+	for key := range n.children {
+		if i, err := strconv.Atoi(key); err != nil || i < 0 || i >= sz {
+			return fmt.Errorf("%s: %v", joinPath(path, key), flexbuffers.ErrNotFound)
+		}
+	}
+	if ext := ref.Ext(); ext != 0 {
+		_ = e.w.PushExt(ext)
+	}
+	ptr, err := e.w.BeginArray()
+	if err != nil {
+		return err
+	}
+	err = forEachElem(ref, func(i int, v flexbuffers.Reference) error {
+		key := strconv.Itoa(i)
+		child := n.children[key]
+		if child != nil && child.del {
+			return nil
+		}
+		return e.write(joinPath(path, key), v, child)
+	})
+	if err != nil {
+		return err
+	}
+	return e.w.EndArray(ptr)
+}
+
+// writeNew writes a value which doesn't exist in the document, intermediate maps are created.
+func (e *editor) writeNew(n *editNode) error {
+	if n.set != nil {
+		return e.reader.ReadBuffer(n.set)
+	}
+	ptr, err := e.w.BeginObject()
+	if err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(n.children) {
+		if n.children[key].del {
+			continue
+		}
+		if err := e.w.PushObjectKey(key); err != nil {
+			return err
+		}
+		if err := e.writeNew(n.children[key]); err != nil {
+			return err
+		}
+	}
+	return e.w.EndObject(ptr)
+}
+
+func sortedKeys(m map[string]*editNode) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
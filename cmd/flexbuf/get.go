@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"flexbuffers"
+)
+
+func runGet(c *command, args []string) error {
+	var opts inputOptions
+	var jsonOpts jsonOutputOptions
+	var records recordOptions
+	fs := c.flagSet()
+	opts.register(fs)
+	jsonOpts.register(fs)
+	records.register(fs)
+	if err := c.parse(fs, args, 1, 2); err != nil {
+		return err
+	}
+	encOpts, err := jsonOpts.options()
+	if err != nil {
+		return err
+	}
+	path := splitPath(fs.Arg(0))
+	in, err := openInput(fs.Arg(1), opts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := records.apply(in); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	enc := flexbuffers.NewJsonEncoder(w, encOpts)
+	missing := 0
+	err = in.forEach(func(i int, doc flexbuffers.Raw) error {
+		root, err := doc.Root()
+		if err != nil {
+			return fmt.Errorf("%s: record %d: %v", in.name, i, err)
+		}
+		ref, err := root.LookupPath(path...)
+		if err == flexbuffers.ErrNotFound {
+			missing++
+			fmt.Fprintf(os.Stderr, "%s: record %d: %s not found\n", in.name, i, fs.Arg(0))
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: record %d: %v", in.name, i, err)
+		}
+		if err := enc.Encode(ref); err != nil {
+			return err
+		}
+		return w.WriteByte('\n')
+	})
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if err == nil && missing > 0 {
+		return errFailed
+	}
+	return err
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"flexbuffers"
+	"flexbuffers/container"
+)
+
+const (
+	framingAuto    = "auto"
+	framingSingle  = "single"
+	framingStream  = "stream"
+	framingArchive = "archive"
+)
+
+type inputOptions struct {
+	framing       string
+	skipCorrupted bool
+}
+
+func (o *inputOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.framing, "framing", framingAuto, "framing of flexbuffers input: auto, single (one document), stream or archive")
+	fs.BoolVar(&o.skipCorrupted, "skip-corrupted", false, "skip corrupted records, if the stream has sync markers")
+}
+
+// input reads flexbuffers documents from a single document, a stream or an archive.
+type input struct {
+	name    string
+	framing string
+	stream  *container.StreamReader
+	archive *container.Archive
+	// records are the numbers of the records to read from the archive, all records if nil
+	records []int
+	single  flexbuffers.Raw
+	next    int
+	file    *os.File
+}
+
+// openInput opens the file, "-" or empty name is stdin.
+func openInput(name string, opts inputOptions) (*input, error) {
+	in := &input{name: name}
+	var r io.Reader = os.Stdin
+	if name == "" || name == "-" {
+		in.name = "stdin"
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		in.file = f
+		r = f
+	}
+	br := bufio.NewReaderSize(r, 1<<20)
+	in.framing = opts.framing
+	if in.framing == framingAuto {
+		in.framing = detectFraming(br)
+	}
+	var err error
+	switch in.framing {
+	case framingSingle:
+		in.single, err = ioutil.ReadAll(br)
+	case framingStream:
+		in.stream = container.NewStreamReader(br)
+		in.stream.SkipCorrupted = opts.skipCorrupted
+	case framingArchive:
+		if in.file != nil {
+			in.archive, err = container.OpenArchive(name)
+		} else {
+			var data []byte
+			if data, err = ioutil.ReadAll(br); err == nil {
+				in.archive, err = container.NewArchive(data)
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown framing %q", opts.framing)
+	}
+	if err != nil {
+		in.Close()
+		return nil, fmt.Errorf("%s: %v", in.name, err)
+	}
+	return in, nil
+}
+
+// detectFraming guesses the framing by magic numbers. Without magic, the input is a legacy stream
+// if it starts with a valid length prefixed document, otherwise it's a single document.
+func detectFraming(br *bufio.Reader) string {
+	head, err := br.Peek(4)
+	if err != nil {
+		if len(head) == 0 {
+			return framingStream // empty stream
+		}
+		return framingSingle
+	}
+	switch {
+	case bytes.Equal(head, container.ArchiveMagic[:]):
+		return framingArchive
+	case bytes.Equal(head, container.StreamMagic[:]):
+		return framingStream
+	}
+	n := int(binary.BigEndian.Uint32(head))
+	if n <= 2 || n > br.Size()-4 {
+		return framingSingle
+	}
+	rec, err := br.Peek(4 + n)
+	if err != nil || flexbuffers.Raw(rec[4:]).Validate() != nil {
+		return framingSingle
+	}
+	return framingStream
+}
+
+// Next returns the next document, or io.EOF.
+func (in *input) Next() (flexbuffers.Raw, error) {
+	defer func() { in.next++ }()
+	switch {
+	case in.stream != nil:
+		return in.stream.Next()
+	case in.archive != nil:
+		if in.records != nil {
+			if in.next >= len(in.records) {
+				return nil, io.EOF
+			}
+			return in.archive.Record(in.records[in.next])
+		}
+		if in.next >= in.archive.Len() {
+			return nil, io.EOF
+		}
+		return in.archive.Record(in.next)
+	default:
+		if in.next > 0 {
+			return nil, io.EOF
+		}
+		return in.single, nil
+	}
+}
+
+// selectRecords makes Next read only the records of the numbers, found by -find-index or given by -record.
+// The input must be an archive.
+func (in *input) selectRecords(flag string, records []int) error {
+	if in.archive == nil {
+		return fmt.Errorf("%s requires an archive input", flag)
+	}
+	for _, i := range records {
+		if i < 0 || i >= in.archive.Len() {
+			return fmt.Errorf("%s: record %d: not in the %d records of the archive", in.name, i, in.archive.Len())
+		}
+	}
+	in.records = append([]int{}, records...)
+	return nil
+}
+
+// recordOptions select records of an archive input by -record or -find-index.
+type recordOptions struct {
+	record int
+	index  string
+	key    string
+}
+
+func (o *recordOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.record, "record", -1, "read only the record of the number of the input archive")
+	fs.StringVar(&o.index, "find-index", "", "read only records of -find-key in the secondary index of the input archive")
+	fs.StringVar(&o.key, "find-key", "", "key to find by -find-index")
+}
+
+// apply selects the records of the input, all records are read if no flag is given.
+func (o *recordOptions) apply(in *input) error {
+	switch {
+	case o.record >= 0 && o.index != "":
+		return fmt.Errorf("-record and -find-index can't be used together")
+	case o.record >= 0:
+		return in.selectRecords("-record", []int{o.record})
+	case o.index != "":
+		if in.archive == nil {
+			return fmt.Errorf("-find-index requires an archive input")
+		}
+		records, err := in.archive.Find(o.index, o.key)
+		if err != nil {
+			return err
+		}
+		return in.selectRecords("-find-index", records)
+	}
+	return nil
+}
+
+// StreamOptions returns options to write a stream of the same format, it is available after the first call of Next.
+func (in *input) StreamOptions() container.StreamOptions {
+	if in.stream == nil {
+		return container.StreamOptions{Legacy: true}
+	}
+	return container.StreamOptions{
+		Legacy:     in.stream.Legacy(),
+		Flags:      in.stream.Flags(),
+		Dictionary: in.stream.Dictionary(),
+	}
+}
+
+func (in *input) Close() error {
+	if in.stream != nil && in.stream.Skipped() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %d corrupted records skipped\n", in.name, in.stream.Skipped())
+	}
+	if in.archive != nil {
+		_ = in.archive.Close()
+	}
+	if in.file != nil {
+		return in.file.Close()
+	}
+	return nil
+}
+
+// forEach calls fn with each document and its record number.
+func (in *input) forEach(fn func(i int, doc flexbuffers.Raw) error) error {
+	for n := 0; ; n++ {
+		i := n
+		if in.records != nil && n < len(in.records) {
+			i = in.records[n]
+		}
+		doc, err := in.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: record %d: %v", in.name, i, err)
+		}
+		if err := fn(i, doc); err != nil {
+			return err
+		}
+	}
+}
+
+// splitPath splits a dotted path, empty path is the root.
+func splitPath(path string) []string {
+	if path == "" || path == "." {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// forEachEntry calls fn with each key and value of the map.
+func forEachEntry(ref flexbuffers.Reference, fn func(key string, v flexbuffers.Reference) error) error {
+	m, err := ref.Map()
+	if err != nil {
+		return err
+	}
+	keys, err := m.Keys()
+	if err != nil {
+		return err
+	}
+	sz, err := m.Size()
+	if err != nil {
+		return err
+	}
+	var order []int
+	if m.Ordered() {
+		if order, err = m.AppendOrder(nil); err != nil {
+			return err
+		}
+	}
+	values := m.Values()
+	var k, v flexbuffers.Reference
+	for i := 0; i < sz; i++ {
+		idx := i
+		if order != nil {
+			idx = order[i]
+		}
+		if err := keys.AtRef(idx, &k); err != nil {
+			return err
+		}
+		key, err := k.Key()
+		if err != nil {
+			return err
+		}
+		if err := values.AtRef(idx, &v); err != nil {
+			return err
+		}
+		if err := fn(key.StringValue(), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachElem calls fn with each element of the vector.
+func forEachElem(ref flexbuffers.Reference, fn func(i int, v flexbuffers.Reference) error) error {
+	vec, err := ref.AnyVector()
+	if err != nil {
+		return err
+	}
+	sz, err := vec.Size()
+	if err != nil {
+		return err
+	}
+	var v flexbuffers.Reference
+	for i := 0; i < sz; i++ {
+		if err := vec.AtRef(i, &v); err != nil {
+			return err
+		}
+		if err := fn(i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
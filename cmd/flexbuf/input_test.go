@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers"
+	"flexbuffers/container"
+)
+
+// writeTestArchive writes an archive of documents {"id":i*10,"name":name} indexed by name.
+func writeTestArchive(t *testing.T, dir string, names ...string) string {
+	name := filepath.Join(dir, "test.fba")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := container.NewArchiveWriter(f, container.IndexSpec{Name: "name", Path: []string{"name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range names {
+		b := flexbuffers.NewBuilder()
+		b.Map(func(b *flexbuffers.Builder) {
+			b.IntField([]byte("id"), int64(i*10))
+			b.StringValueField([]byte("name"), n)
+		})
+		if err := b.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(b.Buffer()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestInput_SelectRecords(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "flexbuf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive := writeTestArchive(t, dir, "foo", "bar", "foo")
+	out := filepath.Join(dir, "out.json")
+	convert := func(args ...string) (string, error) {
+		args = append([]string{"-o", out}, args...)
+		if err := runConvert(commands[0], append(args, archive)); err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadFile(out)
+		return string(data), err
+	}
+
+	json, err := convert("-record", "1")
+	if a.NoError(err) {
+		a.Equal(`{"id":10,"name":"bar"}`+"\n", json)
+	}
+	json, err = convert("-find-index", "name", "-find-key", "foo")
+	if a.NoError(err) {
+		a.Equal(`{"id":0,"name":"foo"}`+"\n"+`{"id":20,"name":"foo"}`+"\n", json)
+	}
+	_, err = convert("-record", "3")
+	a.EqualError(err, archive+": record 3: not in the 3 records of the archive")
+	_, err = convert("-record", "0", "-find-index", "name")
+	a.Error(err)
+
+	// record numbers are the numbers in the archive
+	in, err := openInput(archive, inputOptions{framing: framingAuto})
+	if !a.NoError(err) {
+		return
+	}
+	defer in.Close()
+	a.NoError(in.selectRecords("-record", []int{2}))
+	var records []int
+	a.NoError(in.forEach(func(i int, doc flexbuffers.Raw) error {
+		records = append(records, i)
+		a.Equal(int64(20), doc.RootOrNull().AsMap().GetOrNull("id").AsInt64())
+		return nil
+	}))
+	a.Equal([]int{2}, records)
+
+	// -find-index selects records for get as for convert
+	in2, err := openInput(archive, inputOptions{framing: framingAuto})
+	if !a.NoError(err) {
+		return
+	}
+	defer in2.Close()
+	a.NoError((&recordOptions{record: -1, index: "name", key: "bar"}).apply(in2))
+	records = nil
+	a.NoError(in2.forEach(func(i int, doc flexbuffers.Raw) error {
+		records = append(records, i)
+		return nil
+	}))
+	a.Equal([]int{1}, records)
+
+	// other inputs have no record index
+	single := filepath.Join(dir, "single.fb")
+	if err := ioutil.WriteFile(single, flexbuffers.Raw{1, 4, 1}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	in, err = openInput(single, inputOptions{framing: framingAuto})
+	if a.NoError(err) {
+		a.EqualError(in.selectRecords("-record", []int{0}), "-record requires an archive input")
+		a.EqualError((&recordOptions{record: -1, index: "name"}).apply(in), "-find-index requires an archive input")
+		in.Close()
+	}
+}
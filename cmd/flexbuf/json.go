@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"flexbuffers"
+)
+
+type jsonOutputOptions struct {
+	indent    string
+	sortKeys  bool
+	nan       string
+	blob      string
+	ext       bool
+	extended  bool
+	numberExt int64
+}
+
+func (o *jsonOutputOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.indent, "indent", "", "pretty-print JSON output with the indent for each level")
+	fs.BoolVar(&o.sortKeys, "sort-keys", false, "write map entries of JSON output sorted by keys")
+	fs.StringVar(&o.nan, "nan", "null", "how NaN and Inf are written in JSON output: null, string or error")
+	fs.StringVar(&o.blob, "blob", "base64", "how blobs are written in JSON output: base64, hex or array")
+	fs.BoolVar(&o.ext, "ext", false, `write values with ext as {"$ext":n,"value":...} in JSON output`)
+	fs.BoolVar(&o.extended, "extended", false, `use extended JSON keeping FlexBuffers types, like {"$uint":1}, for JSON input and output`)
+	fs.Int64Var(&o.numberExt, "number-ext", 0, "keep big and decimal JSON numbers exactly as strings with the ext, and write them back as numbers")
+}
+
+func (o *jsonOutputOptions) options() (flexbuffers.JsonOptions, error) {
+	opts := flexbuffers.JsonOptions{Indent: o.indent, Ext: o.ext, Extended: o.extended, NumberExt: o.numberExt}
+	if o.sortKeys {
+		opts.KeyOrder = flexbuffers.KeyOrderSorted
+	}
+	switch o.nan {
+	case "null":
+		opts.NaN = flexbuffers.NaNAsNull
+	case "string":
+		opts.NaN = flexbuffers.NaNAsString
+	case "error":
+		opts.NaN = flexbuffers.NaNAsError
+	default:
+		return opts, fmt.Errorf("unknown NaN policy %q", o.nan)
+	}
+	switch o.blob {
+	case "base64":
+		opts.Blob = flexbuffers.BlobBase64
+	case "hex":
+		opts.Blob = flexbuffers.BlobHex
+	case "array":
+		opts.Blob = flexbuffers.BlobArray
+	default:
+		return opts, fmt.Errorf("unknown blob encoding %q", o.blob)
+	}
+	return opts, nil
+}
@@ -0,0 +1,118 @@
+// Command flexbuf converts, inspects and edits flexbuffers documents.
+//
+// Each command reads a single document, a stream of documents (see container.StreamReader) or an archive.
+// The framing of the input is detected automatically, -framing overrides it.
+//
+// Exit status is 0 on success, 1 on errors or when invalid documents or differences are found, and 2 on wrong usage.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+var (
+	// errFailed is returned by commands which have already reported the failure, like invalid documents.
+	errFailed = errors.New("failed")
+	// errUsage is returned when the usage has already been printed.
+	errUsage = errors.New("usage")
+)
+
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(c *command, args []string) error
+}
+
+var commands = []*command{
+	{name: "convert", args: "[flags] [file]", short: "convert documents between flexbuffers, JSON, BSON, MessagePack and Arrow", run: runConvert},
+	{name: "get", args: "[flags] path [file]", short: "print the value at the dotted path of each document as JSON", run: runGet},
+	{name: "validate", args: "[flags] [file...]", short: "validate documents", run: runValidate},
+	{name: "dump", args: "[flags] [file]", short: "print annotated hex dump of documents", run: runDump},
+	{name: "stats", args: "[flags] [file...]", short: "print statistics of documents", run: runStats},
+	{name: "diff", args: "[flags] file1 file2", short: "compare documents of two inputs", run: runDiff},
+	{name: "edit", args: "[flags] [file]", short: "set or delete values of documents", run: runEdit},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: flexbuf <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.short)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Use "flexbuf <command> -h" for flags of the command. File "-" or no file means stdin.`)
+}
+
+// flagSet returns a flag set which reports errors instead of exiting.
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: flexbuf %s %s\n\n%s.\n\nflags:\n", c.name, c.args, c.short)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses flags, and checks the number of positional arguments is in [min, max], max < 0 means unlimited.
+func (c *command) parse(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		fmt.Fprintf(os.Stderr, "flexbuf %s: wrong number of arguments\n", c.name)
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(c, args[1:])
+		switch err {
+		case nil, flag.ErrHelp:
+			return exitOK
+		case errUsage:
+			return exitUsage
+		case errFailed:
+			return exitFailure
+		default:
+			fmt.Fprintf(os.Stderr, "flexbuf %s: %v\n", c.name, err)
+			return exitFailure
+		}
+	}
+	fmt.Fprintf(os.Stderr, "flexbuf: unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
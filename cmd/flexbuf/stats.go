@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+
+	"flexbuffers"
+)
+
+type stats struct {
+	documents int
+	bytes     int
+	minSize   int
+	maxSize   int
+	maxDepth  int
+	types     map[flexbuffers.Type]int
+	keys      map[string]int
+}
+
+func runStats(c *command, args []string) error {
+	var opts inputOptions
+	fs := c.flagSet()
+	opts.register(fs)
+	top := fs.Int("top", 20, "number of the most frequent keys to print")
+	if err := c.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	s := stats{types: map[flexbuffers.Type]int{}, keys: map[string]int{}}
+	for _, name := range names {
+		in, err := openInput(name, opts)
+		if err != nil {
+			return err
+		}
+		err = in.forEach(func(i int, doc flexbuffers.Raw) error {
+			root, err := doc.Root()
+			if err == nil {
+				err = s.walk(root, 1)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: record %d: %v", in.name, i, err)
+			}
+			s.add(len(doc))
+			return nil
+		})
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+	w := bufio.NewWriter(os.Stdout)
+	s.print(w, *top)
+	return w.Flush()
+}
+
+func (s *stats) add(size int) {
+	if s.documents == 0 || size < s.minSize {
+		s.minSize = size
+	}
+	if size > s.maxSize {
+		s.maxSize = size
+	}
+	s.documents++
+	s.bytes += size
+}
+
+func (s *stats) walk(ref flexbuffers.Reference, depth int) error {
+	s.types[ref.Type()]++
+	if depth > s.maxDepth {
+		s.maxDepth = depth
+	}
+	switch {
+	case ref.IsMap():
+		return forEachEntry(ref, func(key string, v flexbuffers.Reference) error {
+			s.keys[key]++
+			return s.walk(v, depth+1)
+		})
+	case ref.IsAnyVector():
+		return forEachElem(ref, func(i int, v flexbuffers.Reference) error {
+			return s.walk(v, depth+1)
+		})
+	}
+	return nil
+}
+
+func (s *stats) print(w *bufio.Writer, top int) {
+	fmt.Fprintf(w, "documents: %d\n", s.documents)
+	fmt.Fprintf(w, "bytes:     %d\n", s.bytes)
+	if s.documents > 0 {
+		fmt.Fprintf(w, "size:      min %d, avg %d, max %d\n", s.minSize, s.bytes/s.documents, s.maxSize)
+	}
+	fmt.Fprintf(w, "max depth: %d\n", s.maxDepth)
+
+	types := make([]flexbuffers.Type, 0, len(s.types))
+	for t := range s.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	fmt.Fprintln(w, "\nvalues by type:")
+	for _, t := range types {
+		fmt.Fprintf(w, "  %-18s %d\n", t.String(), s.types[t])
+	}
+
+	keys := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if s.keys[keys[i]] != s.keys[keys[j]] {
+			return s.keys[keys[i]] > s.keys[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > top {
+		keys = keys[:top]
+	}
+	fmt.Fprintf(w, "\nkeys: %d distinct\n", len(s.keys))
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %-18q %d\n", k, s.keys[k])
+	}
+}
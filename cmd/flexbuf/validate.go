@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func runValidate(c *command, args []string) error {
+	var opts inputOptions
+	fs := c.flagSet()
+	opts.register(fs)
+	quiet := fs.Bool("q", false, "print only the summary")
+	if err := c.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	var total, invalid int
+	for _, name := range names {
+		in, err := openInput(name, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			invalid++
+			continue
+		}
+		for i := 0; ; i++ {
+			doc, err := in.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// the framing is broken, following records can't be read
+				fmt.Printf("%s: record %d: %v\n", in.name, i, err)
+				invalid++
+				break
+			}
+			total++
+			errs := doc.ValidateAll()
+			if len(errs) > 0 {
+				invalid++
+			}
+			if !*quiet {
+				for _, err := range errs {
+					fmt.Printf("%s: record %d: %v\n", in.name, i, err)
+				}
+			}
+		}
+		in.Close()
+	}
+	fmt.Printf("%d documents, %d invalid\n", total, invalid)
+	if invalid > 0 {
+		return errFailed
+	}
+	return nil
+}
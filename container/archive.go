@@ -0,0 +1,474 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"flexbuffers"
+)
+
+// An archive is a seekable file of documents. All integers are little-endian.
+//
+//	header:  magic (4 bytes) | version (1 byte) | reserved (3 bytes)
+//	records: documents, each one is aligned to 8 bytes
+//	record table: offset (uint64) | length (uint64) for each record
+//	secondary indexes (see IndexSpec), each one is aligned to 8 bytes:
+//	  name length (uint32) | name | path count (uint32) | (element length (uint32) | element) for each path element |
+//	  entry count (uint64) | padding to 8 bytes |
+//	  key offset (uint64) | key length (uint32) | record (uint32) for each entry sorted by key and record | keys
+//	index directory: offset (uint64) for each secondary index
+//	footer (40 bytes): record table offset (uint64) | record count (uint64) | index directory offset (uint64) |
+//	  index count (uint32) | reserved (8 bytes) | magic (4 bytes)
+const (
+	ArchiveVersion    = 1
+	archiveHeaderSize = 8
+	archiveFooterSize = 40
+)
+
+var ArchiveMagic = [4]byte{0x89, 'F', 'B', 'A'}
+
+var (
+	ErrNotArchive = errors.New("not an archive")
+	ErrNoIndex    = errors.New("no such index")
+)
+
+// IndexSpec defines a secondary index, records are indexed by the value found by Path (see flexbuffers.Raw.Lookup).
+// Records whose value is not a scalar are not indexed.
+type IndexSpec struct {
+	Name string
+	Path []string
+}
+
+// IndexKey returns a key of secondary indexes for a value. Strings are used as is, and other scalars are formatted
+// as text, e.g. "123", "true".
+func IndexKey(r flexbuffers.Reference) (string, bool) {
+	switch {
+	case r.IsString():
+		s, err := r.StringRef()
+		if err != nil {
+			return "", false
+		}
+		v, err := s.StringValue()
+		return v, err == nil
+	case r.IsKey():
+		k, err := r.Key()
+		if err != nil {
+			return "", false
+		}
+		return k.StringValue(), true
+	case r.IsInt():
+		v, err := r.Int64()
+		return strconv.FormatInt(v, 10), err == nil
+	case r.IsUInt():
+		v, err := r.UInt64()
+		return strconv.FormatUint(v, 10), err == nil
+	case r.IsFloat():
+		v, err := r.Float64()
+		return strconv.FormatFloat(v, 'g', -1, 64), err == nil
+	case r.IsBool():
+		v, err := r.Bool()
+		return strconv.FormatBool(v), err == nil
+	default:
+		return "", false
+	}
+}
+
+type indexEntry struct {
+	key    string
+	record int
+}
+
+type indexBuilder struct {
+	spec    IndexSpec
+	entries []indexEntry
+}
+
+// ArchiveWriter writes an archive. Records and keys of secondary indexes are kept in memory until Close.
+type ArchiveWriter struct {
+	w       io.Writer
+	offset  uint64
+	records []uint64
+	indexes []indexBuilder
+	closed  bool
+}
+
+// NewArchiveWriter creates ArchiveWriter and writes the header.
+func NewArchiveWriter(w io.Writer, indexes ...IndexSpec) (*ArchiveWriter, error) {
+	aw := &ArchiveWriter{w: w}
+	for _, spec := range indexes {
+		aw.indexes = append(aw.indexes, indexBuilder{spec: spec})
+	}
+	header := [archiveHeaderSize]byte{}
+	copy(header[:], ArchiveMagic[:])
+	header[4] = ArchiveVersion
+	if err := aw.write(header[:]); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (w *ArchiveWriter) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.offset += uint64(n)
+	return err
+}
+
+func (w *ArchiveWriter) align() error {
+	var pad [8]byte
+	if r := w.offset % 8; r != 0 {
+		return w.write(pad[:8-r])
+	}
+	return nil
+}
+
+// Write appends a document and returns its record number.
+func (w *ArchiveWriter) Write(doc flexbuffers.Raw) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("archive is closed")
+	}
+	record := len(w.records) / 2
+	if record > 0xFFFFFFFF {
+		return 0, fmt.Errorf("too many records")
+	}
+	if err := w.align(); err != nil {
+		return 0, err
+	}
+	offset := w.offset
+	if err := w.write(doc); err != nil {
+		return 0, err
+	}
+	// the record is added to the table and indexes once it's written
+	w.records = append(w.records, offset, uint64(len(doc)))
+	for i := range w.indexes {
+		idx := &w.indexes[i]
+		ref, err := doc.Lookup(idx.spec.Path...)
+		if err != nil {
+			continue
+		}
+		if key, ok := IndexKey(ref); ok {
+			idx.entries = append(idx.entries, indexEntry{key: key, record: record})
+		}
+	}
+	return record, nil
+}
+
+// Close writes indexes and the footer. It doesn't close the underlying writer.
+func (w *ArchiveWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.align(); err != nil {
+		return err
+	}
+	var footer [archiveFooterSize]byte
+	binary.LittleEndian.PutUint64(footer[0:], w.offset)
+	binary.LittleEndian.PutUint64(footer[8:], uint64(len(w.records)/2))
+	buf := make([]byte, 8*len(w.records))
+	for i, v := range w.records {
+		binary.LittleEndian.PutUint64(buf[i*8:], v)
+	}
+	if err := w.write(buf); err != nil {
+		return err
+	}
+
+	directory := make([]byte, 0, 8*len(w.indexes))
+	for i := range w.indexes {
+		if err := w.align(); err != nil {
+			return err
+		}
+		directory = appendUint64(directory, w.offset)
+		if err := w.writeIndex(&w.indexes[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.align(); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(footer[16:], w.offset)
+	binary.LittleEndian.PutUint32(footer[24:], uint32(len(w.indexes)))
+	copy(footer[36:], ArchiveMagic[:])
+	if err := w.write(directory); err != nil {
+		return err
+	}
+	return w.write(footer[:])
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	return append(b, tmp[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], v)
+	return append(b, tmp[:]...)
+}
+
+func (w *ArchiveWriter) writeIndex(idx *indexBuilder) error {
+	sort.SliceStable(idx.entries, func(i, j int) bool {
+		return idx.entries[i].key < idx.entries[j].key
+	})
+	buf := appendUint32(nil, uint32(len(idx.spec.Name)))
+	buf = append(buf, idx.spec.Name...)
+	buf = appendUint32(buf, uint32(len(idx.spec.Path)))
+	for _, p := range idx.spec.Path {
+		buf = appendUint32(buf, uint32(len(p)))
+		buf = append(buf, p...)
+	}
+	buf = appendUint64(buf, uint64(len(idx.entries)))
+	for (w.offset+uint64(len(buf)))%8 != 0 {
+		buf = append(buf, 0)
+	}
+	keyOffset := w.offset + uint64(len(buf)) + 16*uint64(len(idx.entries))
+	for _, e := range idx.entries {
+		buf = appendUint64(buf, keyOffset)
+		buf = appendUint32(buf, uint32(len(e.key)))
+		buf = appendUint32(buf, uint32(e.record))
+		keyOffset += uint64(len(e.key))
+	}
+	for _, e := range idx.entries {
+		buf = append(buf, e.key...)
+	}
+	return w.write(buf)
+}
+
+type archiveIndex struct {
+	spec    IndexSpec
+	entries []byte
+	count   int
+}
+
+// Archive provides random access to records of an archive.
+type Archive struct {
+	data    []byte
+	unmap   func() error
+	table   []byte
+	count   int
+	indexes []archiveIndex
+}
+
+// OpenArchive opens an archive file. The file is mapped to memory if the platform supports it.
+func OpenArchive(path string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, unmap, err := mapFile(f)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewArchive(data)
+	if err != nil {
+		_ = unmap()
+		return nil, err
+	}
+	a.unmap = unmap
+	return a, nil
+}
+
+// NewArchive reads an archive in memory.
+func NewArchive(data []byte) (*Archive, error) {
+	if len(data) < archiveHeaderSize+archiveFooterSize ||
+		!bytes.Equal(data[:4], ArchiveMagic[:]) || !bytes.Equal(data[len(data)-4:], ArchiveMagic[:]) {
+		return nil, ErrNotArchive
+	}
+	if data[4] != ArchiveVersion {
+		return nil, fmt.Errorf("%w: %d", ErrVersion, data[4])
+	}
+	footer := data[len(data)-archiveFooterSize:]
+	tableOffset := binary.LittleEndian.Uint64(footer[0:])
+	count := binary.LittleEndian.Uint64(footer[8:])
+	dirOffset := binary.LittleEndian.Uint64(footer[16:])
+	indexCount := uint64(binary.LittleEndian.Uint32(footer[24:]))
+	a := &Archive{data: data}
+	var err error
+	if count > uint64(len(data))/16 {
+		return nil, fmt.Errorf("%w: record count", ErrCorrupted)
+	}
+	if a.table, err = a.slice(tableOffset, count*16); err != nil {
+		return nil, err
+	}
+	a.count = int(count)
+	if indexCount > uint64(len(data))/8 {
+		return nil, fmt.Errorf("%w: index count", ErrCorrupted)
+	}
+	dir, err := a.slice(dirOffset, indexCount*8)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(indexCount); i++ {
+		idx, err := a.readIndex(binary.LittleEndian.Uint64(dir[i*8:]))
+		if err != nil {
+			return nil, err
+		}
+		a.indexes = append(a.indexes, idx)
+	}
+	return a, nil
+}
+
+func (a *Archive) slice(offset, length uint64) ([]byte, error) {
+	if offset > uint64(len(a.data)) || length > uint64(len(a.data))-offset {
+		return nil, fmt.Errorf("%w: offset %d is out of range", ErrCorrupted, offset)
+	}
+	return a.data[offset : offset+length], nil
+}
+
+func (a *Archive) readIndex(offset uint64) (archiveIndex, error) {
+	var idx archiveIndex
+	readUint32 := func() (uint32, error) {
+		b, err := a.slice(offset, 4)
+		if err != nil {
+			return 0, err
+		}
+		offset += 4
+		return binary.LittleEndian.Uint32(b), nil
+	}
+	readString := func() (string, error) {
+		l, err := readUint32()
+		if err != nil {
+			return "", err
+		}
+		b, err := a.slice(offset, uint64(l))
+		if err != nil {
+			return "", err
+		}
+		offset += uint64(l)
+		return string(b), nil
+	}
+	var err error
+	if idx.spec.Name, err = readString(); err != nil {
+		return idx, err
+	}
+	pathCount, err := readUint32()
+	if err != nil {
+		return idx, err
+	}
+	for i := uint32(0); i < pathCount; i++ {
+		p, err := readString()
+		if err != nil {
+			return idx, err
+		}
+		idx.spec.Path = append(idx.spec.Path, p)
+	}
+	b, err := a.slice(offset, 8)
+	if err != nil {
+		return idx, err
+	}
+	count := binary.LittleEndian.Uint64(b)
+	offset += 8
+	offset += (8 - offset%8) % 8
+	if count > uint64(len(a.data))/16 {
+		return idx, fmt.Errorf("%w: entry count", ErrCorrupted)
+	}
+	if idx.entries, err = a.slice(offset, count*16); err != nil {
+		return idx, err
+	}
+	idx.count = int(count)
+	return idx, nil
+}
+
+// Close releases the memory mapping, records returned by the archive must not be used after Close.
+func (a *Archive) Close() error {
+	if a.unmap == nil {
+		return nil
+	}
+	err := a.unmap()
+	a.unmap = nil
+	a.data = nil
+	return err
+}
+
+func (a *Archive) Len() int {
+	return a.count
+}
+
+// Record returns i-th record without copying. It must not be modified, since the file may be mapped read-only.
+func (a *Archive) Record(i int) (flexbuffers.Raw, error) {
+	if i < 0 || i >= a.count {
+		return nil, flexbuffers.ErrOutOfRange
+	}
+	offset := binary.LittleEndian.Uint64(a.table[i*16:])
+	length := binary.LittleEndian.Uint64(a.table[i*16+8:])
+	b, err := a.slice(offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return b[:len(b):len(b)], nil
+}
+
+// Indexes returns secondary indexes of the archive.
+func (a *Archive) Indexes() []IndexSpec {
+	specs := make([]IndexSpec, len(a.indexes))
+	for i, idx := range a.indexes {
+		specs[i] = idx.spec
+	}
+	return specs
+}
+
+func (a *Archive) index(name string) (*archiveIndex, error) {
+	for i := range a.indexes {
+		if a.indexes[i].spec.Name == name {
+			return &a.indexes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoIndex, name)
+}
+
+func (a *Archive) entryKey(idx *archiveIndex, i int) ([]byte, error) {
+	e := idx.entries[i*16:]
+	return a.slice(binary.LittleEndian.Uint64(e), uint64(binary.LittleEndian.Uint32(e[8:])))
+}
+
+// Find returns record numbers whose key of the index equals to key, in ascending order.
+func (a *Archive) Find(index, key string) ([]int, error) {
+	idx, err := a.index(index)
+	if err != nil {
+		return nil, err
+	}
+	var searchErr error
+	i := sort.Search(idx.count, func(i int) bool {
+		k, err := a.entryKey(idx, i)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return string(k) >= key
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	var records []int
+	for ; i < idx.count; i++ {
+		k, err := a.entryKey(idx, i)
+		if err != nil {
+			return nil, err
+		}
+		if string(k) != key {
+			break
+		}
+		records = append(records, int(binary.LittleEndian.Uint32(idx.entries[i*16+12:])))
+	}
+	return records, nil
+}
+
+// Lookup returns the first record whose key of the index equals to key. It returns flexbuffers.ErrNotFound if no
+// records are found.
+func (a *Archive) Lookup(index, key string) (flexbuffers.Raw, error) {
+	records, err := a.Find(index, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, flexbuffers.ErrNotFound
+	}
+	return a.Record(records[0])
+}
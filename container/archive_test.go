@@ -0,0 +1,187 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers"
+)
+
+func archiveDocs(t *testing.T) []flexbuffers.Raw {
+	var docs []flexbuffers.Raw
+	names := []string{"foo", "bar", "foo", ""}
+	for i, name := range names {
+		b := flexbuffers.NewBuilder()
+		b.Map(func(b *flexbuffers.Builder) {
+			b.IntField([]byte("id"), int64(i*10))
+			if name != "" {
+				b.MapField([]byte("user"), func(b *flexbuffers.Builder) {
+					b.StringValueField([]byte("name"), name)
+				})
+			}
+		})
+		if err := b.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, append(flexbuffers.Raw(nil), b.Buffer()...))
+	}
+	return docs
+}
+
+func writeArchive(t *testing.T, docs []flexbuffers.Raw, indexes ...IndexSpec) []byte {
+	var buf bytes.Buffer
+	w, err := NewArchiveWriter(&buf, indexes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, d := range docs {
+		n, err := w.Write(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Fatalf("expected record number %d, but got %d", i, n)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchive(t *testing.T) {
+	a := assert.New(t)
+	docs := archiveDocs(t)
+	data := writeArchive(t, docs,
+		IndexSpec{Name: "id", Path: []string{"id"}},
+		IndexSpec{Name: "name", Path: []string{"user", "name"}},
+	)
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.fba")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := OpenArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	a.Equal(len(docs), ar.Len())
+	for i, d := range docs {
+		r, err := ar.Record(i)
+		if a.NoError(err) {
+			a.Equal(d, r)
+		}
+	}
+	_, err = ar.Record(len(docs))
+	a.Equal(flexbuffers.ErrOutOfRange, err)
+	a.Equal([]IndexSpec{
+		{Name: "id", Path: []string{"id"}},
+		{Name: "name", Path: []string{"user", "name"}},
+	}, ar.Indexes())
+
+	records, err := ar.Find("name", "foo")
+	a.NoError(err)
+	a.Equal([]int{0, 2}, records)
+	records, err = ar.Find("name", "baz")
+	a.NoError(err)
+	a.Empty(records)
+	r, err := ar.Lookup("id", "10")
+	if a.NoError(err) {
+		a.Equal(docs[1], r)
+		a.Equal("bar", r.LookupOrNull("user", "name").AsStringRef().StringValueOrEmpty())
+	}
+	_, err = ar.Lookup("id", "11")
+	a.Equal(flexbuffers.ErrNotFound, err)
+	_, err = ar.Find("nope", "1")
+	a.True(errors.Is(err, ErrNoIndex))
+	a.NoError(ar.Close())
+}
+
+func TestArchive_Empty(t *testing.T) {
+	a := assert.New(t)
+	ar, err := NewArchive(writeArchive(t, nil, IndexSpec{Name: "id", Path: []string{"id"}}))
+	if a.NoError(err) {
+		a.Equal(0, ar.Len())
+		records, err := ar.Find("id", "0")
+		a.NoError(err)
+		a.Empty(records)
+	}
+}
+
+func TestArchive_Errors(t *testing.T) {
+	a := assert.New(t)
+	_, err := NewArchive([]byte("not an archive"))
+	a.Equal(ErrNotArchive, err)
+
+	data := writeArchive(t, archiveDocs(t), IndexSpec{Name: "id", Path: []string{"id"}})
+	broken := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint64(broken[len(broken)-archiveFooterSize:], uint64(len(data)))
+	_, err = NewArchive(broken)
+	a.True(errors.Is(err, ErrCorrupted))
+
+	broken = append([]byte(nil), data...)
+	binary.LittleEndian.PutUint64(broken[len(broken)-archiveFooterSize+16:], 1<<40)
+	_, err = NewArchive(broken)
+	a.True(errors.Is(err, ErrCorrupted))
+}
+
+// failingWriter fails the writes while fail is set, without writing anything.
+type failingWriter struct {
+	bytes.Buffer
+	fail bool
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errors.New("write failed")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestArchiveWriter_FailedWrite(t *testing.T) {
+	a := assert.New(t)
+	docs := archiveDocs(t)
+	var buf failingWriter
+	w, err := NewArchiveWriter(&buf, IndexSpec{Name: "name", Path: []string{"user", "name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write(docs[0])
+	a.NoError(err)
+	buf.fail = true
+	_, err = w.Write(docs[1])
+	a.Error(err)
+	buf.fail = false
+	n, err := w.Write(docs[2])
+	a.NoError(err)
+	a.Equal(1, n)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed record is neither in the record table nor in the indexes
+	ar, err := NewArchive(buf.Bytes())
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(2, ar.Len())
+	records, err := ar.Find("name", "bar")
+	a.NoError(err)
+	a.Empty(records)
+	records, err = ar.Find("name", "foo")
+	a.NoError(err)
+	a.Equal([]int{0, 1}, records)
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package container
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+func mapFile(f *os.File) ([]byte, func() error, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
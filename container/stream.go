@@ -0,0 +1,443 @@
+// Package container provides file formats to store sequence of flexbuffers documents.
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"flexbuffers"
+	"flexbuffers/pkg/lz4"
+)
+
+// A stream is a sequence of records. Legacy streams (the format json2fb used to produce) have no header, and each
+// record is a big-endian uint32 length followed by a document.
+//
+// Streams with header begin with:
+//
+//	magic (4 bytes) | version (1 byte) | flags (1 byte) | sync marker (SyncMarkerSize bytes, only if FlagSync) |
+//	dictionary length (uvarint) and dictionary (only if FlagDictionary)
+//
+// and each record is:
+//
+//	sync marker (only if FlagSync) | length (uvarint if FlagVarint, big-endian uint32 otherwise) | payload |
+//	CRC32C of length and payload (big-endian uint32, only if FlagChecksum)
+//
+// The payload is a document, or its size (uvarint) and LZ4 compressed block of it if FlagCompressed.
+const (
+	StreamVersion  = 1
+	SyncMarkerSize = 8
+	// DefaultMaxRecordSize is used to detect broken length.
+	DefaultMaxRecordSize = 1 << 30
+)
+
+// StreamMagic has the high bit set to make it never be a valid length of legacy streams.
+var StreamMagic = [4]byte{0x89, 'F', 'B', 'S'}
+
+type Flags uint8
+
+const (
+	FlagVarint Flags = 1 << iota
+	FlagChecksum
+	FlagSync
+	// FlagCompressed compresses each record by LZ4, with the dictionary in the header if FlagDictionary.
+	FlagCompressed
+	FlagDictionary
+)
+
+var (
+	ErrChecksum       = errors.New("checksum mismatch")
+	ErrCorrupted      = errors.New("corrupted record")
+	ErrVersion        = errors.New("unsupported stream version")
+	ErrRecordTooLarge = errors.New("record too large")
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+type StreamOptions struct {
+	// Legacy writes no header, and Flags are ignored. Use it to produce streams for old readers.
+	Legacy bool
+	Flags  Flags
+	// Dictionary is a preset dictionary for compression (see lz4.TrainDictionary), it implies FlagCompressed.
+	Dictionary []byte
+}
+
+// StreamWriter writes records to a stream. It doesn't buffer output, wrap the writer by bufio.Writer if needed.
+type StreamWriter struct {
+	w          io.Writer
+	flags      Flags
+	legacy     bool
+	syncMarker [SyncMarkerSize]byte
+	buf        []byte
+	compressor *lz4.Compressor
+	payload    []byte
+}
+
+// NewStreamWriter creates StreamWriter and writes stream header.
+func NewStreamWriter(w io.Writer, opts StreamOptions) (*StreamWriter, error) {
+	sw := &StreamWriter{w: w, flags: opts.Flags, legacy: opts.Legacy}
+	if sw.legacy {
+		sw.flags = 0
+		return sw, nil
+	}
+	sw.flags &^= FlagDictionary
+	if len(opts.Dictionary) > 0 {
+		sw.flags |= FlagCompressed | FlagDictionary
+	}
+	if sw.flags&FlagCompressed != 0 {
+		sw.compressor = lz4.NewCompressor(opts.Dictionary)
+	}
+	header := append(append([]byte(nil), StreamMagic[:]...), StreamVersion, byte(sw.flags))
+	if sw.flags&FlagSync != 0 {
+		if _, err := io.ReadFull(rand.Reader, sw.syncMarker[:]); err != nil {
+			return nil, err
+		}
+		header = append(header, sw.syncMarker[:]...)
+	}
+	if sw.flags&FlagDictionary != 0 {
+		var tmp [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(tmp[:], uint64(len(opts.Dictionary)))
+		header = append(append(header, tmp[:n]...), opts.Dictionary...)
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (w *StreamWriter) Flags() Flags {
+	return w.flags
+}
+
+func (w *StreamWriter) Write(doc flexbuffers.Raw) error {
+	if w.compressor != nil {
+		var tmp [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(tmp[:], uint64(len(doc)))
+		w.payload = w.compressor.Compress(append(w.payload[:0], tmp[:n]...), doc)
+		doc = w.payload
+	}
+	if w.legacy || w.flags&FlagVarint == 0 {
+		if uint64(len(doc)) > 0xFFFFFFFF {
+			return ErrRecordTooLarge
+		}
+	}
+	buf := w.buf[:0]
+	if w.flags&FlagSync != 0 {
+		buf = append(buf, w.syncMarker[:]...)
+	}
+	lenStart := len(buf)
+	if w.flags&FlagVarint != 0 {
+		var tmp [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(tmp[:], uint64(len(doc)))
+		buf = append(buf, tmp[:n]...)
+	} else {
+		var tmp [4]byte
+		binary.BigEndian.PutUint32(tmp[:], uint32(len(doc)))
+		buf = append(buf, tmp[:]...)
+	}
+	w.buf = buf
+	// header, document and checksum are written separately to avoid copying document
+	if _, err := w.w.Write(buf); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(doc); err != nil {
+		return err
+	}
+	if w.flags&FlagChecksum != 0 {
+		var tmp [4]byte
+		binary.BigEndian.PutUint32(tmp[:], crc32.Update(crc32.Checksum(buf[lenStart:], crc32c), crc32c, doc))
+		if _, err := w.w.Write(tmp[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamReader reads records from a stream written by StreamWriter, or a legacy stream.
+type StreamReader struct {
+	// MaxRecordSize limits length of records, DefaultMaxRecordSize is used if zero.
+	MaxRecordSize int
+	// SkipCorrupted skips corrupted records by searching next sync marker, instead of returning errors.
+	// It works only for streams written with FlagSync.
+	SkipCorrupted bool
+
+	r          *bufio.Reader
+	started    bool
+	legacy     bool
+	flags      Flags
+	syncMarker [SyncMarkerSize]byte
+	dictionary []byte
+	// bytes consumed by the current record, they are scanned again on resynchronisation
+	consumed []byte
+	track    bool
+	payload  []byte
+	pending  []byte
+	skipped  int
+}
+
+func NewStreamReader(r io.Reader) *StreamReader {
+	return &StreamReader{r: bufio.NewReader(r)}
+}
+
+// Flags returns flags of the stream, it is available after the first call of Next.
+func (r *StreamReader) Flags() Flags {
+	return r.flags
+}
+
+// Legacy reports whether the stream has no header, it is available after the first call of Next.
+func (r *StreamReader) Legacy() bool {
+	return r.legacy
+}
+
+// Skipped returns the number of corrupted records skipped by SkipCorrupted.
+func (r *StreamReader) Skipped() int {
+	return r.skipped
+}
+
+func (r *StreamReader) readHeader() error {
+	r.started = true
+	head, err := r.r.Peek(len(StreamMagic))
+	if err == io.EOF || (err == nil && !bytes.Equal(head, StreamMagic[:])) {
+		r.legacy = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var header [6]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if header[4] != StreamVersion {
+		return fmt.Errorf("%w: %d", ErrVersion, header[4])
+	}
+	r.flags = Flags(header[5])
+	if r.flags&FlagSync != 0 {
+		if _, err := io.ReadFull(r.r, r.syncMarker[:]); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	if r.flags&FlagDictionary != 0 {
+		l, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if l > lz4.MaxDictionarySize {
+			return fmt.Errorf("%w: dictionary too large", ErrCorrupted)
+		}
+		r.dictionary = make([]byte, l)
+		if _, err := io.ReadFull(r.r, r.dictionary); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	return nil
+}
+
+// Dictionary returns the compression dictionary of the stream, it is available after the first call of Next.
+func (r *StreamReader) Dictionary() []byte {
+	return r.dictionary
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readByte reads pending bytes first, then underlying reader. Read bytes are recorded to consumed.
+func (r *StreamReader) readByte() (byte, error) {
+	var c byte
+	if len(r.pending) > 0 {
+		c = r.pending[0]
+		r.pending = r.pending[1:]
+	} else {
+		var err error
+		if c, err = r.r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	if r.track {
+		r.consumed = append(r.consumed, c)
+	}
+	return c, nil
+}
+
+func (r *StreamReader) readFull(p []byte) error {
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	if n < len(p) {
+		m, err := io.ReadFull(r.r, p[n:])
+		n += m
+		if err != nil {
+			if r.track {
+				r.consumed = append(r.consumed, p[:n]...)
+			}
+			if n > 0 {
+				return unexpectedEOF(err)
+			}
+			return err
+		}
+	}
+	if r.track {
+		r.consumed = append(r.consumed, p...)
+	}
+	return nil
+}
+
+// Next returns the next record. It returns io.EOF at the end of stream.
+// Returned buffer is newly allocated for each record.
+func (r *StreamReader) Next() (flexbuffers.Raw, error) {
+	return r.NextInto(nil)
+}
+
+// NextInto is like Next, but the record is read (or decompressed) into buf if it has enough capacity.
+// It avoids allocations when the previous record is no longer used.
+func (r *StreamReader) NextInto(buf []byte) (flexbuffers.Raw, error) {
+	if !r.started {
+		if err := r.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		doc, err := r.next(buf)
+		if err == nil || err == io.EOF || !r.SkipCorrupted || r.flags&FlagSync == 0 {
+			return doc, err
+		}
+		r.skipped++
+		if err := r.resync(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *StreamReader) next(buf []byte) (flexbuffers.Raw, error) {
+	r.consumed = r.consumed[:0]
+	// the length is always tracked for checksum, but the document only if it might be scanned again
+	r.track = true
+	if r.flags&FlagSync != 0 {
+		var marker [SyncMarkerSize]byte
+		if err := r.readFull(marker[:]); err != nil {
+			return nil, err
+		}
+		if marker != r.syncMarker {
+			return nil, fmt.Errorf("%w: sync marker not found", ErrCorrupted)
+		}
+	}
+	lenStart := len(r.consumed)
+	var length uint64
+	if r.flags&FlagVarint != 0 {
+		var err error
+		length, err = binary.ReadUvarint(byteReaderFunc(r.readByte))
+		if err != nil {
+			if len(r.consumed) > 0 {
+				err = unexpectedEOF(err)
+			}
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				err = fmt.Errorf("%w: %s", ErrCorrupted, err)
+			}
+			return nil, err
+		}
+	} else {
+		var tmp [4]byte
+		if err := r.readFull(tmp[:]); err != nil {
+			if err == io.EOF && len(r.consumed) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint32(tmp[:]))
+	}
+	maxSize := r.MaxRecordSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxRecordSize
+	}
+	if length > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: length %d", ErrRecordTooLarge, length)
+	}
+	lenEnd := len(r.consumed)
+	r.track = r.SkipCorrupted && r.flags&FlagSync != 0
+	var doc []byte
+	if r.flags&FlagCompressed != 0 {
+		if cap(r.payload) < int(length) {
+			r.payload = make([]byte, length)
+		}
+		doc = r.payload[:length]
+	} else if cap(buf) >= int(length) {
+		doc = buf[:length]
+	} else {
+		doc = make([]byte, length)
+	}
+	if err := r.readFull(doc); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if r.flags&FlagChecksum != 0 {
+		var tmp [4]byte
+		if err := r.readFull(tmp[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		crc := crc32.Update(crc32.Checksum(r.consumed[lenStart:lenEnd], crc32c), crc32c, doc)
+		if crc != binary.BigEndian.Uint32(tmp[:]) {
+			return nil, ErrChecksum
+		}
+	}
+	if r.flags&FlagCompressed != 0 {
+		return r.decompress(buf, doc, maxSize)
+	}
+	return doc, nil
+}
+
+// resync skips bytes until the next sync marker, the marker is left to be read by next.
+func (r *StreamReader) resync() error {
+	// the first byte is the beginning of broken record, start from next of it
+	if len(r.consumed) > 0 {
+		r.pending = append(append([]byte(nil), r.consumed[1:]...), r.pending...)
+	}
+	for {
+		if i := bytes.Index(r.pending, r.syncMarker[:]); i >= 0 {
+			r.pending = r.pending[i:]
+			return nil
+		}
+		// keep a possible prefix of the marker
+		if len(r.pending) >= SyncMarkerSize {
+			r.pending = r.pending[len(r.pending)-SyncMarkerSize+1:]
+		}
+		buf := make([]byte, 4096)
+		n, err := r.r.Read(buf)
+		r.pending = append(r.pending, buf[:n]...)
+		if err == io.EOF {
+			if n == 0 {
+				r.pending = nil
+				return io.EOF
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+type byteReaderFunc func() (byte, error)
+
+func (f byteReaderFunc) ReadByte() (byte, error) {
+	return f()
+}
+
+func (r *StreamReader) decompress(buf, payload []byte, maxSize int) (flexbuffers.Raw, error) {
+	size, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: broken size", ErrCorrupted)
+	}
+	if size > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: length %d", ErrRecordTooLarge, size)
+	}
+	doc, err := lz4.Decompress(buf, payload[n:], r.dictionary, int(size))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,203 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers"
+	"flexbuffers/pkg/lz4"
+)
+
+func testDocs(t *testing.T) []flexbuffers.Raw {
+	var docs []flexbuffers.Raw
+	for i := 0; i < 3; i++ {
+		b := flexbuffers.NewBuilder()
+		b.Map(func(b *flexbuffers.Builder) {
+			b.IntField([]byte("id"), int64(i))
+			b.StringValueField([]byte("name"), "record")
+		})
+		if err := b.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, append(flexbuffers.Raw(nil), b.Buffer()...))
+	}
+	return docs
+}
+
+func writeStream(t *testing.T, opts StreamOptions, docs []flexbuffers.Raw) []byte {
+	var buf bytes.Buffer
+	w, err := NewStreamWriter(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range docs {
+		if err := w.Write(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func readStream(r *StreamReader) ([]flexbuffers.Raw, error) {
+	var docs []flexbuffers.Raw
+	for {
+		d, err := r.Next()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return docs, err
+		}
+		docs = append(docs, d)
+	}
+}
+
+func TestStream_RoundTrip(t *testing.T) {
+	a := assert.New(t)
+	docs := testDocs(t)
+	cases := []StreamOptions{
+		{Legacy: true},
+		{},
+		{Flags: FlagVarint},
+		{Flags: FlagChecksum},
+		{Flags: FlagSync},
+		{Flags: FlagVarint | FlagChecksum | FlagSync},
+		{Flags: FlagCompressed},
+		{Flags: FlagVarint | FlagChecksum | FlagSync | FlagCompressed},
+	}
+	for _, opts := range cases {
+		data := writeStream(t, opts, docs)
+		r := NewStreamReader(bytes.NewReader(data))
+		actual, err := readStream(r)
+		if a.NoError(err, "%+v", opts) {
+			a.Equal(docs, actual, "%+v", opts)
+		}
+		a.Equal(opts.Legacy, r.Legacy())
+		a.Equal(opts.Flags, r.Flags())
+	}
+}
+
+func TestStream_Legacy(t *testing.T) {
+	a := assert.New(t)
+	docs := testDocs(t)
+	// the format written by json2fb
+	var buf bytes.Buffer
+	for _, d := range docs {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(d)))
+		buf.Write(d)
+	}
+	a.Equal(buf.Bytes(), writeStream(t, StreamOptions{Legacy: true}, docs))
+	actual, err := readStream(NewStreamReader(&buf))
+	a.NoError(err)
+	a.Equal(docs, actual)
+
+	actual, err = readStream(NewStreamReader(bytes.NewReader(nil)))
+	a.NoError(err)
+	a.Empty(actual)
+}
+
+func TestStream_Errors(t *testing.T) {
+	a := assert.New(t)
+	docs := testDocs(t)
+
+	data := writeStream(t, StreamOptions{Flags: FlagChecksum}, docs)
+	data[len(data)-6] ^= 0xff
+	actual, err := readStream(NewStreamReader(bytes.NewReader(data)))
+	a.True(errors.Is(err, ErrChecksum))
+	a.Len(actual, 2)
+
+	data = writeStream(t, StreamOptions{}, docs)
+	_, err = readStream(NewStreamReader(bytes.NewReader(data[:len(data)-1])))
+	a.Equal(io.ErrUnexpectedEOF, err)
+
+	data = writeStream(t, StreamOptions{}, docs)
+	data[4] = 99
+	_, err = readStream(NewStreamReader(bytes.NewReader(data)))
+	a.True(errors.Is(err, ErrVersion))
+
+	data = writeStream(t, StreamOptions{Legacy: true}, docs)
+	r := NewStreamReader(bytes.NewReader(data))
+	r.MaxRecordSize = 8
+	_, err = readStream(r)
+	a.True(errors.Is(err, ErrRecordTooLarge))
+}
+
+func TestStream_Resync(t *testing.T) {
+	a := assert.New(t)
+	docs := testDocs(t)
+	headerSize := len(StreamMagic) + 2 + SyncMarkerSize
+	recordSize := SyncMarkerSize + 1 + len(docs[0]) + 4
+	cases := []struct {
+		name    string
+		corrupt func(data []byte)
+	}{
+		{"document", func(data []byte) { data[headerSize+recordSize+SyncMarkerSize+3] ^= 0xff }},
+		{"length", func(data []byte) { data[headerSize+recordSize+SyncMarkerSize] = 0x7f }},
+		{"marker", func(data []byte) { data[headerSize+recordSize] ^= 0xff }},
+	}
+	for _, cas := range cases {
+		data := writeStream(t, StreamOptions{Flags: FlagVarint | FlagChecksum | FlagSync}, docs)
+		cas.corrupt(data)
+
+		_, err := readStream(NewStreamReader(bytes.NewReader(data)))
+		a.Error(err, cas.name)
+
+		r := NewStreamReader(bytes.NewReader(data))
+		r.SkipCorrupted = true
+		actual, err := readStream(r)
+		if a.NoError(err, cas.name) {
+			a.Equal([]flexbuffers.Raw{docs[0], docs[2]}, actual, cas.name)
+		}
+		a.Equal(1, r.Skipped(), cas.name)
+	}
+
+	// truncated tail
+	data := writeStream(t, StreamOptions{Flags: FlagSync}, docs)
+	r := NewStreamReader(bytes.NewReader(data[:len(data)-3]))
+	r.SkipCorrupted = true
+	actual, err := readStream(r)
+	a.NoError(err)
+	a.Equal(docs[:2], actual)
+}
+
+func TestStream_Compressed(t *testing.T) {
+	a := assert.New(t)
+	docs := testDocs(t)
+	samples := make([][]byte, len(docs))
+	for i, d := range docs {
+		samples[i] = d
+	}
+	dict := lz4.TrainDictionary(samples, 1024)
+	a.NotEmpty(dict)
+	data := writeStream(t, StreamOptions{Flags: FlagChecksum | FlagSync, Dictionary: dict}, docs)
+
+	r := NewStreamReader(bytes.NewReader(data))
+	buf := make([]byte, 0, 1024)
+	for i := range docs {
+		doc, err := r.NextInto(buf)
+		if !a.NoError(err) {
+			return
+		}
+		a.Equal(docs[i], doc)
+		a.True(&buf[:1][0] == &doc[:1][0], "buffer should be reused")
+		a.Equal(int64(i), doc.LookupOrNull("id").AsInt64())
+	}
+	_, err := r.NextInto(buf)
+	a.Equal(io.EOF, err)
+	a.Equal(FlagChecksum|FlagSync|FlagCompressed|FlagDictionary, r.Flags())
+	a.Equal(dict, r.Dictionary())
+
+	// compressed records are smaller with the dictionary
+	a.True(len(data) < len(writeStream(t, StreamOptions{Flags: FlagChecksum | FlagSync | FlagCompressed}, docs)))
+
+	// broken payload without checksum
+	data = writeStream(t, StreamOptions{Flags: FlagSync, Dictionary: dict}, docs)
+	r = NewStreamReader(bytes.NewReader(data[:len(data)-1]))
+	_, err = readStream(r)
+	a.Error(err)
+}
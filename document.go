@@ -0,0 +1,141 @@
+package flexbuffers
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Document holds a buffer which is safe to read while it is updated. Readers get a Snapshot, which is never
+// modified. Writers update a copy of the current version by Update, which is published as a new version at once,
+// so readers see either all or none of the changes of an update.
+type Document struct {
+	// mu serializes writers, readers don't lock
+	mu      sync.Mutex
+	current atomic.Value // *Snapshot
+}
+
+// Snapshot is a version of a Document. The buffer of a snapshot is never modified, it can be read concurrently.
+type Snapshot struct {
+	raw     Raw
+	version uint64
+}
+
+// NewDocument returns a document with a copy of raw as version 0.
+func NewDocument(raw Raw) *Document {
+	d := &Document{}
+	d.current.Store(&Snapshot{raw: append(Raw(nil), raw...)})
+	return d
+}
+
+// Snapshot returns the current version.
+func (d *Document) Snapshot() *Snapshot {
+	return d.current.Load().(*Snapshot)
+}
+
+// Update calls fn with a batch of changes to the current version, and publishes the changed buffer as the next
+// version. If fn returns an error, nothing is published. Updates are serialized, readers are not blocked.
+// Update returns the published snapshot, or the current one if fn changed nothing or failed.
+func (d *Document) Update(fn func(b *Batch) error) (*Snapshot, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cur := d.Snapshot()
+	b := Batch{raw: cur.raw}
+	if err := fn(&b); err != nil {
+		return cur, err
+	}
+	if !b.changed {
+		return cur, nil
+	}
+	s := &Snapshot{raw: b.raw, version: cur.version + 1}
+	d.current.Store(s)
+	return s, nil
+}
+
+// Set updates the value at the path in a new version, see Batch.Set.
+func (d *Document) Set(path []string, v interface{}) (*Snapshot, error) {
+	return d.Update(func(b *Batch) error {
+		return b.Set(path, v)
+	})
+}
+
+// Raw returns the buffer of the snapshot, which must not be modified.
+func (s *Snapshot) Raw() Raw {
+	return s.raw
+}
+
+// Version starts at 0 and is incremented by each update publishing changes.
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Root returns the root of the snapshot, whose values must not be modified.
+func (s *Snapshot) Root() (Reference, error) {
+	return s.raw.Root()
+}
+
+// Lookup returns the value at the path of map keys and vector indexes, the same paths as Batch.Set.
+func (s *Snapshot) Lookup(path ...string) (Reference, error) {
+	root, err := s.Root()
+	if err != nil {
+		return Reference{}, err
+	}
+	return root.LookupPath(path...)
+}
+
+// Batch is the changes of a Document.Update. Values are updated in place in a copy of the current version, made on
+// the first change. Structural changes, like adding keys or growing values, build a new buffer and Replace the
+// batch's one.
+type Batch struct {
+	raw Raw
+	// changed is true once raw is the batch's own copy, or a replacement
+	changed bool
+}
+
+// Root returns the root of the batch's buffer with the changes so far. It's a view of the current version until
+// the first change, so its values must not be modified; use Set, or MutableRoot to update values in place.
+func (b *Batch) Root() (Reference, error) {
+	return b.raw.Root()
+}
+
+// MutableRoot returns the root of the batch's copy, whose values can be updated by Set and its family, or Mutate
+// methods.
+func (b *Batch) MutableRoot() (Reference, error) {
+	b.own()
+	return b.raw.Root()
+}
+
+// Raw returns the buffer of the batch, with the changes so far. It must not be modified unless through MutableRoot.
+func (b *Batch) Raw() Raw {
+	return b.raw
+}
+
+// Set updates the value at the path in place, see Set. Path elements are map keys or vector indexes.
+// Values which don't fit fail with *UpdateError, rebuild the buffer and Replace it to change them.
+func (b *Batch) Set(path []string, v interface{}) error {
+	root, err := b.Root()
+	if err != nil {
+		return err
+	}
+	ref, err := root.LookupPath(path...)
+	if err != nil {
+		return err
+	}
+	// the value is at the same offset in the copy
+	b.own()
+	ref.data_ = b.raw
+	return Set(ref, v)
+}
+
+// Replace replaces the buffer of the batch by raw, which must not be modified afterwards.
+func (b *Batch) Replace(raw Raw) {
+	b.raw = raw
+	b.changed = true
+}
+
+// own copies the buffer on the first change.
+func (b *Batch) own() {
+	if !b.changed {
+		b.raw = append(Raw(nil), b.raw...)
+		b.changed = true
+	}
+}
@@ -0,0 +1,213 @@
+package flexbuffers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocument(t *testing.T) {
+	a := assert.New(t)
+	jsonOf := func(raw Raw) string {
+		root, err := raw.Root()
+		a.NoError(err)
+		return root.String()
+	}
+	b := NewBuilder()
+	a.NoError(b.SetIndirectScalars(8, "hits"))
+	b.Map(func(b *Builder) {
+		b.IntField([]byte("hits"), 0)
+		b.VectorField([]byte("v"), false, false, func(b *Builder) {
+			b.Int(1)
+			b.StringValue("abc")
+		})
+	})
+	a.NoError(b.Finish())
+	doc := NewDocument(b.Buffer())
+	first := doc.Snapshot()
+	a.Equal(uint64(0), first.Version())
+
+	s, err := doc.Update(func(b *Batch) error {
+		if err := b.Set([]string{"hits"}, 1000); err != nil {
+			return err
+		}
+		return b.Set([]string{"v", "1"}, "xyz")
+	})
+	a.NoError(err)
+	a.Equal(uint64(1), s.Version())
+	a.Equal(s, doc.Snapshot())
+	a.Equal(`{"hits":1000,"v":[1,"xyz"]}`, jsonOf(s.Raw()))
+	// the old snapshot is not changed
+	a.Equal(`{"hits":0,"v":[1,"abc"]}`, jsonOf(first.Raw()))
+
+	// failed updates publish nothing
+	s, err = doc.Update(func(b *Batch) error {
+		if err := b.Set([]string{"v", "1"}, "---"); err != nil {
+			return err
+		}
+		return b.Set([]string{"v", "0"}, 1000)
+	})
+	a.True(errors.Is(err, ErrUpdateDoesntFit))
+	a.Equal(uint64(1), s.Version())
+	a.Equal(`{"hits":1000,"v":[1,"xyz"]}`, jsonOf(doc.Snapshot().Raw()))
+	_, err = doc.Set([]string{"missing"}, 1)
+	a.Equal(ErrNotFound, err)
+	_, err = doc.Set([]string{"v", "x"}, 1)
+	a.Equal(ErrNotFound, err)
+
+	// structural changes replace the buffer
+	s, err = doc.Update(func(b *Batch) error {
+		root, err := b.Root()
+		if err != nil {
+			return err
+		}
+		nb := NewBuilder()
+		nb.Map(func(nb *Builder) {
+			nb.IntField([]byte("hits"), root.AsMap().GetOrNull("hits").AsInt64())
+			nb.IntField([]byte("misses"), 1)
+		})
+		if err := nb.Finish(); err != nil {
+			return err
+		}
+		b.Replace(nb.Buffer())
+		return b.Set([]string{"misses"}, 2)
+	})
+	a.NoError(err)
+	a.Equal(uint64(2), s.Version())
+	a.Equal(`{"hits":1000,"misses":2}`, jsonOf(s.Raw()))
+	ref, err := s.Lookup("misses")
+	a.NoError(err)
+	a.Equal(int64(2), ref.AsInt64())
+
+	// updates without changes keep the version
+	s, err = doc.Update(func(b *Batch) error { return nil })
+	a.NoError(err)
+	a.Equal(uint64(2), s.Version())
+
+	// reads and missing paths don't copy the buffer
+	s, err = doc.Update(func(b *Batch) error {
+		root, err := b.Root()
+		if err != nil {
+			return err
+		}
+		a.Equal(int64(1000), root.AsMap().GetOrNull("hits").AsInt64())
+		a.Equal(ErrNotFound, b.Set([]string{"missing"}, 1))
+		a.True(&b.Raw()[0] == &doc.Snapshot().Raw()[0])
+		return nil
+	})
+	a.NoError(err)
+	a.Equal(uint64(2), s.Version())
+
+	// values of the mutable root are updated in place
+	s, err = doc.Update(func(b *Batch) error {
+		root, err := b.MutableRoot()
+		if err != nil {
+			return err
+		}
+		ref, err := root.LookupPath("misses")
+		if err != nil {
+			return err
+		}
+		return ref.MutateInt(3)
+	})
+	a.NoError(err)
+	a.Equal(uint64(3), s.Version())
+	a.Equal(`{"hits":1000,"misses":3}`, jsonOf(s.Raw()))
+}
+
+func TestDocument_Concurrent(t *testing.T) {
+	b := NewBuilder()
+	if err := b.SetIndirectScalars(8); err != nil {
+		t.Fatal(err)
+	}
+	b.Map(func(b *Builder) {
+		b.IntField([]byte("a"), 0)
+		b.IntField([]byte("b"), 0)
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	doc := NewDocument(b.Buffer())
+	const n = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				s := doc.Snapshot()
+				root, err := s.Root()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				m := root.AsMap()
+				// both counters are updated by each version
+				x, y := m.GetOrNull("a").AsInt64(), m.GetOrNull("b").AsInt64()
+				if x != int64(s.Version())<<32 || y != -x {
+					t.Errorf("version %d: a = %d, b = %d", s.Version(), x, y)
+					return
+				}
+				if s.Version() == n {
+					return
+				}
+			}
+		}()
+	}
+	for i := 1; i <= n; i++ {
+		_, err := doc.Update(func(b *Batch) error {
+			if err := b.Set([]string{"a"}, int64(i)<<32); err != nil {
+				return err
+			}
+			return b.Set([]string{"b"}, -int64(i)<<32)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestDocument_Lookup(t *testing.T) {
+	a := assert.New(t)
+	b := NewBuilder()
+	b.Map(func(b *Builder) {
+		b.VectorField([]byte("tv"), true, false, func(b *Builder) {
+			b.Int(1)
+			b.Int(2)
+		})
+		b.VectorField([]byte("v"), false, false, func(b *Builder) {
+			b.Map(func(b *Builder) {
+				b.StringValueField([]byte("s"), "abc")
+			})
+		})
+	})
+	a.NoError(b.Finish())
+	doc := NewDocument(b.Buffer())
+
+	// snapshots read the paths written by Set
+	s, err := doc.Set([]string{"tv", "1"}, 7)
+	a.NoError(err)
+	ref, err := s.Lookup("tv", "1")
+	if a.NoError(err) {
+		a.Equal(int64(7), ref.AsInt64())
+	}
+	s, err = doc.Set([]string{"v", "0", "s"}, "xyz")
+	a.NoError(err)
+	ref, err = s.Lookup("v", "0", "s")
+	if a.NoError(err) {
+		str, err := ref.AsStringRef().StringValue()
+		a.NoError(err)
+		a.Equal("xyz", str)
+	}
+	ref, err = s.Lookup()
+	if a.NoError(err) {
+		a.True(ref.IsMap())
+	}
+	_, err = s.Lookup("tv", "2")
+	a.Error(err)
+	_, err = s.Lookup("tv", "x")
+	a.Equal(ErrNotFound, err)
+}
@@ -59,6 +59,65 @@ func TestExtReadWrite(t *testing.T) {
 				a.Equal(int64(-123), sRef.Ext())
 			},
 		},
+		{
+			name: "ext of the first element vector",
+			buildFn: func(b *Builder) {
+				b.Vector(false, false, func(b *Builder) {
+					b.Ext(3)
+					b.Vector(false, false, func(b *Builder) {
+						b.Int(1)
+					})
+					b.Ext(4)
+					b.Map(func(b *Builder) {})
+				})
+			},
+			assertFn: func(a *assert.Assertions, r Raw) {
+				root, err := r.Root()
+				if !a.NoError(err) {
+					return
+				}
+				a.Equal(int64(0), root.Ext())
+				a.Equal(int64(3), root.AsVector().AtOrNull(0).Ext())
+				a.Equal(int64(4), root.AsVector().AtOrNull(1).Ext())
+			},
+		},
+		{
+			name: "ext of the vector starting with a vector",
+			buildFn: func(b *Builder) {
+				b.Ext(5)
+				b.Vector(false, false, func(b *Builder) {
+					b.Vector(false, false, func(b *Builder) {
+						b.Map(func(b *Builder) {})
+					})
+				})
+			},
+			assertFn: func(a *assert.Assertions, r Raw) {
+				root, err := r.Root()
+				if !a.NoError(err) {
+					return
+				}
+				a.Equal(int64(5), root.Ext())
+				a.Equal(int64(0), root.AsVector().AtOrNull(0).Ext())
+			},
+		},
+		{
+			name: "long blob with large ext",
+			buildFn: func(b *Builder) {
+				b.Ext(-1 << 62)
+				b.Blob(make([]byte, 300))
+			},
+			assertFn: func(a *assert.Assertions, r Raw) {
+				root, err := r.Root()
+				if !a.NoError(err) {
+					return
+				}
+				a.NoError(r.Validate())
+				sRef := root.AsBlob()
+				a.Len(sRef.DataOrEmpty(), 300)
+				a.Equal(int64(-1<<62), sRef.Ext())
+				a.Equal(int64(-1<<62), root.Ext())
+			},
+		},
 		{
 			name: "vector with ext",
 			buildFn: func(b *Builder) {
@@ -126,6 +185,9 @@ func TestExtReadWrite(t *testing.T) {
 				a.Equal(int64(789), v.GetOrNull("c").Ext())
 				a.Equal(int64(789), v.GetOrNull("c").AsVector().Ext())
 				a.Equal(int64(-456), v.Ext())
+				a.Equal(int64(123), r.LookupOrNull("a").Ext())
+				a.Equal(int64(789), r.LookupOrNull("c").Ext())
+				a.NoError(r.Validate())
 			},
 		},
 	}
@@ -2,7 +2,8 @@ package flexbuffers
 
 import "C"
 import (
-	"bytes"
+	"encoding/binary"
+	"math"
 	"reflect"
 	"sort"
 	"unsafe"
@@ -13,6 +14,11 @@ const (
 	MetaBit                     uint8 = 1 << 7
 )
 
+// ExtOrderedMap is the ext stored by maps which keep the order their entries were added in, see
+// Builder.SetOrderedMaps. It's followed by the ext of the map and the indexes of entries in the order they were
+// added, as varints. It's reserved, and cannot be the ext of values.
+const ExtOrderedMap int64 = math.MinInt64
+
 type BitWidth uint8
 
 func (b BitWidth) ByteWidth() uint8 {
@@ -87,7 +93,7 @@ func IsInline(t Type) bool {
 }
 
 func IsTypedVectorElementType(t Type) bool {
-	return (t >= FBTInt && t == FBTString) || t == FBTBool
+	return (t >= FBTInt && t <= FBTString) || t == FBTBool
 }
 
 func IsTypedVector(t Type) bool {
@@ -103,11 +109,11 @@ func ToTypedVector(t Type, fixedLen int) Type {
 	switch fixedLen {
 	case 0:
 		return t - FBTInt + FBTVectorInt
-	case 1:
-		return t - FBTInt + FBTVectorInt2
 	case 2:
-		return t - FBTInt + FBTVectorInt3
+		return t - FBTInt + FBTVectorInt2
 	case 3:
+		return t - FBTInt + FBTVectorInt3
+	case 4:
 		return t - FBTInt + FBTVectorInt4
 	default:
 		return FBTNull
@@ -175,6 +181,7 @@ type Object struct {
 	offset    int
 	byteWidth uint8
 	ext       int64
+	dict      *KeyDictionary
 }
 
 func (o Object) Ext() int64 {
@@ -268,7 +275,7 @@ func (s String) UnsafeStringValue() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if s.offset < 0 || len(s.buf) <= s.offset || len(s.buf)-s.offset < size {
+	if s.offset < 0 || size < 0 || len(s.buf) <= s.offset || len(s.buf)-s.offset < size {
 		return "", ErrOutOfRange
 	}
 	var sh reflect.StringHeader
@@ -278,12 +285,11 @@ func (s String) UnsafeStringValue() (string, error) {
 }
 
 func (s String) IsEmpty() (bool, error) {
-	es := EmptyString()
 	sz, err := s.Size()
 	if err != nil {
 		return false, err
 	}
-	return bytes.Equal(s.buf[s.offset:s.offset+sz], es.buf[es.offset:es.offset+es.SizeOrZero()]), nil
+	return sz == 0, nil
 }
 
 // TODO: define as var?
@@ -312,6 +318,9 @@ func (b Blob) Data() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if b.offset < 0 || sz < 0 || len(b.buf)-b.offset < sz {
+		return nil, ErrOutOfRange
+	}
 	return b.buf[b.offset : b.offset+sz], nil
 }
 
@@ -351,6 +360,8 @@ func (v Vector) AtRef(i int, ref *Reference) error {
 		return ErrOutOfRange
 	}
 	packedType := v.buf[packedTypeOffset]
+	ref.dict = v.dict
+	ref.typeOffset = packedTypeOffset
 	return setReferenceFromPackedType(v.buf, v.offset+i*int(v.byteWidth), v.byteWidth, packedType, ref)
 }
 
@@ -375,7 +386,10 @@ func (v Vector) At(i int) (Reference, error) {
 		return Reference{}, ErrOutOfRange
 	}
 	packedType := v.buf[packedTypeOffset]
-	return NewReferenceFromPackedType(v.buf, v.offset+i*int(v.byteWidth), v.byteWidth, packedType)
+	r, err := NewReferenceFromPackedType(v.buf, v.offset+i*int(v.byteWidth), v.byteWidth, packedType)
+	r.dict = v.dict
+	r.typeOffset = packedTypeOffset
+	return r, err
 }
 
 func EmptyVector() Vector {
@@ -427,6 +441,7 @@ func (v TypedVector) AtRef(i int, ref *Reference) error {
 	ref.parentWidth = v.byteWidth
 	ref.byteWidth = 1
 	ref.type_ = v.type_
+	ref.typeOffset = 0
 	return nil
 }
 
@@ -483,6 +498,7 @@ func (v FixedTypedVector) AtRef(i int, ref *Reference) error {
 	ref.parentWidth = v.byteWidth
 	ref.byteWidth = 1
 	ref.type_ = v.type_
+	ref.typeOffset = 0
 	return nil
 }
 
@@ -526,11 +542,13 @@ func EmptyFixedTypedVector() FixedTypedVector {
 
 type Map struct {
 	Vector
+	// order is the offset of the insertion order, 0 if the map has no order
+	order int
 }
 
 func EmptyMap() Map {
 	return Map{
-		Vector{
+		Vector: Vector{
 			Sized{
 				Object{
 					buf:       []byte{0 /* keys_len */, 0 /* keys_offset */, 1 /* keys_width */, 0 /* len */},
@@ -542,18 +560,63 @@ func EmptyMap() Map {
 	}
 }
 
+// Ordered reports whether the map keeps the order its entries were added in, which differs from the order of keys.
+// See Builder.SetOrderedMaps.
+func (m Map) Ordered() bool {
+	return m.order > 0
+}
+
+// AppendOrder appends indexes of the entries in the order they were added to dst. Indexes of maps without the order
+// are in the order of keys.
+func (m Map) AppendOrder(dst []int) ([]int, error) {
+	sz, err := m.Size()
+	if err != nil {
+		return dst, err
+	}
+	if m.order == 0 {
+		for i := 0; i < sz; i++ {
+			dst = append(dst, i)
+		}
+		return dst, nil
+	}
+	off := m.order
+	for i := 0; i < sz; i++ {
+		if off >= len(m.buf) {
+			return dst, ErrOutOfRange
+		}
+		idx, n := binary.Uvarint(m.buf[off:])
+		if n <= 0 || idx >= uint64(sz) {
+			return dst, ErrInvalidData
+		}
+		dst = append(dst, int(idx))
+		off += n
+	}
+	return dst, nil
+}
+
 func (m Map) Keys() (TypedVector, error) {
 	numPrefixedData := 3
 	keysOffset := m.offset - int(m.byteWidth)*numPrefixedData
-	off, err := m.buf.Indirect(keysOffset, m.byteWidth)
+	bw, err := m.buf.ReadUInt64(keysOffset+int(m.byteWidth), m.byteWidth)
 	if err != nil {
 		return TypedVector{}, nil
 	}
-	bw, err := m.buf.ReadUInt64(keysOffset+int(m.byteWidth), m.byteWidth)
+	if bw == 0 {
+		// keys are in the key dictionary
+		if m.dict == nil {
+			return TypedVector{}, ErrNoKeyDictionary
+		}
+		idx, err := m.buf.ReadUInt64(keysOffset, m.byteWidth)
+		if err != nil {
+			return TypedVector{}, err
+		}
+		return m.dict.KeyVector(int(idx))
+	}
+	off, err := m.buf.Indirect(keysOffset, m.byteWidth)
 	if err != nil {
 		return TypedVector{}, nil
 	}
-	if bw <= 0 || bw > 8 {
+	if bw > 8 {
 		return TypedVector{}, ErrInvalidData
 	}
 	if off < 0 || len(m.buf) <= off {
@@ -571,6 +634,12 @@ func (m Map) Keys() (TypedVector, error) {
 	}, nil
 }
 
+// hasDictionaryKeys reports whether the keys are stored in the key dictionary.
+func (m Map) hasDictionaryKeys() bool {
+	bw, err := m.buf.ReadUInt64(m.offset-int(m.byteWidth)*2, m.byteWidth)
+	return err == nil && bw == 0
+}
+
 func (m Map) Values() Vector {
 	return Vector{
 		Sized{
@@ -578,6 +647,7 @@ func (m Map) Values() Vector {
 				buf:       m.buf,
 				offset:    m.offset,
 				byteWidth: m.byteWidth,
+				dict:      m.dict,
 			},
 		},
 	}
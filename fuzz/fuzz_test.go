@@ -0,0 +1,484 @@
+package fuzz
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"flexbuffers"
+	"flexbuffers/process"
+)
+
+// addTestData adds flexbuffers in testdata to the seed corpus.
+func addTestData(f *testing.F) {
+	paths, err := filepath.Glob("../testdata/*.flexbuf")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+// entry is a map entry of a decoded document. Maps are sorted by keys as the builder does,
+// duplicated keys keep their order.
+type entry struct {
+	Key   string
+	Value interface{}
+}
+
+// withExt is a decoded value tagged by an ext.
+type withExt struct {
+	Ext   int64
+	Value interface{}
+}
+
+// errNotFinite is returned by decode for NaN and Inf, if jsonFloats.
+var errNotFinite = errors.New("float is not finite")
+
+// decodeOptions normalizes values which a format cannot represent exactly.
+type decodeOptions struct {
+	// floats must be finite to be written in JSON
+	jsonFloats bool
+	// blobs are compared as base64 strings
+	jsonBlobs bool
+	noExt     bool
+}
+
+// decode converts a validated document to Go values, for semantic comparison.
+// Ints and uints are compared by value, keys and strings are compared as strings,
+// and every kind of vectors are compared as slices.
+func decode(r flexbuffers.Reference, opts decodeOptions) (interface{}, error) {
+	v, err := decodeValue(r, opts)
+	if err != nil || opts.noExt {
+		return v, err
+	}
+	if ext := r.Ext(); ext != 0 {
+		return withExt{Ext: ext, Value: v}, nil
+	}
+	return v, nil
+}
+
+func decodeValue(r flexbuffers.Reference, opts decodeOptions) (interface{}, error) {
+	switch {
+	case r.IsNull():
+		return nil, nil
+	case r.IsBool():
+		return r.Bool()
+	case r.IsInt():
+		i, err := r.Int64()
+		if err != nil || i < 0 {
+			return i, err
+		}
+		return uint64(i), nil
+	case r.IsUInt():
+		return r.UInt64()
+	case r.IsFloat():
+		f, err := r.Float64()
+		if err != nil || !opts.jsonFloats {
+			return f, err
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, errNotFinite
+		}
+		return f, nil
+	case r.IsKey():
+		k, err := r.Key()
+		if err != nil {
+			return nil, err
+		}
+		return k.StringValue(), nil
+	case r.IsString():
+		s, err := r.StringRef()
+		if err != nil {
+			return nil, err
+		}
+		return s.StringValue()
+	case r.IsBlob():
+		b, err := r.Blob()
+		if err != nil {
+			return nil, err
+		}
+		d, err := b.Data()
+		if err != nil || !opts.jsonBlobs {
+			return d, err
+		}
+		return base64.StdEncoding.EncodeToString(d), nil
+	case r.IsMap():
+		m, err := r.Map()
+		if err != nil {
+			return nil, err
+		}
+		keys, err := m.Keys()
+		if err != nil {
+			return nil, err
+		}
+		sz, err := m.Size()
+		if err != nil {
+			return nil, err
+		}
+		values := m.Values()
+		entries := make([]entry, sz)
+		for i := range entries {
+			k, err := keys.At(i)
+			if err != nil {
+				return nil, err
+			}
+			v, err := values.At(i)
+			if err != nil {
+				return nil, err
+			}
+			entries[i].Key = k.AsKey().StringValue()
+			if entries[i].Value, err = decode(v, opts); err != nil {
+				return nil, err
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Key < entries[j].Key
+		})
+		return entries, nil
+	case r.IsAnyVector():
+		vec, err := r.AnyVector()
+		if err != nil {
+			return nil, err
+		}
+		sz, err := vec.Size()
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]interface{}, sz)
+		for i := range elems {
+			e, err := vec.At(i)
+			if err != nil {
+				return nil, err
+			}
+			if elems[i], err = decode(e, opts); err != nil {
+				return nil, err
+			}
+		}
+		return elems, nil
+	default:
+		return nil, fmt.Errorf("unknown type: %v", r.Type())
+	}
+}
+
+func decodeRaw(t *testing.T, raw flexbuffers.Raw, opts decodeOptions) interface{} {
+	root, err := raw.Root()
+	if err != nil {
+		t.Fatalf("root of %q: %v", []byte(raw), err)
+	}
+	v, err := decode(root, opts)
+	if err != nil {
+		t.Fatalf("decode %q: %v", []byte(raw), err)
+	}
+	return v
+}
+
+func assertSameDocument(t *testing.T, expected, actual flexbuffers.Raw, opts decodeOptions) {
+	assertSameValue(t, decodeRaw(t, expected, opts), actual, opts)
+}
+
+func assertSameValue(t *testing.T, expected interface{}, actual flexbuffers.Raw, opts decodeOptions) {
+	if diff := cmp.Diff(expected, decodeRaw(t, actual, opts), cmpopts.EquateNaNs()); diff != "" {
+		t.Fatalf("documents differ (-expected +actual):\n%s", diff)
+	}
+}
+
+// touch calls every accessor of r and its descendants, they must not panic whatever they return.
+func touch(r flexbuffers.Reference, depth int) {
+	_ = r.String()
+	_ = r.Ext()
+	_ = r.AsBool()
+	_ = r.AsInt64()
+	_ = r.AsUInt64()
+	_ = r.AsFloat64()
+	_ = r.AsFloat32()
+	_ = r.AsKey().StringValue()
+	s := r.AsStringRef()
+	_ = s.StringValueOrEmpty()
+	_ = s.UnsafeStringValueOrEmpty()
+	_, _ = s.IsEmpty()
+	_ = r.AsBlob().DataOrEmpty()
+	_ = r.WriteAsJson(ioutil.Discard)
+	if depth > 64 {
+		return
+	}
+	if m, err := r.Map(); err == nil {
+		if keys, err := m.Keys(); err == nil {
+			sz := keys.SizeOrZero()
+			for i := 0; i < sz; i++ {
+				k := keys.AtOrNull(i)
+				_ = m.GetOrNull(k.AsKey().StringValue())
+			}
+		}
+		_ = m.GetOrNull("")
+		_ = m.Values().AtOrNull(-1)
+	}
+	if vec, err := r.AnyVector(); err == nil {
+		sz, _ := vec.Size()
+		_ = vec.Ext()
+		for i := -1; i <= sz; i++ {
+			var e flexbuffers.Reference
+			if err := vec.AtRef(i, &e); err == nil {
+				touch(e, depth+1)
+			}
+		}
+	}
+	_ = r.AsVector().AtOrNull(0)
+	_ = r.AsTypedVector().AtOrNull(0)
+	_ = r.AsFixedTypedVector().AtOrNull(0)
+}
+
+func FuzzValidate(f *testing.F) {
+	addTestData(f)
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		raw := flexbuffers.Raw(data)
+		// inspector reads any buffer
+		_ = raw.Inspect()
+		_ = raw.Dump(ioutil.Discard)
+
+		err := raw.Validate()
+		all := raw.ValidateAll()
+		if (err == nil) != (len(all) == 0) {
+			t.Fatalf("Validate returned %v, but ValidateAll returned %d errors", err, len(all))
+		}
+		strictErr := raw.ValidateWithOptions(flexbuffers.ValidateOptions{
+			MaxDepth:          64,
+			MaxElements:       1 << 16,
+			MaxBytesVisited:   1 << 20,
+			StrictAlignment:   true,
+			RequireSortedKeys: true,
+			RequireUTF8:       true,
+		})
+		if err != nil {
+			if strictErr == nil {
+				t.Fatalf("ValidateWithOptions accepted a buffer rejected by Validate: %v", err)
+			}
+			return
+		}
+		root, err := raw.Root()
+		if err != nil {
+			t.Fatalf("root of a valid buffer: %v", err)
+		}
+		touch(root, 0)
+	})
+}
+
+func FuzzJSON(f *testing.F) {
+	for _, s := range []string{
+		`null`, `true`, `-1`, `18446744073709551615`, `18446744073709551700`, `1.5`, `"foo"`, `"é😀\n"`,
+		`[]`, `{}`, `[1,"a",{"b":[true,null]}]`, `{"b":1,"a":{"c":-2.25},"a":"dup"}`,
+	} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if !utf8.Valid(data) {
+			// JSON text is UTF-8, invalid bytes in strings cannot be written back
+			return
+		}
+		raw, err := process.FromJson(data)
+		if err != nil {
+			return
+		}
+		if err := raw.Validate(); err != nil {
+			t.Fatalf("FromJson(%q) is invalid: %v", data, err)
+		}
+		opts := decodeOptions{jsonFloats: true, jsonBlobs: true, noExt: true}
+		expected, err := decode(raw.RootOrNull(), opts)
+		if err == errNotFinite {
+			// numbers out of the range of float64 are read as Inf, which JSON cannot represent
+			return
+		} else if err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		// typed and fixed vectors hold the same values
+		typed, err := process.FromJsonWithOptions(data, process.JsonInputOptions{TypedVectors: true, FixedVectors: true})
+		if err != nil {
+			t.Fatalf("FromJsonWithOptions(%q): %v", data, err)
+		}
+		if err := typed.Validate(); err != nil {
+			t.Fatalf("FromJsonWithOptions(%q) is invalid: %v", data, err)
+		}
+		assertSameValue(t, expected, typed, opts)
+
+		var out bytes.Buffer
+		if err := raw.RootOrNull().WriteAsJson(&out); err != nil {
+			t.Fatalf("WriteAsJson: %v", err)
+		}
+		again, err := process.FromJson(out.Bytes())
+		if err != nil {
+			t.Fatalf("FromJson(%q), written from %q: %v", out.Bytes(), data, err)
+		}
+		assertSameValue(t, expected, again, opts)
+
+		// strict parsing accepts only valid JSON, and written JSON
+		strict, err := process.FromJsonWithOptions(data, process.JsonInputOptions{Strict: true})
+		if err == nil {
+			if !json.Valid(data) {
+				t.Fatalf("FromJsonWithOptions(%q) accepts invalid JSON in Strict mode", data)
+			}
+			assertSameValue(t, expected, strict, opts)
+		}
+		if _, err := process.FromJsonWithOptions(out.Bytes(), process.JsonInputOptions{Strict: true}); err != nil {
+			t.Fatalf("FromJsonWithOptions(%q), written from %q, Strict: %v", out.Bytes(), data, err)
+		}
+
+		// ordered maps hold the same values, and write JSON in their order
+		ordered, err := process.FromJsonWithOptions(data, process.JsonInputOptions{OrderedMaps: true})
+		if err != nil {
+			t.Fatalf("FromJsonWithOptions(%q): %v", data, err)
+		}
+		if err := ordered.Validate(); err != nil {
+			t.Fatalf("FromJsonWithOptions(%q) is invalid: %v", data, err)
+		}
+		assertSameValue(t, expected, ordered, opts)
+		orderedOut, err := ordered.RootOrNull().AppendJson(nil, flexbuffers.JsonOptions{})
+		if err != nil {
+			t.Fatalf("AppendJson: %v", err)
+		}
+		orderedAgain, err := process.FromJsonWithOptions(orderedOut, process.JsonInputOptions{OrderedMaps: true})
+		if err != nil {
+			t.Fatalf("FromJsonWithOptions(%q), written from %q: %v", orderedOut, data, err)
+		}
+		if !bytes.Equal(ordered, orderedAgain) {
+			t.Fatalf("ordered maps differ after a round trip of %q through %q", data, orderedOut)
+		}
+
+		// maps have unique keys with DuplicateKeysFirst and DuplicateKeysLast
+		for _, policy := range []flexbuffers.DuplicateKeyPolicy{flexbuffers.DuplicateKeysFirst, flexbuffers.DuplicateKeysLast} {
+			unique, err := process.FromJsonWithOptions(data, process.JsonInputOptions{DuplicateKeys: policy})
+			if err != nil {
+				t.Fatalf("FromJsonWithOptions(%q): %v", data, err)
+			}
+			if err := unique.ValidateWithOptions(flexbuffers.ValidateOptions{RequireUniqueKeys: true}); err != nil {
+				t.Fatalf("FromJsonWithOptions(%q) has duplicate keys: %v", data, err)
+			}
+		}
+
+		// numbers kept as strings are written back as they are
+		const numberExt = 100
+		exact, err := process.FromJsonWithOptions(data, process.JsonInputOptions{NumberExt: numberExt})
+		if err != nil {
+			return
+		}
+		exactOut, err := exact.RootOrNull().AppendJson(nil, flexbuffers.JsonOptions{NumberExt: numberExt})
+		if err != nil {
+			t.Fatalf("AppendJson: %v", err)
+		}
+		exactAgain, err := process.FromJsonWithOptions(exactOut, process.JsonInputOptions{NumberExt: numberExt})
+		if err != nil {
+			t.Fatalf("FromJsonWithOptions(%q), written from %q: %v", exactOut, data, err)
+		}
+		again2, err := exactAgain.RootOrNull().AppendJson(nil, flexbuffers.JsonOptions{NumberExt: numberExt})
+		if err != nil {
+			t.Fatalf("AppendJson: %v", err)
+		}
+		if !bytes.Equal(exactOut, again2) {
+			t.Fatalf("JSON differs after a round trip:\n%s\n%s", exactOut, again2)
+		}
+	})
+}
+
+func FuzzBSON(f *testing.F) {
+	for _, d := range []interface{}{
+		bson.D{},
+		bson.D{{Key: "a", Value: "foo"}, {Key: "b", Value: int32(-1)}, {Key: "c", Value: int64(1) << 40}},
+		bson.D{{Key: "d", Value: 1.25}, {Key: "e", Value: true}, {Key: "f", Value: nil}},
+		bson.D{{Key: "x", Value: bson.A{int32(1), "y", bson.D{{Key: "z", Value: []byte("blob")}}}}},
+	} {
+		b, err := bson.Marshal(d)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		raw, err := process.FromBSON(data)
+		if err != nil {
+			return
+		}
+		if err := raw.Validate(); err != nil {
+			t.Fatalf("FromBSON(%q) is invalid: %v", data, err)
+		}
+		out, err := process.ToBSON(raw)
+		if err != nil {
+			t.Fatalf("ToBSON: %v", err)
+		}
+		again, err := process.FromBSON(out)
+		if err != nil {
+			t.Fatalf("FromBSON(%q), written from %q: %v", out, data, err)
+		}
+		assertSameDocument(t, raw, again, decodeOptions{})
+	})
+}
+
+func FuzzBuilder(f *testing.F) {
+	addTestData(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		raw := flexbuffers.Raw(data)
+		if err := raw.Validate(); err != nil {
+			return
+		}
+		b := flexbuffers.NewBuilder()
+		r := process.FlexbuffersReader{Output: process.NewFlexbuffersWriter(b)}
+		if err := r.ReadBuffer(raw); err != nil {
+			t.Fatalf("read %q: %v", data, err)
+		}
+		if err := b.Finish(); err != nil {
+			t.Fatalf("finish: %v", err)
+		}
+		rebuilt := b.Buffer()
+		if err := rebuilt.Validate(); err != nil {
+			t.Fatalf("rebuilt %q from %q is invalid: %v", []byte(rebuilt), data, err)
+		}
+		assertSameDocument(t, raw, rebuilt, decodeOptions{})
+	})
+}
+
+func FuzzExtendedJSON(f *testing.F) {
+	addTestData(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		raw := flexbuffers.Raw(data)
+		if err := raw.Validate(); err != nil {
+			return
+		}
+		// maps are rebuilt sorted
+		opts := flexbuffers.JsonOptions{Extended: true, KeyOrder: flexbuffers.KeyOrderSorted}
+		out, err := raw.RootOrNull().AppendJson(nil, opts)
+		if err != nil {
+			t.Fatalf("AppendJson %q: %v", data, err)
+		}
+		again, err := process.FromExtendedJson(out)
+		if err != nil {
+			t.Fatalf("FromExtendedJson(%s), written from %q: %v", out, data, err)
+		}
+		if err := again.Validate(); err != nil {
+			t.Fatalf("FromExtendedJson(%s) is invalid: %v", out, err)
+		}
+		out2, err := again.RootOrNull().AppendJson(nil, opts)
+		if err != nil {
+			t.Fatalf("AppendJson %q: %v", []byte(again), err)
+		}
+		if !bytes.Equal(out, out2) {
+			t.Fatalf("extended JSON differs after a round trip:\n%s\n%s", out, out2)
+		}
+	})
+}
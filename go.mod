@@ -3,14 +3,17 @@ module flexbuffers
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/apache/arrow/go/arrow v0.0.0-20200730104253-651201b0f516
 	github.com/bxcodec/faker/v3 v3.2.0
 	github.com/cespare/xxhash v1.1.0
 	github.com/go-stack/stack v1.8.0
-	github.com/golang/protobuf v1.3.2 // indirect
-	github.com/google/go-cmp v0.5.2
+	github.com/google/go-cmp v0.5.5
 	github.com/stretchr/testify v1.6.1
 	github.com/valyala/fastjson v1.4.1
 	github.com/vmihailenco/msgpack v4.0.4+incompatible
 	go.mongodb.org/mongo-driver v1.5.1
 	google.golang.org/appengine v1.1.0 // indirect
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
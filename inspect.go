@@ -0,0 +1,722 @@
+package flexbuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxInspectDepth limits nesting of inspected values, deeper values are marked invalid.
+const maxInspectDepth = 1000
+
+var typeNames = [...]string{
+	FBTNull:          "null",
+	FBTInt:           "int",
+	FBTUint:          "uint",
+	FBTFloat:         "float",
+	FBTKey:           "key",
+	FBTString:        "string",
+	FBTIndirectInt:   "indirect int",
+	FBTIndirectUInt:  "indirect uint",
+	FBTIndirectFloat: "indirect float",
+	FBTMap:           "map",
+	FBTVector:        "vector",
+	FBTVectorInt:     "vector of int",
+	FBTVectorUInt:    "vector of uint",
+	FBTVectorFloat:   "vector of float",
+	FBTVectorKey:     "vector of key",
+	FBTVectorString:  "vector of string",
+	FBTVectorInt2:    "vector of 2 int",
+	FBTVectorUInt2:   "vector of 2 uint",
+	FBTVectorFloat2:  "vector of 2 float",
+	FBTVectorInt3:    "vector of 3 int",
+	FBTVectorUInt3:   "vector of 3 uint",
+	FBTVectorFloat3:  "vector of 3 float",
+	FBTVectorInt4:    "vector of 4 int",
+	FBTVectorUInt4:   "vector of 4 uint",
+	FBTVectorFloat4:  "vector of 4 float",
+	FBTBlob:          "blob",
+	FBTBool:          "bool",
+	FBTVectorBool:    "vector of bool",
+}
+
+func (t Type) String() string {
+	if int(t) < len(typeNames) && typeNames[t] != "" {
+		return typeNames[t]
+	}
+	return "type(" + strconv.Itoa(int(t)) + ")"
+}
+
+// SpanKind is the role of an annotated byte range.
+type SpanKind uint8
+
+const (
+	SpanRootType SpanKind = iota
+	SpanRootWidth
+	// SpanInline is a slot holding an inline scalar.
+	SpanInline
+	// SpanOffset is a slot holding a relative offset to the value.
+	SpanOffset
+	SpanScalar
+	SpanSize
+	SpanKeysOffset
+	SpanKeysWidth
+	// SpanDictionaryIndex is the index of the key vector in the key dictionary, stored instead of the keys offset.
+	SpanDictionaryIndex
+	SpanKey
+	SpanString
+	SpanTerminator
+	SpanBlob
+	SpanTypeTable
+	SpanExt
+	SpanPadding
+	SpanUnreachable
+	// SpanMapOrder is the insertion order of an ordered map, see ExtOrderedMap.
+	SpanMapOrder
+)
+
+var spanKindNames = [...]string{
+	SpanRootType:        "root type",
+	SpanRootWidth:       "root width",
+	SpanInline:          "inline",
+	SpanOffset:          "offset",
+	SpanScalar:          "scalar",
+	SpanSize:            "size",
+	SpanKeysOffset:      "keys offset",
+	SpanKeysWidth:       "keys width",
+	SpanDictionaryIndex: "dictionary index",
+	SpanKey:             "key",
+	SpanString:          "string",
+	SpanTerminator:      "terminator",
+	SpanBlob:            "blob",
+	SpanTypeTable:       "type table",
+	SpanExt:             "ext",
+	SpanPadding:         "padding",
+	SpanUnreachable:     "unreachable",
+	SpanMapOrder:        "map order",
+}
+
+func (k SpanKind) String() string {
+	if int(k) < len(spanKindNames) {
+		return spanKindNames[k]
+	}
+	return "kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Span is an annotated byte range of a buffer, see Raw.Inspect.
+type Span struct {
+	Offset int
+	Size   int
+	Kind   SpanKind
+	// Path is the dotted path of the value the span belongs to, map keys or vector indexes. The root is empty.
+	Path string
+	// Type, ByteWidth and ParentWidth describe the value the span belongs to. ByteWidth is the width of the value
+	// itself (element width of vectors, width of size prefixes), ParentWidth is the width of the slot referring it.
+	Type        Type
+	ByteWidth   uint8
+	ParentWidth uint8
+	// Target is the absolute offset a SpanOffset or SpanKeysOffset points to.
+	Target int
+	// Note describes the content, like the value of scalars.
+	Note string
+	// Err is set when the region is invalid.
+	Err error
+}
+
+func (s Span) End() int {
+	return s.Offset + s.Size
+}
+
+type inspector struct {
+	buf     Raw
+	spans   []Span
+	visited map[int]bool
+	active  map[int]bool
+}
+
+// Inspect walks the buffer from the root and returns annotated byte ranges sorted by offset.
+// Unlike Validate, it doesn't stop at the first problem: invalid regions have Err set, and bytes not reachable
+// from the root are returned as SpanPadding or SpanUnreachable. Keys in the key dictionary are not resolved.
+func (b Raw) Inspect() []Span {
+	in := inspector{buf: b, visited: map[int]bool{}, active: map[int]bool{}}
+	in.root()
+	in.fillGaps()
+	return in.spans
+}
+
+// InvalidSpans returns spans with Err set.
+func InvalidSpans(spans []Span) []Span {
+	var invalid []Span
+	for _, s := range spans {
+		if s.Err != nil {
+			invalid = append(invalid, s)
+		}
+	}
+	return invalid
+}
+
+func (in *inspector) add(s Span) {
+	// clip invalid regions to the buffer
+	if s.Offset < 0 {
+		s.Size += s.Offset
+		s.Offset = 0
+	}
+	if s.Offset > len(in.buf) {
+		s.Offset = len(in.buf)
+	}
+	if s.End() > len(in.buf) {
+		s.Size = len(in.buf) - s.Offset
+	}
+	if s.Size < 0 {
+		s.Size = 0
+	}
+	in.spans = append(in.spans, s)
+}
+
+func (in *inspector) contains(offset, size int) bool {
+	return offset >= 0 && size >= 0 && offset+size <= len(in.buf) && offset+size >= offset
+}
+
+func (in *inspector) readUint(offset int, width uint8) (uint64, bool) {
+	if !in.contains(offset, int(width)) {
+		return 0, false
+	}
+	switch width {
+	case 1:
+		return uint64(in.buf[offset]), true
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(in.buf[offset:])), true
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(in.buf[offset:])), true
+	case 8:
+		return binary.LittleEndian.Uint64(in.buf[offset:]), true
+	default:
+		return 0, false
+	}
+}
+
+func validWidth(w uint64) bool {
+	return w == 1 || w == 2 || w == 4 || w == 8
+}
+
+func (in *inspector) root() {
+	n := len(in.buf)
+	if n <= 2 {
+		in.add(Span{Offset: 0, Size: n, Kind: SpanRootType, Note: "buffer too short", Err: ErrInvalidData})
+		return
+	}
+	packedType := in.buf[n-2]
+	width := in.buf[n-1]
+	bw, t, hasExt := UnpackType(packedType)
+	in.add(Span{Offset: n - 2, Size: 1, Kind: SpanRootType, Type: t, ByteWidth: bw.ByteWidth(), Note: packedTypeNote(packedType)})
+	ws := Span{Offset: n - 1, Size: 1, Kind: SpanRootWidth, Note: strconv.Itoa(int(width))}
+	if !validWidth(uint64(width)) {
+		ws.Err = ErrInvalidData
+		in.add(ws)
+		return
+	}
+	in.add(ws)
+	if n-2-int(width) < 0 {
+		in.add(Span{Offset: 0, Size: n - 2, Kind: SpanInline, Type: t, ParentWidth: width, Err: ErrOutOfRange})
+		return
+	}
+	in.slot("", n-2-int(width), width, t, bw.ByteWidth(), hasExt, 0)
+}
+
+func packedTypeNote(packedType uint8) string {
+	bw, t, hasExt := UnpackType(packedType)
+	note := fmt.Sprintf("%s, width %d", t, bw.ByteWidth())
+	if hasExt {
+		note += ", ext"
+	}
+	return note
+}
+
+func joinInspectPath(path, elem string) string {
+	if path == "" {
+		return elem
+	}
+	return path + "." + elem
+}
+
+// slot annotates a value referred from a slot of parentWidth bytes, and the value it points to.
+func (in *inspector) slot(path string, offset int, parentWidth uint8, t Type, byteWidth uint8, hasExt bool, depth int) {
+	s := Span{Offset: offset, Size: int(parentWidth), Kind: SpanInline, Path: path, Type: t, ByteWidth: byteWidth, ParentWidth: parentWidth}
+	if !in.contains(offset, int(parentWidth)) {
+		s.Err = ErrOutOfRange
+		in.add(s)
+		return
+	}
+	if IsInline(t) {
+		s.Note = in.scalarNote(offset, parentWidth, t)
+		in.add(s)
+		return
+	}
+	s.Kind = SpanOffset
+	rel, _ := in.readUint(offset, parentWidth)
+	target := offset - int(rel)
+	s.Target = target
+	s.Note = fmt.Sprintf("-> %#x %s", target, t)
+	if rel > uint64(offset) || target >= len(in.buf) {
+		s.Err = ErrOutOfRange
+		in.add(s)
+		return
+	}
+	if in.active[target] {
+		s.Err = ErrRecursiveData
+		in.add(s)
+		return
+	}
+	if depth >= maxInspectDepth {
+		s.Err = fmt.Errorf("nested too deep")
+		in.add(s)
+		return
+	}
+	in.add(s)
+	if in.visited[target] {
+		// shared value, annotated already
+		return
+	}
+	in.visited[target] = true
+	in.active[target] = true
+	in.value(path, target, t, byteWidth, hasExt, depth+1)
+	delete(in.active, target)
+}
+
+func (in *inspector) scalarNote(offset int, width uint8, t Type) string {
+	u, ok := in.readUint(offset, width)
+	if !ok {
+		return ""
+	}
+	switch t {
+	case FBTNull:
+		return "null"
+	case FBTBool:
+		return strconv.FormatBool(u != 0)
+	case FBTInt, FBTIndirectInt:
+		shift := 64 - 8*uint(width)
+		return strconv.FormatInt(int64(u<<shift)>>shift, 10)
+	case FBTUint, FBTIndirectUInt:
+		return strconv.FormatUint(u, 10)
+	case FBTFloat, FBTIndirectFloat:
+		switch width {
+		case 4:
+			return strconv.FormatFloat(float64(math.Float32frombits(uint32(u))), 'g', -1, 32)
+		case 8:
+			return strconv.FormatFloat(math.Float64frombits(u), 'g', -1, 64)
+		default:
+			return fmt.Sprintf("float%d is not supported", width*8)
+		}
+	}
+	return ""
+}
+
+// size annotates the size prefix of the object at offset.
+func (in *inspector) size(path string, offset int, width uint8, t Type) (int, bool) {
+	s := Span{Offset: offset - int(width), Size: int(width), Kind: SpanSize, Path: path, Type: t, ByteWidth: width}
+	n, ok := in.readUint(s.Offset, width)
+	if !ok || n > uint64(len(in.buf)) {
+		s.Err = ErrOutOfRange
+		in.add(s)
+		return 0, false
+	}
+	s.Note = strconv.FormatUint(n, 10)
+	in.add(s)
+	return int(n), true
+}
+
+// ext annotates the ext varint at offset.
+func (in *inspector) ext(path string, offset int, t Type) {
+	s := Span{Offset: offset, Kind: SpanExt, Path: path, Type: t}
+	if offset < 0 || offset >= len(in.buf) {
+		s.Err = ErrOutOfRange
+		in.add(s)
+		return
+	}
+	v, n := binary.Varint(in.buf[offset:])
+	if n <= 0 {
+		s.Size = len(in.buf) - offset
+		s.Err = fmt.Errorf("failed to read ext")
+		in.add(s)
+		return
+	}
+	s.Size = n
+	s.Note = strconv.FormatInt(v, 10)
+	in.add(s)
+}
+
+func (in *inspector) value(path string, offset int, t Type, byteWidth uint8, hasExt bool, depth int) {
+	if !validWidth(uint64(byteWidth)) {
+		in.add(Span{Offset: offset, Kind: SpanScalar, Path: path, Type: t, ByteWidth: byteWidth, Err: ErrInvalidData})
+		return
+	}
+	switch {
+	case t == FBTIndirectInt || t == FBTIndirectUInt || t == FBTIndirectFloat:
+		s := Span{Offset: offset, Size: int(byteWidth), Kind: SpanScalar, Path: path, Type: t, ByteWidth: byteWidth}
+		if !in.contains(offset, int(byteWidth)) {
+			s.Err = ErrOutOfRange
+		} else {
+			s.Note = in.scalarNote(offset, byteWidth, t)
+		}
+		in.add(s)
+	case t == FBTKey:
+		in.key(path, offset)
+	case t == FBTString || t == FBTBlob:
+		n, ok := in.size(path, offset, byteWidth, t)
+		if !ok {
+			return
+		}
+		s := Span{Offset: offset, Size: n, Kind: SpanBlob, Path: path, Type: t, ByteWidth: byteWidth}
+		if t == FBTString {
+			s.Kind = SpanString
+		}
+		if !in.contains(offset, n) {
+			s.Err = ErrOutOfRange
+			in.add(s)
+			return
+		}
+		if t == FBTString {
+			s.Note = strconv.Quote(string(in.buf[offset : offset+n]))
+		}
+		in.add(s)
+		end := offset + n
+		if t == FBTString {
+			term := Span{Offset: end, Size: 1, Kind: SpanTerminator, Path: path, Type: t}
+			if end >= len(in.buf) || in.buf[end] != 0 {
+				term.Err = fmt.Errorf("string is not null terminated")
+			}
+			in.add(term)
+			end++
+		}
+		if hasExt {
+			in.ext(path, end, t)
+		}
+	case t == FBTMap:
+		in.mapValue(path, offset, byteWidth, hasExt, depth)
+	case t == FBTVector:
+		n, ok := in.size(path, offset, byteWidth, t)
+		if !ok {
+			return
+		}
+		if end, ok := in.elements(path, offset, n, byteWidth, t, nil, depth); ok && hasExt {
+			in.ext(path, end, t)
+		}
+	case IsTypedVector(t) || IsFixedTypedVector(t) || t == FBTVectorBool:
+		var n int
+		var elem Type
+		if IsFixedTypedVector(t) {
+			var l uint8
+			elem = ToFixedTypedVectorElementType(t, &l)
+			n = int(l)
+		} else {
+			var ok bool
+			if n, ok = in.size(path, offset, byteWidth, t); !ok {
+				return
+			}
+			elem = ToTypedVectorElementType(t)
+		}
+		if end, ok := in.typedElements(path, offset, n, byteWidth, elem, nil, depth); ok && hasExt {
+			in.ext(path, end, t)
+		}
+	default:
+		in.add(Span{Offset: offset, Kind: SpanScalar, Path: path, Type: t, Err: fmt.Errorf("type is invalid: %d", t)})
+	}
+}
+
+// key annotates the null terminated key at offset.
+func (in *inspector) key(path string, offset int) string {
+	s := Span{Offset: offset, Kind: SpanKey, Path: path, Type: FBTKey}
+	if offset < 0 || offset >= len(in.buf) {
+		s.Err = ErrOutOfRange
+		in.add(s)
+		return ""
+	}
+	i := strings.IndexByte(string(in.buf[offset:]), 0)
+	if i < 0 {
+		s.Size = len(in.buf) - offset
+		s.Err = fmt.Errorf("key is not null terminated")
+		in.add(s)
+		return ""
+	}
+	s.Size = i + 1
+	k := string(in.buf[offset : offset+i])
+	s.Note = strconv.Quote(k)
+	in.add(s)
+	return k
+}
+
+// elements annotates elements of an untyped vector and its type table, and returns the end of the type table.
+// Elements are named by keys if given.
+func (in *inspector) elements(path string, offset, n int, width uint8, t Type, keys []string, depth int) (int, bool) {
+	table := offset + n*int(width)
+	ts := Span{Offset: table, Size: n, Kind: SpanTypeTable, Path: path, Type: t, ByteWidth: width}
+	if !in.contains(offset, n*int(width)) || !in.contains(table, n) {
+		ts.Offset, ts.Size, ts.Err = offset, n*int(width)+n, ErrOutOfRange
+		in.add(ts)
+		return 0, false
+	}
+	in.add(ts)
+	for i := 0; i < n; i++ {
+		bw, et, hasExt := UnpackType(in.buf[table+i])
+		in.slot(joinInspectPath(path, elementName(i, keys)), offset+i*int(width), width, et, bw.ByteWidth(), hasExt, depth)
+	}
+	return table + n, true
+}
+
+// typedElements annotates elements of a typed vector, and returns the end of the elements.
+func (in *inspector) typedElements(path string, offset, n int, width uint8, elem Type, keys []string, depth int) (int, bool) {
+	if !in.contains(offset, n*int(width)) {
+		in.add(Span{Offset: offset, Size: n * int(width), Kind: SpanInline, Path: path, Type: elem, ParentWidth: width, Err: ErrOutOfRange})
+		return 0, false
+	}
+	for i := 0; i < n; i++ {
+		in.slot(joinInspectPath(path, elementName(i, keys)), offset+i*int(width), width, elem, 1, false, depth)
+	}
+	return offset + n*int(width), true
+}
+
+func elementName(i int, keys []string) string {
+	if i < len(keys) {
+		return keys[i]
+	}
+	return strconv.Itoa(i)
+}
+
+func (in *inspector) mapValue(path string, offset int, width uint8, hasExt bool, depth int) {
+	n, ok := in.size(path, offset, width, FBTMap)
+	if !ok {
+		return
+	}
+	prefix := offset - 3*int(width)
+	kw := Span{Offset: prefix + int(width), Size: int(width), Kind: SpanKeysWidth, Path: path, Type: FBTMap, ByteWidth: width}
+	keysWidth, ok := in.readUint(kw.Offset, width)
+	if !ok {
+		kw.Err = ErrOutOfRange
+		in.add(kw)
+		return
+	}
+	kw.Note = strconv.FormatUint(keysWidth, 10)
+	if keysWidth != 0 && !validWidth(keysWidth) {
+		kw.Err = ErrInvalidData
+		in.add(kw)
+		return
+	}
+	in.add(kw)
+
+	var keys []string
+	extOffset := -1
+	ko := Span{Offset: prefix, Size: int(width), Kind: SpanKeysOffset, Path: path, Type: FBTMap, ByteWidth: width}
+	rel, ok := in.readUint(prefix, width)
+	if !ok {
+		ko.Err = ErrOutOfRange
+		in.add(ko)
+		return
+	}
+	if keysWidth == 0 {
+		ko.Kind = SpanDictionaryIndex
+		ko.Note = strconv.FormatUint(rel, 10)
+		in.add(ko)
+	} else {
+		target := prefix - int(rel)
+		ko.Target = target
+		ko.Note = fmt.Sprintf("-> %#x", target)
+		if rel > uint64(prefix) {
+			ko.Err = ErrOutOfRange
+			in.add(ko)
+			return
+		}
+		in.add(ko)
+		keys, extOffset, ok = in.keyVector(path, target, uint8(keysWidth), n)
+		if !ok {
+			return
+		}
+	}
+	end, ok := in.elements(path, offset, n, width, FBTMap, keys, depth)
+	if !ok || !hasExt {
+		return
+	}
+	if keysWidth == 0 {
+		// ext follows the type table
+		in.mapExt(path, end, n)
+	} else if extOffset >= 0 {
+		// ext follows the keys vector, it's annotated once for shared key vectors
+		in.mapExt(path, extOffset, n)
+	}
+}
+
+// mapExt annotates the ext of a map of n entries, and the ext and the insertion order following ExtOrderedMap.
+func (in *inspector) mapExt(path string, offset, n int) {
+	in.ext(path, offset, FBTMap)
+	if offset < 0 || offset >= len(in.buf) {
+		return
+	}
+	v, l := binary.Varint(in.buf[offset:])
+	if l <= 0 || v != ExtOrderedMap {
+		return
+	}
+	offset += l
+	in.ext(path, offset, FBTMap)
+	if offset >= len(in.buf) {
+		return
+	}
+	if _, l = binary.Varint(in.buf[offset:]); l <= 0 {
+		return
+	}
+	offset += l
+	s := Span{Offset: offset, Kind: SpanMapOrder, Path: path, Type: FBTMap}
+	indexes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if offset+s.Size >= len(in.buf) {
+			s.Size = len(in.buf) - offset
+			s.Err = ErrOutOfRange
+			in.add(s)
+			return
+		}
+		idx, l := binary.Uvarint(in.buf[offset+s.Size:])
+		if l <= 0 || idx >= uint64(n) {
+			s.Size = len(in.buf) - offset
+			s.Err = ErrInvalidData
+			in.add(s)
+			return
+		}
+		s.Size += l
+		indexes = append(indexes, strconv.FormatUint(idx, 10))
+	}
+	s.Note = strings.Join(indexes, " ")
+	in.add(s)
+}
+
+// keyVector annotates the keys vector of a map. Key vectors can be shared by maps, the ext offset is -1 if the vector
+// has been annotated already.
+func (in *inspector) keyVector(path string, offset int, width uint8, n int) ([]string, int, bool) {
+	l, ok := in.readUint(offset-int(width), width)
+	if !ok {
+		in.add(Span{Offset: offset - int(width), Size: int(width), Kind: SpanSize, Path: path, Type: FBTVectorKey, ByteWidth: width, Err: ErrOutOfRange})
+		return nil, -1, false
+	}
+	if int(l) != n || !in.contains(offset, n*int(width)) {
+		in.add(Span{Offset: offset - int(width), Size: int(width), Kind: SpanSize, Path: path, Type: FBTVectorKey, ByteWidth: width,
+			Note: strconv.FormatUint(l, 10), Err: fmt.Errorf("keys vector has %d elements, but the map has %d", l, n)})
+		return nil, -1, false
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		rel, _ := in.readUint(offset+i*int(width), width)
+		if target := offset + i*int(width) - int(rel); rel <= uint64(offset+i*int(width)) && target < len(in.buf) {
+			k := in.buf[target:]
+			if j := strings.IndexByte(string(k), 0); j >= 0 {
+				keys[i] = string(k[:j])
+			}
+		}
+	}
+	if in.visited[offset] {
+		return keys, -1, true
+	}
+	in.visited[offset] = true
+	in.add(Span{Offset: offset - int(width), Size: int(width), Kind: SpanSize, Path: path, Type: FBTVectorKey, ByteWidth: width, Note: strconv.Itoa(n)})
+	for i := 0; i < n; i++ {
+		in.slot(joinInspectPath(path, keys[i]), offset+i*int(width), width, FBTKey, 1, false, 0)
+	}
+	return keys, offset + n*int(width), true
+}
+
+// fillGaps sorts spans and adds bytes not covered by them as padding or unreachable.
+func (in *inspector) fillGaps() {
+	sort.SliceStable(in.spans, func(i, j int) bool {
+		return in.spans[i].Offset < in.spans[j].Offset
+	})
+	var gaps []Span
+	pos := 0
+	for _, s := range in.spans {
+		if s.Offset > pos {
+			gaps = append(gaps, in.gap(pos, s.Offset))
+		}
+		if s.End() > pos {
+			pos = s.End()
+		}
+	}
+	if pos < len(in.buf) {
+		gaps = append(gaps, in.gap(pos, len(in.buf)))
+	}
+	if len(gaps) == 0 {
+		return
+	}
+	in.spans = append(in.spans, gaps...)
+	sort.SliceStable(in.spans, func(i, j int) bool {
+		return in.spans[i].Offset < in.spans[j].Offset
+	})
+}
+
+// gap returns zero bytes shorter than the maximum alignment as padding, otherwise unreachable.
+func (in *inspector) gap(start, end int) Span {
+	s := Span{Offset: start, Size: end - start, Kind: SpanPadding}
+	if end-start >= 8 {
+		s.Kind = SpanUnreachable
+		return s
+	}
+	for _, c := range in.buf[start:end] {
+		if c != 0 {
+			s.Kind = SpanUnreachable
+			break
+		}
+	}
+	return s
+}
+
+// Dump writes an annotated hex dump of the buffer, see Inspect. Invalid regions are marked with "!!".
+func (b Raw) Dump(w io.Writer) error {
+	const bytesPerLine = 8
+	for _, s := range b.Inspect() {
+		mark := "  "
+		if s.Err != nil {
+			mark = "!!"
+		}
+		var sb strings.Builder
+		sb.WriteString(s.Kind.String())
+		if s.Kind != SpanPadding && s.Kind != SpanUnreachable && s.Kind != SpanRootType && s.Kind != SpanRootWidth {
+			sb.WriteString(" (")
+			sb.WriteString(s.Type.String())
+			if s.ParentWidth != 0 {
+				fmt.Fprintf(&sb, ", parent width %d", s.ParentWidth)
+			}
+			if s.ByteWidth != 0 {
+				fmt.Fprintf(&sb, ", width %d", s.ByteWidth)
+			}
+			sb.WriteString(")")
+		}
+		if s.Path != "" {
+			sb.WriteString(" ")
+			sb.WriteString(s.Path)
+		}
+		if s.Note != "" {
+			sb.WriteString(": ")
+			sb.WriteString(s.Note)
+		}
+		if s.Err != nil {
+			sb.WriteString(": ")
+			sb.WriteString(s.Err.Error())
+		}
+		data := b[s.Offset:s.End()]
+		for i := 0; i == 0 || i < len(data); i += bytesPerLine {
+			line := data[i:]
+			if len(line) > bytesPerLine {
+				line = line[:bytesPerLine]
+			}
+			hex := fmt.Sprintf("% x", line)
+			var err error
+			if i == 0 {
+				_, err = fmt.Fprintf(w, "%s %08x  %-23s  %s\n", mark, s.Offset+i, hex, sb.String())
+			} else {
+				_, err = fmt.Fprintf(w, "%s %08x  %s\n", mark, s.Offset+i, hex)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package flexbuffers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildInspected(t *testing.T) Raw {
+	b := NewBuilder()
+	b.Map(func(b *Builder) {
+		b.IntField([]byte("a"), 1)
+		b.StringValueField([]byte("s"), "hello")
+		b.Key([]byte("m"))
+		b.Ext(7)
+		b.Map(func(b *Builder) {
+			b.Float64Field([]byte("f"), 1.5)
+		})
+		b.VectorField([]byte("v"), true, false, func(b *Builder) {
+			b.Int(1)
+			b.Int(2)
+		})
+		b.VectorField([]byte("u"), false, false, func(b *Builder) {
+			b.IndirectInt(-300)
+			b.Null()
+		})
+		b.BlobField([]byte("b"), []byte{1, 2})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Buffer()
+}
+
+func TestRaw_Inspect(t *testing.T) {
+	a := assert.New(t)
+	buf := buildInspected(t)
+	spans := buf.Inspect()
+	a.Empty(InvalidSpans(spans))
+
+	// spans cover the buffer without overlaps
+	pos := 0
+	kinds := map[SpanKind]int{}
+	notes := map[string]string{}
+	for _, s := range spans {
+		a.Equal(pos, s.Offset, "%+v", s)
+		pos = s.End()
+		kinds[s.Kind]++
+		if s.Kind == SpanInline || s.Kind == SpanScalar || s.Kind == SpanString || s.Kind == SpanExt {
+			notes[s.Kind.String()+" "+s.Path] = s.Note
+		}
+	}
+	a.Equal(len(buf), pos)
+	a.Equal(map[string]string{
+		"inline a":   "1",
+		"string s":   `"hello"`,
+		"ext m":      "7",
+		"inline m.f": "1.5",
+		"inline v.0": "1",
+		"inline v.1": "2",
+		"scalar u.0": "-300",
+		"inline u.1": "null",
+	}, notes)
+	for _, k := range []SpanKind{SpanRootType, SpanRootWidth, SpanOffset, SpanSize, SpanKeysOffset, SpanKeysWidth, SpanKey,
+		SpanTerminator, SpanBlob, SpanTypeTable} {
+		a.NotZero(kinds[k], k.String())
+	}
+	a.Zero(kinds[SpanUnreachable])
+
+	var out bytes.Buffer
+	a.NoError(buf.Dump(&out))
+	a.Contains(out.String(), `string (string, width 1) s: "hello"`)
+	a.NotContains(out.String(), "!!")
+}
+
+func TestRaw_Inspect_Broken(t *testing.T) {
+	a := assert.New(t)
+	buf := buildInspected(t)
+
+	// bytes before the document are not reachable
+	prefixed := append(Raw{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad, 0xbe, 0xef, 0}, buf...)
+	spans := prefixed.Inspect()
+	a.Empty(InvalidSpans(spans))
+	a.Equal(Span{Offset: 0, Size: 9, Kind: SpanUnreachable}, spans[0])
+
+	// the root offset points before the buffer
+	broken := append(Raw(nil), buf...)
+	broken[len(broken)-3] = 0xf0
+	invalid := InvalidSpans(broken.Inspect())
+	if a.Len(invalid, 1) {
+		a.Equal(len(broken)-3, invalid[0].Offset)
+		a.Equal(SpanOffset, invalid[0].Kind)
+		a.Equal(ErrOutOfRange, invalid[0].Err)
+	}
+	var out bytes.Buffer
+	a.NoError(broken.Dump(&out))
+	a.Contains(out.String(), "!! ")
+
+	// the type table has an invalid type, other values are still inspected
+	root := buf.RootOrNull().AsMap()
+	sz, _ := root.Size()
+	broken = append(Raw(nil), buf...)
+	broken[root.offset+sz*int(root.byteWidth)] = PackedType(BitWidth8, 30, false)
+	invalid = InvalidSpans(broken.Inspect())
+	if a.Len(invalid, 1) {
+		a.Equal("a", invalid[0].Path)
+	}
+
+	// cyclic offset, the vector has an element pointing the vector itself
+	cyclic := Raw{1, 0, 0x28, 2, 0x28, 1}
+	invalid = InvalidSpans(cyclic.Inspect())
+	if a.Len(invalid, 1) {
+		a.Equal(ErrRecursiveData, invalid[0].Err)
+	}
+
+	for _, b := range []Raw{nil, {1}, {0, 0, 3}, {1, 4, 8}} {
+		a.NotEmpty(InvalidSpans(b.Inspect()), "%v", b)
+	}
+}
@@ -0,0 +1,627 @@
+package flexbuffers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ErrNotFinite is returned by the JSON encoder for NaN and Inf with NaNAsError.
+var ErrNotFinite = errors.New("NaN or Inf cannot be written as JSON")
+
+// NaNPolicy decides how NaN and Inf, which JSON doesn't have, are written.
+type NaNPolicy int
+
+const (
+	// NaNAsNull writes null.
+	NaNAsNull NaNPolicy = iota
+	// NaNAsString writes "NaN", "Infinity" and "-Infinity".
+	NaNAsString
+	// NaNAsError fails with ErrNotFinite.
+	NaNAsError
+)
+
+// BlobEncoding decides how blobs are written.
+type BlobEncoding int
+
+const (
+	// BlobBase64 writes a string of standard base64.
+	BlobBase64 BlobEncoding = iota
+	// BlobHex writes a string of lower case hex.
+	BlobHex
+	// BlobArray writes an array of byte values.
+	BlobArray
+)
+
+// KeyOrder decides the order of map entries.
+type KeyOrder int
+
+const (
+	// KeyOrderOriginal writes entries in the order of the buffer, or the order they were added for ordered maps,
+	// see Builder.SetOrderedMaps.
+	KeyOrderOriginal KeyOrder = iota
+	// KeyOrderSorted writes entries sorted by keys, entries with the same key keep their order.
+	KeyOrderSorted
+)
+
+// JsonOptions configures JSON output. The zero value writes compact JSON.
+type JsonOptions struct {
+	// Indent pretty-prints with Indent for each level, if not empty.
+	Indent   string
+	NaN      NaNPolicy
+	KeyOrder KeyOrder
+	Blob     BlobEncoding
+	// Ext writes values with ext as {"$ext":n,"value":...}.
+	Ext bool
+	// Extended writes the extended JSON dialect, which keeps the type of every value, so that the document is
+	// read back exactly by process.JsonReader with Extended. Values without a JSON counterpart are written as
+	// objects of a single tag, like {"$uint":1}, {"$float":"NaN"}, {"$key":"k"} or {"$vectorInt2":[1,2]},
+	// see ExtendedJsonTag. Maps whose first key starts with "$" are written as {"$map":{...}}.
+	// Ext is implied, NaN and Blob are ignored.
+	Extended bool
+	// NumberExt, if not zero, writes strings with ext NumberExt as numbers, if they are number literals.
+	// process.JsonReader with the same NumberExt keeps numbers as such strings. Ignored if Extended.
+	NumberExt int64
+}
+
+// extendedJsonTags are the tags of the extended JSON dialect, by the type of the tagged value.
+var extendedJsonTags = map[Type]string{
+	FBTInt:           "$int",
+	FBTUint:          "$uint",
+	FBTFloat:         "$float",
+	FBTKey:           "$key",
+	FBTIndirectInt:   "$indirectInt",
+	FBTIndirectUInt:  "$indirectUInt",
+	FBTIndirectFloat: "$indirectFloat",
+	FBTMap:           "$map",
+	FBTVectorInt:     "$vectorInt",
+	FBTVectorUInt:    "$vectorUInt",
+	FBTVectorFloat:   "$vectorFloat",
+	FBTVectorKey:     "$vectorKey",
+	FBTVectorString:  "$vectorString",
+	FBTVectorInt2:    "$vectorInt2",
+	FBTVectorUInt2:   "$vectorUInt2",
+	FBTVectorFloat2:  "$vectorFloat2",
+	FBTVectorInt3:    "$vectorInt3",
+	FBTVectorUInt3:   "$vectorUInt3",
+	FBTVectorFloat3:  "$vectorFloat3",
+	FBTVectorInt4:    "$vectorInt4",
+	FBTVectorUInt4:   "$vectorUInt4",
+	FBTVectorFloat4:  "$vectorFloat4",
+	FBTBlob:          "$blob",
+}
+
+var extendedJsonTypes = func() map[string]Type {
+	m := make(map[string]Type, len(extendedJsonTags))
+	for t, tag := range extendedJsonTags {
+		m[tag] = t
+	}
+	return m
+}()
+
+// ExtendedJsonTag returns the tag of values of t in the extended JSON dialect,
+// or "" if they are written as plain JSON.
+//
+// Scalars are tagged as {"$int":-1}, blobs as {"$blob":"<base64>"}, and typed vectors as
+// {"$vectorInt":[1,2]}, where elements are written without tags. Floats which are not finite are
+// written as "NaN", "Infinity" and "-Infinity". "$map" tags maps whose first key starts with "$".
+func ExtendedJsonTag(t Type) string {
+	return extendedJsonTags[t]
+}
+
+// ExtendedJsonTagType returns the type tagged by tag in the extended JSON dialect.
+func ExtendedJsonTagType(tag string) (Type, bool) {
+	t, ok := extendedJsonTypes[tag]
+	return t, ok
+}
+
+// IsJsonNumber reports whether s is a number literal of JSON.
+func IsJsonNumber(s string) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	switch {
+	case i == len(s):
+		return false
+	case s[i] == '0':
+		i++
+	case '1' <= s[i] && s[i] <= '9':
+		i = skipDigits(s, i)
+	default:
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		j := skipDigits(s, i+1)
+		if j == i+1 {
+			return false
+		}
+		i = j
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		j := skipDigits(s, i)
+		if j == i {
+			return false
+		}
+		i = j
+	}
+	return i == len(s)
+}
+
+func skipDigits(s string, i int) int {
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// AppendJsonFloat appends f as the shortest representation which is read back as the same float64,
+// like encoding/json. Integral floats end with ".0" to be read back as floats. NaN and Inf, which are not
+// JSON numbers, are appended as the strings "NaN", "Infinity" and "-Infinity".
+func AppendJsonFloat(dst []byte, f float64) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(dst, `"NaN"`...)
+	case math.IsInf(f, 1):
+		return append(dst, `"Infinity"`...)
+	case math.IsInf(f, -1):
+		return append(dst, `"-Infinity"`...)
+	}
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if abs < 1e-6 || abs >= 1e21 {
+			format = 'e'
+		}
+	}
+	n := len(dst)
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'f' && bytes.IndexByte(dst[n:], '.') < 0 {
+		dst = append(dst, ".0"...)
+	}
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+// JsonEncoder writes documents as JSON. Each document is encoded in a buffer reused across documents,
+// and written with a single Write.
+type JsonEncoder struct {
+	w    io.Writer
+	opts JsonOptions
+	buf  []byte
+}
+
+func NewJsonEncoder(w io.Writer, opts JsonOptions) *JsonEncoder {
+	return &JsonEncoder{w: w, opts: opts}
+}
+
+// Encode writes r as JSON. Nothing is written if r cannot be encoded.
+func (e *JsonEncoder) Encode(r Reference) error {
+	buf, err := r.AppendJson(e.buf[:0], e.opts)
+	e.buf = buf[:0]
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(buf)
+	return err
+}
+
+func (r Reference) WriteAsJson(w io.Writer) error {
+	return r.WriteAsJsonWithOptions(w, JsonOptions{})
+}
+
+func (r Reference) WriteAsJsonWithOptions(w io.Writer, opts JsonOptions) error {
+	return NewJsonEncoder(w, opts).Encode(r)
+}
+
+// AppendJson appends r as JSON to dst.
+func (r Reference) AppendJson(dst []byte, opts JsonOptions) ([]byte, error) {
+	e := jsonAppender{opts: &opts}
+	return e.value(dst, r, 0)
+}
+
+type jsonEntry struct {
+	key   string
+	index int
+}
+
+type jsonAppender struct {
+	opts *JsonOptions
+	// entries is reused by maps written in KeyOrderSorted
+	entries []jsonEntry
+	// indexes is reused by ordered maps
+	indexes []int
+}
+
+// newline starts a line indented for depth, if pretty-printing.
+func (e *jsonAppender) newline(dst []byte, depth int) []byte {
+	if e.opts.Indent == "" {
+		return dst
+	}
+	dst = append(dst, '\n')
+	for i := 0; i < depth; i++ {
+		dst = append(dst, e.opts.Indent...)
+	}
+	return dst
+}
+
+func (e *jsonAppender) value(dst []byte, r Reference, depth int) ([]byte, error) {
+	if e.opts.NumberExt != 0 && !e.opts.Extended && r.IsString() && r.Ext() == e.opts.NumberExt {
+		s, err := r.StringRef()
+		if err != nil {
+			return dst, err
+		}
+		v, err := s.UnsafeStringValue()
+		if err != nil {
+			return dst, err
+		}
+		if IsJsonNumber(v) {
+			return append(dst, v...), nil
+		}
+	}
+	if e.opts.Ext || e.opts.Extended {
+		if ext := r.Ext(); ext != 0 {
+			dst = append(dst, '{')
+			dst = e.newline(dst, depth+1)
+			dst = append(dst, `"$ext":`...)
+			if e.opts.Indent != "" {
+				dst = append(dst, ' ')
+			}
+			dst = strconv.AppendInt(dst, ext, 10)
+			dst = append(dst, ',')
+			dst = e.newline(dst, depth+1)
+			dst = append(dst, `"value":`...)
+			if e.opts.Indent != "" {
+				dst = append(dst, ' ')
+			}
+			var err error
+			if dst, err = e.content(dst, r, depth+1); err != nil {
+				return dst, err
+			}
+			dst = e.newline(dst, depth)
+			return append(dst, '}'), nil
+		}
+	}
+	return e.content(dst, r, depth)
+}
+
+// content appends r without ext, tagged if the extended dialect has a tag for it.
+func (e *jsonAppender) content(dst []byte, r Reference, depth int) ([]byte, error) {
+	if e.opts.Extended && r.type_ != FBTMap {
+		if tag := extendedJsonTags[r.type_]; tag != "" {
+			dst = e.tagStart(dst, tag)
+			var err error
+			if r.IsAnyVector() {
+				dst, err = e.typedVector(dst, r)
+			} else {
+				dst, err = e.element(dst, r)
+			}
+			if err != nil {
+				return dst, err
+			}
+			return append(dst, '}'), nil
+		}
+	}
+	return e.plainValue(dst, r, depth)
+}
+
+// tagStart opens a tag object of the extended dialect.
+func (e *jsonAppender) tagStart(dst []byte, tag string) []byte {
+	dst = append(dst, '{')
+	dst = EscapeJSONString(dst, tag)
+	dst = append(dst, ':')
+	if e.opts.Indent != "" {
+		dst = append(dst, ' ')
+	}
+	return dst
+}
+
+// element appends a scalar without tag, as the content of a tag object or an element of a typed vector.
+func (e *jsonAppender) element(dst []byte, r Reference) ([]byte, error) {
+	if !r.IsBlob() {
+		return e.plainValue(dst, r, 0)
+	}
+	b, err := r.Blob()
+	if err != nil {
+		return dst, err
+	}
+	d, err := b.Data()
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, '"')
+	n := len(dst)
+	dst = append(dst, make([]byte, base64.StdEncoding.EncodedLen(len(d)))...)
+	base64.StdEncoding.Encode(dst[n:], d)
+	return append(dst, '"'), nil
+}
+
+// typedVector appends elements of a typed vector in a line.
+func (e *jsonAppender) typedVector(dst []byte, r Reference) ([]byte, error) {
+	vec, err := r.AnyVector()
+	if err != nil {
+		return dst, err
+	}
+	sz, err := vec.Size()
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, '[')
+	var elem Reference
+	for i := 0; i < sz; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+			if e.opts.Indent != "" {
+				dst = append(dst, ' ')
+			}
+		}
+		if err := vec.AtRef(i, &elem); err != nil {
+			return dst, err
+		}
+		if dst, err = e.element(dst, elem); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+func (e *jsonAppender) plainValue(dst []byte, r Reference, depth int) ([]byte, error) {
+	switch {
+	case r.IsNull():
+		return append(dst, "null"...), nil
+	case r.IsBool():
+		b, err := r.Bool()
+		if err != nil {
+			return dst, err
+		}
+		return strconv.AppendBool(dst, b), nil
+	case r.IsInt():
+		i, err := r.Int64()
+		if err != nil {
+			return dst, err
+		}
+		return strconv.AppendInt(dst, i, 10), nil
+	case r.IsUInt():
+		u, err := r.UInt64()
+		if err != nil {
+			return dst, err
+		}
+		return strconv.AppendUint(dst, u, 10), nil
+	case r.IsFloat():
+		f, err := r.Float64()
+		if err != nil {
+			return dst, err
+		}
+		return e.float(dst, f)
+	case r.IsKey():
+		k, err := r.asStringKey()
+		if err != nil {
+			return dst, err
+		}
+		return EscapeJSONString(dst, k), nil
+	case r.IsString():
+		s, err := r.StringRef()
+		if err != nil {
+			return dst, err
+		}
+		v, err := s.UnsafeStringValue()
+		if err != nil {
+			return dst, err
+		}
+		return EscapeJSONString(dst, v), nil
+	case r.IsBlob():
+		b, err := r.Blob()
+		if err != nil {
+			return dst, err
+		}
+		d, err := b.Data()
+		if err != nil {
+			return dst, err
+		}
+		return e.blob(dst, d, depth), nil
+	case r.IsMap():
+		return e.jsonMap(dst, r, depth)
+	case r.IsAnyVector():
+		vec, err := r.AnyVector()
+		if err != nil {
+			return dst, err
+		}
+		sz, err := vec.Size()
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, '[')
+		var elem Reference
+		for i := 0; i < sz; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = e.newline(dst, depth+1)
+			if err := vec.AtRef(i, &elem); err != nil {
+				return dst, err
+			}
+			if dst, err = e.value(dst, elem, depth+1); err != nil {
+				return dst, err
+			}
+		}
+		if sz > 0 {
+			dst = e.newline(dst, depth)
+		}
+		return append(dst, ']'), nil
+	default:
+		return dst, fmt.Errorf("unable to convert to json: type=%v", r.type_)
+	}
+}
+
+func (e *jsonAppender) jsonMap(dst []byte, r Reference, depth int) ([]byte, error) {
+	m, err := r.Map()
+	if err != nil {
+		return dst, err
+	}
+	keys, err := m.Keys()
+	if err != nil {
+		return dst, err
+	}
+	sz, err := m.Size()
+	if err != nil {
+		return dst, err
+	}
+	values := m.Values()
+	var order []jsonEntry
+	if e.opts.KeyOrder == KeyOrderSorted {
+		start := len(e.entries)
+		for i := 0; i < sz; i++ {
+			k, err := keys.At(i)
+			if err != nil {
+				return dst, err
+			}
+			ks, err := k.asStringKey()
+			if err != nil {
+				return dst, err
+			}
+			e.entries = append(e.entries, jsonEntry{key: ks, index: i})
+		}
+		order = e.entries[start:]
+		sort.SliceStable(order, func(i, j int) bool {
+			return order[i].key < order[j].key
+		})
+		// nested maps append after the entries of this map
+		defer func() {
+			e.entries = e.entries[:start]
+		}()
+	}
+	var indexes []int
+	if order == nil && m.Ordered() {
+		start := len(e.indexes)
+		if e.indexes, err = m.AppendOrder(e.indexes); err != nil {
+			return dst, err
+		}
+		indexes = e.indexes[start:]
+		defer func() {
+			e.indexes = e.indexes[:start]
+		}()
+	}
+	var k, v Reference
+	// maps are tagged in the extended dialect, if they would be read as tag objects
+	tagged := false
+	if e.opts.Extended && sz > 0 {
+		first := 0
+		if order != nil {
+			first = order[0].index
+		} else if indexes != nil {
+			first = indexes[0]
+		}
+		if err := keys.AtRef(first, &k); err != nil {
+			return dst, err
+		}
+		ks, err := k.asStringKey()
+		if err != nil {
+			return dst, err
+		}
+		tagged = len(ks) > 0 && ks[0] == '$'
+	}
+	if tagged {
+		dst = e.tagStart(dst, extendedJsonTags[FBTMap])
+	}
+	dst = append(dst, '{')
+	for i := 0; i < sz; i++ {
+		idx := i
+		if order != nil {
+			idx = order[i].index
+		} else if indexes != nil {
+			idx = indexes[i]
+		}
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = e.newline(dst, depth+1)
+		if err := keys.AtRef(idx, &k); err != nil {
+			return dst, err
+		}
+		ks, err := k.asStringKey()
+		if err != nil {
+			return dst, err
+		}
+		dst = EscapeJSONString(dst, ks)
+		dst = append(dst, ':')
+		if e.opts.Indent != "" {
+			dst = append(dst, ' ')
+		}
+		if err := values.AtRef(idx, &v); err != nil {
+			return dst, err
+		}
+		if dst, err = e.value(dst, v, depth+1); err != nil {
+			return dst, err
+		}
+	}
+	if sz > 0 {
+		dst = e.newline(dst, depth)
+	}
+	dst = append(dst, '}')
+	if tagged {
+		dst = append(dst, '}')
+	}
+	return dst, nil
+}
+
+// float appends f as AppendJsonFloat does. Floats stored in 4 bytes are written as float64 too,
+// so the written value is exactly the stored one.
+func (e *jsonAppender) float(dst []byte, f float64) ([]byte, error) {
+	if !e.opts.Extended && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		switch e.opts.NaN {
+		case NaNAsString:
+		case NaNAsError:
+			return dst, ErrNotFinite
+		default:
+			return append(dst, "null"...), nil
+		}
+	}
+	return AppendJsonFloat(dst, f), nil
+}
+
+func (e *jsonAppender) blob(dst []byte, d []byte, depth int) []byte {
+	switch e.opts.Blob {
+	case BlobHex:
+		dst = append(dst, '"')
+		n := len(dst)
+		dst = append(dst, make([]byte, hex.EncodedLen(len(d)))...)
+		hex.Encode(dst[n:], d)
+		return append(dst, '"')
+	case BlobArray:
+		dst = append(dst, '[')
+		for i, c := range d {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = e.newline(dst, depth+1)
+			dst = strconv.AppendUint(dst, uint64(c), 10)
+		}
+		if len(d) > 0 {
+			dst = e.newline(dst, depth)
+		}
+		return append(dst, ']')
+	default:
+		dst = append(dst, '"')
+		n := len(dst)
+		dst = append(dst, make([]byte, base64.StdEncoding.EncodedLen(len(d)))...)
+		base64.StdEncoding.Encode(dst[n:], d)
+		return append(dst, '"')
+	}
+}
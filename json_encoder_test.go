@@ -0,0 +1,304 @@
+package flexbuffers
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonEncoder(t *testing.T) {
+	cases := []struct {
+		name     string
+		buildFn  func(b *Builder)
+		opts     JsonOptions
+		expected string
+	}{
+		{
+			name: "scalars",
+			buildFn: func(b *Builder) {
+				b.Vector(false, false, func(b *Builder) {
+					b.Null()
+					b.Bool(true)
+					b.Int(-1)
+					b.UInt(math.MaxUint64)
+					b.IndirectInt(-2)
+				})
+			},
+			expected: `[null,true,-1,18446744073709551615,-2]`,
+		},
+		{
+			name: "shortest floats",
+			buildFn: func(b *Builder) {
+				b.Vector(false, false, func(b *Builder) {
+					b.Float64(0.1)
+					b.Float64(1e-9)
+					b.Float64(1)
+					b.Float64(-1e21)
+					b.Float32(0.5)
+					b.IndirectFloat64(123456.789)
+				})
+			},
+			expected: `[0.1,1e-9,1.0,-1e+21,0.5,123456.789]`,
+		},
+		{
+			name: "float32 as stored",
+			buildFn: func(b *Builder) {
+				b.Map(func(b *Builder) {
+					b.Float32Field([]byte("a"), 0.1)
+					b.Float32Field([]byte("b"), 18446744073709551700)
+				})
+			},
+			// float64 readers read back the stored values
+			expected: `{"a":0.10000000149011612,"b":18446744073709552000.0}`,
+		},
+		{
+			name: "escaped strings and keys",
+			buildFn: func(b *Builder) {
+				b.Map(func(b *Builder) {
+					b.StringValueField([]byte("%s\"k\""), "100%\n\x01")
+				})
+			},
+			expected: `{"%s\"k\"":"100%\n\u0001"}`,
+		},
+		{
+			name: "NaN as null",
+			buildFn: func(b *Builder) {
+				b.Vector(false, false, func(b *Builder) {
+					b.Float64(math.NaN())
+					b.Float64(math.Inf(-1))
+				})
+			},
+			expected: `[null,null]`,
+		},
+		{
+			name: "NaN as string",
+			buildFn: func(b *Builder) {
+				b.Vector(false, false, func(b *Builder) {
+					b.Float64(math.NaN())
+					b.Float64(math.Inf(1))
+					b.Float64(math.Inf(-1))
+				})
+			},
+			opts:     JsonOptions{NaN: NaNAsString},
+			expected: `["NaN","Infinity","-Infinity"]`,
+		},
+		{
+			name: "blobs",
+			buildFn: func(b *Builder) {
+				b.Vector(false, false, func(b *Builder) {
+					b.Blob([]byte{0, 0xff})
+				})
+			},
+			expected: `["AP8="]`,
+		},
+		{
+			name: "blobs in hex",
+			buildFn: func(b *Builder) {
+				b.Blob([]byte{0, 0xff})
+			},
+			opts:     JsonOptions{Blob: BlobHex},
+			expected: `"00ff"`,
+		},
+		{
+			name: "blobs in array",
+			buildFn: func(b *Builder) {
+				b.Blob([]byte{0, 0xff})
+			},
+			opts:     JsonOptions{Blob: BlobArray},
+			expected: `[0,255]`,
+		},
+		{
+			name: "typed vectors",
+			buildFn: func(b *Builder) {
+				b.Vector(false, false, func(b *Builder) {
+					b.Vector(true, false, func(b *Builder) {
+						b.UInt(1)
+						b.UInt(2)
+					})
+					b.Vector(true, false, func(b *Builder) {
+						b.Float64(1.5)
+						b.Float64(-2)
+					})
+				})
+			},
+			expected: `[[1,2],[1.5,-2.0]]`,
+		},
+		{
+			name: "ext",
+			buildFn: func(b *Builder) {
+				b.Map(func(b *Builder) {
+					b.Ext(7)
+					b.StringValueField([]byte("a"), "x")
+					b.IntField([]byte("b"), 1)
+				})
+			},
+			opts:     JsonOptions{Ext: true},
+			expected: `{"a":{"$ext":7,"value":"x"},"b":1}`,
+		},
+		{
+			name: "ext is ignored by default",
+			buildFn: func(b *Builder) {
+				b.Ext(7)
+				b.StringValue("x")
+			},
+			expected: `"x"`,
+		},
+		{
+			name: "pretty-print",
+			buildFn: func(b *Builder) {
+				b.Map(func(b *Builder) {
+					b.VectorField([]byte("a"), false, false, func(b *Builder) {
+						b.Int(1)
+						b.Map(func(b *Builder) {})
+						b.Vector(false, false, func(b *Builder) {})
+					})
+					b.Ext(3)
+					b.StringValueField([]byte("b"), "x")
+				})
+			},
+			opts: JsonOptions{Indent: "  ", Ext: true},
+			expected: `{
+  "a": [
+    1,
+    {},
+    []
+  ],
+  "b": {
+    "$ext": 3,
+    "value": "x"
+  }
+}`,
+		},
+		{
+			name: "number ext",
+			buildFn: func(b *Builder) {
+				b.Vector(false, false, func(b *Builder) {
+					b.Ext(5)
+					b.StringValue("1.10")
+					b.Ext(5)
+					b.StringValue("1.10.1")
+					b.Ext(6)
+					b.StringValue("2")
+				})
+			},
+			opts:     JsonOptions{NumberExt: 5},
+			expected: `[1.10,"1.10.1","2"]`,
+		},
+		{
+			name: "extended",
+			buildFn: func(b *Builder) {
+				b.Map(func(b *Builder) {
+					b.VectorField([]byte("a"), false, false, func(b *Builder) {
+						b.UInt(1)
+						b.Float64(math.NaN())
+						b.IndirectInt(-1)
+						b.Blob([]byte{0, 0xff})
+					})
+					b.VectorField([]byte("b"), true, true, func(b *Builder) {
+						b.Float64(0.5)
+						b.Float64(1)
+					})
+					b.MapField([]byte("c"), func(b *Builder) {
+						b.Ext(2)
+						b.StringValueField([]byte("$k"), "x")
+					})
+				})
+			},
+			// NaN and Blob are ignored
+			opts:     JsonOptions{Extended: true, NaN: NaNAsError, Blob: BlobHex},
+			expected: `{"a":[{"$uint":1},{"$float":"NaN"},{"$indirectInt":-1},{"$blob":"AP8="}],"b":{"$vectorFloat2":[0.5,1.0]},"c":{"$map":{"$k":{"$ext":2,"value":"x"}}}}`,
+		},
+		{
+			name: "extended pretty-print",
+			buildFn: func(b *Builder) {
+				b.Map(func(b *Builder) {
+					b.VectorField([]byte("a"), true, false, func(b *Builder) {
+						b.Int(1)
+						b.Int(2)
+					})
+					b.MapField([]byte("b"), func(b *Builder) {
+						b.UIntField([]byte("$u"), 1)
+					})
+				})
+			},
+			opts: JsonOptions{Extended: true, Indent: "  "},
+			expected: `{
+  "a": {"$vectorInt": [1, 2]},
+  "b": {"$map": {
+    "$u": {"$uint": 1}
+  }}
+}`,
+		},
+	}
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			a := assert.New(t)
+			b := NewBuilder()
+			cas.buildFn(b)
+			if err := b.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if a.NoError(b.Buffer().RootOrNull().WriteAsJsonWithOptions(&buf, cas.opts)) {
+				a.Equal(cas.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestJsonEncoder_NaNAsError(t *testing.T) {
+	a := assert.New(t)
+	b := NewBuilder()
+	b.Vector(false, false, func(b *Builder) {
+		b.Int(1)
+		b.Float64(math.Inf(1))
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err := b.Buffer().RootOrNull().WriteAsJsonWithOptions(&buf, JsonOptions{NaN: NaNAsError})
+	a.Equal(ErrNotFinite, err)
+	// nothing is written on errors
+	a.Equal(0, buf.Len())
+}
+
+func TestJsonEncoder_KeyOrder(t *testing.T) {
+	a := assert.New(t)
+	b := NewBuilder()
+	b.Map(func(b *Builder) {
+		b.IntField([]byte("a"), 1)
+		b.IntField([]byte("b"), 2)
+		b.MapField([]byte("c"), func(b *Builder) {
+			b.IntField([]byte("x"), 3)
+		})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	buf := append(Raw(nil), b.Buffer()...)
+	keys, _ := buf.RootOrNull().AsMap().Keys()
+	a.Equal(uint8(1), keys.byteWidth)
+	// swap targets of the first and second keys
+	first, second := buf[keys.offset], buf[keys.offset+1]
+	buf[keys.offset], buf[keys.offset+1] = second-1, first+1
+
+	root := buf.RootOrNull()
+	out, err := root.AppendJson(nil, JsonOptions{})
+	if a.NoError(err) {
+		a.Equal(`{"b":1,"a":2,"c":{"x":3}}`, string(out))
+	}
+	out, err = root.AppendJson(out[:0], JsonOptions{KeyOrder: KeyOrderSorted})
+	if a.NoError(err) {
+		a.Equal(`{"a":2,"b":1,"c":{"x":3}}`, string(out))
+	}
+
+	// the encoder reuses its buffer
+	var w bytes.Buffer
+	enc := NewJsonEncoder(&w, JsonOptions{KeyOrder: KeyOrderSorted})
+	a.NoError(enc.Encode(root))
+	a.NoError(enc.Encode(root.AsMap().GetOrNull("c")))
+	a.Equal(`{"a":2,"b":1,"c":{"x":3}}{"x":3}`, w.String())
+}
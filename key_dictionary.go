@@ -0,0 +1,187 @@
+package flexbuffers
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrNoKeyDictionary  = errors.New("map keys are stored in a key dictionary, but no dictionary is given")
+	ErrUnknownKeyVector = errors.New("key vector is not in the key dictionary, the dictionary might be older than the document")
+)
+
+// KeyDictionary is an append-only list of map key vectors shared by documents.
+// A Builder with a key dictionary (see Builder.SetKeyDictionary) stores only the index of the key vector
+// for each map, so documents of the same schema don't repeat their key strings.
+//
+// The version of a dictionary is the number of key vectors in it. A document can be read with the dictionary
+// used to build it, or any later version of it. It's up to the user to store the dictionary with documents.
+// KeyDictionary is safe for concurrent use.
+type KeyDictionary struct {
+	mu sync.Mutex
+	// null terminated sorted keys -> index of the key vector
+	index   map[string]int
+	vectors atomic.Value // []TypedVector
+}
+
+func NewKeyDictionary() *KeyDictionary {
+	d := &KeyDictionary{
+		index: make(map[string]int),
+	}
+	d.vectors.Store([]TypedVector(nil))
+	return d
+}
+
+// LoadKeyDictionary restores the dictionary serialized by KeyDictionary.Bytes. data is referenced, not copied.
+func LoadKeyDictionary(data Raw) (*KeyDictionary, error) {
+	if err := data.Validate(); err != nil {
+		return nil, err
+	}
+	root, err := data.Root()
+	if err != nil {
+		return nil, err
+	}
+	if root.Type() != FBTVector {
+		return nil, ErrInvalidData
+	}
+	vec, err := root.Vector()
+	if err != nil {
+		return nil, err
+	}
+	sz, err := vec.Size()
+	if err != nil {
+		return nil, err
+	}
+	d := NewKeyDictionary()
+	vectors := make([]TypedVector, 0, sz)
+	var keys []byte
+	for i := 0; i < sz; i++ {
+		ref, err := vec.At(i)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Type() != FBTVectorKey {
+			return nil, ErrInvalidData
+		}
+		tv, err := ref.TypedVector()
+		if err != nil {
+			return nil, err
+		}
+		if keys, err = appendKeys(keys[:0], tv); err != nil {
+			return nil, err
+		}
+		if _, ok := d.index[string(keys)]; !ok {
+			d.index[string(keys)] = i
+		}
+		vectors = append(vectors, tv)
+	}
+	d.vectors.Store(vectors)
+	return d, nil
+}
+
+// appendKeys appends null terminated keys of the vector to dst. Keys must be sorted to be looked up.
+func appendKeys(dst []byte, keys TypedVector) ([]byte, error) {
+	n, err := keys.Size()
+	if err != nil {
+		return nil, err
+	}
+	var prev string
+	for i := 0; i < n; i++ {
+		k, err := keys.At(i)
+		if err != nil {
+			return nil, err
+		}
+		s := k.AsKey().StringValue()
+		if i > 0 && s < prev {
+			return nil, ErrInvalidData
+		}
+		prev = s
+		dst = append(append(dst, s...), 0)
+	}
+	return dst, nil
+}
+
+func (d *KeyDictionary) load() []TypedVector {
+	return d.vectors.Load().([]TypedVector)
+}
+
+// Version returns the number of key vectors in the dictionary.
+func (d *KeyDictionary) Version() int {
+	return len(d.load())
+}
+
+// KeyVector returns the i-th key vector.
+func (d *KeyDictionary) KeyVector(i int) (TypedVector, error) {
+	vectors := d.load()
+	if i < 0 || len(vectors) <= i {
+		return TypedVector{}, ErrUnknownKeyVector
+	}
+	return vectors[i], nil
+}
+
+// add returns the index of the key vector, appending it if not exists. keys are sorted null terminated strings.
+func (d *KeyDictionary) add(keys []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if i, ok := d.index[string(keys)]; ok {
+		return i, nil
+	}
+	b := NewBuilder()
+	start := b.StartVector()
+	for rest := keys; len(rest) > 0; {
+		k := readCStringBytes(rest, 0)
+		b.Key(k)
+		rest = rest[len(k)+1:]
+	}
+	if _, err := b.EndVector(start, true, false); err != nil {
+		return 0, err
+	}
+	if err := b.Finish(); err != nil {
+		return 0, err
+	}
+	root, err := b.Buffer().Root()
+	if err != nil {
+		return 0, err
+	}
+	tv, err := root.TypedVector()
+	if err != nil {
+		return 0, err
+	}
+	// readers may hold the current slice, but they never see elements beyond its length
+	vectors := d.load()
+	i := len(vectors)
+	d.vectors.Store(append(vectors, tv))
+	d.index[string(keys)] = i
+	return i, nil
+}
+
+// Bytes serializes the dictionary as a flexbuffers vector of key vectors.
+func (d *KeyDictionary) Bytes() (Raw, error) {
+	b := NewBuilderWithFlags(BuilderFlagShareKeys)
+	outer := b.StartVector()
+	for _, keys := range d.load() {
+		n, err := keys.Size()
+		if err != nil {
+			return nil, err
+		}
+		start := b.StartVector()
+		for i := 0; i < n; i++ {
+			k, err := keys.At(i)
+			if err != nil {
+				return nil, err
+			}
+			b.Key([]byte(k.AsKey().StringValue()))
+		}
+		if _, err := b.EndVector(start, true, false); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := b.EndVector(outer, false, false); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
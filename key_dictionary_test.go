@@ -0,0 +1,162 @@
+package flexbuffers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildWithKeyDictionary(t *testing.T, d *KeyDictionary, id int64) Raw {
+	b := NewBuilder()
+	b.SetKeyDictionary(d)
+	b.Map(func(b *Builder) {
+		b.IntField([]byte("id"), id)
+		b.StringValueField([]byte("name"), "flexbuffers")
+		b.MapField([]byte("user"), func(b *Builder) {
+			b.StringValueField([]byte("screen_name"), "foo")
+			b.IntField([]byte("followers"), 100)
+		})
+		b.VectorField([]byte("tags"), false, false, func(b *Builder) {
+			b.Map(func(b *Builder) {
+				b.StringValueField([]byte("text"), "a")
+			})
+			b.Map(func(b *Builder) {
+				b.StringValueField([]byte("text"), "b")
+			})
+		})
+		b.VectorField([]byte("keys"), true, false, func(b *Builder) {
+			b.Key([]byte("x"))
+			b.Key([]byte("y"))
+		})
+		b.Key([]byte("ext"))
+		b.Ext(7)
+		b.Map(func(b *Builder) {
+			b.BoolField([]byte("ok"), true)
+		})
+		b.MapField([]byte("large"), func(b *Builder) {
+			for i := 0; i < 20; i++ {
+				b.IntField([]byte(fmt.Sprintf("k%02d", i)), int64(i))
+			}
+		})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	return append(Raw(nil), b.Buffer()...)
+}
+
+func TestKeyDictionary(t *testing.T) {
+	a := assert.New(t)
+	d := NewKeyDictionary()
+	doc1 := buildWithKeyDictionary(t, d, 1)
+	version := d.Version()
+	a.Equal(5, version) // root, user, tags elements, ext, large
+	doc2 := buildWithKeyDictionary(t, d, 2)
+	a.Equal(version, d.Version())
+	a.Equal(len(doc1), len(doc2))
+	a.False(bytes.Contains(doc1, []byte("screen_name")))
+	a.True(bytes.Contains(doc1, []byte("x\x00y\x00")), "keys outside of maps are in the buffer")
+
+	data, err := d.Bytes()
+	if !a.NoError(err) {
+		return
+	}
+	loaded, err := LoadKeyDictionary(data)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(version, loaded.Version())
+
+	for _, dict := range []*KeyDictionary{d, loaded} {
+		a.NoError(doc2.RootOrNull().WithKeyDictionary(dict).Validate())
+		r, err := doc2.LookupWithKeyDictionary(dict, "user", "screen_name")
+		if a.NoError(err) {
+			a.Equal("foo", r.AsStringRef().StringValueOrEmpty())
+		}
+		r, err = doc2.LookupWithKeyDictionary(dict, "large", "k13")
+		if a.NoError(err) {
+			a.Equal(int64(13), r.AsInt64())
+		}
+		_, err = doc2.LookupWithKeyDictionary(dict, "large", "k20")
+		a.Equal(ErrNotFound, err)
+
+		root, err := doc2.RootWithKeyDictionary(dict)
+		if !a.NoError(err) {
+			return
+		}
+		m := root.AsMap()
+		a.Equal(int64(2), m.GetOrNull("id").AsInt64())
+		a.Equal(int64(13), m.GetOrNull("large").AsMap().GetOrNull("k13").AsInt64())
+		tag := m.GetOrNull("tags").AsVector().AtOrNull(1).AsMap()
+		a.Equal("b", tag.GetOrNull("text").AsStringRef().StringValueOrEmpty())
+		ext := m.GetOrNull("ext")
+		a.Equal(int64(7), ext.AsMap().Ext())
+		a.True(ext.AsMap().GetOrNull("ok").AsBool())
+
+		var buf bytes.Buffer
+		if a.NoError(root.WriteAsJson(&buf)) {
+			a.Contains(buf.String(), `"user":{"followers":100,"screen_name":"foo"}`)
+			a.Contains(buf.String(), `"keys":["x","y"]`)
+		}
+	}
+
+	// without the dictionary
+	_, err = doc1.Lookup("user")
+	a.Equal(ErrNoKeyDictionary, err)
+	_, err = doc1.RootOrNull().AsMap().Get("id")
+	a.Equal(ErrNoKeyDictionary, err)
+	a.True(errors.Is(doc1.Validate(), ErrNoKeyDictionary))
+
+	// the dictionary is older than the document
+	b := NewBuilder()
+	b.SetKeyDictionary(d)
+	b.Map(func(b *Builder) {
+		b.IntField([]byte("new"), 1)
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	a.Equal(version+1, d.Version())
+	_, err = b.Buffer().LookupWithKeyDictionary(loaded, "new")
+	a.Equal(ErrUnknownKeyVector, err)
+	r, err := b.Buffer().LookupWithKeyDictionary(d, "new")
+	if a.NoError(err) {
+		a.Equal(int64(1), r.AsInt64())
+	}
+}
+
+func TestKeyDictionary_Size(t *testing.T) {
+	a := assert.New(t)
+	d := NewKeyDictionary()
+	withDict := buildWithKeyDictionary(t, d, 1)
+	withoutDict := buildWithKeyDictionary(t, nil, 1)
+	a.NoError(withoutDict.Validate())
+	a.True(len(withDict)*2 < len(withoutDict), "with dictionary: %d, without: %d", len(withDict), len(withoutDict))
+}
+
+func TestLoadKeyDictionary_Errors(t *testing.T) {
+	a := assert.New(t)
+	b := NewBuilder()
+	b.Vector(false, false, func(b *Builder) {
+		b.Vector(true, false, func(b *Builder) {
+			b.Key([]byte("b"))
+			b.Key([]byte("a"))
+		})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadKeyDictionary(b.Buffer())
+	a.Equal(ErrInvalidData, err, "unsorted keys")
+
+	b = NewBuilder()
+	b.Int(1)
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadKeyDictionary(b.Buffer())
+	a.Equal(ErrInvalidData, err)
+}
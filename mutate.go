@@ -0,0 +1,198 @@
+package flexbuffers
+
+import "fmt"
+
+// UpdateError is returned by Set and its family when the value doesn't fit the bytes the old value is stored in.
+// It wraps ErrUpdateDoesntFit.
+type UpdateError struct {
+	// Offset is the offset of the value, or of the data of strings and blobs.
+	Offset int
+	// Size is the byte width of scalars, or the size of strings and blobs.
+	Size int
+	// Needed is the byte width or the size the new value needs.
+	Needed int
+}
+
+func (e *UpdateError) Error() string {
+	return fmt.Sprintf("%v: %d bytes needed at offset %d, but %d bytes are available", ErrUpdateDoesntFit, e.Needed, e.Offset, e.Size)
+}
+
+func (e *UpdateError) Unwrap() error {
+	return ErrUpdateDoesntFit
+}
+
+// Set updates the value r refers to in place, by the setter for the type of v: bool, signed and unsigned integers,
+// float32, float64, string and []byte.
+//
+// Scalars are rewritten in the bytes they are stored in, the vector or map holding them is not resized.
+// A value needing more bytes fails with *UpdateError. The type of scalars is changed to the type of v, e.g. an
+// uint becomes an int, if r has a packed type of its own, that is r is the root or an element of a vector or
+// a map which is not typed. Elements of typed vectors and references returned by Raw.Lookup keep the type,
+// and fail with ErrTypeDoesNotMatch for values of other types.
+func Set(r Reference, v interface{}) error {
+	switch v := v.(type) {
+	case bool:
+		return SetBool(r, v)
+	case int:
+		return SetInt(r, int64(v))
+	case int8:
+		return SetInt(r, int64(v))
+	case int16:
+		return SetInt(r, int64(v))
+	case int32:
+		return SetInt(r, int64(v))
+	case int64:
+		return SetInt(r, v)
+	case uint:
+		return SetUInt(r, uint64(v))
+	case uint8:
+		return SetUInt(r, uint64(v))
+	case uint16:
+		return SetUInt(r, uint64(v))
+	case uint32:
+		return SetUInt(r, uint64(v))
+	case uint64:
+		return SetUInt(r, v)
+	case float32:
+		return SetFloat32(r, v)
+	case float64:
+		return SetFloat64(r, v)
+	case string:
+		return SetString(r, v)
+	case []byte:
+		return SetBlob(r, v)
+	default:
+		return fmt.Errorf("type %T can't be set", v)
+	}
+}
+
+// SetInt updates the scalar r refers to with i, see Set.
+func SetInt(r Reference, i int64) error {
+	return setScalar(r, FBTInt, WidthI(i), func(offset int, byteWidth uint8) error {
+		return r.data_.WriteInt64(offset, byteWidth, i)
+	})
+}
+
+// SetUInt updates the scalar r refers to with u, see Set.
+func SetUInt(r Reference, u uint64) error {
+	return setScalar(r, FBTUint, WidthU(u), func(offset int, byteWidth uint8) error {
+		return r.data_.WriteUInt64(offset, byteWidth, u)
+	})
+}
+
+// SetFloat64 updates the scalar r refers to with f, see Set. f needs 8 bytes unless it is exactly a float32.
+// A float stored in 4 bytes can be set to a float64 if it is inline in a vector or map of 8 bytes width.
+func SetFloat64(r Reference, f float64) error {
+	return setScalar(r, FBTFloat, WidthF(f), func(offset int, byteWidth uint8) error {
+		return r.data_.WriteFloat(offset, byteWidth, f)
+	})
+}
+
+// SetFloat32 updates the scalar r refers to with f, see Set.
+func SetFloat32(r Reference, f float32) error {
+	return SetFloat64(r, float64(f))
+}
+
+// SetBool updates the scalar r refers to with v, see Set.
+func SetBool(r Reference, v bool) error {
+	var u uint64
+	if v {
+		u = 1
+	}
+	return setScalar(r, FBTBool, BitWidth8, func(offset int, byteWidth uint8) error {
+		return r.data_.WriteUInt64(offset, byteWidth, u)
+	})
+}
+
+// SetString updates the string r refers to with s of the same length. Keys can't be updated, they are sorted.
+func SetString(r Reference, s string) error {
+	str, err := r.StringRef()
+	if err != nil {
+		return err
+	}
+	return setData(r, str.Sized, s)
+}
+
+// SetBlob updates the blob r refers to with data of the same length.
+func SetBlob(r Reference, data []byte) error {
+	if r.type_ != FBTBlob {
+		return ErrTypeDoesNotMatch
+	}
+	blob, err := r.Blob()
+	if err != nil {
+		return err
+	}
+	return setData(r, blob.Sized, string(data))
+}
+
+// setData overwrites the data of a string or blob, the size and the ext after the data are kept.
+func setData(r Reference, sz Sized, data string) error {
+	size, err := sz.Size()
+	if err != nil {
+		return err
+	}
+	if len(data) != size {
+		return &UpdateError{Offset: sz.offset, Size: size, Needed: len(data)}
+	}
+	if sz.offset < 0 || len(r.data_) < sz.offset+size {
+		return ErrOutOfRange
+	}
+	copy(r.data_[sz.offset:], data)
+	return nil
+}
+
+// setScalar writes a scalar of type t needing bitWidth with write, to the bytes r is stored in, and updates
+// the packed type.
+func setScalar(r Reference, t Type, bitWidth BitWidth, write func(offset int, byteWidth uint8) error) error {
+	var indirect bool
+	switch r.type_ {
+	case FBTNull, FBTInt, FBTUint, FBTFloat, FBTBool:
+	case FBTIndirectInt, FBTIndirectUInt, FBTIndirectFloat:
+		indirect = true
+	default:
+		return ErrTypeDoesNotMatch
+	}
+	if indirect {
+		switch t {
+		case FBTInt:
+			t = FBTIndirectInt
+		case FBTUint:
+			t = FBTIndirectUInt
+		case FBTFloat:
+			t = FBTIndirectFloat
+		default:
+			return ErrTypeDoesNotMatch
+		}
+	}
+	if t != r.type_ && r.typeOffset == 0 {
+		return ErrTypeDoesNotMatch
+	}
+	offset, byteWidth := r.offset, r.parentWidth
+	if indirect {
+		ind, err := r.indirect()
+		if err != nil {
+			return err
+		}
+		offset, byteWidth = ind, r.byteWidth
+	}
+	if t == FBTFloat || t == FBTIndirectFloat {
+		// floats are read as float32 or float64
+		bitWidth = BitWidthMax(bitWidth, BitWidth32)
+	}
+	if bitWidth.ByteWidth() > byteWidth {
+		return &UpdateError{Offset: offset, Size: int(byteWidth), Needed: int(bitWidth.ByteWidth())}
+	}
+	if offset < 0 || len(r.data_) < offset+int(byteWidth) || len(r.data_) <= r.typeOffset {
+		return ErrOutOfRange
+	}
+	if err := write(offset, byteWidth); err != nil {
+		return err
+	}
+	if r.typeOffset != 0 {
+		if indirect {
+			bitWidth = WidthB(int(byteWidth))
+		}
+		r.data_[r.typeOffset] = PackedType(bitWidth, t, false)
+	}
+	return nil
+}
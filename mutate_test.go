@@ -0,0 +1,215 @@
+package flexbuffers
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	// narrow is a map of 1 byte width, wide one of 8 bytes width
+	narrow := func(b *Builder) {
+		b.Map(func(b *Builder) {
+			b.BoolField([]byte("b"), true)
+			b.BlobField([]byte("blob"), []byte("abc"))
+			b.IntField([]byte("i"), 1)
+			b.NullField([]byte("n"))
+			b.StringValueField([]byte("s"), "abc")
+			b.UIntField([]byte("u"), 2)
+			b.VectorField([]byte("v"), true, false, func(b *Builder) {
+				b.Int(3)
+			})
+		})
+	}
+	wide := func(b *Builder) {
+		b.Map(func(b *Builder) {
+			b.Float32Field([]byte("f"), 0.5)
+			b.IntField([]byte("i"), math.MaxInt64)
+		})
+	}
+	cases := []struct {
+		name    string
+		buildFn func(b *Builder)
+		path    []string
+		value   interface{}
+		wantErr error
+		want    string
+	}{
+		{
+			name:    "int",
+			buildFn: narrow,
+			path:    []string{"i"},
+			value:   -5,
+			want:    `{"b":true,"blob":"YWJj","i":-5,"n":null,"s":"abc","u":2,"v":[3]}`,
+		},
+		{
+			name:    "int overflow",
+			buildFn: narrow,
+			path:    []string{"i"},
+			value:   1000,
+			wantErr: &UpdateError{Offset: 41, Size: 1, Needed: 2},
+		},
+		{
+			name:    "uint to int",
+			buildFn: narrow,
+			path:    []string{"u"},
+			value:   int8(-1),
+			want:    `{"b":true,"blob":"YWJj","i":1,"n":null,"s":"abc","u":-1,"v":[3]}`,
+		},
+		{
+			name:    "int to uint",
+			buildFn: narrow,
+			path:    []string{"i"},
+			value:   uint8(200),
+			want:    `{"b":true,"blob":"YWJj","i":200,"n":null,"s":"abc","u":2,"v":[3]}`,
+		},
+		{
+			name:    "null to int",
+			buildFn: narrow,
+			path:    []string{"n"},
+			value:   int64(7),
+			want:    `{"b":true,"blob":"YWJj","i":1,"n":7,"s":"abc","u":2,"v":[3]}`,
+		},
+		{
+			name:    "bool",
+			buildFn: narrow,
+			path:    []string{"b"},
+			value:   false,
+			want:    `{"b":false,"blob":"YWJj","i":1,"n":null,"s":"abc","u":2,"v":[3]}`,
+		},
+		{
+			name:    "string",
+			buildFn: narrow,
+			path:    []string{"s"},
+			value:   "xyz",
+			want:    `{"b":true,"blob":"YWJj","i":1,"n":null,"s":"xyz","u":2,"v":[3]}`,
+		},
+		{
+			name:    "longer string",
+			buildFn: narrow,
+			path:    []string{"s"},
+			value:   "wxyz",
+			wantErr: &UpdateError{Offset: 18, Size: 3, Needed: 4},
+		},
+		{
+			name:    "blob",
+			buildFn: narrow,
+			path:    []string{"blob"},
+			value:   []byte{0, 1, 2},
+			want:    `{"b":true,"blob":"AAEC","i":1,"n":null,"s":"abc","u":2,"v":[3]}`,
+		},
+		{
+			name:    "string to blob",
+			buildFn: narrow,
+			path:    []string{"s"},
+			value:   []byte("xyz"),
+			wantErr: ErrTypeDoesNotMatch,
+		},
+		{
+			name:    "typed vector",
+			buildFn: narrow,
+			path:    []string{"v", "0"},
+			value:   int16(-100),
+			want:    `{"b":true,"blob":"YWJj","i":1,"n":null,"s":"abc","u":2,"v":[-100]}`,
+		},
+		{
+			name:    "typed vector type",
+			buildFn: narrow,
+			path:    []string{"v", "0"},
+			value:   uint64(1),
+			wantErr: ErrTypeDoesNotMatch,
+		},
+		{
+			name:    "float in narrow map",
+			buildFn: narrow,
+			path:    []string{"i"},
+			value:   0.5,
+			wantErr: &UpdateError{Offset: 41, Size: 1, Needed: 4},
+		},
+		{
+			name:    "float32 to float64",
+			buildFn: wide,
+			path:    []string{"f"},
+			value:   0.1,
+			want:    `{"f":0.1,"i":9223372036854775807}`,
+		},
+		{
+			name:    "int to float",
+			buildFn: wide,
+			path:    []string{"i"},
+			value:   float32(1.5),
+			want:    `{"f":0.5,"i":1.5}`,
+		},
+		{
+			name:    "unsupported",
+			buildFn: wide,
+			path:    []string{"i"},
+			value:   struct{}{},
+			wantErr: errors.New("type struct {} can't be set"),
+		},
+	}
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			a := assert.New(t)
+			b := NewBuilder()
+			cas.buildFn(b)
+			if !a.NoError(b.Finish()) {
+				return
+			}
+			buf := b.Buffer()
+			root, err := buf.Root()
+			if !a.NoError(err) {
+				return
+			}
+			ref := root
+			for _, p := range cas.path {
+				if ref.IsMap() {
+					ref = ref.AsMap().GetOrNull(p)
+				} else {
+					ref = ref.AsTypedVector().AtOrNull(0)
+				}
+			}
+			err = Set(ref, cas.value)
+			if cas.wantErr != nil {
+				a.Equal(cas.wantErr.Error(), err.Error())
+				if _, ok := cas.wantErr.(*UpdateError); ok {
+					a.True(errors.Is(err, ErrUpdateDoesntFit))
+				}
+				return
+			}
+			a.NoError(err)
+			a.NoError(buf.ValidateWithOptions(ValidateOptions{RequireSortedKeys: true}))
+			out, err := root.AppendJson(nil, JsonOptions{})
+			a.NoError(err)
+			a.Equal(cas.want, string(out))
+		})
+	}
+}
+
+func TestSet_Root(t *testing.T) {
+	a := assert.New(t)
+	b := NewBuilder()
+	b.UInt(300)
+	a.NoError(b.Finish())
+	root, _ := b.Buffer().Root()
+	a.NoError(SetInt(root, -300))
+	root, _ = b.Buffer().Root()
+	a.Equal(FBTInt, root.Type())
+	a.Equal(int64(-300), root.AsInt64())
+	err := SetInt(root, math.MaxInt32)
+	a.Equal(&UpdateError{Offset: 0, Size: 2, Needed: 4}, err)
+
+	// indirect scalars keep their width
+	b = NewBuilder()
+	b.IndirectInt(1)
+	a.NoError(b.Finish())
+	root, _ = b.Buffer().Root()
+	a.NoError(SetUInt(root, math.MaxUint8))
+	root, _ = b.Buffer().Root()
+	a.Equal(FBTIndirectUInt, root.Type())
+	a.Equal(uint64(math.MaxUint8), root.AsUInt64())
+	a.Error(SetBool(root, true))
+	a.True(errors.Is(SetUInt(root, math.MaxUint16), ErrUpdateDoesntFit))
+}
@@ -0,0 +1,95 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+const (
+	// dmerSize is the size of substrings counted by TrainDictionary
+	dmerSize = 8
+	// segmentSize is the size of substrings copied to dictionaries
+	segmentSize = 64
+)
+
+func dmer(b []byte, i int) uint64 {
+	return binary.LittleEndian.Uint64(b[i:])
+}
+
+// TrainDictionary builds a dictionary up to size bytes, from substrings which frequently appear across samples.
+// Substrings more likely to be referenced are placed at the end of dictionary, since LZ4 can reference only the
+// last MaxDictionarySize bytes.
+func TrainDictionary(samples [][]byte, size int) []byte {
+	if size > MaxDictionarySize {
+		size = MaxDictionarySize
+	}
+	// count the number of samples each dmer appears in
+	freq := map[uint64]int{}
+	seen := map[uint64]struct{}{}
+	for _, s := range samples {
+		for k := range seen {
+			delete(seen, k)
+		}
+		for i := 0; i+dmerSize <= len(s); i++ {
+			d := dmer(s, i)
+			if _, ok := seen[d]; !ok {
+				seen[d] = struct{}{}
+				freq[d]++
+			}
+		}
+	}
+	score := func(seg []byte) int {
+		total := 0
+		for i := 0; i+dmerSize <= len(seg); i++ {
+			if f := freq[dmer(seg, i)]; f > 1 {
+				total += f
+			}
+		}
+		return total
+	}
+	type candidate struct {
+		seg   []byte
+		score int
+	}
+	var candidates []candidate
+	for _, s := range samples {
+		for i := 0; i < len(s); i += segmentSize / 2 {
+			end := i + segmentSize
+			if end > len(s) {
+				end = len(s)
+			}
+			seg := s[i:end]
+			if sc := score(seg); sc > 0 {
+				candidates = append(candidates, candidate{seg: seg, score: sc})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	var selected [][]byte
+	total := 0
+	for _, c := range candidates {
+		if total >= size {
+			break
+		}
+		// dmers already in the dictionary don't make a segment worth anymore
+		if sc := score(c.seg); sc*2 < c.score || sc == 0 {
+			continue
+		}
+		for i := 0; i+dmerSize <= len(c.seg); i++ {
+			delete(freq, dmer(c.seg, i))
+		}
+		selected = append(selected, c.seg)
+		total += len(c.seg)
+	}
+	dict := make([]byte, 0, total)
+	for i := len(selected) - 1; i >= 0; i-- {
+		dict = append(dict, selected[i]...)
+	}
+	if len(dict) > size {
+		dict = dict[len(dict)-size:]
+	}
+	return dict
+}
@@ -0,0 +1,228 @@
+// Package lz4 implements LZ4 block format, with a preset dictionary support.
+// See https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+package lz4
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	minMatch  = 4
+	hashLog   = 12
+	maxOffset = 65535
+	// the last match must start at least 12 bytes before the end of block
+	mfLimit = 12
+	// the last 5 bytes are always literals
+	lastLiterals = 5
+
+	// MaxDictionarySize is the size of dictionary can be referenced, only the last MaxDictionarySize bytes are used.
+	MaxDictionarySize = maxOffset
+)
+
+var ErrCorrupted = errors.New("lz4: corrupted block")
+
+func hash(v uint32) uint32 {
+	return (v * 2654435761) >> (32 - hashLog)
+}
+
+func load32(b []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(b[i:])
+}
+
+// CompressBound returns the maximum size of compressed n bytes.
+func CompressBound(n int) int {
+	return n + n/255 + 16
+}
+
+// Compressor compresses blocks with a dictionary. It is not safe for concurrent use.
+type Compressor struct {
+	dict      []byte
+	dictTable [1 << hashLog]int32
+	table     [1 << hashLog]int32
+	buf       []byte
+}
+
+func NewCompressor(dict []byte) *Compressor {
+	if len(dict) > MaxDictionarySize {
+		dict = dict[len(dict)-MaxDictionarySize:]
+	}
+	c := &Compressor{dict: dict}
+	for i := range c.dictTable {
+		c.dictTable[i] = -1
+	}
+	for i := 0; i+minMatch <= len(dict); i++ {
+		c.dictTable[hash(load32(dict, i))] = int32(i)
+	}
+	return c
+}
+
+// Compress appends compressed src to dst.
+func (c *Compressor) Compress(dst, src []byte) []byte {
+	// matches are searched in dict+src, positions are relative to the beginning of dict
+	c.buf = append(append(c.buf[:0], c.dict...), src...)
+	c.table = c.dictTable
+	buf := c.buf
+	anchor := len(c.dict)
+	end := len(buf)
+	i := anchor
+	for i < end-mfLimit {
+		v := load32(buf, i)
+		h := hash(v)
+		ref := int(c.table[h])
+		c.table[h] = int32(i)
+		if ref < 0 || i-ref > maxOffset || load32(buf, ref) != v {
+			// skip faster on incompressible data
+			i += 1 + (i-anchor)>>6
+			continue
+		}
+		for i > anchor && ref > 0 && buf[i-1] == buf[ref-1] {
+			i--
+			ref--
+		}
+		n := minMatch
+		for i+n < end-lastLiterals && buf[ref+n] == buf[i+n] {
+			n++
+		}
+		dst = appendSequence(dst, buf[anchor:i], i-ref, n)
+		i += n
+		anchor = i
+		if i < end-mfLimit {
+			c.table[hash(load32(buf, i-2))] = int32(i - 2)
+		}
+	}
+	return appendLength(appendToken(dst, end-anchor, 0), end-anchor, buf[anchor:end])
+}
+
+func appendToken(dst []byte, litLen, matchLen int) []byte {
+	var token byte
+	if litLen >= 15 {
+		token = 15 << 4
+	} else {
+		token = byte(litLen) << 4
+	}
+	if matchLen >= 15 {
+		token |= 15
+	} else {
+		token |= byte(matchLen)
+	}
+	return append(dst, token)
+}
+
+// appendLength appends extra bytes of length if needed, then data.
+func appendLength(dst []byte, l int, data []byte) []byte {
+	if l >= 15 {
+		l -= 15
+		for ; l >= 255; l -= 255 {
+			dst = append(dst, 255)
+		}
+		dst = append(dst, byte(l))
+	}
+	return append(dst, data...)
+}
+
+func appendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	dst = appendToken(dst, len(literals), matchLen-minMatch)
+	dst = appendLength(dst, len(literals), literals)
+	dst = append(dst, byte(offset), byte(offset>>8))
+	return appendLength(dst, matchLen-minMatch, nil)
+}
+
+// Compress compresses src without dictionary.
+func Compress(dst, src []byte) []byte {
+	return NewCompressor(nil).Compress(dst, src)
+}
+
+// Decompress decompresses src to dst[:0], growing dst if needed. size is the exact size of decompressed data.
+// dict must be the same dictionary used to compress.
+func Decompress(dst, src, dict []byte, size int) ([]byte, error) {
+	if len(dict) > MaxDictionarySize {
+		dict = dict[len(dict)-MaxDictionarySize:]
+	}
+	if cap(dst) < size {
+		dst = make([]byte, 0, size)
+	}
+	out := dst[:0]
+	readLength := func(i int, l int) (int, int, error) {
+		if l != 15 {
+			return i, l, nil
+		}
+		for {
+			if i >= len(src) {
+				return 0, 0, ErrCorrupted
+			}
+			c := src[i]
+			i++
+			l += int(c)
+			if l > size {
+				return 0, 0, ErrCorrupted
+			}
+			if c != 255 {
+				return i, l, nil
+			}
+		}
+	}
+	i := 0
+	for {
+		if i >= len(src) {
+			return nil, ErrCorrupted
+		}
+		token := src[i]
+		i++
+		var litLen int
+		var err error
+		if i, litLen, err = readLength(i, int(token>>4)); err != nil {
+			return nil, err
+		}
+		if litLen > len(src)-i || litLen > size-len(out) {
+			return nil, ErrCorrupted
+		}
+		out = append(out, src[i:i+litLen]...)
+		i += litLen
+		if i == len(src) {
+			break
+		}
+		if i+2 > len(src) {
+			return nil, ErrCorrupted
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		var matchLen int
+		if i, matchLen, err = readLength(i, int(token&15)); err != nil {
+			return nil, err
+		}
+		matchLen += minMatch
+		if offset == 0 || matchLen > size-len(out) {
+			return nil, ErrCorrupted
+		}
+		if offset > len(out) {
+			// match starts in the dictionary
+			d := len(dict) - (offset - len(out))
+			if d < 0 {
+				return nil, ErrCorrupted
+			}
+			n := len(dict) - d
+			if n > matchLen {
+				n = matchLen
+			}
+			out = append(out, dict[d:d+n]...)
+			matchLen -= n
+			offset = len(out)
+			if matchLen == 0 {
+				continue
+			}
+		}
+		start := len(out) - offset
+		if offset >= matchLen {
+			out = append(out, out[start:start+matchLen]...)
+		} else {
+			for k := 0; k < matchLen; k++ {
+				out = append(out, out[start+k])
+			}
+		}
+	}
+	if len(out) != size {
+		return nil, ErrCorrupted
+	}
+	return out, nil
+}
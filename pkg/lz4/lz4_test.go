@@ -0,0 +1,102 @@
+package lz4
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers/pkg/fakedata"
+)
+
+func TestRoundTrip(t *testing.T) {
+	a := assert.New(t)
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	rnd.Read(random)
+	repeated := bytes.Repeat([]byte("flexbuffers "), 10000)
+	mixed := make([]byte, 0, 100000)
+	for len(mixed) < 100000 {
+		if rnd.Intn(2) == 0 {
+			mixed = append(mixed, random[:rnd.Intn(50)]...)
+		} else {
+			mixed = append(mixed, repeated[:rnd.Intn(300)]...)
+		}
+	}
+	inputs := [][]byte{nil, []byte("a"), []byte("aaaaaaaaaaaaaaaaaaaa"), random, repeated, mixed}
+	for n := 0; n < 40; n++ {
+		inputs = append(inputs, repeated[:n])
+	}
+	dicts := [][]byte{nil, []byte("flexbuffers"), random[:70000]}
+	for _, dict := range dicts {
+		c := NewCompressor(dict)
+		for _, in := range inputs {
+			compressed := c.Compress(nil, in)
+			a.True(len(compressed) <= CompressBound(len(in)))
+			out, err := Decompress(nil, compressed, dict, len(in))
+			if a.NoError(err) {
+				a.True(bytes.Equal(in, out), "len=%d dict=%d", len(in), len(dict))
+			}
+		}
+	}
+	a.True(len(Compress(nil, repeated)) < len(repeated)/100)
+}
+
+func TestDictionary(t *testing.T) {
+	a := assert.New(t)
+	dict := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	// a match spans the dictionary and the output
+	in := []byte("ABCDEFGHIJ--uvwxyzABCDEFGHIJ------")
+	c := NewCompressor(dict)
+	compressed := c.Compress(nil, in)
+	out, err := Decompress(make([]byte, 3), compressed, dict, len(in))
+	if a.NoError(err) {
+		a.Equal(in, out)
+	}
+	_, err = Decompress(nil, compressed, nil, len(in))
+	a.Error(err)
+}
+
+func TestTrainDictionary(t *testing.T) {
+	a := assert.New(t)
+	var samples [][]byte
+	err := fakedata.Tweets(200, func(tw *fakedata.Tweet) error {
+		b, err := json.Marshal(tw)
+		samples = append(samples, b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := TrainDictionary(samples[:100], 16<<10)
+	a.True(len(dict) > 0 && len(dict) <= 16<<10)
+
+	plain, withDict := 0, 0
+	c := NewCompressor(dict)
+	for _, s := range samples[100:] {
+		plain += len(Compress(nil, s))
+		compressed := c.Compress(nil, s)
+		withDict += len(compressed)
+		out, err := Decompress(nil, compressed, dict, len(s))
+		if a.NoError(err) {
+			a.Equal(s, out)
+		}
+	}
+	a.True(withDict < plain, "with dictionary: %d, without: %d", withDict, plain)
+}
+
+func TestDecompress_Corrupted(t *testing.T) {
+	a := assert.New(t)
+	in := bytes.Repeat([]byte("abcdefgh"), 100)
+	compressed := Compress(nil, in)
+	_, err := Decompress(nil, compressed, nil, len(in)-1)
+	a.Equal(ErrCorrupted, err)
+	_, err = Decompress(nil, compressed[:len(compressed)-3], nil, len(in))
+	a.Equal(ErrCorrupted, err)
+	_, err = Decompress(nil, []byte{0x0f, 0x00, 0x00}, nil, 100)
+	a.Equal(ErrCorrupted, err)
+	_, err = Decompress(nil, nil, nil, 0)
+	a.Equal(ErrCorrupted, err)
+}
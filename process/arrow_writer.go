@@ -0,0 +1,418 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+
+	"flexbuffers"
+)
+
+type ColumnType int
+
+const (
+	// ColumnNull is a column which has no non-null values in samples, it is written as a string column.
+	ColumnNull ColumnType = iota
+	ColumnBool
+	ColumnInt
+	ColumnUint
+	ColumnFloat
+	ColumnString
+	ColumnBinary
+	// ColumnJSON is a string column, vectors and maps are written as JSON.
+	ColumnJSON
+)
+
+func (t ColumnType) String() string {
+	switch t {
+	case ColumnNull:
+		return "null"
+	case ColumnBool:
+		return "bool"
+	case ColumnInt:
+		return "int"
+	case ColumnUint:
+		return "uint"
+	case ColumnFloat:
+		return "float"
+	case ColumnString:
+		return "string"
+	case ColumnBinary:
+		return "binary"
+	case ColumnJSON:
+		return "json"
+	default:
+		return fmt.Sprintf("ColumnType(%d)", int(t))
+	}
+}
+
+func (t ColumnType) arrowType() arrow.DataType {
+	switch t {
+	case ColumnBool:
+		return arrow.FixedWidthTypes.Boolean
+	case ColumnInt:
+		return arrow.PrimitiveTypes.Int64
+	case ColumnUint:
+		return arrow.PrimitiveTypes.Uint64
+	case ColumnFloat:
+		return arrow.PrimitiveTypes.Float64
+	case ColumnBinary:
+		return arrow.BinaryTypes.Binary
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// Column is a value extracted from each document by Path.
+type Column struct {
+	Name string
+	Path []string
+	Type ColumnType
+}
+
+func columnTypeOf(r flexbuffers.Reference) ColumnType {
+	switch {
+	case r.IsNull():
+		return ColumnNull
+	case r.IsBool():
+		return ColumnBool
+	case r.IsInt():
+		return ColumnInt
+	case r.IsUInt():
+		return ColumnUint
+	case r.IsFloat():
+		return ColumnFloat
+	case r.IsString(), r.IsKey():
+		return ColumnString
+	case r.IsBlob():
+		return ColumnBinary
+	default:
+		return ColumnJSON
+	}
+}
+
+// unifyColumnType returns a type which can hold values of both a and b.
+func unifyColumnType(a, b ColumnType) ColumnType {
+	switch {
+	case a == b || b == ColumnNull:
+		return a
+	case a == ColumnNull:
+		return b
+	case (a == ColumnInt && b == ColumnUint) || (a == ColumnUint && b == ColumnInt):
+		return ColumnInt
+	case (a == ColumnInt || a == ColumnUint || a == ColumnFloat) && (b == ColumnInt || b == ColumnUint || b == ColumnFloat):
+		return ColumnFloat
+	case a == ColumnJSON || b == ColumnJSON:
+		return ColumnJSON
+	default:
+		return ColumnString
+	}
+}
+
+// InferColumns infers columns from sample documents. Each scalar, vector or blob found by walking maps from the root
+// becomes a column named by its dotted path, columns are sorted by its name. Documents whose root is not a map are ignored.
+func InferColumns(samples []flexbuffers.Raw) ([]Column, error) {
+	types := map[string]*Column{}
+	var walk func(path []string, r flexbuffers.Reference) error
+	walk = func(path []string, r flexbuffers.Reference) error {
+		m, err := r.Map()
+		if err != nil {
+			return err
+		}
+		keys, err := m.Keys()
+		if err != nil {
+			return err
+		}
+		sz, err := m.Size()
+		if err != nil {
+			return err
+		}
+		values := m.Values()
+		var k, v flexbuffers.Reference
+		for i := 0; i < sz; i++ {
+			if err := keys.AtRef(i, &k); err != nil {
+				return err
+			}
+			key, err := k.Key()
+			if err != nil {
+				return err
+			}
+			if err := values.AtRef(i, &v); err != nil {
+				return err
+			}
+			p := append(path[:len(path):len(path)], key.StringValue())
+			if v.IsMap() {
+				if err := walk(p, v); err != nil {
+					return err
+				}
+				continue
+			}
+			name := strings.Join(p, ".")
+			c, ok := types[name]
+			if !ok {
+				c = &Column{Name: name, Path: p, Type: ColumnNull}
+				types[name] = c
+			}
+			c.Type = unifyColumnType(c.Type, columnTypeOf(v))
+		}
+		return nil
+	}
+	for _, doc := range samples {
+		root, err := doc.Root()
+		if err != nil {
+			return nil, err
+		}
+		if !root.IsMap() {
+			continue
+		}
+		if err := walk(nil, root); err != nil {
+			return nil, err
+		}
+	}
+	columns := make([]Column, 0, len(types))
+	for _, c := range types {
+		columns = append(columns, *c)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].Name < columns[j].Name
+	})
+	return columns, nil
+}
+
+// ArrowWriter writes documents as Apache Arrow IPC record batches, each column is extracted by Column.Path.
+// Values which can't be converted to the column type are written as null, or cause an error if Strict is set.
+type ArrowWriter struct {
+	// BatchSize is the number of rows in a record batch, 1024 is used if zero.
+	BatchSize int
+	Strict    bool
+
+	columns []Column
+	schema  *arrow.Schema
+	builder *array.RecordBuilder
+	rows    int
+	out     interface {
+		Write(rec array.Record) error
+		Close() error
+	}
+	tv    flexbuffers.Traverser
+	cells []arrowCell
+	buf   bytes.Buffer
+}
+
+func newArrowWriter(columns []Column) *ArrowWriter {
+	fields := make([]arrow.Field, len(columns))
+	for i, c := range columns {
+		fields[i] = arrow.Field{Name: c.Name, Type: c.Type.arrowType(), Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+	return &ArrowWriter{
+		columns: columns,
+		schema:  schema,
+		builder: array.NewRecordBuilder(memory.NewGoAllocator(), schema),
+	}
+}
+
+// NewArrowFileWriter creates ArrowWriter writes Arrow IPC file format, which can be read randomly.
+func NewArrowFileWriter(w io.WriteSeeker, columns []Column) (*ArrowWriter, error) {
+	a := newArrowWriter(columns)
+	fw, err := ipc.NewFileWriter(w, ipc.WithSchema(a.schema))
+	if err != nil {
+		return nil, err
+	}
+	a.out = fw
+	return a, nil
+}
+
+// NewArrowStreamWriter creates ArrowWriter writes Arrow IPC streaming format.
+func NewArrowStreamWriter(w io.Writer, columns []Column) *ArrowWriter {
+	a := newArrowWriter(columns)
+	a.out = ipc.NewWriter(w, ipc.WithSchema(a.schema))
+	return a
+}
+
+func (a *ArrowWriter) Schema() *arrow.Schema {
+	return a.schema
+}
+
+// Write appends a document as a row, a record batch is written every BatchSize rows.
+// If an error is returned, the row is not appended.
+func (a *ArrowWriter) Write(doc flexbuffers.Raw) error {
+	if a.cells == nil {
+		a.cells = make([]arrowCell, len(a.columns))
+	}
+	// resolve all cells before appending, to keep columns in the same length on errors
+	for i := range a.columns {
+		doc.InitTraverser(&a.tv)
+		var ref flexbuffers.Reference
+		err := a.tv.Seek(a.columns[i].Path)
+		if err == nil {
+			ref, err = a.tv.Current()
+		}
+		if err == flexbuffers.ErrNotFound {
+			ref, err = flexbuffers.NullReference, nil
+		}
+		if err == nil {
+			err = a.resolve(&a.cells[i], a.columns[i].Type, ref)
+		}
+		if err != nil {
+			return fmt.Errorf("column %s: %s", a.columns[i].Name, err)
+		}
+	}
+	for i := range a.columns {
+		a.appendCell(i, &a.cells[i])
+	}
+	a.rows++
+	batchSize := a.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1024
+	}
+	if a.rows >= batchSize {
+		return a.Flush()
+	}
+	return nil
+}
+
+type arrowCell struct {
+	null bool
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+	s    string
+	data []byte
+}
+
+func (a *ArrowWriter) resolve(c *arrowCell, typ ColumnType, r flexbuffers.Reference) (err error) {
+	*c = arrowCell{}
+	if r.IsNull() {
+		c.null = true
+		return nil
+	}
+	ok := true
+	switch typ {
+	case ColumnBool:
+		if ok = r.IsBool(); ok {
+			c.b, err = r.Bool()
+		}
+	case ColumnInt:
+		if ok = r.IsInt() || r.IsUInt() && r.AsUInt64() <= math.MaxInt64; ok {
+			c.i, err = r.Int64()
+		}
+	case ColumnUint:
+		if ok = r.IsUInt() || r.IsInt() && r.AsInt64() >= 0; ok {
+			c.u, err = r.UInt64()
+		}
+	case ColumnFloat:
+		if ok = r.IsNumeric(); ok {
+			c.f, err = r.Float64()
+		}
+	case ColumnBinary:
+		switch {
+		case r.IsBlob():
+			var blob flexbuffers.Blob
+			if blob, err = r.Blob(); err == nil {
+				c.data, err = blob.Data()
+			}
+		case r.IsString():
+			c.s, err = a.stringValue(r)
+			c.data = []byte(c.s)
+		default:
+			ok = false
+		}
+	default:
+		c.s, err = a.stringValue(r)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if a.Strict {
+			return fmt.Errorf("cannot write %s value as %s", columnTypeOf(r), typ)
+		}
+		c.null = true
+	}
+	return nil
+}
+
+func (a *ArrowWriter) appendCell(i int, c *arrowCell) {
+	b := a.builder.Field(i)
+	if c.null {
+		b.AppendNull()
+		return
+	}
+	switch a.columns[i].Type {
+	case ColumnBool:
+		b.(*array.BooleanBuilder).Append(c.b)
+	case ColumnInt:
+		b.(*array.Int64Builder).Append(c.i)
+	case ColumnUint:
+		b.(*array.Uint64Builder).Append(c.u)
+	case ColumnFloat:
+		b.(*array.Float64Builder).Append(c.f)
+	case ColumnBinary:
+		b.(*array.BinaryBuilder).Append(c.data)
+	default:
+		b.(*array.StringBuilder).Append(c.s)
+	}
+}
+
+// stringValue formats a value for string columns, scalars are formatted as text and others as JSON.
+func (a *ArrowWriter) stringValue(r flexbuffers.Reference) (string, error) {
+	switch {
+	case r.IsString():
+		str, err := r.StringRef()
+		if err != nil {
+			return "", err
+		}
+		return str.StringValue()
+	case r.IsKey():
+		k, err := r.Key()
+		if err != nil {
+			return "", err
+		}
+		return k.StringValue(), nil
+	case r.IsBool():
+		return strconv.FormatBool(r.AsBool()), nil
+	case r.IsInt():
+		return strconv.FormatInt(r.AsInt64(), 10), nil
+	case r.IsUInt():
+		return strconv.FormatUint(r.AsUInt64(), 10), nil
+	case r.IsFloat():
+		return strconv.FormatFloat(r.AsFloat64(), 'g', -1, 64), nil
+	default:
+		a.buf.Reset()
+		if err := r.WriteAsJson(&a.buf); err != nil {
+			return "", err
+		}
+		return a.buf.String(), nil
+	}
+}
+
+// Flush writes buffered rows as a record batch.
+func (a *ArrowWriter) Flush() error {
+	if a.rows == 0 {
+		return nil
+	}
+	rec := a.builder.NewRecord()
+	defer rec.Release()
+	a.rows = 0
+	return a.out.Write(rec)
+}
+
+// Close flushes buffered rows and finishes the output. It doesn't close underlying writer.
+func (a *ArrowWriter) Close() error {
+	if err := a.Flush(); err != nil {
+		return err
+	}
+	a.builder.Release()
+	return a.out.Close()
+}
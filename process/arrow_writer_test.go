@@ -0,0 +1,143 @@
+package process
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers"
+)
+
+func arrowTestDocs(t *testing.T, inputs ...string) []flexbuffers.Raw {
+	docs := make([]flexbuffers.Raw, len(inputs))
+	for i, input := range inputs {
+		raw, err := FromJson([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[i] = raw
+	}
+	return docs
+}
+
+func TestInferColumns(t *testing.T) {
+	docs := arrowTestDocs(t,
+		`{"id": 1, "user": {"name": "foo", "score": 1}, "tags": ["a"], "flag": null}`,
+		`{"id": 2, "user": {"name": "bar", "score": 1.5}, "tags": [], "mixed": 1}`,
+		`{"id": 3, "mixed": "x"}`,
+		`[1, 2]`,
+	)
+	columns, err := InferColumns(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Column{
+		{Name: "flag", Path: []string{"flag"}, Type: ColumnNull},
+		{Name: "id", Path: []string{"id"}, Type: ColumnInt},
+		{Name: "mixed", Path: []string{"mixed"}, Type: ColumnString},
+		{Name: "tags", Path: []string{"tags"}, Type: ColumnJSON},
+		{Name: "user.name", Path: []string{"user", "name"}, Type: ColumnString},
+		{Name: "user.score", Path: []string{"user", "score"}, Type: ColumnFloat},
+	}
+	if diff := cmp.Diff(expected, columns); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestArrowFileWriter(t *testing.T) {
+	a := assert.New(t)
+	docs := arrowTestDocs(t,
+		`{"id": 1, "user": {"name": "foo", "score": 0.5}, "tags": ["a"], "ok": true}`,
+		`{"id": 2, "user": {"name": "bar", "score": 1.5}, "tags": [], "ok": "yes"}`,
+		`{"id": 3}`,
+	)
+	columns, err := InferColumns(docs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "arrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewArrowFileWriter(f, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.BatchSize = 2
+	for _, doc := range docs {
+		if err := w.Write(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ipc.NewFileReader(f, ipc.WithAllocator(memory.NewGoAllocator()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	a.True(r.Schema().Equal(w.Schema()))
+	a.Equal(2, r.NumRecords())
+	rec, err := r.Record(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Equal(int64(2), rec.NumRows())
+	// columns: id, ok, tags, user.name, user.score
+	a.Equal([]int64{1, 2}, rec.Column(0).(*array.Int64).Int64Values())
+	ok := rec.Column(1).(*array.Boolean)
+	a.True(ok.Value(0))
+	a.True(ok.IsNull(1))
+	tags := rec.Column(2).(*array.String)
+	a.Equal(`["a"]`, tags.Value(0))
+	a.Equal(`[]`, tags.Value(1))
+	a.Equal("bar", rec.Column(3).(*array.String).Value(1))
+	a.Equal([]float64{0.5, 1.5}, rec.Column(4).(*array.Float64).Float64Values())
+
+	rec, err = r.Record(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Equal(int64(1), rec.NumRows())
+	a.Equal(int64(3), rec.Column(0).(*array.Int64).Value(0))
+	for i := 1; i < 5; i++ {
+		a.True(rec.Column(i).IsNull(0))
+	}
+}
+
+func TestArrowStreamWriter_Strict(t *testing.T) {
+	a := assert.New(t)
+	docs := arrowTestDocs(t, `{"n": 1}`, `{"n": "x"}`, `{"n": 2}`)
+	columns, err := InferColumns(docs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := NewArrowStreamWriter(&buf, columns)
+	w.Strict = true
+	a.NoError(w.Write(docs[0]))
+	a.Error(w.Write(docs[1]))
+	a.NoError(w.Write(docs[2]))
+	a.NoError(w.Close())
+
+	r, err := ipc.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	a.True(r.Next())
+	a.Equal([]int64{1, 2}, r.Record().Column(0).(*array.Int64).Int64Values())
+	a.False(r.Next())
+}
@@ -0,0 +1,158 @@
+package process
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"flexbuffers"
+)
+
+// BatchEncoder encodes documents in parallel, with builders from a pool.
+// Results are returned in the order of the inputs.
+type BatchEncoder struct {
+	// Workers is the number of goroutines, runtime.GOMAXPROCS(0) if zero.
+	Workers int
+	// Pool provides builders, a pool without flags is used if nil.
+	Pool *flexbuffers.BuilderPool
+	// JSON configures how EncodeJSON and EncodeJSONFrom build documents.
+	JSON JsonInputOptions
+}
+
+type batchJob struct {
+	index int
+	input interface{}
+}
+
+type batchResult struct {
+	index int
+	raw   flexbuffers.Raw
+}
+
+// EncodeValues encodes Go values as ObjectReader does.
+func (e *BatchEncoder) EncodeValues(values []interface{}) ([]flexbuffers.Raw, error) {
+	i := 0
+	return e.run(func() (interface{}, bool) {
+		if i == len(values) {
+			return nil, false
+		}
+		i++
+		return values[i-1], true
+	}, buildValue)
+}
+
+// EncodeValuesFrom encodes Go values received from in until it's closed.
+// in is drained even if an error occurs.
+func (e *BatchEncoder) EncodeValuesFrom(in <-chan interface{}) ([]flexbuffers.Raw, error) {
+	return e.run(func() (interface{}, bool) {
+		v, ok := <-in
+		return v, ok
+	}, buildValue)
+}
+
+// EncodeJSON encodes JSON documents as FromJsonWithOptions does.
+func (e *BatchEncoder) EncodeJSON(docs [][]byte) ([]flexbuffers.Raw, error) {
+	i := 0
+	return e.run(func() (interface{}, bool) {
+		if i == len(docs) {
+			return nil, false
+		}
+		i++
+		return docs[i-1], true
+	}, e.buildJsonInput)
+}
+
+// EncodeJSONFrom encodes JSON documents received from in until it's closed.
+// in is drained even if an error occurs.
+func (e *BatchEncoder) EncodeJSONFrom(in <-chan []byte) ([]flexbuffers.Raw, error) {
+	return e.run(func() (interface{}, bool) {
+		v, ok := <-in
+		return v, ok
+	}, e.buildJsonInput)
+}
+
+func buildValue(b *flexbuffers.Builder, v interface{}) error {
+	r := ObjectReader{Output: NewFlexbuffersWriter(b)}
+	if err := r.Read(v); err != nil {
+		return err
+	}
+	return b.Finish()
+}
+
+func (e *BatchEncoder) buildJsonInput(b *flexbuffers.Builder, v interface{}) error {
+	return buildJson(b, v.([]byte), e.JSON)
+}
+
+// run encodes inputs returned by next until it returns false. On errors, the error of the first input is returned.
+func (e *BatchEncoder) run(next func() (interface{}, bool), build func(b *flexbuffers.Builder, v interface{}) error) ([]flexbuffers.Raw, error) {
+	workers := e.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	pool := e.Pool
+	if pool == nil {
+		pool = defaultBuilderPool
+	}
+
+	jobs := make(chan batchJob, workers)
+	var (
+		mu       sync.Mutex
+		results  []batchResult
+		errIndex = -1
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				mu.Lock()
+				failed := firstErr != nil && errIndex < job.index
+				mu.Unlock()
+				if failed {
+					// inputs after the failed one are not needed
+					continue
+				}
+				b := pool.Get()
+				err := build(b, job.input)
+				var raw flexbuffers.Raw
+				if err == nil {
+					raw = b.AppendTo(nil)
+				}
+				pool.Put(b)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil || job.index < errIndex {
+						errIndex, firstErr = job.index, err
+					}
+				} else {
+					results = append(results, batchResult{index: job.index, raw: raw})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	n := 0
+	for {
+		v, ok := next()
+		if !ok {
+			break
+		}
+		jobs <- batchJob{index: n, input: v}
+		n++
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, fmt.Errorf("document %d: %w", errIndex, firstErr)
+	}
+	out := make([]flexbuffers.Raw, n)
+	for _, r := range results {
+		out[r.index] = r.raw
+	}
+	return out, nil
+}
+
+var defaultBuilderPool = flexbuffers.NewBuilderPool(flexbuffers.BuilderFlagNone)
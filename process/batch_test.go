@@ -0,0 +1,82 @@
+package process
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers"
+)
+
+func TestBatchEncoder(t *testing.T) {
+	a := assert.New(t)
+	type doc struct {
+		ID   int      `json:"id"`
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	var (
+		docs     [][]byte
+		values   []interface{}
+		expected []flexbuffers.Raw
+	)
+	for i := 0; i < 100; i++ {
+		docs = append(docs, []byte(fmt.Sprintf(`{"id": %d, "name": "doc%d", "tags": ["a", "b"]}`, i, i)))
+		values = append(values, doc{ID: i, Name: fmt.Sprintf("doc%d", i), Tags: []string{"a", "b"}})
+		raw, err := FromJson(docs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, raw)
+	}
+	enc := BatchEncoder{Workers: 4, Pool: flexbuffers.NewBuilderPool(flexbuffers.BuilderFlagShareAll)}
+
+	out, err := enc.EncodeJSON(docs)
+	if a.NoError(err) {
+		a.Equal(expected, out)
+	}
+
+	in := make(chan []byte)
+	go func() {
+		for _, d := range docs {
+			in <- d
+		}
+		close(in)
+	}()
+	out, err = enc.EncodeJSONFrom(in)
+	if a.NoError(err) {
+		a.Equal(expected, out)
+	}
+
+	out, err = enc.EncodeValues(values)
+	if a.NoError(err) && a.Len(out, len(values)) {
+		for i, raw := range out {
+			a.Equal(int64(i), raw.LookupOrNull("id").AsInt64())
+			a.Equal(fmt.Sprintf("doc%d", i), raw.LookupOrNull("name").AsStringRef().StringValueOrEmpty())
+		}
+	}
+
+	vin := make(chan interface{}, len(values))
+	for _, v := range values {
+		vin <- v
+	}
+	close(vin)
+	out, err = enc.EncodeValuesFrom(vin)
+	if a.NoError(err) {
+		a.Len(out, len(values))
+	}
+
+	// the error of the first invalid document is returned
+	broken := append([][]byte(nil), docs...)
+	broken[70] = []byte(`{"id":`)
+	broken[30] = []byte(`[1,`)
+	_, err = enc.EncodeJSON(broken)
+	if a.Error(err) {
+		a.Contains(err.Error(), "document 30")
+	}
+
+	out, err = (&BatchEncoder{}).EncodeJSON(nil)
+	a.NoError(err)
+	a.Empty(out)
+}
@@ -5,12 +5,46 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 
 	"flexbuffers"
 )
 
+func FromBSON(data []byte) (flexbuffers.Raw, error) {
+	b := flexbuffers.NewBuilder()
+	r := BSONReader{Output: NewFlexbuffersWriter(b)}
+	if err := r.ReadBuffer(data); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
+
 type BSONReader struct {
 	Output DocumentWriter
+	// DuplicateKeys decides what to do with keys found again in a document. DuplicateKeysReject fails with
+	// an error wrapping flexbuffers.ErrDuplicateKey.
+	DuplicateKeys flexbuffers.DuplicateKeyPolicy
+}
+
+func (b *BSONReader) SetOutput(w DocumentWriter) error {
+	b.Output = w
+	return nil
+}
+
+// ReadBuffer reads a BSON document.
+func (b *BSONReader) ReadBuffer(buf []byte) error {
+	d := bson.Raw(buf)
+	// bson.Raw.Validate panics for a length shorter than the empty document
+	if length, _, ok := bsoncore.ReadLength(buf); ok && length < 5 {
+		return flexbuffers.ErrInvalidData
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	return b.readDocument(d)
 }
 
 func (b *BSONReader) readDocument(d bson.Raw) error {
@@ -22,11 +56,42 @@ func (b *BSONReader) readDocument(d bson.Raw) error {
 	if err != nil {
 		return err
 	}
+	var seen map[string]int
+	switch b.DuplicateKeys {
+	case flexbuffers.DuplicateKeysReject, flexbuffers.DuplicateKeysFirst:
+		seen = make(map[string]int)
+	case flexbuffers.DuplicateKeysLast:
+		seen = make(map[string]int)
+		for _, elem := range elems {
+			key, err := elem.KeyErr()
+			if err != nil {
+				return err
+			}
+			seen[key]++
+		}
+	}
 	for _, elem := range elems {
 		key, err := elem.KeyErr()
 		if err != nil {
 			return err
 		}
+		skip := false
+		switch b.DuplicateKeys {
+		case flexbuffers.DuplicateKeysReject:
+			if seen[key] > 0 {
+				return fmt.Errorf("%w: %q", flexbuffers.ErrDuplicateKey, key)
+			}
+			seen[key]++
+		case flexbuffers.DuplicateKeysFirst:
+			skip = seen[key] > 0
+			seen[key]++
+		case flexbuffers.DuplicateKeysLast:
+			seen[key]--
+			skip = seen[key] > 0
+		}
+		if skip {
+			continue
+		}
 		if err := b.Output.PushObjectKey(key); err != nil {
 			return err
 		}
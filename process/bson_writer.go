@@ -7,27 +7,62 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+
+	"flexbuffers"
 )
 
+// ToBSON converts a document to BSON, the root must be a map.
+func ToBSON(raw flexbuffers.Raw) ([]byte, error) {
+	root, err := raw.Root()
+	if err != nil {
+		return nil, err
+	}
+	if !root.IsMap() {
+		return nil, fmt.Errorf("cannot write %v to BSON document: root must be a map", root.Type())
+	}
+	var w BSONWriter
+	r := FlexbuffersReader{Output: &w}
+	if err := r.ReadReference(root); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
 type BSONWriter struct {
 	dst []byte
 	key string
+	// hasKey distinguishes an empty key from a value in an array
+	hasKey bool
 
 	elemIndex []int
 }
 
+// Bytes returns the written document.
+func (w *BSONWriter) Bytes() []byte {
+	return w.dst
+}
+
+// Reset discards the written document to reuse the writer.
+func (w *BSONWriter) Reset() {
+	w.dst = w.dst[:0]
+	w.key = ""
+	w.hasKey = false
+	w.elemIndex = w.elemIndex[:0]
+}
+
 func (w *BSONWriter) pushHeader(t bsontype.Type) error {
-	if w.key == "" && len(w.elemIndex) == 0 {
+	if !w.hasKey && len(w.elemIndex) == 0 {
 		// non-object && non-array --> no header
 		return nil
 	}
 	key := w.key
-	if key == "" {
+	if !w.hasKey {
 		key = strconv.Itoa(w.elemIndex[len(w.elemIndex)-1]) // TODO: cache?
 		w.elemIndex[len(w.elemIndex)-1]++
 	}
 	w.dst = bsoncore.AppendHeader(w.dst, t, key)
 	w.key = ""
+	w.hasKey = false
 	return nil
 }
 
@@ -121,6 +156,7 @@ func (w *BSONWriter) BeginObject() (int, error) {
 
 func (w *BSONWriter) EndObject(ptr int) error {
 	w.key = ""
+	w.hasKey = false
 	w.elemIndex = w.elemIndex[:len(w.elemIndex)-1]
 	var err error
 	w.dst, err = bsoncore.AppendDocumentEnd(w.dst, int32(ptr))
@@ -129,5 +165,6 @@ func (w *BSONWriter) EndObject(ptr int) error {
 
 func (w *BSONWriter) PushObjectKey(k string) error {
 	w.key = k
+	w.hasKey = true
 	return nil
 }
@@ -1,10 +1,14 @@
 package process
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+
+	"flexbuffers"
 )
 
 func TestBsonWriter(t *testing.T) {
@@ -79,6 +83,23 @@ func TestBsonWriter(t *testing.T) {
 				},
 			},
 		},
+		{
+			// an empty key is not an array index
+			fn: func(w *BSONWriter) error {
+				m, _ := w.BeginObject()
+				_ = w.PushObjectKey("")
+				_ = w.PushInt(1)
+				_ = w.PushObjectKey("a")
+				o, _ := w.BeginArray()
+				_ = w.PushInt(2)
+				_ = w.EndArray(o)
+				return w.EndObject(m)
+			},
+			expected: bson.D{
+				{Key: "", Value: int64(1)},
+				{Key: "a", Value: bson.A{int64(2)}},
+			},
+		},
 	}
 	for _, cas := range cases {
 		var dst []byte
@@ -95,3 +116,67 @@ func TestBsonWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestBSONRoundTrip(t *testing.T) {
+	a := assert.New(t)
+	raw, err := FromJson([]byte(`{"a":1,"b":[true,null,"s"],"c":{"d":1.5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ToBSON(raw)
+	if !a.NoError(err) {
+		return
+	}
+	actual, err := FromBSON(data)
+	if a.NoError(err) {
+		a.Equal(raw, actual)
+	}
+
+	_, err = FromBSON(data[:len(data)-1])
+	a.Error(err)
+	// a length shorter than the empty document
+	_, err = FromBSON([]byte{0, 0, 0, 0})
+	a.Error(err)
+	scalar, err := FromJson([]byte(`1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ToBSON(scalar)
+	a.Error(err)
+}
+
+func TestBSONReader_DuplicateKeys(t *testing.T) {
+	a := assert.New(t)
+	data, err := bson.Marshal(bson.D{
+		{Key: "b", Value: 1},
+		{Key: "a", Value: 2},
+		{Key: "b", Value: 3},
+		{Key: "c", Value: bson.D{{Key: "x", Value: 1}, {Key: "x", Value: 2}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		policy   flexbuffers.DuplicateKeyPolicy
+		expected string
+	}{
+		{policy: flexbuffers.DuplicateKeysFirst, expected: `{"b":1,"a":2,"c":{"x":1}}`},
+		{policy: flexbuffers.DuplicateKeysLast, expected: `{"a":2,"b":3,"c":{"x":2}}`},
+	}
+	for _, cas := range cases {
+		b := flexbuffers.NewBuilder()
+		r := BSONReader{Output: NewFlexbuffersWriter(b), DuplicateKeys: cas.policy}
+		if !a.NoError(r.ReadBuffer(data)) || !a.NoError(b.Finish()) {
+			continue
+		}
+		expected, err := FromJson([]byte(cas.expected))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Equal(expected, b.Buffer())
+	}
+
+	r := BSONReader{Output: NewFlexbuffersWriter(flexbuffers.NewBuilder()), DuplicateKeys: flexbuffers.DuplicateKeysReject}
+	err = r.ReadBuffer(data)
+	a.True(errors.Is(err, flexbuffers.ErrDuplicateKey), "%v", err)
+}
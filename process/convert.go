@@ -1,5 +1,7 @@
 package process
 
+import "flexbuffers"
+
 type DocumentReader interface {
 	SetOutput(w DocumentWriter) error
 	ReadBuffer(b []byte) error
@@ -21,3 +23,40 @@ type DocumentWriter interface {
 	EndObject(int) error
 	PushObjectKey(k string) error
 }
+
+// ExtWriter is implemented by DocumentWriters which can attach an extension tag to the next value.
+// The tag is consumed by the next string, blob, array or object, and discarded by any other value.
+type ExtWriter interface {
+	PushExt(ext int64) error
+}
+
+// AliasWriter is implemented by DocumentWriters which can refer a value written before instead of writing it again.
+type AliasWriter interface {
+	// Anchor marks the value pushed last and returns its id.
+	Anchor() (int, error)
+	// PushAlias pushes the value marked by Anchor again.
+	PushAlias(id int) error
+}
+
+// TypedWriter is implemented by DocumentWriters which keep FlexBuffers types that other formats don't have.
+// Readers fall back to DocumentWriter for other writers, keys are pushed as strings, indirect scalars as
+// scalars and typed vectors as arrays.
+type TypedWriter interface {
+	PushKey(k string) error
+	PushIndirectInt(i int64) error
+	PushIndirectUint(u uint64) error
+	PushIndirectFloat(f float64) error
+	// BeginTypedVector begins a vector of elemType, which is one of FBTInt, FBTUint, FBTFloat, FBTKey
+	// and FBTString. Fixed vectors have fixedLen of 2 to 4 elements of FBTInt, FBTUint or FBTFloat,
+	// fixedLen is 0 for other vectors.
+	BeginTypedVector(elemType flexbuffers.Type, fixedLen int) (int, error)
+	EndTypedVector(ptr int) error
+}
+
+// ArrayHintWriter is implemented by DocumentWriters which can write arrays compactly knowing their elements.
+// Readers call EndArrayHinted instead of EndArray if they track elements.
+type ArrayHintWriter interface {
+	// EndArrayHinted ends an array as EndArray does. elemType is the type of every element, which is FBTNull if
+	// types of elements differ or any of them has ext, and length is the number of elements.
+	EndArrayHinted(ptr int, elemType flexbuffers.Type, length int) error
+}
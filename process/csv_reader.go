@@ -0,0 +1,202 @@
+package process
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"flexbuffers"
+)
+
+func FromCSV(data []byte) (flexbuffers.Raw, error) {
+	b := flexbuffers.NewBuilder()
+	r := CSVReader{Output: NewFlexbuffersWriter(b)}
+	if err := r.ReadBuffer(data); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
+
+// CSVReader reads CSV (or TSV) as an array of objects, one object per row.
+type CSVReader struct {
+	Output DocumentWriter
+	// Comma is the field delimiter, ',' is used if zero. Use '\t' for TSV.
+	Comma rune
+	// Header is used as keys of each row. If nil, the first row is read as the header.
+	Header []string
+	// DisableTypeInference reads all cells as strings. Otherwise integers, floats and booleans are detected,
+	// and empty cells are read as null.
+	DisableTypeInference bool
+	// Nested reads dotted column names (e.g. "user.name") as nested objects.
+	Nested bool
+}
+
+func (r *CSVReader) SetOutput(w DocumentWriter) error {
+	r.Output = w
+	return nil
+}
+
+func (r *CSVReader) ReadBuffer(b []byte) error {
+	return r.Read(bytes.NewReader(b))
+}
+
+func (r *CSVReader) Read(in io.Reader) error {
+	cr := csv.NewReader(in)
+	if r.Comma != 0 {
+		cr.Comma = r.Comma
+	}
+	cr.ReuseRecord = true
+	// field counts are checked by ourselves to report errors with the header
+	cr.FieldsPerRecord = -1
+	header := r.Header
+	if header == nil {
+		h, err := cr.Read()
+		if err != nil {
+			return fmt.Errorf("cannot read header: %s", err)
+		}
+		header = append([]string(nil), h...)
+	}
+	var columns *csvColumn
+	if r.Nested {
+		var err error
+		if columns, err = nestColumns(header); err != nil {
+			return err
+		}
+	} else {
+		columns = flatColumns(header)
+	}
+	ptr, err := r.Output.BeginArray()
+	if err != nil {
+		return err
+	}
+	for row := 1; ; row++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) != len(header) {
+			return fmt.Errorf("row %d: expected %d fields, but got %d", row, len(header), len(record))
+		}
+		if err := r.readObject(columns, record); err != nil {
+			return err
+		}
+	}
+	return r.Output.EndArray(ptr)
+}
+
+// csvColumn is a tree of columns, leaf nodes have index of the column.
+type csvColumn struct {
+	name     string
+	index    int
+	children []*csvColumn
+}
+
+func flatColumns(header []string) *csvColumn {
+	root := &csvColumn{index: -1}
+	for i, h := range header {
+		root.children = append(root.children, &csvColumn{name: h, index: i})
+	}
+	return root
+}
+
+func nestColumns(header []string) (*csvColumn, error) {
+	root := &csvColumn{index: -1}
+	for i, h := range header {
+		node := root
+		parts := strings.Split(h, ".")
+		for j, p := range parts {
+			var child *csvColumn
+			for _, c := range node.children {
+				if c.name == p {
+					child = c
+					break
+				}
+			}
+			leaf := j == len(parts)-1
+			if child == nil {
+				child = &csvColumn{name: p, index: -1}
+				node.children = append(node.children, child)
+			} else if leaf || child.index >= 0 {
+				return nil, fmt.Errorf("column %s conflicts with other columns", h)
+			}
+			if leaf {
+				child.index = i
+			}
+			node = child
+		}
+	}
+	return root, nil
+}
+
+func (r *CSVReader) readObject(col *csvColumn, record []string) error {
+	ptr, err := r.Output.BeginObject()
+	if err != nil {
+		return err
+	}
+	for _, c := range col.children {
+		if err := r.Output.PushObjectKey(c.name); err != nil {
+			return err
+		}
+		if c.index < 0 {
+			err = r.readObject(c, record)
+		} else {
+			err = r.readCell(record[c.index])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return r.Output.EndObject(ptr)
+}
+
+func (r *CSVReader) readCell(s string) error {
+	if r.DisableTypeInference {
+		return r.Output.PushString(s)
+	}
+	if s == "" {
+		return r.Output.PushNull()
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return r.Output.PushInt(i)
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return r.Output.PushUint(u)
+	}
+	if looksLikeDecimal(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return r.Output.PushFloat(f)
+		}
+	}
+	switch s {
+	case "true", "TRUE", "True":
+		return r.Output.PushBool(true)
+	case "false", "FALSE", "False":
+		return r.Output.PushBool(false)
+	}
+	return r.Output.PushString(s)
+}
+
+// looksLikeDecimal rejects what strconv.ParseFloat accepts but humans don't read as numbers, e.g. "inf", "0x1p3"
+func looksLikeDecimal(s string) bool {
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case '0' <= c && c <= '9':
+			digits = true
+		case c == '.' || c == 'e' || c == 'E' || c == '-' || c == '+':
+		default:
+			return false
+		}
+	}
+	return digits
+}
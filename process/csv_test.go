@@ -0,0 +1,179 @@
+package process
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers"
+)
+
+func TestCSVReader(t *testing.T) {
+	cases := []struct {
+		name     string
+		reader   CSVReader
+		input    string
+		expected func(b *flexbuffers.Builder)
+	}{
+		{
+			name:  "inference",
+			input: "a,b,c,d,e\n1,1.5,true,foo,\n-2,1e3,FALSE,0x10,18446744073709551615\n",
+			expected: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Map(func(b *flexbuffers.Builder) {
+						b.IntField([]byte("a"), 1)
+						b.Float64Field([]byte("b"), 1.5)
+						b.BoolField([]byte("c"), true)
+						b.StringValueField([]byte("d"), "foo")
+						b.NullField([]byte("e"))
+					})
+					b.Map(func(b *flexbuffers.Builder) {
+						b.IntField([]byte("a"), -2)
+						b.Float64Field([]byte("b"), 1000)
+						b.BoolField([]byte("c"), false)
+						b.StringValueField([]byte("d"), "0x10")
+						b.UIntField([]byte("e"), 18446744073709551615)
+					})
+				})
+			},
+		},
+		{
+			name:   "tsv with header, no inference",
+			reader: CSVReader{Comma: '\t', Header: []string{"x", "y"}, DisableTypeInference: true},
+			input:  "1\tinf\n",
+			expected: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Map(func(b *flexbuffers.Builder) {
+						b.StringValueField([]byte("x"), "1")
+						b.StringValueField([]byte("y"), "inf")
+					})
+				})
+			},
+		},
+		{
+			name:   "nested",
+			reader: CSVReader{Nested: true},
+			input:  "id,user.name,user.age,score\n1,foo,20,\n",
+			expected: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Map(func(b *flexbuffers.Builder) {
+						b.IntField([]byte("id"), 1)
+						b.MapField([]byte("user"), func(b *flexbuffers.Builder) {
+							b.StringValueField([]byte("name"), "foo")
+							b.IntField([]byte("age"), 20)
+						})
+						b.NullField([]byte("score"))
+					})
+				})
+			},
+		},
+	}
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			b := flexbuffers.NewBuilder()
+			r := cas.reader
+			r.Output = NewFlexbuffersWriter(b)
+			if err := r.ReadBuffer([]byte(cas.input)); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			expected := flexbuffers.NewBuilder()
+			cas.expected(expected)
+			if err := expected.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(expected.Buffer(), b.Buffer()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCSVReader_Errors(t *testing.T) {
+	a := assert.New(t)
+	_, err := FromCSV([]byte("a,b\n1\n"))
+	a.Error(err)
+	r := CSVReader{Output: NewFlexbuffersWriter(flexbuffers.NewBuilder()), Nested: true}
+	a.Error(r.ReadBuffer([]byte("a,a.b\n1,2\n")))
+}
+
+func TestCSVWriter(t *testing.T) {
+	cases := []struct {
+		name     string
+		writer   CSVWriter
+		input    string
+		expected string
+	}{
+		{
+			name:     "flatten",
+			input:    `[{"a": 1, "b": {"c": "x,y", "d": [true, null]}}, {"a": 1.5, "e": "z"}]`,
+			expected: "a,b.c,b.d.0,b.d.1,e\n1,\"x,y\",true,,\n1.5,,,,z\n",
+		},
+		{
+			name:     "columns",
+			writer:   CSVWriter{Comma: '\t', Columns: []string{"e", "a"}},
+			input:    `[{"a": 1, "b": 2}, {"a": 3, "e": "z"}]`,
+			expected: "e\ta\n\t1\nz\t3\n",
+		},
+		{
+			name:     "single object without header",
+			writer:   CSVWriter{NoHeader: true},
+			input:    `{"a": "foo", "b": -1}`,
+			expected: "foo,-1\n",
+		},
+	}
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			raw, err := FromJson([]byte(cas.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			w := cas.writer
+			w.Output = &buf
+			r := FlexbuffersReader{Output: &w}
+			if err := r.ReadBuffer(raw); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(cas.expected, buf.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCSVWriter_Errors(t *testing.T) {
+	a := assert.New(t)
+	for _, input := range []string{`[1]`, `[[1]]`, `"foo"`} {
+		raw, err := FromJson([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := FlexbuffersReader{Output: &CSVWriter{Output: &bytes.Buffer{}}}
+		a.Error(r.ReadBuffer(raw), input)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	input := "id,user.age,user.name\n1,20,foo\n2,,bar\n"
+	b := flexbuffers.NewBuilder()
+	r := CSVReader{Output: NewFlexbuffersWriter(b), Nested: true}
+	if err := r.ReadBuffer([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	fr := FlexbuffersReader{Output: &CSVWriter{Output: &buf}}
+	if err := fr.ReadBuffer(b.Buffer()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(input, buf.String()); diff != "" {
+		t.Error(diff)
+	}
+}
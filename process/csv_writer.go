@@ -0,0 +1,202 @@
+package process
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CSVWriter writes an array of objects as CSV, one row per object. Nested objects and arrays are flattened into
+// columns named by dotted paths (e.g. "user.name", "tags.0"). A single object at the root is written as a row.
+// Rows are buffered and written when the root value is completed, since the header depends on all rows.
+type CSVWriter struct {
+	Output io.Writer
+	// Comma is the field delimiter, ',' is used if zero. Use '\t' for TSV.
+	Comma rune
+	// Columns selects columns and its order. If nil, all columns are written in order of appearance.
+	Columns []string
+	// NoHeader omits the header line.
+	NoHeader bool
+
+	stack    []csvFrame
+	key      string
+	rowDepth int
+	row      map[string]string
+	rows     []map[string]string
+	columns  []string
+	seen     map[string]bool
+}
+
+type csvFrame struct {
+	path  string
+	array bool
+	index int
+}
+
+// path returns path for the next value in the current container.
+func (w *CSVWriter) path() (string, error) {
+	if len(w.stack) < w.rowDepth {
+		return "", fmt.Errorf("rows must be objects")
+	}
+	f := &w.stack[len(w.stack)-1]
+	var name string
+	if f.array {
+		name = strconv.Itoa(f.index)
+		f.index++
+	} else {
+		name = w.key
+	}
+	if f.path == "" {
+		return name, nil
+	}
+	return f.path + "." + name, nil
+}
+
+func (w *CSVWriter) pushCell(s string) error {
+	if len(w.stack) == 0 {
+		return fmt.Errorf("rows must be objects")
+	}
+	p, err := w.path()
+	if err != nil {
+		return err
+	}
+	if !w.seen[p] {
+		w.seen[p] = true
+		w.columns = append(w.columns, p)
+	}
+	w.row[p] = s
+	return nil
+}
+
+func (w *CSVWriter) PushString(s string) error {
+	return w.pushCell(s)
+}
+
+func (w *CSVWriter) PushBlob(b []byte) error {
+	return w.pushCell(base64.StdEncoding.EncodeToString(b))
+}
+
+func (w *CSVWriter) PushInt(i int64) error {
+	return w.pushCell(strconv.FormatInt(i, 10))
+}
+
+func (w *CSVWriter) PushUint(u uint64) error {
+	return w.pushCell(strconv.FormatUint(u, 10))
+}
+
+func (w *CSVWriter) PushFloat(f float64) error {
+	return w.pushCell(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+func (w *CSVWriter) PushBool(b bool) error {
+	return w.pushCell(strconv.FormatBool(b))
+}
+
+func (w *CSVWriter) PushNull() error {
+	return w.pushCell("")
+}
+
+func (w *CSVWriter) begin(array bool) (int, error) {
+	if len(w.stack) == 0 {
+		w.rows = nil
+		w.columns = nil
+		w.seen = map[string]bool{}
+		if array {
+			w.rowDepth = 2
+		} else {
+			w.rowDepth = 1
+		}
+		w.stack = append(w.stack, csvFrame{array: array})
+		if !array {
+			w.row = map[string]string{}
+		}
+		return len(w.stack), nil
+	}
+	var p string
+	if len(w.stack) >= w.rowDepth {
+		var err error
+		if p, err = w.path(); err != nil {
+			return 0, err
+		}
+	} else {
+		// beginning of a row
+		if array {
+			return 0, fmt.Errorf("rows must be objects")
+		}
+		w.row = map[string]string{}
+	}
+	w.stack = append(w.stack, csvFrame{path: p, array: array})
+	return len(w.stack), nil
+}
+
+func (w *CSVWriter) end(array bool) error {
+	if len(w.stack) == 0 {
+		return fmt.Errorf("no array or object to end")
+	}
+	if w.stack[len(w.stack)-1].array != array {
+		return fmt.Errorf("mismatched end of array or object")
+	}
+	w.stack = w.stack[:len(w.stack)-1]
+	if len(w.stack) == w.rowDepth-1 {
+		w.rows = append(w.rows, w.row)
+		w.row = nil
+	}
+	if len(w.stack) == 0 {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *CSVWriter) flush() error {
+	columns := w.Columns
+	if columns == nil {
+		columns = w.columns
+	}
+	cw := csv.NewWriter(w.Output)
+	if w.Comma != 0 {
+		cw.Comma = w.Comma
+	}
+	if !w.NoHeader {
+		if err := cw.Write(columns); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(columns))
+	for _, row := range w.rows {
+		for i, c := range columns {
+			record[i] = row[c]
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	w.rows = nil
+	return cw.Error()
+}
+
+func (w *CSVWriter) BeginArray() (int, error) {
+	return w.begin(true)
+}
+
+func (w *CSVWriter) EndArray(int) error {
+	return w.end(true)
+}
+
+func (w *CSVWriter) BeginObject() (int, error) {
+	return w.begin(false)
+}
+
+func (w *CSVWriter) EndObject(int) error {
+	return w.end(false)
+}
+
+func (w *CSVWriter) PushObjectKey(k string) error {
+	if len(w.stack) == 0 || w.stack[len(w.stack)-1].array {
+		return fmt.Errorf("object key outside of object")
+	}
+	w.key = k
+	return nil
+}
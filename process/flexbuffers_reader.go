@@ -0,0 +1,221 @@
+package process
+
+import (
+	"fmt"
+
+	"flexbuffers"
+)
+
+// FlexbuffersReader emits a flexbuffers document to DocumentWriter.
+type FlexbuffersReader struct {
+	Output DocumentWriter
+	// KeyDictionary resolves map keys of documents built with it.
+	KeyDictionary *flexbuffers.KeyDictionary
+}
+
+func (r *FlexbuffersReader) SetOutput(w DocumentWriter) error {
+	r.Output = w
+	return nil
+}
+
+func (r *FlexbuffersReader) ReadBuffer(b []byte) error {
+	root, err := flexbuffers.Raw(b).RootWithKeyDictionary(r.KeyDictionary)
+	if err != nil {
+		return err
+	}
+	return r.ReadReference(root)
+}
+
+func (r *FlexbuffersReader) ReadReference(ref flexbuffers.Reference) error {
+	if ext := ref.Ext(); ext != 0 {
+		if w, ok := r.Output.(ExtWriter); ok {
+			if err := w.PushExt(ext); err != nil {
+				return err
+			}
+		}
+	}
+	tw, typed := r.Output.(TypedWriter)
+	switch {
+	case ref.IsNull():
+		return r.Output.PushNull()
+	case ref.IsBool():
+		v, err := ref.Bool()
+		if err != nil {
+			return err
+		}
+		return r.Output.PushBool(v)
+	case ref.IsInt():
+		v, err := ref.Int64()
+		if err != nil {
+			return err
+		}
+		if typed && ref.Type() == flexbuffers.FBTIndirectInt {
+			return tw.PushIndirectInt(v)
+		}
+		return r.Output.PushInt(v)
+	case ref.IsUInt():
+		v, err := ref.UInt64()
+		if err != nil {
+			return err
+		}
+		if typed && ref.Type() == flexbuffers.FBTIndirectUInt {
+			return tw.PushIndirectUint(v)
+		}
+		return r.Output.PushUint(v)
+	case ref.IsFloat():
+		v, err := ref.Float64()
+		if err != nil {
+			return err
+		}
+		if typed && ref.Type() == flexbuffers.FBTIndirectFloat {
+			return tw.PushIndirectFloat(v)
+		}
+		return r.Output.PushFloat(v)
+	case ref.IsKey():
+		k, err := ref.Key()
+		if err != nil {
+			return err
+		}
+		if typed {
+			return tw.PushKey(k.StringValue())
+		}
+		return r.Output.PushString(k.StringValue())
+	case ref.IsString():
+		s, err := ref.StringRef()
+		if err != nil {
+			return err
+		}
+		v, err := s.StringValue()
+		if err != nil {
+			return err
+		}
+		return r.Output.PushString(v)
+	case ref.IsBlob():
+		blob, err := ref.Blob()
+		if err != nil {
+			return err
+		}
+		d, err := blob.Data()
+		if err != nil {
+			return err
+		}
+		return r.Output.PushBlob(d)
+	case ref.IsMap():
+		return r.readMap(ref)
+	case typed && (ref.IsTypedVector() || ref.IsFixedTypedVector()):
+		return r.readTypedVector(ref, tw)
+	case ref.IsAnyVector():
+		return r.readVector(ref)
+	default:
+		return fmt.Errorf("unable to read: type=%v", ref.Type())
+	}
+}
+
+func (r *FlexbuffersReader) readMap(ref flexbuffers.Reference) error {
+	m, err := ref.Map()
+	if err != nil {
+		return err
+	}
+	keys, err := m.Keys()
+	if err != nil {
+		return err
+	}
+	sz, err := m.Size()
+	if err != nil {
+		return err
+	}
+	ptr, err := r.Output.BeginObject()
+	if err != nil {
+		return err
+	}
+	var order []int
+	if m.Ordered() {
+		if order, err = m.AppendOrder(nil); err != nil {
+			return err
+		}
+	}
+	values := m.Values()
+	var k, v flexbuffers.Reference
+	for i := 0; i < sz; i++ {
+		idx := i
+		if order != nil {
+			idx = order[i]
+		}
+		if err := keys.AtRef(idx, &k); err != nil {
+			return err
+		}
+		key, err := k.Key()
+		if err != nil {
+			return err
+		}
+		if err := r.Output.PushObjectKey(key.StringValue()); err != nil {
+			return err
+		}
+		if err := values.AtRef(idx, &v); err != nil {
+			return err
+		}
+		if err := r.ReadReference(v); err != nil {
+			return err
+		}
+	}
+	return r.Output.EndObject(ptr)
+}
+
+func (r *FlexbuffersReader) readVector(ref flexbuffers.Reference) error {
+	vec, err := ref.AnyVector()
+	if err != nil {
+		return err
+	}
+	sz, err := vec.Size()
+	if err != nil {
+		return err
+	}
+	ptr, err := r.Output.BeginArray()
+	if err != nil {
+		return err
+	}
+	var v flexbuffers.Reference
+	for i := 0; i < sz; i++ {
+		if err := vec.AtRef(i, &v); err != nil {
+			return err
+		}
+		if err := r.ReadReference(v); err != nil {
+			return err
+		}
+	}
+	return r.Output.EndArray(ptr)
+}
+
+func (r *FlexbuffersReader) readTypedVector(ref flexbuffers.Reference, w TypedWriter) error {
+	vec, err := ref.AnyVector()
+	if err != nil {
+		return err
+	}
+	sz, err := vec.Size()
+	if err != nil {
+		return err
+	}
+	var elemType flexbuffers.Type
+	fixedLen := 0
+	if ref.IsFixedTypedVector() {
+		var l uint8
+		elemType = flexbuffers.ToFixedTypedVectorElementType(ref.Type(), &l)
+		fixedLen = int(l)
+	} else {
+		elemType = flexbuffers.ToTypedVectorElementType(ref.Type())
+	}
+	ptr, err := w.BeginTypedVector(elemType, fixedLen)
+	if err != nil {
+		return err
+	}
+	var v flexbuffers.Reference
+	for i := 0; i < sz; i++ {
+		if err := vec.AtRef(i, &v); err != nil {
+			return err
+		}
+		if err := r.ReadReference(v); err != nil {
+			return err
+		}
+	}
+	return w.EndTypedVector(ptr)
+}
@@ -1,50 +1,133 @@
 package process
 
 import (
+	"fmt"
+
 	"flexbuffers"
 	"flexbuffers/pkg/unsafeutil"
 )
 
 type FlexbuffersWriter struct {
-	b *flexbuffers.Builder
+	// TypedVectors builds arrays hinted to have ints, uints, floats, keys or strings of the same type as typed vectors.
+	TypedVectors bool
+	// FixedVectors builds arrays hinted to have 2 to 4 ints, uints or floats of the same type as fixed typed vectors.
+	FixedVectors bool
+
+	b       *flexbuffers.Builder
+	ext     int64
+	anchors []flexbuffers.BuiltValue
+	// typed are the typed vectors being built
+	typed []typedVector
+}
+
+type typedVector struct {
+	elemType flexbuffers.Type
+	fixed    bool
+}
+
+func NewFlexbuffersWriter(b *flexbuffers.Builder) *FlexbuffersWriter {
+	return &FlexbuffersWriter{b: b}
+}
+
+// applyExt passes pending ext to the builder, it must be called just before pushing a value which can hold ext.
+func (w *FlexbuffersWriter) applyExt() {
+	if w.ext != 0 {
+		w.b.Ext(w.ext)
+		w.ext = 0
+	}
+}
+
+func (w *FlexbuffersWriter) PushExt(ext int64) error {
+	w.ext = ext
+	return nil
 }
 
 func (w *FlexbuffersWriter) PushString(s string) error {
+	w.applyExt()
 	_ = w.b.StringValue(s)
 	return nil
 }
 
 func (w *FlexbuffersWriter) PushBlob(blb []byte) error {
+	w.applyExt()
 	_ = w.b.Blob(blb)
 	return nil
 }
 
 func (w *FlexbuffersWriter) PushInt(i int64) error {
+	w.ext = 0
 	w.b.Int(i)
 	return nil
 }
 
 func (w *FlexbuffersWriter) PushUint(u uint64) error {
+	w.ext = 0
 	w.b.UInt(u)
 	return nil
 }
 
 func (w *FlexbuffersWriter) PushFloat(f float64) error {
+	w.ext = 0
 	w.b.Float64(f)
 	return nil
 }
 
 func (w *FlexbuffersWriter) PushBool(tf bool) error {
+	w.ext = 0
 	w.b.Bool(tf)
 	return nil
 }
 
 func (w *FlexbuffersWriter) PushNull() error {
+	w.ext = 0
 	w.b.Null()
 	return nil
 }
 
+func (w *FlexbuffersWriter) PushKey(k string) error {
+	w.ext = 0
+	w.b.Key(unsafeutil.S2B(k))
+	return nil
+}
+
+func (w *FlexbuffersWriter) PushIndirectInt(i int64) error {
+	w.ext = 0
+	w.b.IndirectInt(i)
+	return nil
+}
+
+func (w *FlexbuffersWriter) PushIndirectUint(u uint64) error {
+	w.ext = 0
+	w.b.IndirectUInt(u)
+	return nil
+}
+
+func (w *FlexbuffersWriter) PushIndirectFloat(f float64) error {
+	w.ext = 0
+	w.b.IndirectFloat64(f)
+	return nil
+}
+
+func (w *FlexbuffersWriter) Anchor() (int, error) {
+	v, err := w.b.LastValue()
+	if err != nil {
+		return 0, err
+	}
+	w.anchors = append(w.anchors, v)
+	return len(w.anchors) - 1, nil
+}
+
+func (w *FlexbuffersWriter) PushAlias(id int) error {
+	if id < 0 || len(w.anchors) <= id {
+		return fmt.Errorf("unknown anchor: %d", id)
+	}
+	w.ext = 0
+	w.b.PushValue(w.anchors[id])
+	return nil
+}
+
 func (w *FlexbuffersWriter) BeginArray() (int, error) {
+	w.applyExt()
 	return w.b.StartVector(), nil
 }
 
@@ -54,7 +137,37 @@ func (w *FlexbuffersWriter) EndArray(ptr int) error {
 	return err
 }
 
+func (w *FlexbuffersWriter) EndArrayHinted(ptr int, elemType flexbuffers.Type, length int) error {
+	var typed, fixed bool
+	switch elemType {
+	case flexbuffers.FBTInt, flexbuffers.FBTUint, flexbuffers.FBTFloat:
+		fixed = w.FixedVectors && 2 <= length && length <= 4
+		typed = w.TypedVectors || fixed
+	case flexbuffers.FBTKey, flexbuffers.FBTString:
+		typed = w.TypedVectors
+	}
+	_, err := w.b.EndVector(ptr, typed, fixed)
+	return err
+}
+
+func (w *FlexbuffersWriter) BeginTypedVector(elemType flexbuffers.Type, fixedLen int) (int, error) {
+	w.applyExt()
+	w.typed = append(w.typed, typedVector{elemType: elemType, fixed: fixedLen != 0})
+	return w.b.StartVector(), nil
+}
+
+func (w *FlexbuffersWriter) EndTypedVector(ptr int) error {
+	if len(w.typed) == 0 {
+		return fmt.Errorf("no typed vector to end")
+	}
+	v := w.typed[len(w.typed)-1]
+	w.typed = w.typed[:len(w.typed)-1]
+	_, err := w.b.EndTypedVector(ptr, v.elemType, v.fixed)
+	return err
+}
+
 func (w *FlexbuffersWriter) BeginObject() (int, error) {
+	w.applyExt()
 	return w.b.StartMap(), nil
 }
 
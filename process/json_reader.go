@@ -3,32 +3,169 @@ package process
 // json parsing code based on https://github.com/valyala/fastjson
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"unicode/utf16"
-
-	"github.com/valyala/fastjson/fastfloat"
+	"unicode/utf8"
 
 	"flexbuffers"
 	"flexbuffers/pkg/unsafeutil"
 )
 
+// JsonInputOptions configures how JSON documents are built.
+type JsonInputOptions struct {
+	// Extended reads the extended JSON dialect, see JsonReader.
+	Extended bool
+	// TypedVectors builds arrays of numbers or strings of the same type as typed vectors.
+	TypedVectors bool
+	// FixedVectors builds arrays of 2 to 4 numbers of the same type, like coordinates, as fixed typed vectors.
+	FixedVectors bool
+	// NumberExt keeps numbers exactly as strings with ext NumberExt, see JsonReader.
+	NumberExt int64
+	// Strict rejects input which is not valid JSON, see JsonReader.
+	Strict bool
+	// MaxDepth limits nesting in Strict mode, see JsonReader.
+	MaxDepth int
+	// DuplicateKeys decides what to do with keys found again in an object, see JsonReader.
+	DuplicateKeys flexbuffers.DuplicateKeyPolicy
+	// OrderedMaps keeps the order of object keys, see flexbuffers.Builder.SetOrderedMaps.
+	OrderedMaps bool
+	// IndirectScalars, if not zero, stores numbers indirectly at this byte width, so they can be mutated in place.
+	// IndirectPaths selects the numbers by dotted paths, see flexbuffers.Builder.SetIndirectScalars.
+	// Numbers of arrays built as typed vectors stay inline.
+	IndirectScalars int
+	IndirectPaths   []string
+}
+
+// DefaultJsonMaxDepth limits nesting of arrays and objects in Strict mode if JsonReader.MaxDepth is zero.
+const DefaultJsonMaxDepth = 1000
+
+// JsonSyntaxError is returned by JsonReader with the position where reading failed.
+type JsonSyntaxError struct {
+	// Offset is the byte offset in the input.
+	Offset int
+	// Line and Column start at 1, Column counts bytes.
+	Line   int
+	Column int
+	Err    error
+}
+
+func newJsonSyntaxError(input string, offset int, err error) *JsonSyntaxError {
+	head := input[:offset]
+	return &JsonSyntaxError{
+		Offset: offset,
+		Line:   1 + strings.Count(head, "\n"),
+		Column: offset - strings.LastIndexByte(head, '\n'),
+		Err:    err,
+	}
+}
+
+func (e *JsonSyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d (offset %d): %v", e.Line, e.Column, e.Offset, e.Err)
+}
+
+func (e *JsonSyntaxError) Unwrap() error {
+	return e.Err
+}
+
 func FromJson(data []byte) (flexbuffers.Raw, error) {
+	return FromJsonWithOptions(data, JsonInputOptions{})
+}
+
+// FromExtendedJson reads the extended JSON dialect, which keeps FlexBuffers types.
+func FromExtendedJson(data []byte) (flexbuffers.Raw, error) {
+	return FromJsonWithOptions(data, JsonInputOptions{Extended: true})
+}
+
+func FromJsonWithOptions(data []byte, opts JsonInputOptions) (flexbuffers.Raw, error) {
 	b := flexbuffers.NewBuilder()
-	r := JsonReader{Output: &FlexbuffersWriter{b: b}}
-	_, err := r.parseValue(unsafeutil.B2S(data))
-	if err != nil {
-		return nil, err
-	}
-	if err := b.Finish(); err != nil {
+	if err := buildJson(b, data, opts); err != nil {
 		return nil, err
 	}
 	return b.Buffer(), nil
 }
 
+// buildJson builds the JSON document with b, and finishes it.
+func buildJson(b *flexbuffers.Builder, data []byte, opts JsonInputOptions) error {
+	b.SetOrderedMaps(opts.OrderedMaps)
+	if err := b.SetIndirectScalars(opts.IndirectScalars, opts.IndirectPaths...); err != nil {
+		return err
+	}
+	w := &FlexbuffersWriter{b: b, TypedVectors: opts.TypedVectors, FixedVectors: opts.FixedVectors}
+	r := JsonReader{
+		Output:        w,
+		Extended:      opts.Extended,
+		NumberExt:     opts.NumberExt,
+		Strict:        opts.Strict,
+		MaxDepth:      opts.MaxDepth,
+		DuplicateKeys: opts.DuplicateKeys,
+	}
+	if err := r.ReadBuffer(data); err != nil {
+		return err
+	}
+	return b.Finish()
+}
+
 type JsonReader struct {
 	Output DocumentWriter
+	// Extended reads the extended JSON dialect written by JsonWriter with Extended, see flexbuffers.ExtendedJsonTag.
+	// Objects whose first key starts with "$" are read as tag objects, unknown tags are errors.
+	// Tagged values are pushed to TypedWriter and ExtWriter if Output implements them.
+	Extended bool
+	// NumberExt, if not zero, keeps integers out of the range of int64 and uint64, and numbers with fraction
+	// or exponent, as strings of the literal with ext NumberExt, so that decimals are not rounded.
+	// JsonWriter and flexbuffers.JsonOptions with the same NumberExt write the literals back.
+	NumberExt int64
+	// Strict rejects input which the default best effort parsing accepts: invalid UTF-8, invalid escapes
+	// and control characters in strings, numbers which are not JSON numbers, nesting deeper than MaxDepth
+	// and content after the value.
+	Strict bool
+	// MaxDepth limits nesting of arrays and objects in Strict mode, the root is at depth 1.
+	// DefaultJsonMaxDepth is used if zero.
+	MaxDepth int
+	// DuplicateKeys decides what to do with keys found again in an object. DuplicateKeysReject fails with
+	// an error wrapping flexbuffers.ErrDuplicateKey. For DuplicateKeysLast, each object is read twice,
+	// first to count its keys.
+	DuplicateKeys flexbuffers.DuplicateKeyPolicy
+
+	// last is the type of the value parsed last, for hints of arrays
+	last  flexbuffers.Type
+	depth int
+	// skipping is positive while values are parsed without being pushed
+	skipping int
+}
+
+func (r *JsonReader) SetOutput(w DocumentWriter) error {
+	r.Output = w
+	return nil
+}
+
+// ReadBuffer reads a JSON value. Errors are *JsonSyntaxError.
+func (r *JsonReader) ReadBuffer(b []byte) error {
+	s := unsafeutil.B2S(b)
+	r.depth = 0
+	tail, err := r.parseValue(skipWS(s))
+	if err == nil && r.Strict {
+		if tail = skipWS(tail); len(tail) > 0 {
+			err = fmt.Errorf("unexpected content after value: %q", startOf(tail))
+		}
+	}
+	if err != nil {
+		return newJsonSyntaxError(s, len(s)-len(tail), err)
+	}
+	return nil
+}
+
+// startOf returns the start of s for error messages.
+func startOf(s string) string {
+	if len(s) > 16 {
+		return s[:16] + "..."
+	}
+	return s
 }
 
 func skipWS(s string) string {
@@ -56,15 +193,27 @@ func (r *JsonReader) parseValue(s string) (string, error) {
 		return s, fmt.Errorf("cannot parse empty string")
 	}
 
+	if s[0] == '{' || s[0] == '[' {
+		if err := r.enter(); err != nil {
+			return s, err
+		}
+		defer r.leave()
+	}
 	if s[0] == '{' {
+		if r.Extended {
+			if tag, tail, ok := parseExtendedTag(s[1:]); ok {
+				return r.parseTagged(tag, tail)
+			}
+		}
 		ptr, err := r.Output.BeginObject()
 		if err != nil {
 			return s, err
 		}
 		tail, err := r.parseObject(s[1:])
 		if err != nil {
-			return tail, fmt.Errorf("cannot parse object: %s", err)
+			return tail, fmt.Errorf("cannot parse object: %w", err)
 		}
+		r.last = flexbuffers.FBTMap
 		return tail, r.Output.EndObject(ptr)
 	}
 	if s[0] == '[' {
@@ -72,71 +221,157 @@ func (r *JsonReader) parseValue(s string) (string, error) {
 		if err != nil {
 			return s, err
 		}
-		tail, err := r.parseArray(s[1:])
+		tail, elemType, n, err := r.parseArray(s[1:])
 		if err != nil {
-			return tail, fmt.Errorf("cannot parse array: %s", err)
+			return tail, fmt.Errorf("cannot parse array: %w", err)
+		}
+		r.last = flexbuffers.FBTVector
+		if w, ok := r.Output.(ArrayHintWriter); ok {
+			return tail, w.EndArrayHinted(ptr, elemType, n)
 		}
 		return tail, r.Output.EndArray(ptr)
 	}
 	if s[0] == '"' {
-		ss, tail, err := parseRawString(s[1:])
+		ss, tail, err := r.parseString(s)
 		if err != nil {
-			return tail, fmt.Errorf("cannot parse string: %s", err)
+			return tail, fmt.Errorf("cannot parse string: %w", err)
 		}
-		return tail, r.Output.PushString(unescapeStringBestEffort(ss))
+		r.last = flexbuffers.FBTString
+		return tail, r.Output.PushString(ss)
 	}
 	if s[0] == 't' {
 		if len(s) < len("true") || s[:len("true")] != "true" {
 			return s, fmt.Errorf("unexpected value found: %q", s)
 		}
+		r.last = flexbuffers.FBTBool
 		return s[len("true"):], r.Output.PushBool(true)
 	}
 	if s[0] == 'f' {
 		if len(s) < len("false") || s[:len("false")] != "false" {
 			return s, fmt.Errorf("unexpected value found: %q", s)
 		}
+		r.last = flexbuffers.FBTBool
 		return s[len("false"):], r.Output.PushBool(false)
 	}
 	if s[0] == 'n' {
 		if len(s) < len("null") || s[:len("null")] != "null" {
 			return s, fmt.Errorf("unexpected value found: %q", s)
 		}
+		r.last = flexbuffers.FBTNull
 		return s[len("null"):], r.Output.PushNull()
 	}
 
-	integral, ns, tail, err := parseRawNumber(s)
+	integral, ns, tail, err := r.parseNumber(s)
 	if err != nil {
-		return tail, fmt.Errorf("cannot parse number: %s", err)
+		return tail, fmt.Errorf("cannot parse number: %w", err)
+	}
+	return tail, r.pushNumber(ns, integral)
+}
+
+// enter starts an array or object, and checks MaxDepth in Strict mode.
+func (r *JsonReader) enter() error {
+	r.depth++
+	if !r.Strict {
+		return nil
+	}
+	max := r.MaxDepth
+	if max == 0 {
+		max = DefaultJsonMaxDepth
+	}
+	if r.depth > max {
+		return fmt.Errorf("exceeded max depth %d", max)
+	}
+	return nil
+}
+
+func (r *JsonReader) leave() {
+	r.depth--
+}
+
+// pushNumber pushes a number literal as an int, an uint above the range of int64, or a float.
+// With NumberExt, integers out of range and numbers with fraction or exponent are pushed as strings instead.
+func (r *JsonReader) pushNumber(ns string, integral bool) error {
+	if r.NumberExt != 0 && !flexbuffers.IsJsonNumber(ns) {
+		return fmt.Errorf("invalid number: %q", ns)
 	}
 	if integral {
-		return tail, r.Output.PushInt(fastfloat.ParseInt64BestEffort(ns))
-	} else {
-		return tail, r.Output.PushFloat(fastfloat.ParseBestEffort(ns))
+		i, err := strconv.ParseInt(ns, 10, 64)
+		if err == nil {
+			r.last = flexbuffers.FBTInt
+			return r.Output.PushInt(i)
+		}
+		if ns[0] != '-' {
+			if u, err := strconv.ParseUint(ns, 10, 64); err == nil {
+				r.last = flexbuffers.FBTUint
+				return r.Output.PushUint(u)
+			}
+		}
+		if !errors.Is(err, strconv.ErrRange) {
+			return fmt.Errorf("cannot parse number: %q", ns)
+		}
+	}
+	if r.NumberExt != 0 {
+		if w, ok := r.Output.(ExtWriter); ok {
+			if err := w.PushExt(r.NumberExt); err != nil {
+				return err
+			}
+		}
+		// strings with ext are not typed
+		r.last = flexbuffers.FBTNull
+		return r.Output.PushString(ns)
 	}
+	// out of range numbers are Inf
+	f, err := strconv.ParseFloat(ns, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("cannot parse number: %q", ns)
+	}
+	r.last = flexbuffers.FBTFloat
+	return r.Output.PushFloat(f)
 }
 
-func (r *JsonReader) parseArray(s string) (string, error) {
+// parseArray parses elements of an array after '[', and returns the type of every element,
+// or FBTNull if they differ, and the number of them.
+func (r *JsonReader) parseArray(s string) (string, flexbuffers.Type, int, error) {
+	elemType := flexbuffers.FBTNull
+	first := true
+	tail, n, err := parseElements(s, func(s string) (string, error) {
+		s, err := r.parseValue(s)
+		if err != nil {
+			return s, err
+		}
+		if first {
+			elemType, first = r.last, false
+		} else if r.last != elemType {
+			elemType = flexbuffers.FBTNull
+		}
+		return s, nil
+	})
+	return tail, elemType, n, err
+}
+
+// parseElements parses elements of an array after '[' with parseElem, and returns the number of them.
+func parseElements(s string, parseElem func(s string) (string, error)) (string, int, error) {
 	s = skipWS(s)
 	if len(s) == 0 {
-		return s, fmt.Errorf("missing ']'")
+		return s, 0, fmt.Errorf("missing ']'")
 	}
 
 	if s[0] == ']' {
-		return s[1:], nil
+		return s[1:], 0, nil
 	}
 
-	for {
+	for n := 1; ; n++ {
 		var err error
 
 		s = skipWS(s)
-		s, err = r.parseValue(s)
+		s, err = parseElem(s)
 		if err != nil {
-			return s, fmt.Errorf("cannot parse array value: %s", err)
+			return s, n, fmt.Errorf("cannot parse array value: %w", err)
 		}
 
 		s = skipWS(s)
 		if len(s) == 0 {
-			return s, fmt.Errorf("unexpected end of array")
+			return s, n, fmt.Errorf("unexpected end of array")
 		}
 		if s[0] == ',' {
 			s = s[1:]
@@ -144,13 +379,74 @@ func (r *JsonReader) parseArray(s string) (string, error) {
 		}
 		if s[0] == ']' {
 			s = s[1:]
-			return s, nil
+			return s, n, nil
 		}
-		return s, fmt.Errorf("missing ',' after array value")
+		return s, n, fmt.Errorf("missing ',' after array value")
 	}
 }
 
 func (r *JsonReader) parseObject(s string) (string, error) {
+	if r.skipping > 0 {
+		return r.parseEntries(s, func(_, _, s string) (string, error) {
+			return r.parseValue(s)
+		})
+	}
+	var seen map[string]int
+	switch r.DuplicateKeys {
+	case flexbuffers.DuplicateKeysReject, flexbuffers.DuplicateKeysFirst:
+		seen = make(map[string]int)
+	case flexbuffers.DuplicateKeysLast:
+		// count keys first, to skip all but the last entry
+		var err error
+		if seen, err = r.countKeys(s); err != nil {
+			return s, err
+		}
+	}
+	return r.parseEntries(s, func(k, keyStart, s string) (string, error) {
+		skip := false
+		switch r.DuplicateKeys {
+		case flexbuffers.DuplicateKeysReject:
+			if seen[k] > 0 {
+				return keyStart, fmt.Errorf("%w: %q", flexbuffers.ErrDuplicateKey, k)
+			}
+			seen[k]++
+		case flexbuffers.DuplicateKeysFirst:
+			skip = seen[k] > 0
+			seen[k]++
+		case flexbuffers.DuplicateKeysLast:
+			seen[k]--
+			skip = seen[k] > 0
+		}
+		if skip {
+			return r.skipValue(s)
+		}
+		if err := r.Output.PushObjectKey(k); err != nil {
+			return s, err
+		}
+		return r.parseValue(s)
+	})
+}
+
+// countKeys returns the number of entries of each key in the object after '{'.
+func (r *JsonReader) countKeys(s string) (map[string]int, error) {
+	counts := make(map[string]int)
+	out := r.Output
+	r.Output = discardWriter{}
+	r.skipping++
+	defer func() {
+		r.Output = out
+		r.skipping--
+	}()
+	_, err := r.parseEntries(s, func(k, _, s string) (string, error) {
+		counts[k]++
+		return r.parseValue(s)
+	})
+	return counts, err
+}
+
+// parseEntries parses entries of an object after '{'. parseEntry is called with the key, the input at the key
+// and the input at the value, and parses the value.
+func (r *JsonReader) parseEntries(s string, parseEntry func(k, keyStart, s string) (string, error)) (string, error) {
 	s = skipWS(s)
 	if len(s) == 0 {
 		return s, fmt.Errorf("missing '}'")
@@ -168,13 +464,11 @@ func (r *JsonReader) parseObject(s string) (string, error) {
 		if len(s) == 0 || s[0] != '"' {
 			return s, fmt.Errorf(`cannot find opening '"" for object key`)
 		}
+		keyStart := s
 		var k string
-		k, s, err = parseRawKey(s[1:])
+		k, s, err = r.parseKey(s)
 		if err != nil {
-			return s, fmt.Errorf("cannot parse object key: %s", err)
-		}
-		if err := r.Output.PushObjectKey(k); err != nil {
-			return s, err
+			return s, fmt.Errorf("cannot parse object key: %w", err)
 		}
 		s = skipWS(s)
 		if len(s) == 0 || s[0] != ':' {
@@ -184,9 +478,9 @@ func (r *JsonReader) parseObject(s string) (string, error) {
 
 		// Parse value
 		s = skipWS(s)
-		s, err = r.parseValue(s)
+		s, err = parseEntry(k, keyStart, s)
 		if err != nil {
-			return s, fmt.Errorf("cannot parse object value: %s", err)
+			return s, fmt.Errorf("cannot parse object value: %w", err)
 		}
 		s = skipWS(s)
 		if len(s) == 0 {
@@ -203,6 +497,348 @@ func (r *JsonReader) parseObject(s string) (string, error) {
 	}
 }
 
+// skipValue parses a value without pushing it to Output.
+func (r *JsonReader) skipValue(s string) (string, error) {
+	out := r.Output
+	r.Output = discardWriter{}
+	r.skipping++
+	defer func() {
+		r.Output = out
+		r.skipping--
+	}()
+	return r.parseValue(s)
+}
+
+// parseExtendedTag returns the first key of the object after '{' and the tail after the key, if it is a tag of the extended dialect.
+func parseExtendedTag(s string) (string, string, bool) {
+	s = skipWS(s)
+	if len(s) == 0 || s[0] != '"' {
+		return "", s, false
+	}
+	k, tail, err := parseRawKey(s[1:])
+	if err != nil {
+		return "", s, false
+	}
+	k = unescapeStringBestEffort(k)
+	if len(k) == 0 || k[0] != '$' {
+		return "", s, false
+	}
+	return k, tail, true
+}
+
+// parseTagged parses the tag object of the extended dialect after the tag.
+func (r *JsonReader) parseTagged(tag, s string) (string, error) {
+	s = skipWS(s)
+	if len(s) == 0 || s[0] != ':' {
+		return s, fmt.Errorf("missing ':' after object key")
+	}
+	s = skipWS(s[1:])
+	var err error
+	switch tag {
+	case "$ext":
+		s, err = r.parseExt(s)
+	case flexbuffers.ExtendedJsonTag(flexbuffers.FBTMap):
+		if len(s) == 0 || s[0] != '{' {
+			return s, fmt.Errorf("cannot parse %s: missing '{'", tag)
+		}
+		var ptr int
+		if ptr, err = r.Output.BeginObject(); err != nil {
+			return s, err
+		}
+		if s, err = r.parseObject(s[1:]); err != nil {
+			return s, fmt.Errorf("cannot parse object: %w", err)
+		}
+		err = r.Output.EndObject(ptr)
+	default:
+		t, ok := flexbuffers.ExtendedJsonTagType(tag)
+		if !ok {
+			return s, fmt.Errorf("unknown tag %q", tag)
+		}
+		if flexbuffers.IsTypedVector(t) || flexbuffers.IsFixedTypedVector(t) {
+			s, err = r.parseTypedVector(t, s)
+		} else {
+			s, err = r.parseScalar(t, s)
+		}
+	}
+	if err != nil {
+		return s, fmt.Errorf("cannot parse %s: %s", tag, err)
+	}
+	s = skipWS(s)
+	if len(s) == 0 || s[0] != '}' {
+		return s, fmt.Errorf("missing '}' after %s value", tag)
+	}
+	if t, ok := flexbuffers.ExtendedJsonTagType(tag); ok {
+		r.last = t
+	} else {
+		// values with ext are not typed
+		r.last = flexbuffers.FBTNull
+	}
+	return s[1:], nil
+}
+
+// parseExt parses {"$ext":n,"value":...} after "$ext":.
+func (r *JsonReader) parseExt(s string) (string, error) {
+	if len(s) == 0 {
+		return s, fmt.Errorf("missing ext")
+	}
+	integral, ns, s, err := r.parseNumber(s)
+	if err != nil {
+		return s, err
+	}
+	ext, err := strconv.ParseInt(ns, 10, 64)
+	if !integral || err != nil {
+		return s, fmt.Errorf("invalid ext: %q", ns)
+	}
+	s = skipWS(s)
+	if len(s) == 0 || s[0] != ',' {
+		return s, fmt.Errorf(`missing "value" after ext`)
+	}
+	s = skipWS(s[1:])
+	if len(s) == 0 || s[0] != '"' {
+		return s, fmt.Errorf(`missing "value" after ext`)
+	}
+	k, s, err := parseRawKey(s[1:])
+	if err != nil || k != "value" {
+		return s, fmt.Errorf(`missing "value" after ext`)
+	}
+	s = skipWS(s)
+	if len(s) == 0 || s[0] != ':' {
+		return s, fmt.Errorf("missing ':' after object key")
+	}
+	if w, ok := r.Output.(ExtWriter); ok {
+		if err := w.PushExt(ext); err != nil {
+			return s, err
+		}
+	}
+	return r.parseValue(skipWS(s[1:]))
+}
+
+func (r *JsonReader) parseTypedVector(t flexbuffers.Type, s string) (string, error) {
+	if len(s) == 0 || s[0] != '[' {
+		return s, fmt.Errorf("missing '['")
+	}
+	var elemType flexbuffers.Type
+	fixedLen := 0
+	if flexbuffers.IsFixedTypedVector(t) {
+		var l uint8
+		elemType = flexbuffers.ToFixedTypedVectorElementType(t, &l)
+		fixedLen = int(l)
+	} else {
+		elemType = flexbuffers.ToTypedVectorElementType(t)
+	}
+	tw, typed := r.Output.(TypedWriter)
+	var ptr int
+	var err error
+	if typed {
+		ptr, err = tw.BeginTypedVector(elemType, fixedLen)
+	} else {
+		ptr, err = r.Output.BeginArray()
+	}
+	if err != nil {
+		return s, err
+	}
+	s, n, err := parseElements(s[1:], func(s string) (string, error) {
+		return r.parseScalar(elemType, s)
+	})
+	if err != nil {
+		return s, err
+	}
+	if fixedLen != 0 && n != fixedLen {
+		return s, fmt.Errorf("%d elements found, but must be %d", n, fixedLen)
+	}
+	if typed {
+		return s, tw.EndTypedVector(ptr)
+	}
+	return s, r.Output.EndArray(ptr)
+}
+
+// parseScalar parses a value of t without tag, the content of a tag object or an element of a typed vector.
+func (r *JsonReader) parseScalar(t flexbuffers.Type, s string) (string, error) {
+	if len(s) == 0 {
+		return s, fmt.Errorf("cannot parse empty string")
+	}
+	tw, typed := r.Output.(TypedWriter)
+	switch t {
+	case flexbuffers.FBTKey, flexbuffers.FBTString, flexbuffers.FBTBlob:
+		if s[0] != '"' {
+			return s, fmt.Errorf("string expected: %q", s)
+		}
+		ss, tail, err := r.parseString(s)
+		if err != nil {
+			return tail, fmt.Errorf("cannot parse string: %w", err)
+		}
+		switch {
+		case t == flexbuffers.FBTBlob:
+			d, err := base64.StdEncoding.DecodeString(ss)
+			if err != nil {
+				return tail, fmt.Errorf("cannot parse blob: %w", err)
+			}
+			return tail, r.Output.PushBlob(d)
+		case t == flexbuffers.FBTKey && typed:
+			return tail, tw.PushKey(ss)
+		default:
+			return tail, r.Output.PushString(ss)
+		}
+	case flexbuffers.FBTFloat, flexbuffers.FBTIndirectFloat:
+		var f float64
+		var tail string
+		if s[0] == '"' {
+			ss, tl, err := parseRawString(s[1:])
+			if err != nil {
+				return tl, fmt.Errorf("cannot parse string: %w", err)
+			}
+			switch ss {
+			case "NaN":
+				f = math.NaN()
+			case "Infinity":
+				f = math.Inf(1)
+			case "-Infinity":
+				f = math.Inf(-1)
+			default:
+				return tl, fmt.Errorf("invalid float: %q", ss)
+			}
+			tail = tl
+		} else {
+			_, ns, tl, err := r.parseNumber(s)
+			if err != nil {
+				return tl, fmt.Errorf("cannot parse number: %w", err)
+			}
+			if f, err = strconv.ParseFloat(ns, 64); err != nil {
+				return tl, fmt.Errorf("invalid float: %q", ns)
+			}
+			tail = tl
+		}
+		if t == flexbuffers.FBTIndirectFloat && typed {
+			return tail, tw.PushIndirectFloat(f)
+		}
+		return tail, r.Output.PushFloat(f)
+	case flexbuffers.FBTInt, flexbuffers.FBTIndirectInt, flexbuffers.FBTUint, flexbuffers.FBTIndirectUInt:
+		_, ns, tail, err := r.parseNumber(s)
+		if err != nil {
+			return tail, fmt.Errorf("cannot parse number: %w", err)
+		}
+		if t == flexbuffers.FBTInt || t == flexbuffers.FBTIndirectInt {
+			i, err := strconv.ParseInt(ns, 10, 64)
+			if err != nil {
+				return tail, fmt.Errorf("invalid int: %q", ns)
+			}
+			if t == flexbuffers.FBTIndirectInt && typed {
+				return tail, tw.PushIndirectInt(i)
+			}
+			return tail, r.Output.PushInt(i)
+		}
+		u, err := strconv.ParseUint(ns, 10, 64)
+		if err != nil {
+			return tail, fmt.Errorf("invalid uint: %q", ns)
+		}
+		if t == flexbuffers.FBTIndirectUInt && typed {
+			return tail, tw.PushIndirectUint(u)
+		}
+		return tail, r.Output.PushUint(u)
+	default:
+		return s, fmt.Errorf("unable to read: type=%v", t)
+	}
+}
+
+// parseString parses the string at s, which starts with '"', and returns it unescaped.
+func (r *JsonReader) parseString(s string) (string, string, error) {
+	raw, tail, err := parseRawString(s[1:])
+	if err != nil {
+		return raw, tail, err
+	}
+	return r.unescape(s, raw, tail)
+}
+
+// parseKey is parseString for object keys.
+func (r *JsonReader) parseKey(s string) (string, string, error) {
+	raw, tail, err := parseRawKey(s[1:])
+	if err != nil {
+		return raw, tail, err
+	}
+	return r.unescape(s, raw, tail)
+}
+
+// unescape unescapes raw, the content of the string at s. In Strict mode, it fails at the first invalid byte.
+func (r *JsonReader) unescape(s, raw, tail string) (string, string, error) {
+	if r.Strict {
+		if i, err := checkString(raw); err != nil {
+			return raw, s[1+i:], err
+		}
+	}
+	return unescapeStringBestEffort(raw), tail, nil
+}
+
+// parseNumber is parseRawNumber which accepts only JSON numbers in Strict mode.
+func (r *JsonReader) parseNumber(s string) (bool, string, string, error) {
+	integral, ns, tail, err := parseRawNumber(s)
+	if err == nil && r.Strict && !flexbuffers.IsJsonNumber(ns) {
+		return integral, ns, s, fmt.Errorf("invalid number: %q", ns)
+	}
+	return integral, ns, tail, err
+}
+
+// checkString validates the content of a string for Strict mode, and returns the index of the invalid byte.
+func checkString(s string) (int, error) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c < 0x20:
+			return i, fmt.Errorf("control character %q in string", c)
+		case c == '\\':
+			n, err := checkEscape(s[i:])
+			if err != nil {
+				return i, err
+			}
+			i += n
+		case c < utf8.RuneSelf:
+			i++
+		default:
+			r, n := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && n == 1 {
+				return i, fmt.Errorf("invalid UTF-8 in string")
+			}
+			i += n
+		}
+	}
+	return 0, nil
+}
+
+// checkEscape validates the escape sequence at the start of s, and returns its length.
+func checkEscape(s string) (int, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid escape %q", s)
+	}
+	switch s[1] {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		return 2, nil
+	case 'u':
+		x, ok := parseHex4(s[2:])
+		if !ok {
+			return 0, fmt.Errorf("invalid escape %q", startOf(s))
+		}
+		if !utf16.IsSurrogate(x) {
+			return 6, nil
+		}
+		if x >= 0xdc00 || len(s) < 12 || s[6] != '\\' || s[7] != 'u' {
+			return 0, fmt.Errorf("lone surrogate %q", s[:6])
+		}
+		if x1, ok := parseHex4(s[8:]); !ok || x1 < 0xdc00 || x1 > 0xdfff {
+			return 0, fmt.Errorf("invalid surrogate pair %q", s[:12])
+		}
+		return 12, nil
+	default:
+		return 0, fmt.Errorf("invalid escape %q", s[:2])
+	}
+}
+
+func parseHex4(s string) (rune, bool) {
+	if len(s) < 4 {
+		return 0, false
+	}
+	x, err := strconv.ParseUint(s[:4], 16, 16)
+	return rune(x), err == nil
+}
+
 func unescapeStringBestEffort(s string) string {
 	n := strings.IndexByte(s, '\\')
 	if n < 0 {
@@ -211,7 +847,8 @@ func unescapeStringBestEffort(s string) string {
 	}
 
 	// Slow path - unescape string.
-	var b []byte
+	b := make([]byte, 0, len(s))
+	b = append(b, s[:n]...)
 	s = s[n+1:]
 	for len(s) > 0 {
 		ch := s[0]
@@ -353,3 +990,19 @@ func parseRawNumber(s string) (bool, string, string, error) {
 	}
 	return integral, s, "", nil
 }
+
+// discardWriter drops every value, for values of duplicate keys.
+type discardWriter struct{}
+
+func (discardWriter) PushString(string) error    { return nil }
+func (discardWriter) PushBlob([]byte) error      { return nil }
+func (discardWriter) PushInt(int64) error        { return nil }
+func (discardWriter) PushUint(uint64) error      { return nil }
+func (discardWriter) PushFloat(float64) error    { return nil }
+func (discardWriter) PushBool(bool) error        { return nil }
+func (discardWriter) PushNull() error            { return nil }
+func (discardWriter) BeginArray() (int, error)   { return 0, nil }
+func (discardWriter) EndArray(int) error         { return nil }
+func (discardWriter) BeginObject() (int, error)  { return 0, nil }
+func (discardWriter) EndObject(int) error        { return nil }
+func (discardWriter) PushObjectKey(string) error { return nil }
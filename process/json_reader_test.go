@@ -1,9 +1,12 @@
 package process
 
 import (
+	"errors"
+	"math"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
 
 	"flexbuffers"
 	"flexbuffers/pkg/unsafeutil"
@@ -83,6 +86,15 @@ func TestFromJson(t *testing.T) {
 				})
 			},
 		},
+		{
+			// escape after other chars, and escaped key
+			input: `{"a\"b": "x\ty"}`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.StringValueField([]byte("a\"b"), "x\ty")
+				})
+			},
+		},
 	}
 	for _, cas := range cases {
 		r, err := FromJson(unsafeutil.S2B(cas.input))
@@ -101,3 +113,337 @@ func TestFromJson(t *testing.T) {
 		}
 	}
 }
+
+func TestFromExtendedJson(t *testing.T) {
+	cases := []struct {
+		input   string
+		buildFn func(b *flexbuffers.Builder)
+	}{
+		{
+			// tagged scalars
+			input: `[{"$int": 1}, {"$uint": 18446744073709551615}, {"$float": 1}, {"$float": "-Infinity"}, {"$key": "k"}, {"$blob": "AP8="}]`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Int(1)
+					b.UInt(math.MaxUint64)
+					b.Float64(1)
+					b.Float64(math.Inf(-1))
+					b.Key([]byte("k"))
+					b.Blob([]byte{0, 0xff})
+				})
+			},
+		},
+		{
+			// indirect scalars
+			input: `[{"$indirectInt": -2}, {"$indirectUInt": 3}, {"$indirectFloat": 0.1}]`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.IndirectInt(-2)
+					b.IndirectUInt(3)
+					b.IndirectFloat64(0.1)
+				})
+			},
+		},
+		{
+			// typed and fixed vectors
+			input: `[{"$vectorUInt": [1, 2]}, {"$vectorFloat3": [1, 2.5, "NaN"]}, {"$vectorString": []}]`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Vector(true, false, func(b *flexbuffers.Builder) {
+						b.UInt(1)
+						b.UInt(2)
+					})
+					b.Vector(true, true, func(b *flexbuffers.Builder) {
+						b.Float64(1)
+						b.Float64(2.5)
+						b.Float64(math.NaN())
+					})
+					start := b.StartVector()
+					_, _ = b.EndTypedVector(start, flexbuffers.FBTString, false)
+				})
+			},
+		},
+		{
+			// ext and maps with tag like keys
+			input: `{"a": {"$ext": 7, "value": "x"}, "b": {"$map": {"$int": 1}}, "c": 2}`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.Ext(7)
+					b.StringValueField([]byte("a"), "x")
+					b.MapField([]byte("b"), func(b *flexbuffers.Builder) {
+						b.IntField([]byte("$int"), 1)
+					})
+					b.IntField([]byte("c"), 2)
+				})
+			},
+		},
+	}
+	for _, cas := range cases {
+		r, err := FromExtendedJson(unsafeutil.S2B(cas.input))
+		if err != nil {
+			t.Errorf("'%s': %v", cas.input, err)
+			continue
+		}
+		b := flexbuffers.NewBuilder()
+		cas.buildFn(b)
+		if err := b.Finish(); err != nil {
+			t.Errorf("'%s': %v", cas.input, err)
+			continue
+		}
+		if diff := cmp.Diff(b.Buffer(), r); diff != "" {
+			t.Errorf("'%s': %s", cas.input, diff)
+		}
+	}
+}
+
+func TestFromJsonWithOptions(t *testing.T) {
+	cases := []struct {
+		input   string
+		opts    JsonInputOptions
+		buildFn func(b *flexbuffers.Builder)
+	}{
+		{
+			// typed vectors of ints and strings
+			input: `{"a": [1, -2, 3], "b": ["x", "y"], "c": [1, 2]}`,
+			opts:  JsonInputOptions{TypedVectors: true},
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.VectorField([]byte("a"), true, false, func(b *flexbuffers.Builder) {
+						b.Int(1)
+						b.Int(-2)
+						b.Int(3)
+					})
+					b.VectorField([]byte("b"), true, false, func(b *flexbuffers.Builder) {
+						b.StringValue("x")
+						b.StringValue("y")
+					})
+					b.VectorField([]byte("c"), true, false, func(b *flexbuffers.Builder) {
+						b.Int(1)
+						b.Int(2)
+					})
+				})
+			},
+		},
+		{
+			// fixed vectors of 2 to 4 numbers, others are untyped
+			input: `[[0.5, 1.5, 2.0], [1, 2, 3, 4, 5], [1, 2.5]]`,
+			opts:  JsonInputOptions{FixedVectors: true},
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Vector(true, true, func(b *flexbuffers.Builder) {
+						b.Float64(0.5)
+						b.Float64(1.5)
+						b.Float64(2)
+					})
+					b.Vector(false, false, func(b *flexbuffers.Builder) {
+						for i := int64(1); i <= 5; i++ {
+							b.Int(i)
+						}
+					})
+					b.Vector(false, false, func(b *flexbuffers.Builder) {
+						b.Int(1)
+						b.Float64(2.5)
+					})
+				})
+			},
+		},
+		{
+			// uint above int64, and big integers as floats
+			input: `[9223372036854775807, 9223372036854775808, -1, 18446744073709551616]`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Int(math.MaxInt64)
+					b.UInt(math.MaxInt64 + 1)
+					b.Int(-1)
+					b.Float64(18446744073709551616)
+				})
+			},
+		},
+		{
+			// exact numbers
+			input: `{"price": 12.30, "big": -123456789012345678901234567890, "n": 1, "e": 1E+2}`,
+			opts:  JsonInputOptions{NumberExt: 9},
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.Ext(9)
+					b.StringValueField([]byte("price"), "12.30")
+					b.Ext(9)
+					b.StringValueField([]byte("big"), "-123456789012345678901234567890")
+					b.IntField([]byte("n"), 1)
+					b.Ext(9)
+					b.StringValueField([]byte("e"), "1E+2")
+				})
+			},
+		},
+		{
+			// numbers at the paths are indirect
+			input: `{"hits": 1, "rate": 0.5, "items": [{"ts": 2, "n": 3}], "typed": [4, 5]}`,
+			opts:  JsonInputOptions{TypedVectors: true, IndirectScalars: 8, IndirectPaths: []string{"hits", "items.*.ts", "typed.0"}},
+			buildFn: func(b *flexbuffers.Builder) {
+				_ = b.SetIndirectScalars(8, "hits", "items.*.ts")
+				b.Map(func(b *flexbuffers.Builder) {
+					b.IntField([]byte("hits"), 1)
+					b.Float64Field([]byte("rate"), 0.5)
+					b.VectorField([]byte("items"), false, false, func(b *flexbuffers.Builder) {
+						b.Map(func(b *flexbuffers.Builder) {
+							b.IntField([]byte("ts"), 2)
+							b.IntField([]byte("n"), 3)
+						})
+					})
+					b.VectorField([]byte("typed"), true, false, func(b *flexbuffers.Builder) {
+						b.Int(4)
+						b.Int(5)
+					})
+				})
+			},
+		},
+		{
+			// arrays of other values are untyped
+			input: `[[], [true, false], [null], [[1], [2]], [{"$ext": 1, "value": "x"}, "y"]]`,
+			opts:  JsonInputOptions{Extended: true, TypedVectors: true, FixedVectors: true},
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Vector(false, false, func(b *flexbuffers.Builder) {})
+					b.Vector(false, false, func(b *flexbuffers.Builder) {
+						b.Bool(true)
+						b.Bool(false)
+					})
+					b.Vector(false, false, func(b *flexbuffers.Builder) {
+						b.Null()
+					})
+					b.Vector(false, false, func(b *flexbuffers.Builder) {
+						b.Vector(true, false, func(b *flexbuffers.Builder) {
+							b.Int(1)
+						})
+						b.Vector(true, false, func(b *flexbuffers.Builder) {
+							b.Int(2)
+						})
+					})
+					b.Vector(false, false, func(b *flexbuffers.Builder) {
+						b.Ext(1)
+						b.StringValue("x")
+						b.StringValue("y")
+					})
+				})
+			},
+		},
+		{
+			// strict accepts valid escapes and surrounding whitespace, the first of duplicate keys is kept
+			input: " {\"a\": \"\\ud83d\\ude00\\u00e9\", \"b\": [1], \"a\": {\"c\": 2}, \"b\": 3}\n",
+			opts:  JsonInputOptions{Strict: true, DuplicateKeys: flexbuffers.DuplicateKeysFirst},
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.StringValueField([]byte("a"), "\U0001F600\u00e9")
+					b.VectorField([]byte("b"), false, false, func(b *flexbuffers.Builder) {
+						b.Int(1)
+					})
+				})
+			},
+		},
+		{
+			// the last of duplicate keys is kept, duplicates in skipped values don't matter
+			input: `{"a": 1, "b": {"c": 1, "c": 2}, "a": {"d": [{"e": 1, "e": 2}]}, "b": {"c": 3, "c": 4}}`,
+			opts:  JsonInputOptions{DuplicateKeys: flexbuffers.DuplicateKeysLast},
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.MapField([]byte("a"), func(b *flexbuffers.Builder) {
+						b.VectorField([]byte("d"), false, false, func(b *flexbuffers.Builder) {
+							b.Map(func(b *flexbuffers.Builder) {
+								b.IntField([]byte("e"), 2)
+							})
+						})
+					})
+					b.MapField([]byte("b"), func(b *flexbuffers.Builder) {
+						b.IntField([]byte("c"), 4)
+					})
+				})
+			},
+		},
+	}
+	for _, cas := range cases {
+		r, err := FromJsonWithOptions(unsafeutil.S2B(cas.input), cas.opts)
+		if err != nil {
+			t.Errorf("'%s': %v", cas.input, err)
+			continue
+		}
+		b := flexbuffers.NewBuilder()
+		cas.buildFn(b)
+		if err := b.Finish(); err != nil {
+			t.Errorf("'%s': %v", cas.input, err)
+			continue
+		}
+		if diff := cmp.Diff(b.Buffer(), r); diff != "" {
+			t.Errorf("'%s': %s", cas.input, diff)
+		}
+	}
+}
+
+func TestFromExtendedJson_Error(t *testing.T) {
+	for _, input := range []string{
+		`{"$foo": 1}`,
+		`{"$int": 1.5}`,
+		`{"$uint": -1}`,
+		`{"$int": 1, "x": 2}`,
+		`{"$float": "nan"}`,
+		`{"$vectorInt2": [1, 2, 3]}`,
+		`{"$vectorKey": [1]}`,
+		`{"$vectorBool": [true]}`,
+		`{"$blob": "!"}`,
+		`{"$ext": 1, "val": 2}`,
+	} {
+		if _, err := FromExtendedJson(unsafeutil.S2B(input)); err == nil {
+			t.Errorf("'%s': error expected", input)
+		}
+	}
+	for _, input := range []string{`1-2`, `-`, `01.5`, `1.`} {
+		if _, err := FromJsonWithOptions(unsafeutil.S2B(input), JsonInputOptions{NumberExt: 1}); err == nil {
+			t.Errorf("'%s': error expected", input)
+		}
+	}
+}
+
+func TestFromJsonWithOptions_Strict(t *testing.T) {
+	cases := []struct {
+		input  string
+		opts   JsonInputOptions
+		offset int
+		line   int
+		column int
+		msg    string
+	}{
+		{input: `[1, 2] x`, offset: 7, line: 1, column: 8, msg: "unexpected content after value"},
+		{input: "{\n  \"a\": \"x\\qy\"\n}", offset: 11, line: 2, column: 10, msg: `invalid escape "\\q"`},
+		{input: `["\u12"]`, offset: 2, line: 1, column: 3, msg: "invalid escape"},
+		{input: `["\ud800"]`, offset: 2, line: 1, column: 3, msg: "lone surrogate"},
+		{input: `["\ud800\u0041"]`, offset: 2, line: 1, column: 3, msg: "invalid surrogate pair"},
+		{input: "[\"a\xffb\"]", offset: 3, line: 1, column: 4, msg: "invalid UTF-8"},
+		{input: "[\"a\tb\"]", offset: 3, line: 1, column: 4, msg: "control character"},
+		{input: "[\n1,\n01]", offset: 5, line: 3, column: 1, msg: "invalid number"},
+		{input: `{"a": 1, "a": 2}`, opts: JsonInputOptions{DuplicateKeys: flexbuffers.DuplicateKeysReject}, offset: 9, line: 1, column: 10, msg: `duplicate map key: "a"`},
+		{input: `[[[1]]]`, opts: JsonInputOptions{MaxDepth: 2}, offset: 2, line: 1, column: 3, msg: "exceeded max depth 2"},
+		{input: `[1, 2`, offset: 5, line: 1, column: 6, msg: "unexpected end of array"},
+	}
+	for _, cas := range cases {
+		opts := cas.opts
+		opts.Strict = true
+		_, err := FromJsonWithOptions(unsafeutil.S2B(cas.input), opts)
+		var syntaxErr *JsonSyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("'%s': JsonSyntaxError expected, got %v", cas.input, err)
+			continue
+		}
+		assert.Equal(t, cas.offset, syntaxErr.Offset, cas.input)
+		assert.Equal(t, cas.line, syntaxErr.Line, cas.input)
+		assert.Equal(t, cas.column, syntaxErr.Column, cas.input)
+		assert.Contains(t, err.Error(), cas.msg, cas.input)
+	}
+	_, err := FromJsonWithOptions([]byte(`[{"a": [{"b": 1, "b": 2}]}]`), JsonInputOptions{DuplicateKeys: flexbuffers.DuplicateKeysReject})
+	assert.True(t, errors.Is(err, flexbuffers.ErrDuplicateKey), "%v", err)
+
+	// best effort parsing accepts the same input
+	for _, input := range []string{`[1, 2] x`, `["x\qy"]`, "[\"a\xffb\"]", `[01]`, `{"a": 1, "a": 2}`} {
+		if _, err := FromJson(unsafeutil.S2B(input)); err != nil {
+			t.Errorf("'%s': %v", input, err)
+		}
+	}
+}
@@ -4,147 +4,298 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"strconv"
 
 	"flexbuffers"
 )
 
 type JsonWriter struct {
-	Output     io.Writer
+	Output io.Writer
+	// Extended writes the extended JSON dialect, which keeps FlexBuffers types and exts,
+	// as flexbuffers.JsonOptions with Extended does.
+	Extended bool
+	// NumberExt writes strings with ext NumberExt as numbers, if they are number literals.
+	// See JsonReader and flexbuffers.JsonOptions. Ignored if Extended.
+	NumberExt int64
+
 	elemIndex  []int
 	keyWritten bool
+	// closers are written at the end of each array and object, with the ends of tag objects around them
+	closers []string
+	// typed is true for the elements of typed vectors, which are written without tags
+	typed []bool
+	// objectPending is set by BeginObject in Extended until the first key, which decides if the object is tagged
+	objectPending bool
+	ext           int64
+	buf           []byte
 }
 
-func (j *JsonWriter) PushString(s string) (err error) {
-	if err := j.preElem(); err != nil {
-		return err
+func (j *JsonWriter) PushExt(ext int64) error {
+	j.ext = ext
+	return nil
+}
+
+func (j *JsonWriter) PushString(s string) error {
+	if j.NumberExt != 0 && !j.Extended && j.ext == j.NumberExt && flexbuffers.IsJsonNumber(s) {
+		buf, end := j.begin(false)
+		buf = append(buf, s...)
+		return j.end(buf, end)
 	}
-	buf := make([]byte, 0, len(s))
+	buf, end := j.begin(true)
 	buf = flexbuffers.EscapeJSONString(buf, s)
-	_, err = j.Output.Write(buf)
-	if err != nil {
-		return
-	}
-	j.incrementElemIndex()
-	return
+	return j.end(buf, end)
 }
 
-func (j *JsonWriter) PushBlob(b []byte) (err error) {
-	if err := j.preElem(); err != nil {
-		return err
+func (j *JsonWriter) PushBlob(b []byte) error {
+	buf, end := j.begin(true)
+	tagged := j.inTag()
+	if tagged {
+		buf = j.tagStart(buf, flexbuffers.FBTBlob)
 	}
-	_, err = base64.NewEncoder(base64.StdEncoding, j.Output).Write(b)
-	if err != nil {
-		return
+	buf = append(buf, '"')
+	n := len(buf)
+	buf = append(buf, make([]byte, base64.StdEncoding.EncodedLen(len(b)))...)
+	base64.StdEncoding.Encode(buf[n:], b)
+	buf = append(buf, '"')
+	if tagged {
+		buf = append(buf, '}')
 	}
-	j.incrementElemIndex()
-	return
+	return j.end(buf, end)
 }
 
 func (j *JsonWriter) PushInt(i int64) error {
-	if err := j.preElem(); err != nil {
-		return err
-	}
-	_, err := fmt.Fprintf(j.Output, "%d", i)
-	j.incrementElemIndex()
-	return err
+	return j.pushInt(flexbuffers.FBTInt, i)
 }
 
 func (j *JsonWriter) PushUint(u uint64) error {
-	if err := j.preElem(); err != nil {
-		return err
-	}
-	_, err := fmt.Fprintf(j.Output, "%d", u)
-	j.incrementElemIndex()
-	return err
+	return j.pushUint(flexbuffers.FBTUint, u)
 }
 
 func (j *JsonWriter) PushFloat(f float64) error {
-	if err := j.preElem(); err != nil {
-		return err
+	return j.pushFloat(flexbuffers.FBTFloat, f)
+}
+
+func (j *JsonWriter) PushBool(b bool) error {
+	buf, end := j.begin(false)
+	buf = strconv.AppendBool(buf, b)
+	return j.end(buf, end)
+}
+
+func (j *JsonWriter) PushNull() error {
+	buf, end := j.begin(false)
+	buf = append(buf, "null"...)
+	return j.end(buf, end)
+}
+
+func (j *JsonWriter) PushKey(k string) error {
+	buf, end := j.begin(false)
+	if j.inTag() {
+		buf = j.tagStart(buf, flexbuffers.FBTKey)
+		buf = flexbuffers.EscapeJSONString(buf, k)
+		buf = append(buf, '}')
+	} else {
+		buf = flexbuffers.EscapeJSONString(buf, k)
 	}
-	_, err := fmt.Fprintf(j.Output, "%f", f)
-	j.incrementElemIndex()
-	return err
+	return j.end(buf, end)
 }
 
-func (j *JsonWriter) PushBool(b bool) (err error) {
-	if err := j.preElem(); err != nil {
-		return err
+func (j *JsonWriter) PushIndirectInt(i int64) error {
+	return j.pushInt(flexbuffers.FBTIndirectInt, i)
+}
+
+func (j *JsonWriter) PushIndirectUint(u uint64) error {
+	return j.pushUint(flexbuffers.FBTIndirectUInt, u)
+}
+
+func (j *JsonWriter) PushIndirectFloat(f float64) error {
+	return j.pushFloat(flexbuffers.FBTIndirectFloat, f)
+}
+
+func (j *JsonWriter) pushInt(t flexbuffers.Type, i int64) error {
+	buf, end := j.begin(false)
+	tagged := j.inTag()
+	if tagged {
+		buf = j.tagStart(buf, t)
 	}
-	if b {
-		_, err = fmt.Fprintf(j.Output, "true")
-	} else {
-		_, err = fmt.Fprintf(j.Output, "false")
+	buf = strconv.AppendInt(buf, i, 10)
+	if tagged {
+		buf = append(buf, '}')
 	}
-	j.incrementElemIndex()
-	return
+	return j.end(buf, end)
 }
 
-func (j *JsonWriter) PushNull() error {
-	_, err := fmt.Fprintf(j.Output, "null")
-	j.incrementElemIndex()
-	return err
+func (j *JsonWriter) pushUint(t flexbuffers.Type, u uint64) error {
+	buf, end := j.begin(false)
+	tagged := j.inTag()
+	if tagged {
+		buf = j.tagStart(buf, t)
+	}
+	buf = strconv.AppendUint(buf, u, 10)
+	if tagged {
+		buf = append(buf, '}')
+	}
+	return j.end(buf, end)
 }
 
-func (j *JsonWriter) BeginArray() (int, error) {
-	if err := j.preElem(); err != nil {
-		return 0, err
+func (j *JsonWriter) pushFloat(t flexbuffers.Type, f float64) error {
+	buf, end := j.begin(false)
+	if !j.Extended {
+		buf = append(buf, fmt.Sprintf("%f", f)...)
+		return j.end(buf, end)
 	}
-	j.elemIndex = append(j.elemIndex, 0)
-	_, err := fmt.Fprintf(j.Output, "[")
-	j.keyWritten = false
-	return 0, err
+	tagged := j.inTag()
+	if tagged {
+		buf = j.tagStart(buf, t)
+	}
+	buf = flexbuffers.AppendJsonFloat(buf, f)
+	if tagged {
+		buf = append(buf, '}')
+	}
+	return j.end(buf, end)
+}
+
+func (j *JsonWriter) BeginArray() (int, error) {
+	buf, end := j.begin(true)
+	buf = append(buf, '[')
+	j.push(false, "]"+end)
+	return 0, j.write(buf)
 }
 
 func (j *JsonWriter) EndArray(int) error {
-	j.elemIndex = j.elemIndex[:len(j.elemIndex)-1]
-	_, err := fmt.Fprintf(j.Output, "]")
-	j.incrementElemIndex()
-	return err
+	return j.pop()
+}
+
+func (j *JsonWriter) BeginTypedVector(elemType flexbuffers.Type, fixedLen int) (int, error) {
+	buf, end := j.begin(true)
+	if j.inTag() {
+		buf = j.tagStart(buf, flexbuffers.ToTypedVector(elemType, fixedLen))
+		end = "}" + end
+	}
+	buf = append(buf, '[')
+	j.push(j.Extended, "]"+end)
+	return 0, j.write(buf)
+}
+
+func (j *JsonWriter) EndTypedVector(int) error {
+	return j.pop()
 }
 
 func (j *JsonWriter) BeginObject() (int, error) {
-	if err := j.preElem(); err != nil {
-		return 0, err
+	buf, end := j.begin(true)
+	if j.Extended {
+		// written with the first key
+		j.objectPending = true
+		j.push(false, end)
+		return 0, j.write(buf)
 	}
-	j.elemIndex = append(j.elemIndex, 0)
-	_, err := fmt.Fprintf(j.Output, "{")
-	j.keyWritten = false
-	return 0, err
+	buf = append(buf, '{')
+	j.push(false, "}"+end)
+	return 0, j.write(buf)
 }
 
 func (j *JsonWriter) EndObject(int) error {
-	j.elemIndex = j.elemIndex[:len(j.elemIndex)-1]
-	_, err := fmt.Fprintf(j.Output, "}")
-	j.incrementElemIndex()
-	return err
+	if j.objectPending {
+		j.objectPending = false
+		if err := j.write([]byte{'{'}); err != nil {
+			return err
+		}
+		j.closers[len(j.closers)-1] = "}" + j.closers[len(j.closers)-1]
+	}
+	return j.pop()
 }
 
-func (j *JsonWriter) preElem() (err error) {
+func (j *JsonWriter) PushObjectKey(k string) error {
+	buf := j.buf[:0]
+	if j.objectPending {
+		j.objectPending = false
+		top := len(j.closers) - 1
+		if len(k) > 0 && k[0] == '$' {
+			buf = j.tagStart(buf, flexbuffers.FBTMap)
+			j.closers[top] = "}" + j.closers[top]
+		}
+		buf = append(buf, '{')
+		j.closers[top] = "}" + j.closers[top]
+	} else if j.elemIndex[len(j.elemIndex)-1] > 0 {
+		buf = append(buf, ',')
+	}
+	buf = flexbuffers.EscapeJSONString(buf, k)
+	buf = append(buf, ':')
+	j.keyWritten = true
+	return j.write(buf)
+}
+
+// begin starts a value in j.buf with the separator, and in Extended, the tag object of the pending ext
+// if the value can hold it.
+// end closes the tag object.
+func (j *JsonWriter) begin(canHoldExt bool) (buf []byte, end string) {
+	buf = j.buf[:0]
 	if len(j.elemIndex) > 0 && j.elemIndex[len(j.elemIndex)-1] > 0 && !j.keyWritten {
-		_, err = fmt.Fprintf(j.Output, ",")
+		buf = append(buf, ',')
+	}
+	if j.ext != 0 && canHoldExt && j.Extended {
+		buf = append(buf, `{"$ext":`...)
+		buf = strconv.AppendInt(buf, j.ext, 10)
+		buf = append(buf, `,"value":`...)
+		end = "}"
 	}
-	return
+	j.ext = 0
+	return buf, end
 }
 
-func (j *JsonWriter) incrementElemIndex() {
-	if len(j.elemIndex) > 0 {
-		j.elemIndex[len(j.elemIndex)-1]++
+// end writes a value started by begin.
+func (j *JsonWriter) end(buf []byte, end string) error {
+	buf = append(buf, end...)
+	if err := j.write(buf); err != nil {
+		return err
 	}
+	j.incrementElemIndex()
+	return nil
+}
+
+func (j *JsonWriter) write(buf []byte) error {
+	j.buf = buf[:0]
+	_, err := j.Output.Write(buf)
+	return err
+}
+
+// inTag returns true if the next value is written as a tag object, in Extended and not in a typed vector.
+func (j *JsonWriter) inTag() bool {
+	return j.Extended && (len(j.typed) == 0 || !j.typed[len(j.typed)-1])
+}
+
+func (j *JsonWriter) tagStart(buf []byte, t flexbuffers.Type) []byte {
+	buf = append(buf, '{')
+	buf = flexbuffers.EscapeJSONString(buf, flexbuffers.ExtendedJsonTag(t))
+	return append(buf, ':')
+}
+
+func (j *JsonWriter) push(typed bool, closer string) {
+	j.elemIndex = append(j.elemIndex, 0)
+	j.typed = append(j.typed, typed)
+	j.closers = append(j.closers, closer)
 	j.keyWritten = false
 }
 
-func (j *JsonWriter) PushObjectKey(k string) (err error) {
-	if err := j.preElem(); err != nil {
+func (j *JsonWriter) pop() error {
+	if len(j.closers) == 0 {
+		return fmt.Errorf("no array or object to end")
+	}
+	top := len(j.closers) - 1
+	closer := j.closers[top]
+	j.elemIndex = j.elemIndex[:top]
+	j.typed = j.typed[:top]
+	j.closers = j.closers[:top]
+	buf := append(j.buf[:0], closer...)
+	if err := j.write(buf); err != nil {
 		return err
 	}
-	buf := make([]byte, 0, len(k))
-	buf = flexbuffers.EscapeJSONString(buf, k)
-	_, err = j.Output.Write(buf)
-	if err != nil {
-		return
+	j.incrementElemIndex()
+	return nil
+}
+
+func (j *JsonWriter) incrementElemIndex() {
+	if len(j.elemIndex) > 0 {
+		j.elemIndex[len(j.elemIndex)-1]++
 	}
-	_, err = fmt.Fprintf(j.Output, ":")
-	j.keyWritten = true
-	return
+	j.keyWritten = false
 }
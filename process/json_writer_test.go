@@ -2,9 +2,12 @@ package process
 
 import (
 	"bytes"
+	"math"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+
+	"flexbuffers"
 )
 
 func TestJsonWriter(t *testing.T) {
@@ -61,6 +64,16 @@ func TestJsonWriter(t *testing.T) {
 			},
 			expected: `{"a":{"x":"y"},"b":[1,2,{"x":"y"}]}`,
 		},
+		{
+			fn: func(w *JsonWriter) error {
+				a, _ := w.BeginArray()
+				_ = w.PushNull()
+				_ = w.PushBlob([]byte{0, 0xff})
+				_ = w.PushNull()
+				return w.EndArray(a)
+			},
+			expected: `[null,"AP8=",null]`,
+		},
 	}
 	for _, cas := range cases {
 		var buf bytes.Buffer
@@ -73,3 +86,155 @@ func TestJsonWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestJsonWriter_Extended(t *testing.T) {
+	b := flexbuffers.NewBuilder()
+	b.Map(func(b *flexbuffers.Builder) {
+		b.VectorField([]byte("scalars"), false, false, func(b *flexbuffers.Builder) {
+			b.Null()
+			b.Bool(true)
+			b.Int(-1)
+			b.UInt(1)
+			b.Float64(0.1)
+			b.Float32(float32(math.Inf(1)))
+			b.StringValue("s")
+			b.Key([]byte("k"))
+			b.Blob([]byte{0, 0xff})
+			b.IndirectInt(-2)
+			b.IndirectUInt(2)
+			b.IndirectFloat64(2.5)
+		})
+		b.VectorField([]byte("typed"), false, false, func(b *flexbuffers.Builder) {
+			b.Vector(true, false, func(b *flexbuffers.Builder) {
+				b.Key([]byte("x"))
+				b.Key([]byte("y"))
+			})
+			b.Vector(true, true, func(b *flexbuffers.Builder) {
+				b.Int(1)
+				b.Int(-1)
+			})
+			start := b.StartVector()
+			_, _ = b.EndTypedVector(start, flexbuffers.FBTInt, false)
+		})
+		b.MapField([]byte("$map"), func(b *flexbuffers.Builder) {
+			b.Ext(3)
+			b.StringValueField([]byte("$ext"), "x")
+		})
+		b.MapField([]byte("empty"), func(b *flexbuffers.Builder) {})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	doc := b.Buffer()
+	expected := `{"$map":{"$map":{"$map":{"$ext":{"$ext":3,"value":"x"}}},"empty":{},` +
+		`"scalars":[null,true,{"$int":-1},{"$uint":1},{"$float":0.1},{"$float":"Infinity"},"s",{"$key":"k"},` +
+		`{"$blob":"AP8="},{"$indirectInt":-2},{"$indirectUInt":2},{"$indirectFloat":2.5}],` +
+		`"typed":[{"$vectorKey":["x","y"]},{"$vectorInt2":[1,-1]},{"$vectorInt":[]}]}}`
+
+	var buf bytes.Buffer
+	r := FlexbuffersReader{Output: &JsonWriter{Output: &buf, Extended: true}}
+	if err := r.ReadBuffer(doc); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Error(diff)
+	}
+	// the same as the encoder
+	out, err := doc.RootOrNull().AppendJson(nil, flexbuffers.JsonOptions{Extended: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, string(out)); diff != "" {
+		t.Error(diff)
+	}
+	// read back with the same types, maps are built in another order
+	again, err := FromExtendedJson(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = again.RootOrNull().AppendJson(out[:0], flexbuffers.JsonOptions{Extended: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, string(out)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestJsonWriter_NumberExt(t *testing.T) {
+	input := `{"big":-123456789012345678901234567890,"n":1,"price":12.30}`
+	doc, err := FromJsonWithOptions([]byte(input), JsonInputOptions{NumberExt: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := flexbuffers.NewBuilder()
+	b.Map(func(b *flexbuffers.Builder) {
+		b.Ext(9)
+		b.StringValueField([]byte("not number"), "1x")
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	r := FlexbuffersReader{Output: &JsonWriter{Output: &buf, NumberExt: 9}}
+	if err := r.ReadBuffer(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"big":-123456789012345678901234567890,"n":1,"price":12.30}`
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Error(diff)
+	}
+	// strings which are not numbers are kept
+	buf.Reset()
+	if err := r.ReadBuffer(b.Buffer()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(`{"not number":"1x"}`, buf.String()); diff != "" {
+		t.Error(diff)
+	}
+	// the same as the encoder
+	out, err := doc.RootOrNull().AppendJson(nil, flexbuffers.JsonOptions{NumberExt: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, string(out)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestJsonWriter_OrderedMaps(t *testing.T) {
+	input := `{"z":1,"a":[{"y":true,"b":null}],"m":{"a":"sorted","b":"map"}}`
+	doc, err := FromJsonWithOptions([]byte(input), JsonInputOptions{OrderedMaps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	r := FlexbuffersReader{Output: &JsonWriter{Output: &buf}}
+	if err := r.ReadBuffer(doc); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(input, buf.String()); diff != "" {
+		t.Error(diff)
+	}
+	// the same as the encoder
+	out, err := doc.RootOrNull().AppendJson(nil, flexbuffers.JsonOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(input, string(out)); diff != "" {
+		t.Error(diff)
+	}
+	// the order is kept by rebuilding
+	b := flexbuffers.NewBuilder()
+	b.SetOrderedMaps(true)
+	r = FlexbuffersReader{Output: NewFlexbuffersWriter(b)}
+	if err := r.ReadBuffer(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(doc, b.Buffer()); diff != "" {
+		t.Error(diff)
+	}
+}
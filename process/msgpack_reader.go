@@ -0,0 +1,267 @@
+package process
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"flexbuffers"
+)
+
+// maxMsgpackDepth limits nesting of arrays and maps, to not exhaust the stack by malicious input.
+const maxMsgpackDepth = 10000
+
+func FromMsgpack(data []byte) (flexbuffers.Raw, error) {
+	b := flexbuffers.NewBuilder()
+	r := MsgpackReader{Output: NewFlexbuffersWriter(b)}
+	if err := r.ReadBuffer(data); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
+
+// MsgpackReader reads a MessagePack value.
+// Map keys must be strings or binaries, integer keys are read as decimal strings. Extension types are not supported.
+type MsgpackReader struct {
+	Output DocumentWriter
+}
+
+func (r *MsgpackReader) SetOutput(w DocumentWriter) error {
+	r.Output = w
+	return nil
+}
+
+// ReadBuffer reads b, which must hold exactly one value.
+func (r *MsgpackReader) ReadBuffer(b []byte) error {
+	n, err := r.ReadValue(b)
+	if err != nil {
+		return err
+	}
+	if n != len(b) {
+		return fmt.Errorf("msgpack: %d bytes remain after the value", len(b)-n)
+	}
+	return nil
+}
+
+// ReadValue reads the first value of b and returns its size, to read concatenated values.
+func (r *MsgpackReader) ReadValue(b []byte) (int, error) {
+	return r.read(b, 0, 0)
+}
+
+// msgpackUint reads a big endian unsigned integer of size bytes at b[i:].
+func msgpackUint(b []byte, i, size int) (uint64, int, error) {
+	if len(b)-i < size {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	switch size {
+	case 1:
+		return uint64(b[i]), i + 1, nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b[i:])), i + 2, nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b[i:])), i + 4, nil
+	default:
+		return binary.BigEndian.Uint64(b[i:]), i + 8, nil
+	}
+}
+
+func msgpackInt(b []byte, i, size int) (int64, int, error) {
+	u, i, err := msgpackUint(b, i, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch size {
+	case 1:
+		return int64(int8(u)), i, nil
+	case 2:
+		return int64(int16(u)), i, nil
+	case 4:
+		return int64(int32(u)), i, nil
+	default:
+		return int64(u), i, nil
+	}
+}
+
+// msgpackBytes reads n bytes of a string or a binary.
+func msgpackBytes(b []byte, i int, n uint64) ([]byte, int, error) {
+	if uint64(len(b)-i) < n {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	end := i + int(n)
+	return b[i:end], end, nil
+}
+
+func (r *MsgpackReader) read(b []byte, i, depth int) (int, error) {
+	if depth > maxMsgpackDepth {
+		return 0, fmt.Errorf("msgpack: nesting too deep")
+	}
+	if i >= len(b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	c := b[i]
+	i++
+	switch {
+	case c <= 0x7f:
+		return i, r.Output.PushInt(int64(c))
+	case c >= 0xe0:
+		return i, r.Output.PushInt(int64(int8(c)))
+	case c&0xf0 == 0x80:
+		return r.readMap(b, i, uint64(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return r.readArray(b, i, uint64(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		s, i, err := msgpackBytes(b, i, uint64(c&0x1f))
+		if err != nil {
+			return 0, err
+		}
+		return i, r.Output.PushString(string(s))
+	}
+	switch c {
+	case 0xc0:
+		return i, r.Output.PushNull()
+	case 0xc2:
+		return i, r.Output.PushBool(false)
+	case 0xc3:
+		return i, r.Output.PushBool(true)
+	case 0xc4, 0xc5, 0xc6: // bin 8, 16, 32
+		n, i, err := msgpackUint(b, i, 1<<(c-0xc4))
+		if err != nil {
+			return 0, err
+		}
+		data, i, err := msgpackBytes(b, i, n)
+		if err != nil {
+			return 0, err
+		}
+		return i, r.Output.PushBlob(data)
+	case 0xca:
+		u, i, err := msgpackUint(b, i, 4)
+		if err != nil {
+			return 0, err
+		}
+		return i, r.Output.PushFloat(float64(math.Float32frombits(uint32(u))))
+	case 0xcb:
+		u, i, err := msgpackUint(b, i, 8)
+		if err != nil {
+			return 0, err
+		}
+		return i, r.Output.PushFloat(math.Float64frombits(u))
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8, 16, 32, 64
+		u, i, err := msgpackUint(b, i, 1<<(c-0xcc))
+		if err != nil {
+			return 0, err
+		}
+		return i, r.Output.PushUint(u)
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8, 16, 32, 64
+		v, i, err := msgpackInt(b, i, 1<<(c-0xd0))
+		if err != nil {
+			return 0, err
+		}
+		return i, r.Output.PushInt(v)
+	case 0xd9, 0xda, 0xdb: // str 8, 16, 32
+		n, i, err := msgpackUint(b, i, 1<<(c-0xd9))
+		if err != nil {
+			return 0, err
+		}
+		s, i, err := msgpackBytes(b, i, n)
+		if err != nil {
+			return 0, err
+		}
+		return i, r.Output.PushString(string(s))
+	case 0xdc, 0xdd: // array 16, 32
+		n, i, err := msgpackUint(b, i, 2<<(c-0xdc))
+		if err != nil {
+			return 0, err
+		}
+		return r.readArray(b, i, n, depth)
+	case 0xde, 0xdf: // map 16, 32
+		n, i, err := msgpackUint(b, i, 2<<(c-0xde))
+		if err != nil {
+			return 0, err
+		}
+		return r.readMap(b, i, n, depth)
+	case 0xc7, 0xc8, 0xc9, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return 0, fmt.Errorf("msgpack: extension types are not supported")
+	default:
+		return 0, fmt.Errorf("msgpack: invalid code 0x%x", c)
+	}
+}
+
+func (r *MsgpackReader) readArray(b []byte, i int, n uint64, depth int) (int, error) {
+	// each element takes one byte at least
+	if uint64(len(b)-i) < n {
+		return 0, io.ErrUnexpectedEOF
+	}
+	ptr, err := r.Output.BeginArray()
+	if err != nil {
+		return 0, err
+	}
+	for k := uint64(0); k < n; k++ {
+		if i, err = r.read(b, i, depth+1); err != nil {
+			return 0, err
+		}
+	}
+	return i, r.Output.EndArray(ptr)
+}
+
+func (r *MsgpackReader) readMap(b []byte, i int, n uint64, depth int) (int, error) {
+	if uint64(len(b)-i)/2 < n {
+		return 0, io.ErrUnexpectedEOF
+	}
+	ptr, err := r.Output.BeginObject()
+	if err != nil {
+		return 0, err
+	}
+	var key string
+	for k := uint64(0); k < n; k++ {
+		if key, i, err = msgpackKey(b, i); err != nil {
+			return 0, err
+		}
+		if err := r.Output.PushObjectKey(key); err != nil {
+			return 0, err
+		}
+		if i, err = r.read(b, i, depth+1); err != nil {
+			return 0, err
+		}
+	}
+	return i, r.Output.EndObject(ptr)
+}
+
+func msgpackKey(b []byte, i int) (string, int, error) {
+	if i >= len(b) {
+		return "", 0, io.ErrUnexpectedEOF
+	}
+	c := b[i]
+	i++
+	var n uint64
+	var err error
+	switch {
+	case c <= 0x7f:
+		return strconv.Itoa(int(c)), i, nil
+	case c >= 0xe0:
+		return strconv.Itoa(int(int8(c))), i, nil
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c >= 0xd9 && c <= 0xdb:
+		n, i, err = msgpackUint(b, i, 1<<(c-0xd9))
+	case c >= 0xc4 && c <= 0xc6:
+		n, i, err = msgpackUint(b, i, 1<<(c-0xc4))
+	case c >= 0xcc && c <= 0xcf:
+		u, i, err := msgpackUint(b, i, 1<<(c-0xcc))
+		return strconv.FormatUint(u, 10), i, err
+	case c >= 0xd0 && c <= 0xd3:
+		v, i, err := msgpackInt(b, i, 1<<(c-0xd0))
+		return strconv.FormatInt(v, 10), i, err
+	default:
+		return "", 0, fmt.Errorf("msgpack: map key must be a string, but got code 0x%x", c)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	s, i, err := msgpackBytes(b, i, n)
+	return string(s), i, err
+}
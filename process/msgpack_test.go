@@ -0,0 +1,176 @@
+package process
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack"
+
+	"flexbuffers"
+)
+
+func TestMsgpackReader(t *testing.T) {
+	cases := []struct {
+		name  string
+		input interface{}
+		// raw is used instead of input, if set
+		raw     []byte
+		buildFn func(b *flexbuffers.Builder)
+	}{
+		{
+			name:  "scalars",
+			input: []interface{}{nil, true, false, int8(-5), int64(-1 << 40), uint8(200), uint64(math.MaxUint64), 1.5, float32(0.25)},
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Null()
+					b.Bool(true)
+					b.Bool(false)
+					b.Int(-5)
+					b.Int(-1 << 40)
+					b.UInt(200)
+					b.UInt(math.MaxUint64)
+					b.Float64(1.5)
+					b.Float64(0.25)
+				})
+			},
+		},
+		{
+			name: "nested",
+			input: map[string]interface{}{
+				"s":   strings.Repeat("a", 40),
+				"b":   []byte("blob"),
+				"arr": []interface{}{"x", map[string]interface{}{}},
+			},
+			buildFn: func(b *flexbuffers.Builder) {
+				// keys are encoded in sorted order
+				b.Map(func(b *flexbuffers.Builder) {
+					b.VectorField([]byte("arr"), false, false, func(b *flexbuffers.Builder) {
+						b.StringValue("x")
+						b.Map(func(b *flexbuffers.Builder) {})
+					})
+					b.BlobField([]byte("b"), []byte("blob"))
+					b.StringValueField([]byte("s"), strings.Repeat("a", 40))
+				})
+			},
+		},
+		{
+			name: "int keys",
+			raw:  append(append([]byte{0x82, 0x01, 0xa3}, "one"...), append([]byte{0xfe, 0xa9}, "minus two"...)...),
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.StringValueField([]byte("1"), "one")
+					b.StringValueField([]byte("-2"), "minus two")
+				})
+			},
+		},
+	}
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			data := cas.raw
+			if data == nil {
+				var buf bytes.Buffer
+				if err := msgpack.NewEncoder(&buf).SortMapKeys(true).Encode(cas.input); err != nil {
+					t.Fatal(err)
+				}
+				data = buf.Bytes()
+			}
+			actual, err := FromMsgpack(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := flexbuffers.NewBuilder()
+			cas.buildFn(b)
+			if err := b.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(b.Buffer(), actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestMsgpackReader_Errors(t *testing.T) {
+	a := assert.New(t)
+	data, err := msgpack.Marshal(map[string]interface{}{"a": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = FromMsgpack(data[:len(data)-1])
+	a.Equal(io.ErrUnexpectedEOF, err)
+	_, err = FromMsgpack(append(data, 0xc0))
+	a.Error(err)
+	_, err = FromMsgpack([]byte{0xc1})
+	a.Error(err)
+	_, err = FromMsgpack([]byte{0xd4, 0x01, 0x00})
+	a.Error(err)
+	_, err = FromMsgpack([]byte{0xdd, 0xff, 0xff, 0xff, 0xff})
+	a.Equal(io.ErrUnexpectedEOF, err)
+	_, err = FromMsgpack([]byte{0x81, 0xc0, 0xc0})
+	a.Error(err)
+	_, err = FromMsgpack(bytes.Repeat([]byte{0x91}, maxMsgpackDepth+2))
+	a.Error(err)
+
+	// concatenated values
+	var r MsgpackReader
+	var w MsgpackWriter
+	a.NoError(r.SetOutput(&w))
+	n, err := r.ReadValue(append(append([]byte(nil), data...), data...))
+	a.NoError(err)
+	a.Equal(len(data), n)
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	a := assert.New(t)
+	b := flexbuffers.NewBuilder()
+	b.Map(func(b *flexbuffers.Builder) {
+		b.IntField([]byte("small"), 5)
+		b.IntField([]byte("neg"), -100)
+		b.IntField([]byte("int32"), 1<<20)
+		b.IntField([]byte("int64"), -1<<40)
+		b.UIntField([]byte("uint"), 7)
+		b.Float64Field([]byte("float"), 1.25)
+		b.BoolField([]byte("bool"), true)
+		b.NullField([]byte("null"))
+		b.StringValueField([]byte("long"), strings.Repeat("x", 300))
+		b.BlobField([]byte("blob"), []byte{})
+		b.VectorField([]byte("vec"), false, false, func(b *flexbuffers.Builder) {
+			for i := 0; i < 20; i++ {
+				b.Int(int64(i))
+			}
+		})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ToMsgpack(b.Buffer())
+	if !a.NoError(err) {
+		return
+	}
+
+	// readable by other implementations
+	var decoded map[string]interface{}
+	if a.NoError(msgpack.Unmarshal(data, &decoded)) {
+		a.Equal(int8(-100), decoded["neg"])
+		a.Equal(strings.Repeat("x", 300), decoded["long"])
+		a.Len(decoded["vec"], 20)
+	}
+
+	// keys are written in sorted order, so compare by the value
+	actual, err := FromMsgpack(data)
+	if !a.NoError(err) {
+		return
+	}
+	again, err := ToMsgpack(actual)
+	if a.NoError(err) {
+		a.Equal(data, again)
+	}
+	a.True(actual.LookupOrNull("uint").IsUInt())
+	a.Equal(int64(-1<<40), actual.LookupOrNull("int64").AsInt64())
+	a.True(actual.LookupOrNull("blob").IsBlob())
+}
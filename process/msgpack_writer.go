@@ -0,0 +1,220 @@
+package process
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"flexbuffers"
+)
+
+func ToMsgpack(raw flexbuffers.Raw) ([]byte, error) {
+	var w MsgpackWriter
+	r := FlexbuffersReader{Output: &w}
+	if err := r.ReadBuffer(raw); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// MsgpackWriter writes a MessagePack value. Extension tags are discarded.
+// Integers keep their signedness, so that MsgpackReader reads them back as the same type.
+type MsgpackWriter struct {
+	dst    []byte
+	frames []msgpackFrame
+}
+
+type msgpackFrame struct {
+	// the header is inserted at start when the array or map ends
+	start  int
+	count  uint64
+	object bool
+}
+
+// Bytes returns the written value.
+func (w *MsgpackWriter) Bytes() []byte {
+	return w.dst
+}
+
+// Reset discards the written value to reuse the writer.
+func (w *MsgpackWriter) Reset() {
+	w.dst = w.dst[:0]
+	w.frames = w.frames[:0]
+}
+
+func (w *MsgpackWriter) elem() {
+	if len(w.frames) > 0 {
+		w.frames[len(w.frames)-1].count++
+	}
+}
+
+func appendMsgpackUint(dst []byte, code byte, u uint64, size int) []byte {
+	dst = append(dst, code)
+	switch size {
+	case 1:
+		return append(dst, byte(u))
+	case 2:
+		return append(dst, byte(u>>8), byte(u))
+	case 4:
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(u))
+		return append(dst, buf[:]...)
+	default:
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], u)
+		return append(dst, buf[:]...)
+	}
+}
+
+// appendMsgpackLength appends the header of fix, 8 (if code8 is not zero), 16 or 32 bits length of strings, arrays and maps.
+func appendMsgpackLength(dst []byte, n uint64, fix byte, fixMax uint64, code8, code16, code32 byte) ([]byte, error) {
+	switch {
+	case n <= fixMax:
+		return append(dst, fix|byte(n)), nil
+	case code8 != 0 && n <= math.MaxUint8:
+		return appendMsgpackUint(dst, code8, n, 1), nil
+	case n <= math.MaxUint16:
+		return appendMsgpackUint(dst, code16, n, 2), nil
+	case n <= math.MaxUint32:
+		return appendMsgpackUint(dst, code32, n, 4), nil
+	default:
+		return nil, fmt.Errorf("msgpack: length %d overflows", n)
+	}
+}
+
+func appendMsgpackString(dst []byte, s string) ([]byte, error) {
+	dst, err := appendMsgpackLength(dst, uint64(len(s)), 0xa0, 31, 0xd9, 0xda, 0xdb)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, s...), nil
+}
+
+func (w *MsgpackWriter) PushString(s string) (err error) {
+	w.elem()
+	w.dst, err = appendMsgpackString(w.dst, s)
+	return
+}
+
+func (w *MsgpackWriter) PushBlob(b []byte) error {
+	w.elem()
+	n := uint64(len(b))
+	switch {
+	case n <= math.MaxUint8:
+		w.dst = appendMsgpackUint(w.dst, 0xc4, n, 1)
+	case n <= math.MaxUint16:
+		w.dst = appendMsgpackUint(w.dst, 0xc5, n, 2)
+	case n <= math.MaxUint32:
+		w.dst = appendMsgpackUint(w.dst, 0xc6, n, 4)
+	default:
+		return fmt.Errorf("msgpack: length %d overflows", n)
+	}
+	w.dst = append(w.dst, b...)
+	return nil
+}
+
+func (w *MsgpackWriter) PushInt(i int64) error {
+	w.elem()
+	switch {
+	case 0 <= i && i <= 0x7f, -32 <= i && i < 0:
+		w.dst = append(w.dst, byte(i))
+	case math.MinInt8 <= i && i <= math.MaxInt8:
+		w.dst = appendMsgpackUint(w.dst, 0xd0, uint64(i), 1)
+	case math.MinInt16 <= i && i <= math.MaxInt16:
+		w.dst = appendMsgpackUint(w.dst, 0xd1, uint64(i), 2)
+	case math.MinInt32 <= i && i <= math.MaxInt32:
+		w.dst = appendMsgpackUint(w.dst, 0xd2, uint64(i), 4)
+	default:
+		w.dst = appendMsgpackUint(w.dst, 0xd3, uint64(i), 8)
+	}
+	return nil
+}
+
+func (w *MsgpackWriter) PushUint(u uint64) error {
+	w.elem()
+	switch {
+	case u <= math.MaxUint8:
+		w.dst = appendMsgpackUint(w.dst, 0xcc, u, 1)
+	case u <= math.MaxUint16:
+		w.dst = appendMsgpackUint(w.dst, 0xcd, u, 2)
+	case u <= math.MaxUint32:
+		w.dst = appendMsgpackUint(w.dst, 0xce, u, 4)
+	default:
+		w.dst = appendMsgpackUint(w.dst, 0xcf, u, 8)
+	}
+	return nil
+}
+
+func (w *MsgpackWriter) PushFloat(f float64) error {
+	w.elem()
+	w.dst = appendMsgpackUint(w.dst, 0xcb, math.Float64bits(f), 8)
+	return nil
+}
+
+func (w *MsgpackWriter) PushBool(b bool) error {
+	w.elem()
+	if b {
+		w.dst = append(w.dst, 0xc3)
+	} else {
+		w.dst = append(w.dst, 0xc2)
+	}
+	return nil
+}
+
+func (w *MsgpackWriter) PushNull() error {
+	w.elem()
+	w.dst = append(w.dst, 0xc0)
+	return nil
+}
+
+func (w *MsgpackWriter) begin(object bool) (int, error) {
+	w.elem()
+	w.frames = append(w.frames, msgpackFrame{start: len(w.dst), object: object})
+	return len(w.frames) - 1, nil
+}
+
+func (w *MsgpackWriter) end(ptr int, object bool) error {
+	if ptr != len(w.frames)-1 || w.frames[ptr].object != object {
+		return fmt.Errorf("msgpack: mismatched end of array or object")
+	}
+	f := w.frames[ptr]
+	w.frames = w.frames[:ptr]
+	var header [5]byte
+	var h []byte
+	var err error
+	if object {
+		h, err = appendMsgpackLength(header[:0], f.count, 0x80, 15, 0, 0xde, 0xdf)
+	} else {
+		h, err = appendMsgpackLength(header[:0], f.count, 0x90, 15, 0, 0xdc, 0xdd)
+	}
+	if err != nil {
+		return err
+	}
+	// insert the header before the elements
+	w.dst = append(w.dst, h...)
+	copy(w.dst[f.start+len(h):], w.dst[f.start:len(w.dst)-len(h)])
+	copy(w.dst[f.start:], h)
+	return nil
+}
+
+func (w *MsgpackWriter) BeginArray() (int, error) {
+	return w.begin(false)
+}
+
+func (w *MsgpackWriter) EndArray(ptr int) error {
+	return w.end(ptr, false)
+}
+
+func (w *MsgpackWriter) BeginObject() (int, error) {
+	return w.begin(true)
+}
+
+func (w *MsgpackWriter) EndObject(ptr int) error {
+	return w.end(ptr, true)
+}
+
+func (w *MsgpackWriter) PushObjectKey(k string) (err error) {
+	// keys are not counted, the count of a map is the number of values
+	w.dst, err = appendMsgpackString(w.dst, k)
+	return
+}
@@ -0,0 +1,189 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"flexbuffers"
+)
+
+// LoadProtoMessageDescriptor finds message named `name` (e.g. "pkg.Event") from serialized FileDescriptorSet.
+// Such a file is generated by `protoc --include_imports --descriptor_set_out=FILE`.
+func LoadProtoMessageDescriptor(descriptorSet []byte, name string) (protoreflect.MessageDescriptor, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &set); err != nil {
+		return nil, fmt.Errorf("cannot parse descriptor set: %s", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, err
+	}
+	return findProtoMessageDescriptor(files, name)
+}
+
+func findProtoMessageDescriptor(files *protoregistry.Files, name string) (protoreflect.MessageDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %s", name, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+func FromProto(md protoreflect.MessageDescriptor, data []byte) (flexbuffers.Raw, error) {
+	b := flexbuffers.NewBuilder()
+	r := ProtoReader{Output: NewFlexbuffersWriter(b), Message: md}
+	if err := r.ReadBuffer(data); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
+
+// ProtoReader reads wire-format protobuf message as an object keyed by field names.
+// Unknown fields are ignored.
+type ProtoReader struct {
+	Output  DocumentWriter
+	Message protoreflect.MessageDescriptor
+	// EnumAsInt emits enum values as numbers instead of its names.
+	EnumAsInt bool
+	// EmitUnpopulated emits unset fields with default values (null for messages).
+	EmitUnpopulated bool
+}
+
+func (r *ProtoReader) SetOutput(w DocumentWriter) error {
+	r.Output = w
+	return nil
+}
+
+func (r *ProtoReader) ReadBuffer(b []byte) error {
+	if r.Message == nil {
+		return fmt.Errorf("message descriptor is not set")
+	}
+	m := dynamicpb.NewMessage(r.Message)
+	if err := proto.Unmarshal(b, m); err != nil {
+		return err
+	}
+	return r.ReadMessage(m)
+}
+
+func (r *ProtoReader) ReadMessage(m protoreflect.Message) error {
+	ptr, err := r.Output.BeginObject()
+	if err != nil {
+		return err
+	}
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !m.Has(fd) {
+			if !r.EmitUnpopulated || fd.ContainingOneof() != nil {
+				continue
+			}
+		}
+		if err := r.Output.PushObjectKey(string(fd.Name())); err != nil {
+			return err
+		}
+		if !m.Has(fd) && fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+			if err := r.Output.PushNull(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.readField(fd, m.Get(fd)); err != nil {
+			return err
+		}
+	}
+	return r.Output.EndObject(ptr)
+}
+
+func (r *ProtoReader) readField(fd protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	switch {
+	case fd.IsList():
+		l := v.List()
+		ptr, err := r.Output.BeginArray()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < l.Len(); i++ {
+			if err := r.readSingular(fd, l.Get(i)); err != nil {
+				return err
+			}
+		}
+		return r.Output.EndArray(ptr)
+	case fd.IsMap():
+		return r.readMap(fd, v.Map())
+	default:
+		return r.readSingular(fd, v)
+	}
+}
+
+func (r *ProtoReader) readMap(fd protoreflect.FieldDescriptor, m protoreflect.Map) error {
+	type entry struct {
+		key   string
+		value protoreflect.Value
+	}
+	entries := make([]entry, 0, m.Len())
+	m.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		entries = append(entries, entry{key: k.String(), value: v})
+		return true
+	})
+	// map order of protobuf is undefined
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	ptr, err := r.Output.BeginObject()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := r.Output.PushObjectKey(e.key); err != nil {
+			return err
+		}
+		if err := r.readSingular(fd.MapValue(), e.value); err != nil {
+			return err
+		}
+	}
+	return r.Output.EndObject(ptr)
+}
+
+func (r *ProtoReader) readSingular(fd protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return r.Output.PushBool(v.Bool())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return r.Output.PushInt(v.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return r.Output.PushUint(v.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return r.Output.PushFloat(v.Float())
+	case protoreflect.StringKind:
+		return r.Output.PushString(v.String())
+	case protoreflect.BytesKind:
+		return r.Output.PushBlob(v.Bytes())
+	case protoreflect.EnumKind:
+		n := v.Enum()
+		if !r.EnumAsInt {
+			if ev := fd.Enum().Values().ByNumber(n); ev != nil {
+				return r.Output.PushString(string(ev.Name()))
+			}
+		}
+		return r.Output.PushInt(int64(n))
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return r.ReadMessage(v.Message())
+	default:
+		return fmt.Errorf("field %s: unsupported kind %s", fd.FullName(), fd.Kind())
+	}
+}
@@ -0,0 +1,212 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"flexbuffers"
+)
+
+// testProtoDescriptorSet returns a descriptor set equivalent to:
+//
+//   syntax = "proto3";
+//   package test;
+//   enum Kind { UNKNOWN = 0; CLICK = 1; }
+//   message Inner { double score = 1; }
+//   message Event {
+//     string name = 1;
+//     int64 count = 2;
+//     uint32 flags = 3;
+//     bytes payload = 4;
+//     Kind kind = 5;
+//     repeated string tags = 6;
+//     Inner inner = 7;
+//     map<string, int32> attrs = 8;
+//     repeated Inner items = 9;
+//   }
+func testProtoDescriptorSet(t *testing.T) []byte {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(num),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	opt := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	rep := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Kind"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("CLICK"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Inner"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("score", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, opt, ""),
+				},
+			},
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt, ""),
+					field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, opt, ""),
+					field("flags", 3, descriptorpb.FieldDescriptorProto_TYPE_UINT32, opt, ""),
+					field("payload", 4, descriptorpb.FieldDescriptorProto_TYPE_BYTES, opt, ""),
+					field("kind", 5, descriptorpb.FieldDescriptorProto_TYPE_ENUM, opt, ".test.Kind"),
+					field("tags", 6, descriptorpb.FieldDescriptorProto_TYPE_STRING, rep, ""),
+					field("inner", 7, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, opt, ".test.Inner"),
+					field("attrs", 8, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, rep, ".test.Event.AttrsEntry"),
+					field("items", 9, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, rep, ".test.Inner"),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("AttrsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt, ""),
+						field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, opt, ""),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+		},
+	}
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testProtoEvent(t *testing.T, md protoreflect.MessageDescriptor) *dynamicpb.Message {
+	m := dynamicpb.NewMessage(md)
+	fields := md.Fields()
+	m.Set(fields.ByName("name"), protoreflect.ValueOfString("click"))
+	m.Set(fields.ByName("count"), protoreflect.ValueOfInt64(-3))
+	m.Set(fields.ByName("flags"), protoreflect.ValueOfUint32(7))
+	m.Set(fields.ByName("payload"), protoreflect.ValueOfBytes([]byte{1, 2}))
+	m.Set(fields.ByName("kind"), protoreflect.ValueOfEnum(1))
+	tags := m.Mutable(fields.ByName("tags")).List()
+	tags.Append(protoreflect.ValueOfString("a"))
+	tags.Append(protoreflect.ValueOfString("b"))
+	inner := m.Mutable(fields.ByName("inner")).Message()
+	inner.Set(inner.Descriptor().Fields().ByName("score"), protoreflect.ValueOfFloat64(0.5))
+	attrs := m.Mutable(fields.ByName("attrs")).Map()
+	attrs.Set(protoreflect.ValueOfString("x").MapKey(), protoreflect.ValueOfInt32(10))
+	items := m.Mutable(fields.ByName("items")).List()
+	item := items.NewElement()
+	item.Message().Set(inner.Descriptor().Fields().ByName("score"), protoreflect.ValueOfFloat64(1.5))
+	items.Append(item)
+	return m
+}
+
+func TestProtoConvert(t *testing.T) {
+	a := assert.New(t)
+	md, err := LoadProtoMessageDescriptor(testProtoDescriptorSet(t), "test.Event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := testProtoEvent(t, md)
+	wire, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := FromProto(md, wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := flexbuffers.NewBuilder()
+	b.Map(func(b *flexbuffers.Builder) {
+		b.StringValueField([]byte("name"), "click")
+		b.IntField([]byte("count"), -3)
+		b.UIntField([]byte("flags"), 7)
+		b.BlobField([]byte("payload"), []byte{1, 2})
+		b.StringValueField([]byte("kind"), "CLICK")
+		b.VectorField([]byte("tags"), false, false, func(b *flexbuffers.Builder) {
+			b.StringValue("a")
+			b.StringValue("b")
+		})
+		b.MapField([]byte("inner"), func(b *flexbuffers.Builder) {
+			b.Float64Field([]byte("score"), 0.5)
+		})
+		b.MapField([]byte("attrs"), func(b *flexbuffers.Builder) {
+			b.IntField([]byte("x"), 10)
+		})
+		b.VectorField([]byte("items"), false, false, func(b *flexbuffers.Builder) {
+			b.Map(func(b *flexbuffers.Builder) {
+				b.Float64Field([]byte("score"), 1.5)
+			})
+		})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(b.Buffer(), raw); diff != "" {
+		t.Error(diff)
+	}
+
+	// reverse
+	out, err := ToProto(md, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(out, decoded); err != nil {
+		t.Fatal(err)
+	}
+	a.True(proto.Equal(msg, decoded))
+}
+
+func TestProtoWriter_Errors(t *testing.T) {
+	a := assert.New(t)
+	md, err := LoadProtoMessageDescriptor(testProtoDescriptorSet(t), "test.Event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toProto := func(input string, discardUnknown bool) ([]byte, error) {
+		raw, err := FromJson([]byte(input))
+		if err != nil {
+			return nil, err
+		}
+		var out []byte
+		w := &ProtoWriter{Message: md, DiscardUnknown: discardUnknown, Output: writerFunc(func(p []byte) (int, error) {
+			out = append(out, p...)
+			return len(p), nil
+		})}
+		r := FlexbuffersReader{Output: w}
+		return out, r.ReadBuffer(raw)
+	}
+	_, err = toProto(`{"unknown": {"a": [1]}, "name": "x"}`, false)
+	a.Error(err)
+	out, err := toProto(`{"unknown": {"a": [1]}, "name": "x", "kind": 1}`, true)
+	if a.NoError(err) {
+		decoded := dynamicpb.NewMessage(md)
+		a.NoError(proto.Unmarshal(out, decoded))
+		a.Equal("x", decoded.Get(md.Fields().ByName("name")).String())
+		a.Equal(protoreflect.EnumNumber(1), decoded.Get(md.Fields().ByName("kind")).Enum())
+	}
+	_, err = toProto(`{"flags": -1}`, false)
+	a.Error(err)
+	_, err = toProto(`{"kind": "NOPE"}`, false)
+	a.Error(err)
+	_, err = toProto(`[1]`, false)
+	a.Error(err)
+}
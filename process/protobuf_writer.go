@@ -0,0 +1,419 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"flexbuffers"
+)
+
+func ToProto(md protoreflect.MessageDescriptor, raw flexbuffers.Raw) ([]byte, error) {
+	var out []byte
+	w := ProtoWriter{Message: md, Output: writerFunc(func(p []byte) (int, error) {
+		out = append(out, p...)
+		return len(p), nil
+	})}
+	r := FlexbuffersReader{Output: &w}
+	if err := r.ReadBuffer(raw); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+type protoFrame struct {
+	msg  protoreflect.Message
+	list protoreflect.List
+	mp   protoreflect.Map
+	// field is the field currently selected by key (message frame), or the field of list/map frame
+	field protoreflect.FieldDescriptor
+	// mapKey is a key of map frame selected by PushObjectKey
+	mapKey protoreflect.MapKey
+	// listElem is an element of list being built
+	listElem *protoreflect.Value
+}
+
+// ProtoWriter writes an object as wire-format protobuf message. Keys are matched to field names or json names.
+// Output is written when the root object is completed.
+type ProtoWriter struct {
+	Output  io.Writer
+	Message protoreflect.MessageDescriptor
+	// DiscardUnknown ignores keys which don't match to any field, instead of returning an error.
+	DiscardUnknown bool
+
+	stack []protoFrame
+	// skip is true while skipping a value of unknown field, skipNest is the nesting level inside the value
+	skip     bool
+	skipNest int
+}
+
+func (w *ProtoWriter) top() *protoFrame {
+	return &w.stack[len(w.stack)-1]
+}
+
+// skipping reports the event should be ignored. nest is 1 for begin events, -1 for end events and 0 for others.
+func (w *ProtoWriter) skipping(nest int) bool {
+	if !w.skip {
+		return false
+	}
+	w.skipNest += nest
+	if w.skipNest == 0 {
+		w.skip = false
+	}
+	return true
+}
+
+// target returns the field which receives the value being pushed
+func (w *ProtoWriter) target() (protoreflect.FieldDescriptor, error) {
+	if len(w.stack) == 0 {
+		return nil, fmt.Errorf("root value must be an object")
+	}
+	f := w.top()
+	if f.field == nil {
+		return nil, fmt.Errorf("no field selected")
+	}
+	if f.mp != nil {
+		return f.field.MapValue(), nil
+	}
+	return f.field, nil
+}
+
+func (w *ProtoWriter) setValue(v protoreflect.Value) error {
+	f := w.top()
+	switch {
+	case f.list != nil:
+		f.list.Append(v)
+	case f.mp != nil:
+		f.mp.Set(f.mapKey, v)
+	default:
+		f.msg.Set(f.field, v)
+		f.field = nil
+	}
+	return nil
+}
+
+func (w *ProtoWriter) pushScalar(v interface{}) error {
+	if w.skipping(0) {
+		return nil
+	}
+	fd, err := w.target()
+	if err != nil {
+		return err
+	}
+	if w.top().list == nil && fd.IsList() {
+		return fmt.Errorf("field %s: repeated field requires an array", fd.FullName())
+	}
+	pv, err := protoScalar(fd, v)
+	if err != nil {
+		return err
+	}
+	return w.setValue(pv)
+}
+
+func protoScalar(fd protoreflect.FieldDescriptor, v interface{}) (protoreflect.Value, error) {
+	mismatch := func() (protoreflect.Value, error) {
+		return protoreflect.Value{}, fmt.Errorf("field %s: cannot set %T to %s", fd.FullName(), v, fd.Kind())
+	}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if b, ok := v.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if i, ok := protoInt(v); ok && math.MinInt32 <= i && i <= math.MaxInt32 {
+			return protoreflect.ValueOfInt32(int32(i)), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, ok := protoInt(v); ok {
+			return protoreflect.ValueOfInt64(i), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if u, ok := protoUint(v); ok && u <= math.MaxUint32 {
+			return protoreflect.ValueOfUint32(uint32(u)), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if u, ok := protoUint(v); ok {
+			return protoreflect.ValueOfUint64(u), nil
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		var f float64
+		switch vv := v.(type) {
+		case float64:
+			f = vv
+		case int64:
+			f = float64(vv)
+		case uint64:
+			f = float64(vv)
+		default:
+			return mismatch()
+		}
+		if fd.Kind() == protoreflect.FloatKind {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+	case protoreflect.StringKind:
+		if s, ok := v.(string); ok {
+			return protoreflect.ValueOfString(s), nil
+		}
+	case protoreflect.BytesKind:
+		switch vv := v.(type) {
+		case []byte:
+			return protoreflect.ValueOfBytes(append([]byte(nil), vv...)), nil
+		case string:
+			return protoreflect.ValueOfBytes([]byte(vv)), nil
+		}
+	case protoreflect.EnumKind:
+		if s, ok := v.(string); ok {
+			ev := fd.Enum().Values().ByName(protoreflect.Name(s))
+			if ev == nil {
+				return protoreflect.Value{}, fmt.Errorf("field %s: unknown enum value %s", fd.FullName(), s)
+			}
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		if i, ok := protoInt(v); ok && math.MinInt32 <= i && i <= math.MaxInt32 {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), nil
+		}
+	}
+	return mismatch()
+}
+
+func protoInt(v interface{}) (int64, bool) {
+	switch vv := v.(type) {
+	case int64:
+		return vv, true
+	case uint64:
+		return int64(vv), vv <= math.MaxInt64
+	case float64:
+		return int64(vv), float64(int64(vv)) == vv
+	}
+	return 0, false
+}
+
+func protoUint(v interface{}) (uint64, bool) {
+	switch vv := v.(type) {
+	case int64:
+		return uint64(vv), vv >= 0
+	case uint64:
+		return vv, true
+	case float64:
+		return uint64(vv), vv >= 0 && float64(uint64(vv)) == vv
+	}
+	return 0, false
+}
+
+func (w *ProtoWriter) PushString(s string) error {
+	return w.pushScalar(s)
+}
+
+func (w *ProtoWriter) PushBlob(b []byte) error {
+	return w.pushScalar(b)
+}
+
+func (w *ProtoWriter) PushInt(i int64) error {
+	return w.pushScalar(i)
+}
+
+func (w *ProtoWriter) PushUint(u uint64) error {
+	return w.pushScalar(u)
+}
+
+func (w *ProtoWriter) PushFloat(f float64) error {
+	return w.pushScalar(f)
+}
+
+func (w *ProtoWriter) PushBool(b bool) error {
+	return w.pushScalar(b)
+}
+
+func (w *ProtoWriter) PushNull() error {
+	if w.skipping(0) {
+		return nil
+	}
+	if len(w.stack) == 0 {
+		return fmt.Errorf("root value must be an object")
+	}
+	f := w.top()
+	if f.list != nil || f.mp != nil {
+		return fmt.Errorf("field %s: null is not allowed in repeated or map field", f.field.FullName())
+	}
+	// null leaves the field unset
+	f.field = nil
+	return nil
+}
+
+func (w *ProtoWriter) BeginArray() (int, error) {
+	if w.skipping(1) {
+		return 0, nil
+	}
+	fd, err := w.target()
+	if err != nil {
+		return 0, err
+	}
+	f := w.top()
+	if f.list != nil || f.mp != nil || !fd.IsList() {
+		return 0, fmt.Errorf("field %s: unexpected array", fd.FullName())
+	}
+	list := f.msg.Mutable(fd).List()
+	f.field = nil
+	w.stack = append(w.stack, protoFrame{
+		list:  list,
+		field: fd,
+	})
+	return len(w.stack), nil
+}
+
+func (w *ProtoWriter) EndArray(int) error {
+	if w.skipping(-1) {
+		return nil
+	}
+	w.stack = w.stack[:len(w.stack)-1]
+	return nil
+}
+
+func (w *ProtoWriter) BeginObject() (int, error) {
+	if w.skipping(1) {
+		return 0, nil
+	}
+	if len(w.stack) == 0 {
+		if w.Message == nil {
+			return 0, fmt.Errorf("message descriptor is not set")
+		}
+		w.stack = append(w.stack, protoFrame{msg: dynamicpb.NewMessage(w.Message)})
+		return len(w.stack), nil
+	}
+	fd, err := w.target()
+	if err != nil {
+		return 0, err
+	}
+	f := w.top()
+	switch {
+	case fd.IsMap() && f.mp == nil && f.list == nil:
+		mp := f.msg.Mutable(fd).Map()
+		f.field = nil
+		w.stack = append(w.stack, protoFrame{
+			mp:    mp,
+			field: fd,
+		})
+	case fd.Message() != nil:
+		var frame protoFrame
+		switch {
+		case f.list != nil:
+			elem := f.list.NewElement()
+			frame.msg = elem.Message()
+			frame.listElem = &elem
+		case f.mp != nil:
+			frame.msg = f.mp.Mutable(f.mapKey).Message()
+		default:
+			frame.msg = f.msg.Mutable(fd).Message()
+			f.field = nil
+		}
+		w.stack = append(w.stack, frame)
+	default:
+		return 0, fmt.Errorf("field %s: unexpected object", fd.FullName())
+	}
+	return len(w.stack), nil
+}
+
+func (w *ProtoWriter) EndObject(int) error {
+	if w.skipping(-1) {
+		return nil
+	}
+	f := w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+	if len(w.stack) == 0 {
+		b, err := proto.Marshal(f.msg.Interface())
+		if err != nil {
+			return err
+		}
+		_, err = w.Output.Write(b)
+		return err
+	}
+	if f.listElem != nil {
+		w.top().list.Append(*f.listElem)
+	}
+	return nil
+}
+
+func (w *ProtoWriter) PushObjectKey(k string) error {
+	if w.skip {
+		return nil
+	}
+	if len(w.stack) == 0 {
+		return fmt.Errorf("object key outside of object")
+	}
+	f := w.top()
+	if f.mp != nil {
+		key, err := protoMapKey(f.field.MapKey(), k)
+		if err != nil {
+			return err
+		}
+		f.mapKey = key
+		return nil
+	}
+	fields := f.msg.Descriptor().Fields()
+	fd := fields.ByName(protoreflect.Name(k))
+	if fd == nil {
+		fd = fields.ByJSONName(k)
+	}
+	if fd == nil {
+		if w.DiscardUnknown {
+			w.skip = true
+			return nil
+		}
+		return fmt.Errorf("message %s has no field %s", f.msg.Descriptor().FullName(), k)
+	}
+	f.field = fd
+	return nil
+}
+
+func protoMapKey(fd protoreflect.FieldDescriptor, k string) (protoreflect.MapKey, error) {
+	var v protoreflect.Value
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(k)
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(k)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(k, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfInt32(int32(i))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfInt64(i)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		u, err := strconv.ParseUint(k, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfUint32(uint32(u))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		u, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfUint64(u)
+	default:
+		return protoreflect.MapKey{}, fmt.Errorf("unsupported map key kind: %s", fd.Kind())
+	}
+	return v.MapKey(), nil
+}
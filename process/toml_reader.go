@@ -0,0 +1,113 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"flexbuffers"
+	"flexbuffers/pkg/unsafeutil"
+)
+
+func FromTOML(data []byte) (flexbuffers.Raw, error) {
+	b := flexbuffers.NewBuilder()
+	r := TOMLReader{Output: NewFlexbuffersWriter(b)}
+	if err := r.ReadBuffer(data); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
+
+// TOMLReader reads TOML document as an object. Datetime values are read as RFC3339 strings.
+type TOMLReader struct {
+	Output DocumentWriter
+	// TimeExt is attached to datetime values if not zero.
+	TimeExt int64
+}
+
+func (r *TOMLReader) SetOutput(w DocumentWriter) error {
+	r.Output = w
+	return nil
+}
+
+func (r *TOMLReader) ReadBuffer(b []byte) error {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(unsafeutil.B2S(b), &doc); err != nil {
+		return err
+	}
+	return r.readTable(doc)
+}
+
+func (r *TOMLReader) readTable(t map[string]interface{}) error {
+	ptr, err := r.Output.BeginObject()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := r.Output.PushObjectKey(k); err != nil {
+			return err
+		}
+		if err := r.readValue(t[k]); err != nil {
+			return err
+		}
+	}
+	return r.Output.EndObject(ptr)
+}
+
+func (r *TOMLReader) readValue(v interface{}) error {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		return r.readTable(vv)
+	case []map[string]interface{}:
+		ptr, err := r.Output.BeginArray()
+		if err != nil {
+			return err
+		}
+		for _, t := range vv {
+			if err := r.readTable(t); err != nil {
+				return err
+			}
+		}
+		return r.Output.EndArray(ptr)
+	case []interface{}:
+		ptr, err := r.Output.BeginArray()
+		if err != nil {
+			return err
+		}
+		for _, e := range vv {
+			if err := r.readValue(e); err != nil {
+				return err
+			}
+		}
+		return r.Output.EndArray(ptr)
+	case string:
+		return r.Output.PushString(vv)
+	case int64:
+		return r.Output.PushInt(vv)
+	case float64:
+		return r.Output.PushFloat(vv)
+	case bool:
+		return r.Output.PushBool(vv)
+	case time.Time:
+		if r.TimeExt != 0 {
+			if w, ok := r.Output.(ExtWriter); ok {
+				if err := w.PushExt(r.TimeExt); err != nil {
+					return err
+				}
+			}
+		}
+		return r.Output.PushString(vv.Format(time.RFC3339Nano))
+	default:
+		return fmt.Errorf("unsupported toml value: %T", v)
+	}
+}
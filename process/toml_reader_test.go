@@ -0,0 +1,77 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers"
+	"flexbuffers/pkg/unsafeutil"
+)
+
+func TestFromTOML(t *testing.T) {
+	input := `
+title = "example"
+port = 8080
+ratio = 0.5
+enabled = true
+hosts = ["a", "b"]
+
+[owner]
+name = "tom"
+
+[[servers]]
+ip = "10.0.0.1"
+
+[[servers]]
+ip = "10.0.0.2"
+`
+	r, err := FromTOML(unsafeutil.S2B(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := flexbuffers.NewBuilder()
+	b.Map(func(b *flexbuffers.Builder) {
+		b.BoolField([]byte("enabled"), true)
+		b.VectorField([]byte("hosts"), false, false, func(b *flexbuffers.Builder) {
+			b.StringValue("a")
+			b.StringValue("b")
+		})
+		b.MapField([]byte("owner"), func(b *flexbuffers.Builder) {
+			b.StringValueField([]byte("name"), "tom")
+		})
+		b.IntField([]byte("port"), 8080)
+		b.Float64Field([]byte("ratio"), 0.5)
+		b.VectorField([]byte("servers"), false, false, func(b *flexbuffers.Builder) {
+			b.Map(func(b *flexbuffers.Builder) {
+				b.StringValueField([]byte("ip"), "10.0.0.1")
+			})
+			b.Map(func(b *flexbuffers.Builder) {
+				b.StringValueField([]byte("ip"), "10.0.0.2")
+			})
+		})
+		b.StringValueField([]byte("title"), "example")
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(b.Buffer(), r); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestTOMLReader_TimeExt(t *testing.T) {
+	a := assert.New(t)
+	b := flexbuffers.NewBuilder()
+	r := TOMLReader{Output: NewFlexbuffersWriter(b), TimeExt: 10}
+	if err := r.ReadBuffer([]byte("at = 1979-05-27T07:32:00Z")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	at := b.Buffer().LookupOrNull("at")
+	a.Equal("1979-05-27T07:32:00Z", at.AsStringRef().StringValueOrEmpty())
+	a.Equal(int64(10), at.Ext())
+}
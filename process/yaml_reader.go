@@ -0,0 +1,262 @@
+package process
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"flexbuffers"
+)
+
+func FromYAML(data []byte) (flexbuffers.Raw, error) {
+	b := flexbuffers.NewBuilder()
+	r := YAMLReader{Output: NewFlexbuffersWriter(b)}
+	if err := r.ReadBuffer(data); err != nil {
+		return nil, err
+	}
+	if err := b.Finish(); err != nil {
+		return nil, err
+	}
+	return b.Buffer(), nil
+}
+
+// YAMLReader reads the first document of YAML stream.
+// Aliases are emitted with AliasWriter if Output supports it, otherwise anchored nodes are expanded.
+type YAMLReader struct {
+	Output DocumentWriter
+	// Tags maps local tags (e.g. "!money") to ext. Values with a tag not in Tags are read without ext.
+	Tags map[string]int64
+
+	anchors map[*yaml.Node]int
+}
+
+func (r *YAMLReader) SetOutput(w DocumentWriter) error {
+	r.Output = w
+	return nil
+}
+
+func (r *YAMLReader) ReadBuffer(b []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return fmt.Errorf("cannot parse empty document")
+	}
+	r.anchors = make(map[*yaml.Node]int)
+	return r.readNode(doc.Content[0])
+}
+
+func (r *YAMLReader) readNode(n *yaml.Node) error {
+	if n.Kind == yaml.AliasNode {
+		return r.readAlias(n)
+	}
+	if err := r.pushTag(n); err != nil {
+		return err
+	}
+	var err error
+	switch n.Kind {
+	case yaml.ScalarNode:
+		err = r.readScalar(n)
+	case yaml.SequenceNode:
+		err = r.readSequence(n)
+	case yaml.MappingNode:
+		err = r.readMapping(n)
+	default:
+		err = fmt.Errorf("line %d: unexpected node kind: %d", n.Line, n.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	if n.Anchor != "" {
+		if w, ok := r.Output.(AliasWriter); ok {
+			id, err := w.Anchor()
+			if err != nil {
+				return err
+			}
+			r.anchors[n] = id
+		}
+	}
+	return nil
+}
+
+func (r *YAMLReader) readAlias(n *yaml.Node) error {
+	if n.Alias == nil {
+		return fmt.Errorf("line %d: unknown anchor '%s' referenced", n.Line, n.Value)
+	}
+	if id, ok := r.anchors[n.Alias]; ok {
+		return r.Output.(AliasWriter).PushAlias(id)
+	}
+	// anchored node is not marked (AliasWriter is not supported, or aliased from inside of itself)
+	return r.readNode(n.Alias)
+}
+
+// pushTag emits ext for local tags listed in Tags
+func (r *YAMLReader) pushTag(n *yaml.Node) error {
+	if !isLocalTag(n.Tag) {
+		return nil
+	}
+	ext, ok := r.Tags[n.Tag]
+	if !ok {
+		return nil
+	}
+	w, ok := r.Output.(ExtWriter)
+	if !ok {
+		return nil
+	}
+	return w.PushExt(ext)
+}
+
+func isLocalTag(tag string) bool {
+	return strings.HasPrefix(tag, "!") && !strings.HasPrefix(tag, "!!")
+}
+
+func (r *YAMLReader) readScalar(n *yaml.Node) error {
+	plain := n
+	if isLocalTag(n.Tag) {
+		// read local tagged value as untagged value
+		c := *n
+		c.Tag = ""
+		plain = &c
+	}
+	switch plain.ShortTag() {
+	case "!!null":
+		return r.Output.PushNull()
+	case "!!binary":
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(n.Value), ""))
+		if err != nil {
+			return fmt.Errorf("line %d: cannot decode binary: %s", n.Line, err)
+		}
+		return r.Output.PushBlob(b)
+	case "!!str":
+		return r.Output.PushString(n.Value)
+	}
+	var v interface{}
+	if err := plain.Decode(&v); err != nil {
+		return err
+	}
+	switch vv := v.(type) {
+	case nil:
+		return r.Output.PushNull()
+	case bool:
+		return r.Output.PushBool(vv)
+	case int:
+		return r.Output.PushInt(int64(vv))
+	case int64:
+		return r.Output.PushInt(vv)
+	case uint64:
+		if vv <= math.MaxInt64 {
+			return r.Output.PushInt(int64(vv))
+		}
+		return r.Output.PushUint(vv)
+	case float64:
+		return r.Output.PushFloat(vv)
+	case string:
+		return r.Output.PushString(vv)
+	case time.Time:
+		return r.Output.PushString(vv.Format(time.RFC3339Nano))
+	default:
+		return fmt.Errorf("line %d: unsupported scalar: %s", n.Line, n.Value)
+	}
+}
+
+func (r *YAMLReader) readSequence(n *yaml.Node) error {
+	ptr, err := r.Output.BeginArray()
+	if err != nil {
+		return err
+	}
+	for _, c := range n.Content {
+		if err := r.readNode(c); err != nil {
+			return err
+		}
+	}
+	return r.Output.EndArray(ptr)
+}
+
+type yamlPair struct {
+	key   string
+	value *yaml.Node
+}
+
+func (r *YAMLReader) readMapping(n *yaml.Node) error {
+	pairs, err := r.mappingPairs(n, 0)
+	if err != nil {
+		return err
+	}
+	ptr, err := r.Output.BeginObject()
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		if err := r.Output.PushObjectKey(p.key); err != nil {
+			return err
+		}
+		if err := r.readNode(p.value); err != nil {
+			return err
+		}
+	}
+	return r.Output.EndObject(ptr)
+}
+
+// mappingPairs resolves merge keys ("<<") of n. Keys written in n explicitly take precedence over merged ones.
+func (r *YAMLReader) mappingPairs(n *yaml.Node, depth int) ([]yamlPair, error) {
+	if depth > 64 {
+		return nil, fmt.Errorf("line %d: too deep merge", n.Line)
+	}
+	var explicit, merged []yamlPair
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge" {
+			var sources []*yaml.Node
+			if resolveAlias(v).Kind == yaml.SequenceNode {
+				sources = resolveAlias(v).Content
+			} else {
+				sources = []*yaml.Node{v}
+			}
+			for _, src := range sources {
+				src = resolveAlias(src)
+				if src.Kind != yaml.MappingNode {
+					return nil, fmt.Errorf("line %d: map merge requires map or sequence of maps as the value", v.Line)
+				}
+				pairs, err := r.mappingPairs(src, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				merged = appendPairs(merged, pairs...)
+			}
+			continue
+		}
+		key := resolveAlias(k)
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: map key must be scalar", k.Line)
+		}
+		explicit = appendPairs(explicit, yamlPair{key: key.Value, value: v})
+	}
+	return appendPairs(merged, explicit...), nil
+}
+
+// appendPairs appends pairs to dst, overwriting values of existing keys
+func appendPairs(dst []yamlPair, pairs ...yamlPair) []yamlPair {
+outer:
+	for _, p := range pairs {
+		for i := range dst {
+			if dst[i].key == p.key {
+				dst[i] = p
+				continue outer
+			}
+		}
+		dst = append(dst, p)
+	}
+	return dst
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
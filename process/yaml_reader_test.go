@@ -0,0 +1,160 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+
+	"flexbuffers"
+	"flexbuffers/pkg/unsafeutil"
+)
+
+func TestFromYAML(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		buildFn func(b *flexbuffers.Builder)
+	}{
+		{
+			name:  "scalars",
+			input: "[1, -2, 1.5, true, null, foo, '123', 18446744073709551615]",
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Vector(false, false, func(b *flexbuffers.Builder) {
+					b.Int(1)
+					b.Int(-2)
+					b.Float64(1.5)
+					b.Bool(true)
+					b.Null()
+					b.StringValue("foo")
+					b.StringValue("123")
+					b.UInt(18446744073709551615)
+				})
+			},
+		},
+		{
+			name: "nested",
+			input: `
+b: 123
+a:
+  x: [1, 2]
+  y: {z: bar}
+`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.IntField([]byte("b"), 123)
+					b.MapField([]byte("a"), func(b *flexbuffers.Builder) {
+						b.VectorField([]byte("x"), false, false, func(b *flexbuffers.Builder) {
+							b.Int(1)
+							b.Int(2)
+						})
+						b.MapField([]byte("y"), func(b *flexbuffers.Builder) {
+							b.StringValueField([]byte("z"), "bar")
+						})
+					})
+				})
+			},
+		},
+		{
+			name:  "binary",
+			input: "!!binary aGVsbG8=",
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Blob([]byte("hello"))
+			},
+		},
+		{
+			name: "anchor and alias",
+			input: `
+a: &x {k: 1}
+b: *x
+c: [*x, *x]
+`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.MapField([]byte("a"), func(b *flexbuffers.Builder) {
+						b.IntField([]byte("k"), 1)
+					})
+					v, _ := b.LastValue()
+					b.Key([]byte("b"))
+					b.PushValue(v)
+					b.VectorField([]byte("c"), false, false, func(b *flexbuffers.Builder) {
+						b.PushValue(v)
+						b.PushValue(v)
+					})
+				})
+			},
+		},
+		{
+			name: "merge",
+			input: `
+base: &base {x: 1, y: 2}
+derived:
+  <<: *base
+  y: 3
+`,
+			buildFn: func(b *flexbuffers.Builder) {
+				b.Map(func(b *flexbuffers.Builder) {
+					b.MapField([]byte("base"), func(b *flexbuffers.Builder) {
+						b.IntField([]byte("x"), 1)
+						b.IntField([]byte("y"), 2)
+					})
+					b.MapField([]byte("derived"), func(b *flexbuffers.Builder) {
+						b.IntField([]byte("x"), 1)
+						b.IntField([]byte("y"), 3)
+					})
+				})
+			},
+		},
+	}
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			r, err := FromYAML(unsafeutil.S2B(cas.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := flexbuffers.NewBuilder()
+			cas.buildFn(b)
+			if err := b.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(b.Buffer(), r); diff != "" {
+				t.Error(diff)
+			}
+			// aliases share the anchored value, which is not cyclic
+			if err := r.Validate(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestYAMLReader_Tags(t *testing.T) {
+	a := assert.New(t)
+	input := `
+price: !money "12.50"
+items: !list [1, 2]
+other: !unknown foo
+`
+	b := flexbuffers.NewBuilder()
+	r := YAMLReader{
+		Output: NewFlexbuffersWriter(b),
+		Tags:   map[string]int64{"!money": 1, "!list": 2},
+	}
+	if err := r.ReadBuffer([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	raw := b.Buffer()
+	a.NoError(raw.Validate())
+	price := raw.LookupOrNull("price")
+	a.Equal("12.50", price.AsStringRef().StringValueOrEmpty())
+	a.Equal(int64(1), price.Ext())
+	items := raw.LookupOrNull("items")
+	a.Equal(int64(2), items.AsVector().AtOrNull(1).AsInt64())
+	a.Equal(int64(2), items.Ext())
+	other := raw.LookupOrNull("other")
+	a.Equal("foo", other.AsStringRef().StringValueOrEmpty())
+	a.Equal(int64(0), other.Ext())
+}
@@ -0,0 +1,166 @@
+package process
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLWriter writes a document as YAML. Output is written when the root value is completed.
+type YAMLWriter struct {
+	Output io.Writer
+	// Indent is the number of spaces for indentation, 4 is used if zero.
+	Indent int
+	// Tags maps local tags (e.g. "!money") to ext, values with ext found in Tags are written with its tag.
+	Tags map[string]int64
+
+	stack []*yaml.Node
+	ext   int64
+}
+
+func (y *YAMLWriter) PushExt(ext int64) error {
+	y.ext = ext
+	return nil
+}
+
+func (y *YAMLWriter) tagOf(ext int64) string {
+	if ext == 0 {
+		return ""
+	}
+	for tag, e := range y.Tags {
+		if e == ext {
+			return tag
+		}
+	}
+	return ""
+}
+
+func (y *YAMLWriter) push(n *yaml.Node) error {
+	if tag := y.tagOf(y.ext); tag != "" {
+		if n.Tag == "!!str" && (&yaml.Node{Kind: yaml.ScalarNode, Value: n.Value}).ShortTag() != "!!str" {
+			// quote it, otherwise the value is resolved as non-string type by readers
+			n.Style |= yaml.DoubleQuotedStyle
+		}
+		n.Tag = tag
+		n.Style |= yaml.TaggedStyle
+	}
+	y.ext = 0
+	if len(y.stack) == 0 {
+		return y.encode(n)
+	}
+	parent := y.stack[len(y.stack)-1]
+	parent.Content = append(parent.Content, n)
+	return nil
+}
+
+func (y *YAMLWriter) encode(n *yaml.Node) error {
+	enc := yaml.NewEncoder(y.Output)
+	if y.Indent > 0 {
+		enc.SetIndent(y.Indent)
+	}
+	if err := enc.Encode(n); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func (y *YAMLWriter) pushScalar(tag, value string) error {
+	return y.push(&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value})
+}
+
+func (y *YAMLWriter) PushString(s string) error {
+	n := &yaml.Node{}
+	n.SetString(s)
+	return y.push(n)
+}
+
+func (y *YAMLWriter) PushBlob(b []byte) error {
+	return y.pushScalar("!!binary", base64.StdEncoding.EncodeToString(b))
+}
+
+func (y *YAMLWriter) PushInt(i int64) error {
+	return y.pushScalar("!!int", strconv.FormatInt(i, 10))
+}
+
+func (y *YAMLWriter) PushUint(u uint64) error {
+	return y.pushScalar("!!int", strconv.FormatUint(u, 10))
+}
+
+func (y *YAMLWriter) PushFloat(f float64) error {
+	var s string
+	switch {
+	case math.IsNaN(f):
+		s = ".nan"
+	case math.IsInf(f, 1):
+		s = ".inf"
+	case math.IsInf(f, -1):
+		s = "-.inf"
+	default:
+		s = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return y.pushScalar("!!float", s)
+}
+
+func (y *YAMLWriter) PushBool(b bool) error {
+	return y.pushScalar("!!bool", strconv.FormatBool(b))
+}
+
+func (y *YAMLWriter) PushNull() error {
+	return y.pushScalar("!!null", "null")
+}
+
+func (y *YAMLWriter) begin(kind yaml.Kind, tag string) (int, error) {
+	n := &yaml.Node{Kind: kind, Tag: tag}
+	if t := y.tagOf(y.ext); t != "" {
+		n.Tag = t
+		n.Style |= yaml.TaggedStyle
+	}
+	y.ext = 0
+	y.stack = append(y.stack, n)
+	return len(y.stack), nil
+}
+
+func (y *YAMLWriter) end() error {
+	if len(y.stack) == 0 {
+		return fmt.Errorf("no array or object to end")
+	}
+	n := y.stack[len(y.stack)-1]
+	y.stack = y.stack[:len(y.stack)-1]
+	if len(y.stack) == 0 {
+		return y.encode(n)
+	}
+	parent := y.stack[len(y.stack)-1]
+	parent.Content = append(parent.Content, n)
+	return nil
+}
+
+func (y *YAMLWriter) BeginArray() (int, error) {
+	return y.begin(yaml.SequenceNode, "!!seq")
+}
+
+func (y *YAMLWriter) EndArray(int) error {
+	return y.end()
+}
+
+func (y *YAMLWriter) BeginObject() (int, error) {
+	return y.begin(yaml.MappingNode, "!!map")
+}
+
+func (y *YAMLWriter) EndObject(int) error {
+	return y.end()
+}
+
+func (y *YAMLWriter) PushObjectKey(k string) error {
+	if len(y.stack) == 0 || y.stack[len(y.stack)-1].Kind != yaml.MappingNode {
+		return fmt.Errorf("object key outside of object")
+	}
+	n := &yaml.Node{}
+	n.SetString(k)
+	parent := y.stack[len(y.stack)-1]
+	parent.Content = append(parent.Content, n)
+	return nil
+}
@@ -0,0 +1,108 @@
+package process
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestYAMLWriter(t *testing.T) {
+	cases := []struct {
+		fn       func(w *YAMLWriter) error
+		expected string
+	}{
+		{
+			fn: func(w *YAMLWriter) error {
+				_, _ = w.BeginObject()
+				return w.EndObject(0)
+			},
+			expected: "{}\n",
+		},
+		{
+			fn: func(w *YAMLWriter) error {
+				_, _ = w.BeginObject()
+				_ = w.PushObjectKey("a")
+				_ = w.PushString("foo")
+				_ = w.PushObjectKey("b")
+				_ = w.PushInt(-1)
+				_ = w.PushObjectKey("c")
+				_ = w.PushUint(1)
+				_ = w.PushObjectKey("d")
+				_ = w.PushFloat(1.234)
+				_ = w.PushObjectKey("e")
+				_ = w.PushBool(true)
+				_ = w.PushObjectKey("f")
+				_ = w.PushString("true")
+				_ = w.PushObjectKey("g")
+				_ = w.PushNull()
+				_ = w.PushObjectKey("h")
+				_ = w.PushBlob([]byte("hello"))
+				return w.EndObject(0)
+			},
+			expected: `a: foo
+b: -1
+c: 1
+d: 1.234
+e: true
+f: "true"
+g: null
+h: !!binary aGVsbG8=
+`,
+		},
+		{
+			fn: func(w *YAMLWriter) error {
+				m, _ := w.BeginObject()
+				_ = w.PushObjectKey("a")
+				n, _ := w.BeginObject()
+				_ = w.PushObjectKey("x")
+				_ = w.PushString("y")
+				_ = w.EndObject(n)
+				_ = w.PushObjectKey("b")
+				o, _ := w.BeginArray()
+				_ = w.PushUint(1)
+				_ = w.PushExt(1)
+				_ = w.PushString("2")
+				_ = w.EndArray(o)
+				return w.EndObject(m)
+			},
+			expected: `a:
+  x: y
+b:
+- 1
+- !money "2"
+`,
+		},
+	}
+	for _, cas := range cases {
+		var buf bytes.Buffer
+		w := &YAMLWriter{Output: &buf, Indent: 2, Tags: map[string]int64{"!money": 1}}
+		if err := cas.fn(w); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(cas.expected, buf.String()); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	input := `a:
+- 1
+- 2.5
+- foo
+b: true
+`
+	raw, err := FromYAML([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	r := FlexbuffersReader{Output: &YAMLWriter{Output: &buf, Indent: 2}}
+	if err := r.ReadBuffer(raw); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(input, buf.String()); diff != "" {
+		t.Error(diff)
+	}
+}
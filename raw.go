@@ -10,14 +10,45 @@ var (
 
 type Raw []byte
 
+// Validate checks the whole buffer is readable, and returns *ValidationError for the first invalid element.
 func (b Raw) Validate() error {
 	root, err := b.Root()
 	if err != nil {
-		return err
+		return b.rootError(err)
 	}
 	return root.Validate()
 }
 
+// ValidateWithOptions checks the whole buffer with limits and stricter checks, see Reference.ValidateWithOptions.
+func (b Raw) ValidateWithOptions(opts ValidateOptions) error {
+	root, err := b.Root()
+	if err != nil {
+		return b.rootError(err)
+	}
+	return root.ValidateWithOptions(opts)
+}
+
+// ValidateAll returns all invalid elements of the buffer, see Reference.ValidateAll.
+func (b Raw) ValidateAll() []*ValidationError {
+	root, err := b.Root()
+	if err != nil {
+		return []*ValidationError{b.rootError(err)}
+	}
+	return root.ValidateAll()
+}
+
+func (b Raw) rootError(err error) *ValidationError {
+	offset := len(b) - 2
+	if offset < 0 {
+		offset = 0
+	}
+	var t Type
+	if len(b) >= 2 {
+		_, t, _ = UnpackType(b[len(b)-2])
+	}
+	return &ValidationError{Path: "$", Offset: offset, Expected: t, Actual: t, Invariant: "root is in the buffer", Err: err}
+}
+
 func (b Raw) RootOrNull() Reference {
 	v, err := b.Root()
 	if err != nil {
@@ -26,26 +57,39 @@ func (b Raw) RootOrNull() Reference {
 	return v
 }
 
+// RootWithKeyDictionary returns the root which resolves map keys through the key dictionary.
+func (b Raw) RootWithKeyDictionary(d *KeyDictionary) (Reference, error) {
+	r, err := b.Root()
+	return r.WithKeyDictionary(d), err
+}
+
 func (b Raw) Root() (Reference, error) {
 	if len(b) <= 2 {
 		return Reference{}, ErrInvalidData
 	}
 	byteWidth := b[len(b)-1]
+	if !validWidth(uint64(byteWidth)) {
+		return Reference{}, ErrInvalidData
+	}
 	packedType := b[len(b)-2]
 	rootOffset := len(b) - 2 - int(byteWidth)
-	return NewReferenceFromPackedType(b, rootOffset, byteWidth, packedType)
+	r, err := NewReferenceFromPackedType(b, rootOffset, byteWidth, packedType)
+	r.typeOffset = len(b) - 2
+	return r, err
 }
 
 func (b Raw) InitTraverser(tv *Traverser) {
 	byteWidth := b[len(b)-1]
 	packedType := b[len(b)-2]
 	rootOffset := len(b) - 2 - int(byteWidth)
+	bw, typ, hasExt := UnpackType(packedType)
 	*tv = Traverser{
 		buf:         b,
 		offset:      rootOffset,
-		typ:         Type(packedType >> 2),
+		typ:         typ,
 		parentWidth: int(byteWidth),
-		byteWidth:   1 << (packedType & 3),
+		byteWidth:   int(bw.ByteWidth()),
+		hasExt:      hasExt,
 	}
 }
 
@@ -58,8 +102,17 @@ func (b Raw) LookupOrNull(path ...string) Reference {
 }
 
 func (b Raw) Lookup(path ...string) (Reference, error) {
+	return b.LookupWithKeyDictionary(nil, path...)
+}
+
+// LookupWithKeyDictionary is the same as Lookup, but resolves map keys through the key dictionary.
+func (b Raw) LookupWithKeyDictionary(d *KeyDictionary, path ...string) (Reference, error) {
+	if _, err := b.Root(); err != nil {
+		return Reference{}, err
+	}
 	var tv Traverser
 	b.InitTraverser(&tv)
+	tv.SetKeyDictionary(d)
 	if err := tv.Seek(path); err != nil {
 		return Reference{}, err
 	}
@@ -79,21 +79,10 @@ func (b Raw) WriteInt64(offset int, byteWidth uint8, value int64) error {
 	if !fits {
 		return ErrUpdateDoesntFit
 	}
-	if valueWidth <= BitWidth8 {
-		b[offset] = byte(value)
-	}
-	if valueWidth <= BitWidth16 {
-		b[offset+1] = byte(value >> 8)
-	}
-	if valueWidth <= BitWidth32 {
-		b[offset+2] = byte(value >> 16)
-		b[offset+3] = byte(value >> 24)
-	}
-	if valueWidth <= BitWidth64 {
-		b[offset+4] = byte(value >> 32)
-		b[offset+5] = byte(value >> 40)
-		b[offset+6] = byte(value >> 48)
-		b[offset+7] = byte(value >> 56)
+	// write all bytes of the slot, the value may be narrower than the previous one
+	u := uint64(value)
+	for i := 0; i < int(byteWidth); i++ {
+		b[offset+i] = byte(u >> (8 * i))
 	}
 	return nil
 }
@@ -107,21 +96,9 @@ func (b Raw) WriteUInt64(offset int, byteWidth uint8, value uint64) error {
 	if !fits {
 		return ErrUpdateDoesntFit
 	}
-	if valueWidth <= BitWidth8 {
-		b[offset] = byte(value)
-	}
-	if valueWidth <= BitWidth16 {
-		b[offset+1] = byte(value >> 8)
-	}
-	if valueWidth <= BitWidth32 {
-		b[offset+2] = byte(value >> 16)
-		b[offset+3] = byte(value >> 24)
-	}
-	if valueWidth <= BitWidth64 {
-		b[offset+4] = byte(value >> 32)
-		b[offset+5] = byte(value >> 40)
-		b[offset+6] = byte(value >> 48)
-		b[offset+7] = byte(value >> 56)
+	// write all bytes of the slot, the value may be narrower than the previous one
+	for i := 0; i < int(byteWidth); i++ {
+		b[offset+i] = byte(value >> (8 * i))
 	}
 	return nil
 }
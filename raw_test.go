@@ -1,6 +1,7 @@
 package flexbuffers
 
 import (
+	"bytes"
 	"io/ioutil"
 	"math"
 	"path"
@@ -222,6 +223,49 @@ func TestRawFromTestData(t *testing.T) {
 	}
 }
 
+func TestRawCorruptedSize(t *testing.T) {
+	a := assert.New(t)
+	build := func(fn func(b *Builder)) Raw {
+		b := NewBuilder()
+		b.Ext(1)
+		fn(b)
+		a.NoError(b.Finish())
+		return b.Buffer()
+	}
+	// the size is the byte before the data, make it larger than the buffer
+	corrupt := func(r Raw, offset int) {
+		r[offset-1] = 0x7f
+	}
+	r := build(func(b *Builder) { b.StringValue("abc") })
+	corrupt(r, r.RootOrNull().AsStringRef().offset)
+	_, err := r.RootOrNull().StringRef()
+	a.Equal(ErrOutOfRange, err)
+	_, err = r.RootOrNull().Blob()
+	a.Equal(ErrOutOfRange, err)
+
+	r = build(func(b *Builder) { b.Vector(false, false, func(b *Builder) { b.Int(1) }) })
+	corrupt(r, r.RootOrNull().AsVector().offset)
+	_, err = r.RootOrNull().Vector()
+	a.Equal(ErrOutOfRange, err)
+
+	r = build(func(b *Builder) { b.Vector(true, false, func(b *Builder) { b.Int(1) }) })
+	corrupt(r, r.RootOrNull().AsTypedVector().offset)
+	_, err = r.RootOrNull().TypedVector()
+	a.Equal(ErrOutOfRange, err)
+
+	r = build(func(b *Builder) { b.Map(func(b *Builder) { b.IntField([]byte("a"), 1) }) })
+	corrupt(r, r.RootOrNull().AsMap().offset)
+	_, err = r.RootOrNull().Map()
+	a.Equal(ErrOutOfRange, err)
+
+	// scalars are not typed vectors
+	v, err := Raw{1, 4, 1}.RootOrNull().TypedVector()
+	a.NoError(err)
+	a.Equal(EmptyTypedVector(), v)
+	_, err = Raw{0, 0, NullPackedType, 3}.Root()
+	a.Equal(ErrInvalidData, err)
+}
+
 func TestRawOffsetError(t *testing.T) {
 	a := assert.New(t)
 	r := Raw([]byte{})
@@ -245,3 +289,20 @@ func TestRawOffsetError(t *testing.T) {
 		a.Equal(ErrOutOfRange, err)
 	}
 }
+
+func TestReference_WriteAsJsonEscaping(t *testing.T) {
+	a := assert.New(t)
+	b := NewBuilder()
+	b.Map(func(b *Builder) {
+		b.StringValueField([]byte("a\"b"), "100%\x01\n")
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	// control chars are escaped as JSON, not Go, and strings are not format strings
+	if a.NoError(b.Buffer().RootOrNull().WriteAsJson(&buf)) {
+		a.Equal(`{"a\"b":"100%\u0001\n"}`, buf.String())
+	}
+	a.Equal(`"\\\u001f\t"`, string(EscapeJSONString(nil, "\\\x1f\t")))
+}
@@ -74,11 +74,12 @@ func (b Raw) WriteInt64(offset int, byteWidth uint8, value int64) error {
 	if !fits {
 		return ErrUpdateDoesntFit
 	}
-	if valueWidth == BitWidth8 {
+	// write all bytes of the slot, the value may be narrower than the previous one
+	if byteWidth == 1 {
 		*(*int8)(unsafe.Pointer(&b[offset])) = int8(value)
-	} else if valueWidth == BitWidth16 {
+	} else if byteWidth == 2 {
 		*(*int16)(unsafe.Pointer(&b[offset])) = int16(value)
-	} else if valueWidth == BitWidth32 {
+	} else if byteWidth == 4 {
 		*(*int32)(unsafe.Pointer(&b[offset])) = int32(value)
 	} else {
 		*(*int64)(unsafe.Pointer(&b[offset])) = value
@@ -95,11 +96,12 @@ func (b Raw) WriteUInt64(offset int, byteWidth uint8, value uint64) error {
 	if !fits {
 		return ErrUpdateDoesntFit
 	}
-	if valueWidth == BitWidth8 {
+	// write all bytes of the slot, the value may be narrower than the previous one
+	if byteWidth == 1 {
 		*(*uint8)(unsafe.Pointer(&b[offset])) = uint8(value)
-	} else if valueWidth == BitWidth16 {
+	} else if byteWidth == 2 {
 		*(*uint16)(unsafe.Pointer(&b[offset])) = uint16(value)
-	} else if valueWidth == BitWidth32 {
+	} else if byteWidth == 4 {
 		*(*uint32)(unsafe.Pointer(&b[offset])) = uint32(value)
 	} else {
 		*(*uint64)(unsafe.Pointer(&b[offset])) = value
@@ -3,16 +3,10 @@ package flexbuffers
 import "C"
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 	"strconv"
-	"strings"
-	"unsafe"
-
-	"flexbuffers/pkg/unsafeutil"
 )
 
 var (
@@ -34,6 +28,15 @@ type Reference struct {
 	parentWidth uint8
 	byteWidth   uint8
 	hasExt      bool
+	dict        *KeyDictionary
+	// typeOffset is the offset of the packed type, zero if it is shared by a typed vector or not known
+	typeOffset int
+}
+
+// WithKeyDictionary returns the reference which resolves map keys through the key dictionary.
+func (r Reference) WithKeyDictionary(d *KeyDictionary) Reference {
+	r.dict = d
+	return r
 }
 
 func (r Reference) CheckBoundary() error {
@@ -51,170 +54,6 @@ func (r Reference) String() string {
 	return sb.String()
 }
 
-func (r Reference) writeJsonVector(l int, vec AnyVector, w io.Writer) (err error) {
-	if _, err = fmt.Fprintf(w, "["); err != nil {
-		return
-	}
-	for i := 0; i < l; i++ {
-		item, err := vec.At(i)
-		if err != nil {
-			return err
-		}
-		if err := item.WriteAsJson(w); err != nil {
-			return err
-		}
-		if i != l-1 {
-			if _, err := fmt.Fprintf(w, ","); err != nil {
-				return err
-			}
-		}
-	}
-	if _, err := fmt.Fprintf(w, "]"); err != nil {
-		return err
-	}
-	return
-}
-
-func (r Reference) WriteAsJson(w io.Writer) (err error) {
-	switch r.type_ {
-	case FBTNull:
-		_, err = fmt.Fprintf(w, "null")
-	case FBTInt, FBTIndirectInt:
-		i, err := r.Int64()
-		if err != nil {
-			return err
-		}
-		_, err = fmt.Fprintf(w, "%d", i)
-	case FBTUint, FBTIndirectUInt:
-		i, err := r.UInt64()
-		if err != nil {
-			return err
-		}
-		_, err = fmt.Fprintf(w, "%d", i)
-	case FBTFloat, FBTIndirectFloat:
-		f, err := r.Float64()
-		if err != nil {
-			return err
-		}
-		_, err = fmt.Fprintf(w, "%f", f)
-	case FBTKey:
-		k, err := r.asStringKey()
-		if err != nil {
-			return err
-		}
-		_, err = fmt.Fprintf(w, "\"%s\"", k)
-	case FBTString:
-		sRef, err := r.StringRef()
-		if err != nil {
-			return err
-		}
-		unsafeStr, err := sRef.StringValue()
-		if err != nil {
-			return err
-		}
-		out := make([]byte, 0, len(unsafeStr))
-		out = EscapeJSONString(out, unsafeStr)
-
-		_, err = fmt.Fprintf(w, unsafeutil.B2S(out))
-	case FBTMap:
-		if _, err := fmt.Fprintf(w, "{"); err != nil {
-			return err
-		}
-		m, err := r.Map()
-		if err != nil {
-			return err
-		}
-		var keys TypedVector
-		keys, err = m.Keys()
-		if err != nil {
-			return err
-		}
-		values := m.Values()
-		sz, err := keys.Size()
-		if err != nil {
-			return err
-		}
-		for i := 0; i < sz; i++ {
-			k, err := keys.At(i)
-			if err != nil {
-				return err
-			}
-			v, err := values.At(i)
-			if err != nil {
-				return err
-			}
-			if err := k.WriteAsJson(w); err != nil {
-				return err
-			}
-			if _, err := fmt.Fprintf(w, ":"); err != nil {
-				return err
-			}
-			if err := v.WriteAsJson(w); err != nil {
-				return err
-			}
-			if i != sz-1 {
-				if _, err := fmt.Fprintf(w, ","); err != nil {
-					return err
-				}
-			}
-		}
-		if _, err := fmt.Fprintf(w, "}"); err != nil {
-			return err
-		}
-	case FBTVector:
-		vec, err := r.Vector()
-		if err != nil {
-			return err
-		}
-		sz, err := vec.Size()
-		if err != nil {
-			return err
-		}
-		err = r.writeJsonVector(sz, vec, w)
-	case FBTBlob:
-		blob, err := r.Blob()
-		if err != nil {
-			return err
-		}
-		d, err := blob.Data()
-		if err != nil {
-			return err
-		}
-		_, err = fmt.Fprintf(w, "\"%s\"", base64.StdEncoding.EncodeToString(d))
-	case FBTBool:
-		b, err := r.Bool()
-		if err != nil {
-			return err
-		}
-		if b {
-			_, err = fmt.Fprintf(w, "true")
-		} else {
-			_, err = fmt.Fprintf(w, "false")
-		}
-	default:
-		if r.IsTypedVector() {
-			vec, err := r.TypedVector()
-			if err != nil {
-				return err
-			}
-			sz, err := vec.Size()
-			if err != nil {
-				return err
-			}
-			err = r.writeJsonVector(sz, vec, w)
-		} else if r.IsFixedTypedVector() {
-			vec, err := r.FixedTypedVector()
-			if err != nil {
-				return err
-			}
-			err = r.writeJsonVector(int(vec.len_), vec, w)
-		} else {
-			return fmt.Errorf("unable to convert to json: type=%v", r.type_)
-		}
-	}
-	return
-}
-
 func setReferenceFromPackedType(buf Raw, offset int, parentWidth uint8, packedType uint8, ref *Reference) error {
 	bw, t, hasExt := UnpackType(packedType)
 	if offset < 0 || len(buf) <= offset+int(bw) {
@@ -242,6 +81,10 @@ func NewReferenceFromPackedType(buf Raw, offset int, parentWidth uint8, packedTy
 	return r, r.CheckBoundary()
 }
 
+func (r Reference) Type() Type {
+	return r.type_
+}
+
 func (r Reference) IsNull() bool {
 	return r.type_ == FBTNull
 }
@@ -643,9 +486,11 @@ func (r Reference) StringRef() (String, error) {
 	if r.hasExt {
 		size, err := sz.Size()
 		if err != nil {
-			return EmptyString(), nil
+			return EmptyString(), err
+		}
+		if sz.ext, err = r.readExt(ind + size + 1); err != nil { //+1 for null byte
+			return EmptyString(), err
 		}
-		sz.ext, _ = binary.Varint(r.data_[ind+size+1:]) //+1 for null byte
 	}
 	return String{sz}, nil
 }
@@ -670,12 +515,13 @@ func (r Reference) Blob() (Blob, error) {
 		if r.hasExt {
 			size, err := sz.Size()
 			if err != nil {
-				return EmptyBlob(), nil
+				return EmptyBlob(), err
+			}
+			if r.type_ == FBTString {
+				size++ // null byte
 			}
-			var n int
-			sz.ext, n = binary.Varint(r.data_[ind+int(r.byteWidth)*size:])
-			if n <= 0 {
-				return EmptyBlob(), fmt.Errorf("failed to read ext")
+			if sz.ext, err = r.readExt(ind + size); err != nil {
+				return EmptyBlob(), err
 			}
 		}
 		return Blob{sz}, nil
@@ -717,15 +563,18 @@ func (r Reference) Vector() (Vector, error) {
 				buf:       r.data_,
 				offset:    ind,
 				byteWidth: r.byteWidth,
+				dict:      r.dict,
 			},
 		}
 		if r.hasExt {
 			size, err := sz.Size()
 			if err != nil {
-				return EmptyVector(), nil
+				return EmptyVector(), err
 			}
 			// ind + body vector (byteWitdh * size) + type vector
-			sz.ext, _ = binary.Varint(r.data_[ind+int(r.byteWidth)*size+size:])
+			if sz.ext, err = r.readExt(ind + int(r.byteWidth)*size + size); err != nil {
+				return EmptyVector(), err
+			}
 		}
 		return Vector{sz}, nil
 	} else {
@@ -738,6 +587,9 @@ func (r Reference) AsTypedVector() TypedVector {
 }
 
 func (r Reference) TypedVector() (TypedVector, error) {
+	if !r.IsTypedVector() {
+		return EmptyTypedVector(), nil
+	}
 	ind, err := r.indirect()
 	if err != nil {
 		return TypedVector{}, err
@@ -752,18 +604,16 @@ func (r Reference) TypedVector() (TypedVector, error) {
 	if r.hasExt {
 		size, err := sz.Size()
 		if err != nil {
-			return EmptyTypedVector(), nil
+			return EmptyTypedVector(), err
+		}
+		if sz.ext, err = r.readExt(ind + int(r.byteWidth)*size); err != nil {
+			return EmptyTypedVector(), err
 		}
-		sz.ext, _ = binary.Varint(r.data_[ind+int(r.byteWidth)*size:])
-	}
-	if r.IsTypedVector() {
-		return TypedVector{
-			Sized: sz,
-			type_: ToTypedVectorElementType(r.type_),
-		}, nil
-	} else {
-		return EmptyTypedVector(), nil
 	}
+	return TypedVector{
+		Sized: sz,
+		type_: ToTypedVectorElementType(r.type_),
+	}, nil
 }
 func (r Reference) AsFixedTypedVector() FixedTypedVector {
 	v, err := r.FixedTypedVector()
@@ -785,7 +635,9 @@ func (r Reference) FixedTypedVector() (FixedTypedVector, error) {
 	vtype := ToFixedTypedVectorElementType(r.type_, &l)
 	var ext int64
 	if r.hasExt {
-		ext, _ = binary.Varint(r.data_[ind+int(r.byteWidth)*int(l):])
+		if ext, err = r.readExt(ind + int(r.byteWidth)*int(l)); err != nil {
+			return FixedTypedVector{}, err
+		}
 	}
 	return FixedTypedVector{
 		Object: Object{
@@ -820,35 +672,73 @@ func (r Reference) Map() (Map, error) {
 			buf:       r.data_,
 			offset:    ind,
 			byteWidth: r.byteWidth,
+			dict:      r.dict,
 		},
 	}
 	if r.hasExt {
 		size, err := sz.Size()
 		if err != nil {
-			return EmptyMap(), nil
+			return EmptyMap(), err
 		}
 
 		numPrefixedData := 3
 		keysOffset := ind - int(r.byteWidth)*numPrefixedData
-		off, err := r.data_.Indirect(keysOffset, r.byteWidth)
+		bw, err := r.data_.ReadUInt64(keysOffset+int(r.byteWidth), r.byteWidth)
 		if err != nil {
 			return EmptyMap(), fmt.Errorf("broken data: no ext for map")
 		}
-		bw, err := r.data_.ReadUInt64(keysOffset+int(r.byteWidth), r.byteWidth)
+		var order int
+		if bw == 0 {
+			// keys are in the key dictionary, ext follows the values
+			if sz.ext, order, err = r.readMapExt(ind + int(r.byteWidth)*size + size); err != nil {
+				return EmptyMap(), err
+			}
+			return Map{Vector: Vector{sz}, order: order}, nil
+		}
+		off, err := r.data_.Indirect(keysOffset, r.byteWidth)
 		if err != nil {
 			return EmptyMap(), fmt.Errorf("broken data: no ext for map")
 		}
-		if bw <= 0 || bw > 8 {
+		if bw > 8 {
 			return EmptyMap(), ErrInvalidData
 		}
-		if off < 0 || len(r.data_) <= off {
-			return EmptyMap(), ErrOutOfRange
+		if sz.ext, order, err = r.readMapExt(off + int(bw)*size); err != nil {
+			return EmptyMap(), err
 		}
-		sz.ext, _ = binary.Varint(r.data_[off+int(bw)*size:])
+		return Map{Vector: Vector{sz}, order: order}, nil
+	}
+	return Map{Vector: Vector{sz}}, nil
+}
+
+// readExt reads the ext varint at off.
+func (r Reference) readExt(off int) (int64, error) {
+	if off < 0 || len(r.data_) <= off {
+		return 0, ErrOutOfRange
+	}
+	ext, n := binary.Varint(r.data_[off:])
+	if n <= 0 {
+		return 0, fmt.Errorf("failed to read ext")
+	}
+	return ext, nil
+}
+
+// readMapExt reads the ext of a map at off, and returns the offset of the insertion order of ordered maps.
+func (r Reference) readMapExt(off int) (int64, int, error) {
+	ext, err := r.readExt(off)
+	if err != nil || ext != ExtOrderedMap {
+		return ext, 0, err
 	}
-	return Map{Vector{sz}}, nil
+	_, n := binary.Varint(r.data_[off:])
+	off += n
+	if ext, err = r.readExt(off); err != nil {
+		return 0, 0, err
+	}
+	_, n = binary.Varint(r.data_[off:])
+	return ext, off + n, nil
 }
 
+// MutateInt writes i in the stored type, ints and uints are not converted. It fails with ErrUpdateDoesntFit
+// if i doesn't fit the stored width, see SetInt for an error with the needed width.
 func (r Reference) MutateInt(i int64) error {
 	switch r.type_ {
 	case FBTInt:
@@ -874,6 +764,7 @@ func (r Reference) MutateInt(i int64) error {
 	}
 }
 
+// MutateUInt is MutateInt for uints, see SetUInt.
 func (r Reference) MutateUInt(u uint64) error {
 	if r.type_ == FBTUint {
 		return r.data_.WriteUInt64(r.offset, r.parentWidth, u)
@@ -898,6 +789,7 @@ func (r Reference) MutateUInt(u uint64) error {
 	}
 }
 
+// MutateFloat64 fails with ErrUpdateDoesntFit if f isn't exactly a float32 stored in 4 bytes, see SetFloat64.
 func (r Reference) MutateFloat64(f float64) error {
 	if r.type_ == FBTFloat {
 		return r.data_.WriteFloat(r.offset, r.parentWidth, f)
@@ -926,6 +818,7 @@ func (r Reference) MutateFloat32(f float32) error {
 	}
 }
 
+// MutateString overwrites the string with s of the same length, see SetString.
 func (r Reference) MutateString(s string) bool {
 	if len(s) == 0 {
 		return false
@@ -933,127 +826,8 @@ func (r Reference) MutateString(s string) bool {
 	// This is very strict, could allow shorter strings, but that creates
 	// garbage.
 	// ... flexbuffers.h says so
-	if len(s) != r.AsStringRef().SizeOrZero() {
-		return false
-	}
-	data := *(*[]byte)(unsafe.Pointer(&s))
-	if r.offset < 0 || len(r.data_) <= r.offset || len(r.data_) <= r.offset+len(data) {
-		return false
-	}
-	copy(r.data_[r.offset:], data)
-	r.data_[r.offset+len(data)] = 0 // NUL terminator
-	return true
-}
-func (r Reference) Validate() (err error) {
-	visited := make(map[int]struct{})
-	return r.validate(visited)
-}
-
-func (r Reference) validate(visited map[int]struct{}) (err error) {
-	if _, ok := visited[r.offset]; ok {
-		return ErrRecursiveData
-	}
-	visited[r.offset] = struct{}{}
-
-	_ = r.Ext()
-
-	switch r.type_ {
-	case FBTInt, FBTIndirectInt:
-		_, err = r.Int64()
-	case FBTUint, FBTIndirectUInt:
-		_, err = r.UInt64()
-	case FBTFloat, FBTIndirectFloat:
-		_, err = r.Float64()
-	case FBTKey:
-		k, err := r.Key()
-		if err != nil {
-			return err
-		}
-		if strings.Index(k.StringValue(), "\x00") >= 0 {
-			return fmt.Errorf("key contains null char")
-		}
-	case FBTString:
-		s, err := r.StringRef()
-		if err != nil {
-			return err
-		}
-		if _, err := s.StringValue(); err != nil {
-			return err
-		}
-	case FBTMap:
-		m, err := r.Map()
-		if err != nil {
-			return err
-		}
-		keys, err := m.Keys()
-		if err != nil {
-			return err
-		}
-		var key Reference
-		var value Reference
-		sz, err := m.Size()
-		if err != nil {
-			return err
-		}
-		for i := 0; i < sz; i++ {
-			if err := keys.AtRef(i, &key); err != nil {
-				return err
-			}
-			if err := key.validate(visited); err != nil {
-				return err
-			}
-			if err := m.AtRef(i, &value); err != nil {
-				return err
-			}
-			if err := value.validate(visited); err != nil {
-				return err
-			}
-		}
-	case FBTVector:
-		vec, err := r.Vector()
-		if err != nil {
-			return err
-		}
-		var v Reference
-		sz, err := vec.Size()
-		if err != nil {
-			return err
-		}
-		for i := 0; i < sz; i++ {
-			if err := vec.AtRef(i, &v); err != nil {
-				return err
-			}
-			if v.offset == vec.offset {
-				return ErrRecursiveData
-			}
-			if err := v.validate(visited); err != nil {
-				return err
-			}
-		}
-	default:
-		anyVec, err := r.AnyVector()
-		if err == nil {
-			var v Reference
-			sz, err := anyVec.Size()
-			if err != nil {
-				return err
-			}
-			for i := 0; i < sz; i++ {
-				if err := anyVec.AtRef(i, &v); err != nil {
-					return err
-				}
-				if err := v.validate(visited); err != nil {
-					return err
-				}
-			}
-			return nil
-		}
-
-		err = fmt.Errorf("type is invalid: %d", r.type_)
-	}
-	return
+	return SetString(r, s) == nil
 }
-
 func (r Reference) Ext() int64 {
 	if !r.hasExt {
 		return 0
@@ -1072,3 +846,35 @@ func (r Reference) Ext() int64 {
 		return 0
 	}
 }
+
+// LookupPath follows the path from r. Path elements are map keys, or indexes of vectors.
+// ErrNotFound is returned if a key is missing, or an element is neither a map nor a vector.
+func (r Reference) LookupPath(path ...string) (Reference, error) {
+	for _, p := range path {
+		switch {
+		case r.IsMap():
+			m, err := r.Map()
+			if err != nil {
+				return Reference{}, err
+			}
+			if r, err = m.Get(p); err != nil {
+				return Reference{}, err
+			}
+		case r.IsAnyVector():
+			i, err := strconv.Atoi(p)
+			if err != nil {
+				return Reference{}, ErrNotFound
+			}
+			vec, err := r.AnyVector()
+			if err != nil {
+				return Reference{}, err
+			}
+			if r, err = vec.At(i); err != nil {
+				return Reference{}, err
+			}
+		default:
+			return Reference{}, ErrNotFound
+		}
+	}
+	return r, nil
+}
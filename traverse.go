@@ -17,6 +17,13 @@ type Traverser struct {
 	typ         Type
 	byteWidth   int
 	parentWidth int
+	hasExt      bool
+	dict        *KeyDictionary
+}
+
+// SetKeyDictionary sets the dictionary to resolve map keys stored in it.
+func (t *Traverser) SetKeyDictionary(d *KeyDictionary) {
+	t.dict = d
 }
 
 func (t *Traverser) digMap(key string) error {
@@ -31,11 +38,31 @@ func (t *Traverser) digMap(key string) error {
 		return err
 	}
 	keysByteWidth := int(keysByteWidth64)
-	keysOffset, err := t.buf.Indirect(keysVectorInd, uint8(t.byteWidth))
-	if err != nil {
-		return err
+	keysBuf := t.buf
+	var keysOffset int
+	if keysByteWidth == 0 {
+		// keys are in the key dictionary
+		if t.dict == nil {
+			return ErrNoKeyDictionary
+		}
+		idx, err := t.buf.ReadUInt64(keysVectorInd, uint8(t.byteWidth))
+		if err != nil {
+			return err
+		}
+		keys, err := t.dict.KeyVector(int(idx))
+		if err != nil {
+			return err
+		}
+		keysBuf = keys.buf
+		keysOffset = keys.offset
+		keysByteWidth = int(keys.byteWidth)
+	} else {
+		keysOffset, err = t.buf.Indirect(keysVectorInd, uint8(t.byteWidth))
+		if err != nil {
+			return err
+		}
 	}
-	keysLen64, err := t.buf.ReadUInt64(keysOffset-keysByteWidth, uint8(keysByteWidth))
+	keysLen64, err := keysBuf.ReadUInt64(keysOffset-keysByteWidth, uint8(keysByteWidth))
 	if err != nil {
 		return err
 	}
@@ -43,13 +70,13 @@ func (t *Traverser) digMap(key string) error {
 
 	var searchErr error
 	foundIdx := sort.Search(keysLen, func(i int) bool {
-		ind, err := t.buf.Indirect(keysOffset+i*keysByteWidth, uint8(keysByteWidth))
+		ind, err := keysBuf.Indirect(keysOffset+i*keysByteWidth, uint8(keysByteWidth))
 		if err != nil {
 			searchErr = err
 			return true
 		}
 		for i, c := range keyBytes {
-			kc := t.buf[ind+i]
+			kc := keysBuf[ind+i]
 			if kc == 0 {
 				return false // -1
 			} else if kc > c {
@@ -64,13 +91,13 @@ func (t *Traverser) digMap(key string) error {
 		return searchErr
 	}
 	if foundIdx < keysLen { // found
-		keyDataOffset, err := t.buf.Indirect(keysOffset+foundIdx*keysByteWidth, uint8(keysByteWidth))
+		keyDataOffset, err := keysBuf.Indirect(keysOffset+foundIdx*keysByteWidth, uint8(keysByteWidth))
 		if err != nil {
 			return err
 		}
 		exactEqual := true
 		for i, c := range keyBytes {
-			kc := t.buf[keyDataOffset+i]
+			kc := keysBuf[keyDataOffset+i]
 			if kc == 0 || kc != c {
 				exactEqual = false
 				break
@@ -79,12 +106,14 @@ func (t *Traverser) digMap(key string) error {
 		if exactEqual {
 			valuePackedType := t.buf[mapOffset+keysLen*t.byteWidth+foundIdx]
 			valueOffset := mapOffset + foundIdx*t.byteWidth
+			bw, typ, hasExt := UnpackType(valuePackedType)
 
 			// proceed
 			t.parentWidth = t.byteWidth
 			t.offset = valueOffset
-			t.typ = Type(valuePackedType >> 2)
-			t.byteWidth = 1 << (valuePackedType & 3)
+			t.typ = typ
+			t.byteWidth = int(bw.ByteWidth())
+			t.hasExt = hasExt
 		} else {
 			t.offset = -1
 			t.typ = FBTNull
@@ -118,6 +147,8 @@ func (t *Traverser) Current() (Reference, error) {
 		parentWidth: uint8(t.parentWidth),
 		byteWidth:   uint8(t.byteWidth),
 		type_:       t.typ,
+		hasExt:      t.hasExt,
+		dict:        t.dict,
 	}
 	return r, r.CheckBoundary()
 }
@@ -0,0 +1,547 @@
+package flexbuffers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrLimitExceeded is returned by ValidateWithOptions when the buffer exceeds a limit of ValidateOptions.
+var ErrLimitExceeded = errors.New("validation limit exceeded")
+
+// ValidationError describes the element which broke an invariant of the format. It wraps the cause, so that
+// errors.Is works with ErrOutOfRange, ErrInvalidData, ErrRecursiveData and ErrNoKeyDictionary.
+type ValidationError struct {
+	// Path is the JSON path of the element, like $.user.tags[0].
+	Path string
+	// Offset is the offset of the element, the slot of the parent referring it. It's the trailer for the root.
+	Offset int
+	// Expected is the type required by the parent, like keys of maps. It's the same as Actual if the parent accepts
+	// any type.
+	Expected Type
+	Actual   Type
+	// Invariant is the violated rule.
+	Invariant string
+	Err       error
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Path)
+	fmt.Fprintf(&sb, " (offset %#x, ", e.Offset)
+	if e.Expected != e.Actual {
+		fmt.Fprintf(&sb, "expected %s, got %s", e.Expected, e.Actual)
+	} else {
+		sb.WriteString(e.Actual.String())
+	}
+	sb.WriteString("): ")
+	sb.WriteString(e.Invariant)
+	if e.Err != nil {
+		sb.WriteString(": ")
+		sb.WriteString(e.Err.Error())
+	}
+	return sb.String()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateOptions hardens validation of untrusted buffers. Zero limits are unlimited.
+type ValidateOptions struct {
+	// MaxDepth limits nesting of maps and vectors, the root is at depth 1.
+	MaxDepth int
+	// MaxElements limits the number of values, including map keys.
+	MaxElements int
+	// MaxBytesVisited limits the total size of visited slots, prefixes, bodies and type tables.
+	// Shared values are counted once.
+	MaxBytesVisited int
+	// StrictAlignment requires values to be aligned to their byte width, as the builder writes them.
+	StrictAlignment bool
+	// RequireSortedKeys requires keys of each map to be sorted and unique, Map.Get depends on it.
+	RequireSortedKeys bool
+	// RequireUniqueKeys requires keys of each map to be unique, see DuplicateKeyPolicy. Keys of sorted maps
+	// are compared with the previous one, RequireSortedKeys finds other maps.
+	RequireUniqueKeys bool
+	// RequireUTF8 requires keys and strings to be valid UTF-8.
+	RequireUTF8 bool
+}
+
+type pathElem struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// validateFrame is a map or vector whose elements are being validated.
+type validateFrame struct {
+	vec      AnyVector
+	m        Map
+	keys     TypedVector
+	isMap    bool
+	dictKeys bool
+	// keys of shared key vectors are validated once
+	sharedKeys bool
+	// untyped vectors are checked for elements pointing the vector itself
+	untyped   bool
+	offset    int
+	byteWidth uint8
+	size      int
+	next      int
+	depth     int
+	pathLen   int
+	prevKey   string
+}
+
+// validator validates without recursion, using a stack of frames.
+type validator struct {
+	opts ValidateOptions
+	// visited has the targets of values validated already, shared values are validated once
+	visited map[target]struct{}
+	// active has the offsets of maps and vectors on the path, an element pointing one of them is cyclic
+	active     map[int]struct{}
+	keyVectors map[int]struct{}
+	stack      []validateFrame
+	path       []pathElem
+	// all collects errors instead of stopping at the first one
+	all      bool
+	errs     []*ValidationError
+	elements int
+	bytes    int
+}
+
+// target is a value stored out of line. A target read as another type or width is validated again.
+type target struct {
+	offset    int
+	type_     Type
+	byteWidth uint8
+}
+
+func newValidator(opts ValidateOptions, all bool) *validator {
+	return &validator{
+		opts:       opts,
+		visited:    make(map[target]struct{}),
+		active:     make(map[int]struct{}),
+		keyVectors: make(map[int]struct{}),
+		all:        all,
+	}
+}
+
+// jsonPath formats path elements, keys which are not identifiers are quoted.
+func jsonPath(path []pathElem) string {
+	var sb strings.Builder
+	sb.WriteByte('$')
+	for _, p := range path {
+		switch {
+		case !p.isKey:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(p.index))
+			sb.WriteByte(']')
+		case isIdentifier(p.key):
+			sb.WriteByte('.')
+			sb.WriteString(p.key)
+		default:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Quote(p.key))
+			sb.WriteByte(']')
+		}
+	}
+	return sb.String()
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || c == '$' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// fail records the error. It returns the error to stop validation, or nil to continue with the next element
+// if all errors are collected. Exceeded limits always stop validation.
+func (v *validator) fail(r Reference, expected Type, invariant string, err error) error {
+	e := &ValidationError{
+		Path:      jsonPath(v.path),
+		Offset:    r.offset,
+		Expected:  expected,
+		Actual:    r.type_,
+		Invariant: invariant,
+		Err:       err,
+	}
+	if v.all {
+		v.errs = append(v.errs, e)
+		if err != ErrLimitExceeded {
+			return nil
+		}
+	}
+	return e
+}
+
+// Validate checks the whole document is readable, and returns *ValidationError for the first invalid element.
+func (r Reference) Validate() error {
+	return newValidator(ValidateOptions{}, false).run(r)
+}
+
+// ValidateWithOptions is the same as Validate, but applies limits and stricter checks of opts.
+// Use it for buffers from untrusted sources.
+func (r Reference) ValidateWithOptions(opts ValidateOptions) error {
+	return newValidator(opts, false).run(r)
+}
+
+// ValidateAll is the same as Validate, but returns all invalid elements. Children of an invalid element are not
+// checked.
+func (r Reference) ValidateAll() []*ValidationError {
+	v := newValidator(ValidateOptions{}, true)
+	_ = v.run(r)
+	return v.errs
+}
+
+func (v *validator) run(root Reference) error {
+	// slots of other elements are counted with their parents
+	if err := v.visit(root, root.type_, int(root.parentWidth)+2); err != nil {
+		return err
+	}
+	if err := v.enter(root, root.type_, 1); err != nil {
+		return err
+	}
+	for len(v.stack) > 0 {
+		f := &v.stack[len(v.stack)-1]
+		if f.next >= f.size {
+			delete(v.active, f.offset)
+			v.stack = v.stack[:len(v.stack)-1]
+			continue
+		}
+		i := f.next
+		f.next++
+		v.path = append(v.path[:f.pathLen], pathElem{index: i})
+		var key, elem Reference
+		var err error
+		switch {
+		case f.isMap:
+			err = v.mapEntry(f, i, &key, &elem)
+		case f.untyped:
+			if err = f.vec.AtRef(i, &elem); err != nil {
+				elem.offset, elem.type_ = f.offset+i*int(f.byteWidth), FBTNull
+				err = v.fail(elem, FBTNull, "element and its type are in the buffer", err)
+			} else if ind, ierr := elem.indirect(); !IsInline(elem.type_) && ierr == nil && ind == f.offset {
+				err = v.fail(elem, elem.type_, "element doesn't point its vector", ErrRecursiveData)
+			} else {
+				err = v.enter(elem, elem.type_, f.depth+1)
+			}
+		default:
+			if err = f.vec.AtRef(i, &elem); err != nil {
+				err = v.fail(elem, elem.type_, "elements are in the buffer", err)
+			} else {
+				err = v.enter(elem, elem.type_, f.depth+1)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *validator) mapEntry(f *validateFrame, i int, key, value *Reference) error {
+	if err := f.keys.AtRef(i, key); err != nil {
+		return v.fail(*key, FBTKey, "keys vector has as many elements as the map", err)
+	}
+	if !f.dictKeys && !f.sharedKeys {
+		n := len(v.errs)
+		if err := v.enter(*key, FBTKey, f.depth+1); err != nil {
+			return err
+		}
+		if len(v.errs) > n {
+			// the key is invalid, the value is named by the index
+			return nil
+		}
+	}
+	k := key.AsKey().StringValue()
+	if v.opts.RequireSortedKeys && !f.dictKeys && i > 0 && k <= f.prevKey {
+		return v.fail(*key, FBTKey, "keys are sorted and unique", ErrInvalidData)
+	}
+	if v.opts.RequireUniqueKeys && i > 0 && k == f.prevKey {
+		return v.fail(*key, FBTKey, "keys are unique", ErrDuplicateKey)
+	}
+	f.prevKey = k
+	v.path[len(v.path)-1] = pathElem{key: k, isKey: true}
+	if err := f.m.AtRef(i, value); err != nil {
+		value.offset, value.type_ = f.offset+i*int(f.byteWidth), FBTNull
+		return v.fail(*value, FBTNull, "value and its type are in the buffer", err)
+	}
+	return v.enter(*value, value.type_, f.depth+1)
+}
+
+// visit counts the element and its bytes against the limits.
+func (v *validator) visit(r Reference, expected Type, bytes int) error {
+	v.bytes += bytes
+	if v.opts.MaxBytesVisited > 0 && v.bytes > v.opts.MaxBytesVisited {
+		return v.fail(r, expected, "visited bytes are within the limit", ErrLimitExceeded)
+	}
+	return nil
+}
+
+// aligned checks the object at offset is aligned to its byte width, if StrictAlignment.
+func (v *validator) aligned(r Reference, expected Type, offset int, byteWidth uint8) error {
+	if v.opts.StrictAlignment && byteWidth > 0 && offset%int(byteWidth) != 0 {
+		return v.fail(r, expected, "value is aligned to its byte width", ErrInvalidData)
+	}
+	return nil
+}
+
+// fits checks the body of n elements of byteWidth, and trailing bytes after the body, are in the buffer.
+func (v *validator) fits(r Reference, expected Type, offset, n int, byteWidth uint8, trailing int) error {
+	end := offset + n*int(byteWidth) + trailing
+	if n < 0 || n > len(r.data_) || end > len(r.data_) {
+		return v.fail(r, expected, "size fits in the buffer", ErrOutOfRange)
+	}
+	return nil
+}
+
+func (v *validator) utf8(r Reference, expected Type, s string) error {
+	if v.opts.RequireUTF8 && !utf8.ValidString(s) {
+		return v.fail(r, expected, "text is valid UTF-8", ErrInvalidData)
+	}
+	return nil
+}
+
+// enter validates the element, and pushes a frame to validate its elements if it's a map or vector.
+// Errors of the element are returned by fail, so nil is returned to continue if all errors are collected.
+func (v *validator) enter(r Reference, expected Type, depth int) error {
+	if !IsInline(r.type_) {
+		if ind, err := r.indirect(); err == nil {
+			if _, ok := v.active[ind]; ok {
+				return v.fail(r, expected, "offsets are not cyclic", ErrRecursiveData)
+			}
+			t := target{offset: ind, type_: r.type_, byteWidth: r.byteWidth}
+			if _, ok := v.visited[t]; ok {
+				// shared value, validated and counted already
+				return nil
+			}
+			v.visited[t] = struct{}{}
+		}
+	}
+	v.elements++
+	if v.opts.MaxElements > 0 && v.elements > v.opts.MaxElements {
+		return v.fail(r, expected, "number of elements is within the limit", ErrLimitExceeded)
+	}
+
+	switch r.type_ {
+	case FBTNull:
+	case FBTBool:
+		if _, err := r.Bool(); err != nil {
+			return v.fail(r, expected, "scalar is in the buffer", err)
+		}
+	case FBTInt, FBTUint, FBTFloat:
+		if _, err := r.data_.ReadUInt64(r.offset, r.parentWidth); err != nil {
+			return v.fail(r, expected, "scalar is in the buffer", err)
+		}
+		if r.type_ == FBTFloat {
+			if _, err := r.Float64(); err != nil {
+				return v.fail(r, expected, "scalar is in the buffer", err)
+			}
+		}
+	case FBTIndirectInt, FBTIndirectUInt, FBTIndirectFloat:
+		ind, err := r.indirect()
+		if err == nil {
+			_, err = r.data_.ReadUInt64(ind, r.byteWidth)
+		}
+		if err == nil && r.type_ == FBTIndirectFloat {
+			_, err = r.Float64()
+		}
+		if err != nil {
+			return v.fail(r, expected, "scalar is in the buffer", err)
+		}
+		if err := v.aligned(r, expected, ind, r.byteWidth); err != nil {
+			return err
+		}
+		return v.visit(r, expected, int(r.byteWidth))
+	case FBTKey:
+		k, err := r.Key()
+		if err != nil {
+			return v.fail(r, expected, "key is in the buffer", err)
+		}
+		s, err := unsafeReadCString(r.data_, k.offset)
+		if err != nil {
+			return v.fail(r, expected, "key is in the buffer", err)
+		}
+		if strings.IndexByte(s, 0) >= 0 {
+			return v.fail(r, expected, "key contains no null char", ErrInvalidData)
+		}
+		if err := v.utf8(r, expected, s); err != nil {
+			return err
+		}
+		return v.visit(r, expected, len(s)+1)
+	case FBTString, FBTBlob:
+		var data []byte
+		var ind int
+		var sized Sized
+		if r.type_ == FBTString {
+			str, err := r.StringRef()
+			if err == nil {
+				var s string
+				s, err = str.StringValue()
+				data = []byte(s)
+			}
+			if err != nil {
+				return v.fail(r, expected, "string is in the buffer", err)
+			}
+			sized = str.Sized
+		} else {
+			b, err := r.Blob()
+			if err == nil {
+				data, err = b.Data()
+			}
+			if err != nil {
+				return v.fail(r, expected, "blob is in the buffer", err)
+			}
+			sized = b.Sized
+		}
+		ind = sized.offset
+		if err := v.aligned(r, expected, ind, r.byteWidth); err != nil {
+			return err
+		}
+		if r.type_ == FBTString {
+			if end := ind + len(data); end >= len(r.data_) || r.data_[end] != 0 {
+				return v.fail(r, expected, "string is null terminated", ErrInvalidData)
+			}
+			if err := v.utf8(r, expected, string(data)); err != nil {
+				return err
+			}
+		}
+		return v.visit(r, expected, int(r.byteWidth)+len(data))
+	case FBTMap:
+		return v.enterMap(r, expected, depth)
+	default:
+		return v.enterVector(r, expected, depth)
+	}
+	return nil
+}
+
+func (v *validator) push(r Reference, expected Type, f validateFrame) error {
+	if v.opts.MaxDepth > 0 && f.depth > v.opts.MaxDepth {
+		return v.fail(r, expected, "nesting is within the limit", ErrLimitExceeded)
+	}
+	f.pathLen = len(v.path)
+	v.active[f.offset] = struct{}{}
+	v.stack = append(v.stack, f)
+	return nil
+}
+
+func (v *validator) enterMap(r Reference, expected Type, depth int) error {
+	n := len(v.errs)
+	m, err := r.Map()
+	if err != nil {
+		return v.fail(r, expected, "map is in the buffer", err)
+	}
+	keys, err := m.Keys()
+	if err != nil {
+		return v.fail(r, expected, "keys vector is readable", err)
+	}
+	sz, err := m.Size()
+	if err != nil {
+		return v.fail(r, expected, "size is in the buffer", err)
+	}
+	if err := v.fits(r, expected, m.offset, sz, m.byteWidth, sz); err != nil {
+		return err
+	}
+	if err := v.aligned(r, expected, m.offset, m.byteWidth); err != nil {
+		return err
+	}
+	bytes := 3*int(m.byteWidth) + sz*int(m.byteWidth) + sz
+	// keys in the key dictionary are validated when it's loaded
+	dictKeys := m.hasDictionaryKeys()
+	var sharedKeys bool
+	if !dictKeys {
+		ksz, err := keys.Size()
+		if err != nil {
+			return v.fail(r, expected, "keys vector size is in the buffer", err)
+		}
+		if ksz != sz {
+			return v.fail(r, expected, "keys vector has the same size as the map", ErrInvalidData)
+		}
+		if err := v.fits(r, expected, keys.offset, sz, keys.byteWidth, 0); err != nil {
+			return err
+		}
+		if err := v.aligned(r, expected, keys.offset, keys.byteWidth); err != nil {
+			return err
+		}
+		if _, sharedKeys = v.keyVectors[keys.offset]; !sharedKeys {
+			v.keyVectors[keys.offset] = struct{}{}
+			bytes += int(keys.byteWidth) + sz*int(keys.byteWidth)
+		}
+	}
+	if m.Ordered() {
+		if err := v.mapOrder(r, expected, m, sz); err != nil {
+			return err
+		}
+	}
+	if err := v.visit(r, expected, bytes); err != nil {
+		return err
+	}
+	if len(v.errs) > n {
+		// children of the invalid map are not checked
+		return nil
+	}
+	return v.push(r, expected, validateFrame{m: m, keys: keys, isMap: true, dictKeys: dictKeys, sharedKeys: sharedKeys, offset: m.offset, byteWidth: m.byteWidth, size: sz, depth: depth})
+}
+
+// mapOrder checks the insertion order of an ordered map has every index of sz entries once.
+func (v *validator) mapOrder(r Reference, expected Type, m Map, sz int) error {
+	order, err := m.AppendOrder(make([]int, 0, sz))
+	if err != nil {
+		return v.fail(r, expected, "insertion order is readable", err)
+	}
+	seen := make([]bool, sz)
+	for _, idx := range order {
+		if seen[idx] {
+			return v.fail(r, expected, "insertion order has each entry once", ErrInvalidData)
+		}
+		seen[idx] = true
+	}
+	return nil
+}
+
+func (v *validator) enterVector(r Reference, expected Type, depth int) error {
+	n := len(v.errs)
+	if r.type_ != FBTVector && !r.IsTypedVector() && !r.IsFixedTypedVector() {
+		return v.fail(r, expected, "type is valid", ErrInvalidData)
+	}
+	vec, err := r.AnyVector()
+	if err != nil {
+		return v.fail(r, expected, "vector is in the buffer", err)
+	}
+	sz, err := vec.Size()
+	if err != nil {
+		return v.fail(r, expected, "size is in the buffer", err)
+	}
+	ind, _ := r.indirect()
+	untyped := r.type_ == FBTVector
+	table := 0
+	if untyped {
+		table = sz
+	}
+	if err := v.fits(r, expected, ind, sz, r.byteWidth, table); err != nil {
+		return err
+	}
+	if err := v.aligned(r, expected, ind, r.byteWidth); err != nil {
+		return err
+	}
+	bytes := sz*int(r.byteWidth) + table
+	if !r.IsFixedTypedVector() {
+		bytes += int(r.byteWidth)
+	}
+	if err := v.visit(r, expected, bytes); err != nil {
+		return err
+	}
+	if len(v.errs) > n {
+		return nil
+	}
+	return v.push(r, expected, validateFrame{vec: vec, untyped: untyped, offset: ind, byteWidth: r.byteWidth, size: sz, depth: depth})
+}
@@ -0,0 +1,273 @@
+package flexbuffers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildForValidation(t *testing.T) Raw {
+	b := NewBuilder()
+	b.Map(func(b *Builder) {
+		b.IntField([]byte("id"), 1)
+		b.VectorField([]byte("tags"), false, false, func(b *Builder) {
+			b.StringValue("a")
+			b.StringValue("b")
+		})
+		b.MapField([]byte("user name"), func(b *Builder) {
+			b.StringValueField([]byte("x"), "y")
+		})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Buffer()
+}
+
+// breakString makes the size of the string out of range.
+func breakString(t *testing.T, buf Raw, s Reference) {
+	ind, err := s.indirect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[ind-int(s.byteWidth)] = 0xff
+}
+
+func TestValidate_Errors(t *testing.T) {
+	a := assert.New(t)
+	buf := buildForValidation(t)
+	a.NoError(buf.Validate())
+	a.Empty(buf.ValidateAll())
+
+	broken := append(Raw(nil), buf...)
+	root := broken.RootOrNull().AsMap()
+	tag := root.GetOrNull("tags").AsVector().AtOrNull(1)
+	breakString(t, broken, tag)
+	breakString(t, broken, root.GetOrNull("user name").AsMap().GetOrNull("x"))
+
+	err := broken.Validate()
+	a.True(errors.Is(err, ErrOutOfRange), "%v", err)
+	var verr *ValidationError
+	if a.True(errors.As(err, &verr)) {
+		a.Equal("$.tags[1]", verr.Path)
+		a.Equal(FBTString, verr.Actual)
+		a.Equal(FBTString, verr.Expected)
+		a.Equal(tag.offset, verr.Offset)
+		a.Equal("string is in the buffer", verr.Invariant)
+		a.Contains(verr.Error(), "$.tags[1] (offset ")
+	}
+
+	all := broken.ValidateAll()
+	if a.Len(all, 2) {
+		a.Equal("$.tags[1]", all[0].Path)
+		a.Equal(`$["user name"].x`, all[1].Path)
+	}
+
+	// the root is out of the buffer
+	err = Raw{0, 0x24, 8}.Validate()
+	a.True(errors.As(err, &verr))
+	a.Equal("$", verr.Path)
+	a.True(errors.Is(err, ErrOutOfRange))
+
+	// invalid type
+	err = Raw{0, PackedType(BitWidth8, 30, false), 1}.Validate()
+	a.True(errors.Is(err, ErrInvalidData), "%v", err)
+
+	// invalid root width
+	err = Raw{0, 0, NullPackedType, 3}.Validate()
+	a.True(errors.Is(err, ErrInvalidData), "%v", err)
+
+	// elements of a vector larger than the buffer are not collected
+	all = Raw("\x03\x00\x00\x01\x01\x00\x00\x00\x00\x01\x00\x00\n\x00+\x00\f.\x01").ValidateAll()
+	if a.Len(all, 1) {
+		a.Equal("size fits in the buffer", all[0].Invariant)
+	}
+
+	// the keys vector is shorter than the map
+	broken = append(Raw(nil), buf...)
+	keys, _ := broken.RootOrNull().AsMap().Keys()
+	broken[keys.offset-int(keys.byteWidth)]--
+	err = broken.Validate()
+	if a.True(errors.As(err, &verr)) {
+		a.Equal("$", verr.Path)
+		a.Equal("keys vector has the same size as the map", verr.Invariant)
+	}
+
+	// the size of the keys vector is out of the buffer
+	broken = append(Raw(nil), buf...)
+	m := broken.RootOrNull().AsMap()
+	keysOffset := m.offset - 3*int(m.byteWidth)
+	broken[keysOffset] = byte(keysOffset)
+	err = broken.Validate()
+	a.True(errors.Is(err, ErrOutOfRange), "%v", err)
+	if a.True(errors.As(err, &verr)) {
+		a.Equal("$", verr.Path)
+		a.Equal("keys vector size is in the buffer", verr.Invariant)
+	}
+
+	// the vector is out of the buffer
+	err = Raw{5, PackedType(BitWidth8, FBTVector, false), 1}.Validate()
+	a.True(errors.Is(err, ErrOutOfRange), "%v", err)
+	if a.True(errors.As(err, &verr)) {
+		a.Equal("vector is in the buffer", verr.Invariant)
+	}
+
+	// the string is not null terminated
+	broken = append(Raw(nil), buf...)
+	x := broken.RootOrNull().AsMap().GetOrNull("user name").AsMap().GetOrNull("x").AsStringRef()
+	broken[x.offset+1] = 'z'
+	err = broken.Validate()
+	if a.True(errors.As(err, &verr)) {
+		a.Equal(`$["user name"].x`, verr.Path)
+		a.Equal("string is null terminated", verr.Invariant)
+	}
+}
+
+func TestValidateWithOptions(t *testing.T) {
+	a := assert.New(t)
+	strict := ValidateOptions{StrictAlignment: true, RequireSortedKeys: true, RequireUTF8: true}
+	buf := buildForValidation(t)
+	a.NoError(buf.ValidateWithOptions(strict))
+
+	// keys vectors shared by maps are not cyclic
+	b := NewBuilderWithFlags(BuilderFlagShareKeyVectors)
+	b.Vector(false, false, func(b *Builder) {
+		for i := 0; i < 3; i++ {
+			b.Map(func(b *Builder) {
+				b.IntField([]byte("a"), 1)
+				b.IntField([]byte("b"), 2)
+			})
+		}
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	a.NoError(b.Buffer().Validate())
+	a.NoError(b.Buffer().ValidateWithOptions(strict))
+
+	// values shared by several parents are not cyclic, and are counted once
+	b = NewBuilder()
+	b.Map(func(b *Builder) {
+		b.Key([]byte("a"))
+		b.Map(func(b *Builder) {
+			b.VectorField([]byte("k"), false, false, func(b *Builder) {
+				b.Int(1)
+				b.StringValue("x")
+			})
+		})
+		shared, err := b.LastValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Key([]byte("b"))
+		b.PushValue(shared)
+		b.VectorField([]byte("c"), false, false, func(b *Builder) {
+			b.PushValue(shared)
+			b.PushValue(shared)
+		})
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	dag := b.Buffer()
+	a.NoError(dag.Validate())
+	a.NoError(dag.ValidateWithOptions(strict))
+	a.Empty(dag.ValidateAll())
+	// root, 3 keys, the values a and c, and the shared map with its key, value and 2 elements once
+	a.NoError(dag.ValidateWithOptions(ValidateOptions{MaxElements: 10}))
+	a.True(errors.Is(dag.ValidateWithOptions(ValidateOptions{MaxElements: 9}), ErrLimitExceeded))
+
+	// the element of the vector points the vector itself
+	err := Raw{1, 0, 0x28, 2, 0x28, 1}.Validate()
+	a.True(errors.Is(err, ErrRecursiveData), "%v", err)
+
+	// unsorted keys
+	unsorted := append(Raw(nil), buf...)
+	keys, _ := unsorted.RootOrNull().AsMap().Keys()
+	a.Equal(uint8(1), keys.byteWidth)
+	// swap targets of the first and second keys
+	first, second := unsorted[keys.offset], unsorted[keys.offset+1]
+	unsorted[keys.offset], unsorted[keys.offset+1] = second-1, first+1
+	a.NoError(unsorted.Validate())
+	err = unsorted.ValidateWithOptions(strict)
+	var verr *ValidationError
+	if a.True(errors.As(err, &verr), "%v", err) {
+		a.Equal("keys are sorted and unique", verr.Invariant)
+		a.Equal("$[1]", verr.Path)
+	}
+
+	// duplicate keys are sorted, but not unique
+	b = NewBuilder()
+	b.Map(func(b *Builder) {
+		b.IntField([]byte("a"), 1)
+		b.IntField([]byte("a"), 2)
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	a.NoError(b.Buffer().Validate())
+	err = b.Buffer().ValidateWithOptions(ValidateOptions{RequireUniqueKeys: true})
+	a.True(errors.Is(err, ErrDuplicateKey))
+	if a.True(errors.As(err, &verr)) {
+		a.Equal("$[1]", verr.Path)
+		a.Equal("keys are unique", verr.Invariant)
+	}
+
+	// invalid UTF-8
+	b = NewBuilder()
+	b.Vector(false, false, func(b *Builder) {
+		b.StringValue("ok")
+		b.StringValue("\xff")
+	})
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	a.NoError(b.Buffer().Validate())
+	err = b.Buffer().ValidateWithOptions(strict)
+	a.True(errors.Is(err, ErrInvalidData))
+	if a.True(errors.As(err, &verr)) {
+		a.Equal("$[1]", verr.Path)
+	}
+
+	// indirect int16 at an odd offset
+	misaligned := Raw{0, 0x34, 0x12, 2, PackedType(BitWidth16, FBTIndirectInt, false), 1}
+	a.Equal(int64(0x1234), misaligned.RootOrNull().AsInt64())
+	a.NoError(misaligned.Validate())
+	a.True(errors.Is(misaligned.ValidateWithOptions(strict), ErrInvalidData))
+}
+
+func TestValidateWithOptions_Limits(t *testing.T) {
+	a := assert.New(t)
+	const depth = 10000
+	b := NewBuilder()
+	starts := make([]int, depth)
+	for i := range starts {
+		starts[i] = b.StartVector()
+	}
+	b.Int(1)
+	for i := depth - 1; i >= 0; i-- {
+		if _, err := b.EndVector(starts[i], false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	deep := b.Buffer()
+	a.NoError(deep.Validate())
+	a.NoError(deep.ValidateWithOptions(ValidateOptions{MaxDepth: depth}))
+	err := deep.ValidateWithOptions(ValidateOptions{MaxDepth: depth - 1})
+	a.True(errors.Is(err, ErrLimitExceeded), "%v", err)
+
+	buf := buildForValidation(t)
+	// root, 3 keys and values, 2 tags, 1 key and value of user
+	a.NoError(buf.ValidateWithOptions(ValidateOptions{MaxElements: 11}))
+	a.True(errors.Is(buf.ValidateWithOptions(ValidateOptions{MaxElements: 10}), ErrLimitExceeded))
+	a.NoError(buf.ValidateWithOptions(ValidateOptions{MaxBytesVisited: len(buf)}))
+	a.True(errors.Is(buf.ValidateWithOptions(ValidateOptions{MaxBytesVisited: len(buf) / 2}), ErrLimitExceeded))
+
+	// declared size much larger than the buffer
+	huge := Raw{0xff, 0xff, 0xff, 0x7f, 4, PackedType(BitWidth32, FBTVectorInt, false), 1}
+	a.True(errors.Is(huge.ValidateWithOptions(ValidateOptions{}), ErrOutOfRange))
+}
@@ -9,6 +9,8 @@ type value struct {
 	typ         Type
 	minBitWidth BitWidth
 	hasExt      bool
+	// indirect scalars are written before the vector or map they are added to, see Builder.SetIndirectScalars
+	indirect bool
 }
 
 func newValueBool(b bool) value {